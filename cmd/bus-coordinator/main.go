@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/inconshreveable/log15"
+
+	"github.com/grafana/devtools/pkg/log15adapter"
+	"github.com/grafana/devtools/pkg/streams/log"
+	"github.com/grafana/devtools/pkg/streams/netbus"
+)
+
+func main() {
+	var (
+		port           string
+		verboseLogging bool
+		retention      time.Duration
+	)
+
+	flag.StringVar(&port, "port", "8090", "port to serve the bus from")
+	flag.BoolVar(&verboseLogging, "verbose", false, "enable verbose logging")
+	flag.DurationVar(&retention, "retention", netbus.DefaultRetention, "how long a complete publication is kept once no subscriber is receiving it, 0 keeps publications until the coordinator is stopped")
+	flag.Parse()
+
+	logger := log.New()
+
+	logLevel := log15.LvlInfo
+	if verboseLogging {
+		logLevel = log15.LvlDebug
+	}
+
+	log15Logger := log15.New()
+	log15Logger.SetHandler(log15.LvlFilterHandler(
+		logLevel, log15.StreamHandler(os.Stdout, log15adapter.GetConsoleFormat())))
+	logger.AddHandler(log15adapter.New(log15Logger))
+
+	server := netbus.NewServer()
+	server.SetLogger(logger)
+	server.SetRetention(retention)
+
+	logger.Info("serving bus", "port", port)
+	if err := http.ListenAndServe(":"+port, server); err != nil {
+		logger.Fatal("failed to serve bus", "error", err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/grafana/devtools/pkg/streams/diskbus"
+)
+
+func main() {
+	var (
+		dataDir string
+		topic   string
+	)
+
+	flag.StringVar(&dataDir, "dir", "", "data directory of the disk bus")
+	flag.StringVar(&topic, "topic", "", "print the stored messages of this topic, one per line, instead of listing topics")
+	flag.Parse()
+
+	if dataDir == "" {
+		fmt.Fprintln(os.Stderr, "missing -dir")
+		os.Exit(2)
+	}
+
+	bus, err := diskbus.New(dataDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to open disk bus:", err)
+		os.Exit(1)
+	}
+	defer bus.Close()
+
+	if topic != "" {
+		messages, errors := bus.ReadAll(topic)
+		for msg := range messages {
+			fmt.Println(string(msg.([]byte)))
+		}
+
+		if err := <-errors; err != nil {
+			fmt.Fprintln(os.Stderr, "failed to read topic:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	topics, err := bus.Topics()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to list topics:", err)
+		os.Exit(1)
+	}
+
+	for _, name := range topics {
+		info, err := bus.Describe(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to describe topic:", name, err)
+			continue
+		}
+
+		fmt.Printf("%s\tsegments=%d\tcommitted=%d\n", info.Name, info.Segments, info.CommittedOffset)
+
+		consumers := []string{}
+		for id := range info.ConsumerOffsets {
+			consumers = append(consumers, id)
+		}
+		sort.Strings(consumers)
+
+		for _, id := range consumers {
+			fmt.Printf("\tconsumer %s\toffset=%d\n", id, info.ConsumerOffsets[id])
+		}
+	}
+}
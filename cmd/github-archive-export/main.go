@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/grafana/devtools/pkg/archive"
+	"github.com/grafana/devtools/pkg/log15adapter"
+	"github.com/grafana/devtools/pkg/streams/log"
+	"github.com/inconshreveable/log15"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const simpleDateFormat = "2006-01-02"
+
+func main() {
+	var (
+		database         string
+		connectionString string
+		dir              string
+		startDateFlag    string
+		stopDateFlag     string
+		verboseLogging   bool
+	)
+
+	flag.StringVar(&database, "database", "", "database type")
+	flag.StringVar(&connectionString, "connstring", "", "")
+	flag.StringVar(&dir, "dir", "", "directory to write the hourly archive files to")
+	flag.StringVar(&startDateFlag, "startDate", "", "export the hours from this date, from the oldest stored event if empty")
+	flag.StringVar(&stopDateFlag, "stopDate", "", "export the hours before this date, until now if empty")
+	flag.BoolVar(&verboseLogging, "verbose", false, "enable verbose logging")
+	flag.Parse()
+
+	logger := newLogger(verboseLogging)
+
+	if dir == "" {
+		logger.Fatal("missing -dir")
+	}
+
+	startDate, err := parseDate(startDateFlag)
+	if err != nil {
+		logger.Fatal("could not parse start date", "error", err)
+	}
+	stopDate, err := parseDate(stopDateFlag)
+	if err != nil {
+		logger.Fatal("could not parse stop date", "error", err)
+	}
+
+	engine, err := archive.InitDatabase(database, connectionString)
+	if err != nil {
+		logger.Fatal("migration failed", "error", err)
+	}
+
+	exporter := archive.NewArchiveExporter(logger, engine)
+	if _, _, err := exporter.Export(context.Background(), dir, startDate, stopDate); err != nil {
+		logger.Fatal("export failed", "error", err)
+	}
+}
+
+func newLogger(verbose bool) log.Logger {
+	logLevel := log15.LvlInfo
+	if verbose {
+		logLevel = log15.LvlDebug
+	}
+
+	log15Logger := log15.New()
+	log15Logger.SetHandler(log15.LvlFilterHandler(
+		logLevel, log15.StreamHandler(os.Stdout, log15adapter.GetConsoleFormat())))
+
+	logger := log.New()
+	logger.AddHandler(log15adapter.New(log15Logger))
+	return logger
+}
+
+// parseDate parses dates like 2019-01-01, returning the zero time for empty
+// dates
+func parseDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(simpleDateFormat, date)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"runtime"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/grafana/devtools/pkg/archive"
+	"github.com/grafana/devtools/pkg/log15adapter"
+	"github.com/grafana/devtools/pkg/streams/log"
+	"github.com/inconshreveable/log15"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const simpleDateFormat = "2006-01-02"
+
+func main() {
+	var (
+		database         string
+		connectionString string
+		dir              string
+		startDateFlag    string
+		stopDateFlag     string
+		eventStorage     string
+		eventCodec       string
+		numWorkers       int
+		verboseLogging   bool
+	)
+
+	flag.StringVar(&database, "database", "", "database type")
+	flag.StringVar(&connectionString, "connstring", "", "")
+	flag.StringVar(&dir, "dir", "", "directory with hourly archive files, e.g. written by github-archive-export")
+	flag.StringVar(&startDateFlag, "startDate", "", "import the hours from this date, all files if empty")
+	flag.StringVar(&stopDateFlag, "stopDate", "", "import the hours before this date, all files if empty")
+	flag.StringVar(&eventStorage, "eventStorage", string(archive.StorageJSON), "how events are stored: json, columns extracting type, repo, actor and action, or compressed")
+	flag.StringVar(&eventCodec, "eventCodec", "deflate", "codec compressing events stored as compressed, only deflate is built in")
+	flag.IntVar(&numWorkers, "numWorkers", runtime.NumCPU(), "number of workers to spawn")
+	flag.BoolVar(&verboseLogging, "verbose", false, "enable verbose logging")
+	flag.Parse()
+
+	logger := newLogger(verboseLogging)
+
+	if dir == "" {
+		logger.Fatal("missing -dir")
+	}
+
+	startDate, err := parseDate(startDateFlag)
+	if err != nil {
+		logger.Fatal("could not parse start date", "error", err)
+	}
+	stopDate, err := parseDate(stopDateFlag)
+	if err != nil {
+		logger.Fatal("could not parse stop date", "error", err)
+	}
+
+	files, err := archive.ExportedFiles(dir, startDate, stopDate)
+	if err != nil {
+		logger.Fatal("failed to list archive files", "dir", dir, "error", err)
+	}
+	logger.Info("importing archive files", "dir", dir, "files", len(files))
+
+	engine, err := archive.InitDatabase(database, connectionString)
+	if err != nil {
+		logger.Fatal("migration failed", "error", err)
+	}
+
+	source, err := archive.NewArchiveSource(dir)
+	if err != nil {
+		logger.Fatal("invalid archive directory", "error", err)
+	}
+
+	// the events were filtered when they were downloaded, so all of them are
+	// imported
+	ad := archive.NewArchiveDownloader(
+		engine, true, source, &archive.EventFilter{}, startDate, stopDate, numWorkers, false, logger,
+	)
+	ad.SetFiles(files)
+	if err := ad.SetStorage(archive.StorageFormat(eventStorage), eventCodec); err != nil {
+		logger.Fatal("invalid event storage", "error", err)
+	}
+
+	if err := ad.DownloadEvents(context.Background()); err != nil {
+		logger.Fatal("import failed", "error", err)
+	}
+}
+
+func newLogger(verbose bool) log.Logger {
+	logLevel := log15.LvlInfo
+	if verbose {
+		logLevel = log15.LvlDebug
+	}
+
+	log15Logger := log15.New()
+	log15Logger.SetHandler(log15.LvlFilterHandler(
+		logLevel, log15.StreamHandler(os.Stdout, log15adapter.GetConsoleFormat())))
+
+	logger := log.New()
+	logger.AddHandler(log15adapter.New(log15Logger))
+	return logger
+}
+
+// parseDate parses dates like 2019-01-01, returning the zero time for empty
+// dates
+func parseDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(simpleDateFormat, date)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"net/http"
 	"os"
 	"runtime"
 	"strings"
@@ -12,6 +13,8 @@ import (
 	"github.com/grafana/devtools/pkg/archive"
 	"github.com/grafana/devtools/pkg/log15adapter"
 	"github.com/grafana/devtools/pkg/streams/log"
+	"github.com/grafana/devtools/pkg/streams/metrics"
+	"github.com/grafana/devtools/pkg/streams/tracing"
 	_ "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
 	"github.com/inconshreveable/log15"
 	_ "github.com/lib/pq"
@@ -32,38 +35,105 @@ func main() {
 		startDateFlag    string
 		stopDateFlag     string
 		orgNamesFlag     string
-		orgNames         []string
+		filterConfig     string
+		filterFlags      = map[string]*string{}
 		maxDuration      time.Duration
 		overrideAllFiles bool
 		skipErrors       bool
+		retryFailed      bool
+		maxAttempts      int
+		initialBackoff   time.Duration
+		maxBackoff       time.Duration
+		cacheDir         string
+		cacheMaxGB       int64
+		eventStorage     string
+		eventCodec       string
+		partitionByMonth bool
 		numWorkers       int
+		logFormat        string
 		verboseLogging   bool
+		metricsAddr      string
+		statusAddr       string
+		progressInterval time.Duration
+		drainTimeout     time.Duration
+		metricsFile      string
+		traceFile        string
 	)
 
 	flag.StringVar(&database, "database", "", "database type")
 	flag.StringVar(&connectionString, "connstring", "", "")
-	flag.StringVar(&archiveUrl, "archiveUrl", "https://data.githubarchive.org/%d-%02d-%02d-%d.json.gz", "")
+	flag.StringVar(&archiveUrl, "archiveUrl", "https://data.githubarchive.org/%d-%02d-%02d-%d.json.gz", "url template of the archive files, or file:// url of a directory or tar bundle with archive files")
 	flag.StringVar(&startDateFlag, "startDateFlag", "2015-01-01", "")
 	flag.StringVar(&stopDateFlag, "stopDateFlag", "", "")
 	flag.StringVar(&orgNamesFlag, "orgNames", "grafana", "comma sepearted list of orgs to download all events for")
+	flag.StringVar(&filterConfig, "filterConfig", "", "json file with the event filter, flags setting filters are added to it")
+	for name, usage := range map[string]string{
+		"excludeOrgs":       "comma separated list of orgs to skip the events of",
+		"repos":             "comma separated list of repos, e.g. grafana/*-datasource, to download all events for in addition to those of orgNames",
+		"excludeRepos":      "comma separated list of repos to skip the events of",
+		"actors":            "comma separated list of actors to only download the events of",
+		"excludeActors":     "comma separated list of actors, e.g. *[bot], to skip the events of",
+		"eventTypes":        "comma separated list of event types to only download, e.g. PullRequestEvent",
+		"excludeEventTypes": "comma separated list of event types to skip, e.g. WatchEvent",
+	} {
+		filterFlags[name] = flag.String(name, "", usage)
+	}
 	flag.DurationVar(&maxDuration, "maxDuration", time.Minute*10, "")
 	flag.BoolVar(&overrideAllFiles, "overrideAllFiles", false, "overrides all files instead of just those missing")
 	flag.IntVar(&numWorkers, "numWorkers", runtime.NumCPU(), "number of workers to spawn")
 	flag.BoolVar(&verboseLogging, "verbose", false, "enable verbose logging")
+	flag.StringVar(&logFormat, "logFormat", "console", "log format, console or json")
 	flag.BoolVar(&skipErrors, "skipErrors", false, "mark archive as processed even if some events had parsing errors")
+	flag.BoolVar(&retryFailed, "retry-failed", false, "only download the hours that failed in earlier runs")
+	flag.IntVar(&maxAttempts, "maxAttempts", archive.DefaultMaxAttempts, "number of attempts to download a file before it is recorded as failed")
+	flag.DurationVar(&initialBackoff, "initialBackoff", archive.DefaultInitialBackoff, "wait before retrying a failed download, doubled for every attempt")
+	flag.DurationVar(&maxBackoff, "maxBackoff", archive.DefaultMaxBackoff, "maximum wait before retrying a failed download")
+	flag.StringVar(&cacheDir, "cacheDir", "", "keep downloaded archive files in this directory and read them from there on later runs")
+	flag.Int64Var(&cacheMaxGB, "cacheMaxGB", 100, "size limit of the cache directory in GB, the least recently used files are evicted")
+	flag.StringVar(&eventStorage, "eventStorage", string(archive.StorageJSON), "how events are stored: json, columns extracting type, repo, actor and action, or compressed")
+	flag.StringVar(&eventCodec, "eventCodec", "deflate", "codec compressing events stored as compressed, only deflate is built in")
+	flag.BoolVar(&partitionByMonth, "partitionByMonth", false, "partition the github_event table by month on postgres and mysql, moving stored events into the partitions")
+	flag.StringVar(&statusAddr, "statusAddr", "", "serve the progress of downloads as json on /status at this address, e.g. :9091")
+	flag.DurationVar(&progressInterval, "progressInterval", archive.DefaultProgressInterval, "how often the progress of downloads is logged, 0 disables")
+	flag.DurationVar(&drainTimeout, "drainTimeout", archive.DefaultDrainTimeout, "time files being downloaded when maxDuration is reached may take to finish")
+	flag.StringVar(&metricsAddr, "metricsAddr", "", "serve metrics in prometheus format on /metrics at this address, e.g. :9090")
+	flag.StringVar(&metricsFile, "metricsFile", "", "write metrics in prometheus format to this file when done, e.g. for the node exporter textfile collector")
+	flag.StringVar(&traceFile, "traceFile", "", "write tracing spans in OTLP JSON format to this file")
 	flag.Parse()
 
 	logger := log.New()
 
-	logLevel := log15.LvlInfo
-	if verboseLogging {
-		logLevel = log15.LvlDebug
+	if logFormat == "json" {
+		logLevel := log.LogLevelInfo
+		if verboseLogging {
+			logLevel = log.LogLevelDebug
+		}
+		logger.AddHandler(log.NewJSONHandler(os.Stdout, logLevel))
+	} else {
+		logLevel := log15.LvlInfo
+		if verboseLogging {
+			logLevel = log15.LvlDebug
+		}
+
+		log15Logger := log15.New()
+		log15Logger.SetHandler(log15.LvlFilterHandler(
+			logLevel, log15.StreamHandler(os.Stdout, log15adapter.GetConsoleFormat())))
+		logger.AddHandler(log15adapter.New(log15Logger))
 	}
 
-	log15Logger := log15.New()
-	log15Logger.SetHandler(log15.LvlFilterHandler(
-		logLevel, log15.StreamHandler(os.Stdout, log15adapter.GetConsoleFormat())))
-	logger.AddHandler(log15adapter.New(log15Logger))
+	if metricsAddr != "" {
+		go serveMetrics(logger, metricsAddr)
+	}
+
+	var tracer *tracing.Tracer
+	if traceFile != "" {
+		exporter, err := tracing.NewFileExporter(traceFile)
+		if err != nil {
+			logger.Fatal("failed to create trace file", "error", err)
+		}
+		tracer = tracing.New("github-archive-parser", exporter)
+		tracing.SetDefault(tracer)
+	}
 
 	startDate, err := time.Parse(simpleDateFormat, startDateFlag)
 	if err != nil {
@@ -80,23 +150,131 @@ func main() {
 		}
 	}
 
-	orgNames = strings.Split(orgNamesFlag, ",")
-	engine, err := archive.InitDatabase(database, connectionString)
+	filter, err := buildFilter(filterConfig, orgNamesFlag, filterFlags)
+	if err != nil {
+		logger.Fatal("invalid event filter", "error", err)
+	}
+
+	var dbOptions []archive.DatabaseOption
+	if partitionByMonth {
+		dbOptions = append(dbOptions, archive.PartitionByMonth())
+	}
+
+	engine, err := archive.InitDatabase(database, connectionString, dbOptions...)
 	if err != nil {
 		logger.Fatal("migration failed", "error", err)
 	}
 
+	source, err := archive.NewArchiveSource(archiveUrl)
+	if err != nil {
+		logger.Fatal("invalid archive url", "error", err)
+	}
+
 	ad := archive.NewArchiveDownloader(
-		engine, overrideAllFiles, archiveUrl, orgNames, startDate, stopDate, numWorkers, skipErrors, logger,
+		engine, overrideAllFiles, source, filter, startDate, stopDate, numWorkers, skipErrors, logger,
 	)
+	ad.SetRetry(maxAttempts, initialBackoff, maxBackoff)
+	ad.SetRetryFailed(retryFailed)
+	ad.SetProgressInterval(progressInterval)
+	ad.SetDrainTimeout(drainTimeout)
+	if err := ad.SetStorage(archive.StorageFormat(eventStorage), eventCodec); err != nil {
+		logger.Fatal("invalid event storage", "error", err)
+	}
+
+	if cacheDir != "" {
+		cache, err := archive.NewCache(cacheDir, cacheMaxGB<<30)
+		if err != nil {
+			logger.Fatal("failed to open cache", "path", cacheDir, "error", err)
+		}
+		ad.SetCache(cache)
+	}
+
+	if statusAddr != "" {
+		go serveStatus(logger, statusAddr, ad.StatusHandler())
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), maxDuration)
 	defer cancel()
 
 	err = ad.DownloadEvents(ctx)
+
+	if tracer != nil {
+		if err := tracer.Close(); err != nil {
+			logger.Error("failed to write trace file", "path", traceFile, "error", err)
+		}
+	}
+
 	if err != nil {
 		logger.Fatal("failed to download archive files", "error", err)
 	}
 
+	if metricsFile != "" {
+		if err := metrics.WriteTextFile(metricsFile); err != nil {
+			logger.Error("failed to write metrics file", "path", metricsFile, "error", err)
+		}
+	}
+
 	logger.Info("done", "took", time.Since(start))
 }
+
+// buildFilter builds the event filter from the config file and the filter
+// flags. Without config file the orgs default to the orgNames flag, with a
+// config file only explicitly set flags are added.
+func buildFilter(configPath string, orgNames string, flags map[string]*string) (*archive.EventFilter, error) {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	filter := &archive.EventFilter{}
+	if configPath != "" {
+		var err error
+		if filter, err = archive.LoadEventFilter(configPath); err != nil {
+			return nil, err
+		}
+	}
+	if configPath == "" || set["orgNames"] {
+		filter.Orgs.Include = append(filter.Orgs.Include, splitList(orgNames)...)
+	}
+
+	for name, list := range map[string]*[]string{
+		"excludeOrgs":       &filter.Orgs.Exclude,
+		"repos":             &filter.Repos.Include,
+		"excludeRepos":      &filter.Repos.Exclude,
+		"actors":            &filter.Actors.Include,
+		"excludeActors":     &filter.Actors.Exclude,
+		"eventTypes":        &filter.Types.Include,
+		"excludeEventTypes": &filter.Types.Exclude,
+	} {
+		*list = append(*list, splitList(*flags[name])...)
+	}
+
+	return filter, filter.Validate()
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func serveMetrics(logger log.Logger, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	logger.Info("serving metrics", "addr", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Error("failed to serve metrics", "error", err)
+	}
+}
+
+func serveStatus(logger log.Logger, addr string, handler http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/status", handler)
+
+	logger.Info("serving status", "addr", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Error("failed to serve status", "error", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/grafana/devtools/pkg/archive"
+	"github.com/grafana/devtools/pkg/streams/log"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	var (
+		database         string
+		connectionString string
+		keepMonths       int
+		exportDir        string
+		dryRun           bool
+	)
+
+	flag.StringVar(&database, "database", "", "database type, postgres or mysql")
+	flag.StringVar(&connectionString, "connstring", "", "")
+	flag.IntVar(&keepMonths, "keepMonths", 0, "keep the events of the current month and this many months before it, dropping the partitions of older months")
+	flag.StringVar(&exportDir, "exportDir", "", "export the events of partitions to hourly files in the layout of GH Archive in this directory before dropping them")
+	flag.BoolVar(&dryRun, "dryRun", false, "only print the partitions that would be dropped")
+	flag.Parse()
+
+	if keepMonths <= 0 {
+		fmt.Fprintln(os.Stderr, "missing -keepMonths")
+		os.Exit(2)
+	}
+
+	engine, err := archive.InitDatabase(database, connectionString)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to open database:", err)
+		os.Exit(1)
+	}
+
+	partitions := archive.NewPartitions(engine)
+	enabled, err := partitions.Enabled()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to read partitions:", err)
+		os.Exit(1)
+	}
+	if !enabled {
+		fmt.Fprintln(os.Stderr, "github_event is not partitioned, run github-archive-parser with -partitionByMonth first")
+		os.Exit(1)
+	}
+
+	list, err := partitions.List()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to read partitions:", err)
+		os.Exit(1)
+	}
+
+	exporter := archive.NewArchiveExporter(log.New(), engine)
+	cutoff := archive.RetentionCutoff(time.Now(), keepMonths)
+	for _, p := range archive.PartitionsBefore(list, cutoff) {
+		if dryRun {
+			fmt.Printf("%s\tto=%s\n", p.Name, p.To.Format("2006-01-02"))
+			continue
+		}
+
+		if exportDir != "" {
+			files, events, err := exporter.Export(context.Background(), exportDir, p.From, p.To)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "failed to export partition:", p.Name, err)
+				os.Exit(1)
+			}
+			fmt.Printf("exported %d events of %s to %d files in %s\n", events, p.Name, files, exportDir)
+		}
+
+		if err := partitions.Drop(p); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to drop partition:", p.Name, err)
+			os.Exit(1)
+		}
+		fmt.Printf("dropped %s\n", p.Name)
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,11 +16,16 @@ import (
 
 	"github.com/grafana/devtools/pkg/archive"
 	"github.com/grafana/devtools/pkg/githubstats"
+	"github.com/grafana/devtools/pkg/streams"
+	"github.com/grafana/devtools/pkg/streams/diskbus"
 	"github.com/grafana/devtools/pkg/streams/log"
 	"github.com/grafana/devtools/pkg/streams/memorybus"
+	"github.com/grafana/devtools/pkg/streams/metrics"
+	"github.com/grafana/devtools/pkg/streams/netbus"
 	"github.com/grafana/devtools/pkg/streams/projections"
 	_ "github.com/grafana/devtools/pkg/streams/sqlpersistence/mysqlpersistence"
 	_ "github.com/grafana/devtools/pkg/streams/sqlpersistence/postgrespersistence"
+	"github.com/grafana/devtools/pkg/streams/tracing"
 )
 
 func main() {
@@ -28,62 +36,200 @@ func main() {
 		fromConnectionString string
 		toConnectionString   string
 		limit                int64
+		logFormat            string
 		verboseLogging       bool
+		metricsAddr          string
+		metricsFile          string
+		traceFile            string
+		busReadyTimeout      time.Duration
+		busDataDir           string
+		busURL               string
+		busRun               string
+		projectionGroups     string
+		publishEvents        bool
+		deadLetterTable      string
+		eventTypes           string
+		fromDate             string
+		toDate               string
 	)
 	flag.StringVar(&database, "database", "", "database type")
 	flag.StringVar(&fromConnectionString, "fromConnectionstring", "", "")
 	flag.StringVar(&toConnectionString, "toConnectionstring", "", "")
 	flag.Int64Var(&limit, "limit", 5000, "")
 	flag.BoolVar(&verboseLogging, "verbose", false, "enable verbose logging")
+	flag.StringVar(&logFormat, "logFormat", "console", "log format, console or json")
+	flag.DurationVar(&busReadyTimeout, "busReadyTimeout", 0, "fail when a subscription of the in memory bus has not received any stream within this duration, e.g. a projection whose input is never published, 0 waits forever. Subscriptions of persisters only become ready once the projections before them have read all events")
+	flag.StringVar(&busDataDir, "busDataDir", "", "store intermediate streams on disk in this directory instead of in memory, a later run using the same directory resumes unconsumed streams")
+	flag.StringVar(&busURL, "busURL", "", "publish and subscribe to streams through the bus coordinator at this url, e.g. http://localhost:8090, to run projection groups in separate processes")
+	flag.StringVar(&busRun, "busRun", "", "id of the run the processes connected to the bus coordinator take part in, required with -busURL and new for each run so that subscribers never receive streams of a previous run, e.g. a timestamp")
+	flag.StringVar(&projectionGroups, "projections", "", "comma separated projection groups to run, all if empty: "+strings.Join(githubstats.ProjectionGroupNames(), ","))
+	flag.BoolVar(&publishEvents, "publishEvents", true, "read events from the archive database and publish them, disable for processes only running projections of a networked bus")
+	flag.StringVar(&deadLetterTable, "deadLetterTable", "", "persist messages that projections failed to handle to this table, only logged if empty")
+	flag.StringVar(&eventTypes, "eventTypes", "", "comma separated event types to read from the archive database, e.g. PushEvent, all if empty")
+	flag.StringVar(&fromDate, "fromDate", "", "only read events created from this date, e.g. 2019-01-01, reading only the partitions needed if github_event is partitioned")
+	flag.StringVar(&toDate, "toDate", "", "only read events created before this date")
+	flag.StringVar(&metricsAddr, "metricsAddr", "", "serve metrics in prometheus format on /metrics at this address, e.g. :9090")
+	flag.StringVar(&metricsFile, "metricsFile", "", "write metrics in prometheus format to this file when done, e.g. for the node exporter textfile collector")
+	flag.StringVar(&traceFile, "traceFile", "", "write tracing spans in OTLP JSON format to this file")
 	flag.Parse()
 
 	logger := log.New()
 
-	logLevel := log15.LvlInfo
-	if verboseLogging {
-		logLevel = log15.LvlDebug
+	if logFormat == "json" {
+		logLevel := log.LogLevelInfo
+		if verboseLogging {
+			logLevel = log.LogLevelDebug
+		}
+		logger.AddHandler(log.NewJSONHandler(os.Stdout, logLevel))
+	} else {
+		logLevel := log15.LvlInfo
+		if verboseLogging {
+			logLevel = log15.LvlDebug
+		}
+
+		log15Logger := log15.New()
+		log15Logger.SetHandler(log15.LvlFilterHandler(
+			logLevel, log15.StreamHandler(os.Stdout, log15adapter.GetConsoleFormat())))
+		logger.AddHandler(log15adapter.New(log15Logger))
+	}
+
+	if metricsAddr != "" {
+		go serveMetrics(logger, metricsAddr)
+	}
+
+	var tracer *tracing.Tracer
+	if traceFile != "" {
+		exporter, err := tracing.NewFileExporter(traceFile)
+		if err != nil {
+			logger.Fatal("failed to create trace file", "error", err)
+		}
+		tracer = tracing.New("github-event-aggregator", exporter)
+		tracing.SetDefault(tracer)
 	}
 
-	log15Logger := log15.New()
-	log15Logger.SetHandler(log15.LvlFilterHandler(
-		logLevel, log15.StreamHandler(os.Stdout, log15adapter.GetConsoleFormat())))
-	logger.AddHandler(log15adapter.New(log15Logger))
+	ctx, span := tracing.Start(context.Background(), "aggregate events", logger)
 
 	streamPersister, err := sqlpersistence.Open(logger, database, toConnectionString)
 	if err != nil {
 		logger.Fatal("Failed to open sql stream persister", "error", err)
 	}
 
-	bus := memorybus.New()
-	bus.SetLogger(logger)
+	var bus streams.Bus
+	if busURL != "" {
+		if busRun == "" {
+			logger.Fatal("-busRun is required with -busURL")
+		}
+
+		netBus := netbus.New(busURL)
+		netBus.SetLogger(logger)
+		netBus.SetRun(busRun)
+		for topic, codec := range githubstats.Codecs() {
+			netBus.RegisterCodec(topic, codec)
+		}
+		bus = netBus
+	} else if busDataDir != "" {
+		diskBus, err := diskbus.New(busDataDir)
+		if err != nil {
+			logger.Fatal("Failed to open disk bus", "error", err)
+		}
+		defer diskBus.Close()
+
+		diskBus.SetLogger(logger)
+		for topic, codec := range githubstats.Codecs() {
+			diskBus.RegisterCodec(topic, codec)
+		}
+		bus = diskBus
+	} else {
+		memoryBus := memorybus.New()
+		memoryBus.SetLogger(logger)
+		memoryBus.SetReadyTimeout(busReadyTimeout)
+		bus = memoryBus
+	}
 
 	projectionEngine := projections.New(bus, streamPersister)
 	projectionEngine.SetLogger(logger)
+	projectionEngine.SetContext(ctx)
 
-	githubstats.RegisterProjections(projectionEngine)
+	if deadLetterTable != "" {
+		if err := projectionEngine.PersistDeadLetters(deadLetterTable); err != nil {
+			logger.Fatal("failed to register dead letter table", "error", err)
+		}
+	}
 
-	engine, err := archive.InitDatabase(database, fromConnectionString)
-	if err != nil {
-		logger.Fatal("migration failed", "error", err)
+	groups := githubstats.ProjectionGroupNames()
+	if projectionGroups != "" {
+		groups = strings.Split(projectionGroups, ",")
 	}
 
-	reader := archive.NewArchiveReader(logger, engine, limit)
-	events, errors := reader.ReadAllEvents()
+	if err := githubstats.RegisterProjectionGroups(projectionEngine, groups...); err != nil {
+		logger.Fatal("failed to register projections", "error", err)
+	}
 
-	go printErrorSummary(logger, errors)
+	if memoryBus, ok := bus.(*memorybus.InMemoryBus); ok {
+		if err := memoryBus.Validate(); err != nil {
+			logger.Fatal("invalid projection subscriptions", "error", err)
+		}
+	}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 
+	busSucceeded := false
 	go func() {
-		<-bus.Start()
+		busSucceeded = <-bus.Start()
 		wg.Done()
 	}()
 
-	bus.Publish(githubstats.GithubEventStream, events)
+	if publishEvents {
+		engine, err := archive.InitDatabase(database, fromConnectionString)
+		if err != nil {
+			logger.Fatal("migration failed", "error", err)
+		}
+
+		reader := archive.NewArchiveReader(logger, engine, limit)
+		if eventTypes != "" {
+			reader.SetEventTypes(strings.Split(eventTypes, ",")...)
+		}
+
+		from, err := parseDate(fromDate)
+		if err != nil {
+			logger.Fatal("could not parse from date", "error", err)
+		}
+		to, err := parseDate(toDate)
+		if err != nil {
+			logger.Fatal("could not parse to date", "error", err)
+		}
+		reader.SetTimeRange(from, to)
+		events, errors := reader.ReadAllEvents()
+
+		go printErrorSummary(logger, errors)
+
+		bus.Publish(githubstats.GithubEventStream, events)
+	}
 
 	wg.Wait()
 
+	if !busSucceeded {
+		logger.Fatal("bus failed, projections did not complete", "error", bus.Err())
+	}
+
+	for _, f := range projectionEngine.FailureSummary() {
+		logger.Warn("projection failed to handle messages", "projection", f.Projection, "panics", f.Panics, "errors", f.Errors)
+	}
+
+	span.Finish()
+	if tracer != nil {
+		if err := tracer.Close(); err != nil {
+			logger.Error("failed to write trace file", "path", traceFile, "error", err)
+		}
+	}
+
+	if metricsFile != "" {
+		if err := metrics.WriteTextFile(metricsFile); err != nil {
+			logger.Error("failed to write metrics file", "path", metricsFile, "error", err)
+		}
+	}
+
 	elapsed := time.Since(start)
 	logger.Info("done", "took", elapsed)
 }
@@ -93,3 +239,22 @@ func printErrorSummary(logger log.Logger, errors <-chan error) {
 		logger.Error("Receive error", "error", err)
 	}
 }
+
+func serveMetrics(logger log.Logger, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	logger.Info("serving metrics", "addr", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Error("failed to serve metrics", "error", err)
+	}
+}
+
+// parseDate parses dates like 2019-01-01, returning the zero time for empty
+// dates
+func parseDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", date)
+}
@@ -15,18 +15,30 @@ import (
 	"time"
 
 	"github.com/NYTimes/gziphandler"
+	"github.com/grafana/devtools/pkg/archive"
 )
 
 func main() {
 	var (
-		srcPath string
-		port    string
+		srcPath  string
+		cacheDir string
+		port     string
 	)
 
 	flag.StringVar(&srcPath, "path", "", "local path on disk where github archive events are located")
+	flag.StringVar(&cacheDir, "cacheDir", "", "cache directory of github-archive-parser to serve archive files from, opened read only so a parser can keep using it")
 	flag.StringVar(&port, "port", "8000", "port to serve arhive files from")
 	flag.Parse()
 
+	var cache *archive.Cache
+	if cacheDir != "" {
+		var err error
+		cache, err = archive.OpenCacheReadOnly(cacheDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	withoutGz := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fileName := strings.TrimSuffix(r.URL.Path, ".gz")
 		if fileName == "/" {
@@ -75,6 +87,40 @@ func main() {
 
 	withGz := gziphandler.GzipHandler(withoutGz)
 
-	http.Handle("/", withGz)
+	// cached and exported files are already compressed and served as they are
+	fromCache := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cache != nil {
+			f, err := cache.Open(path.Base(r.URL.Path))
+			if err == nil {
+				defer f.Close()
+				log.Println("serving cached file", "path", r.URL.Path)
+				w.Header().Add("Content-Type", "application/gzip")
+				http.ServeContent(w, r, "", time.Now(), f)
+				return
+			}
+			if !os.IsNotExist(err) {
+				log.Fatal(err)
+			}
+		}
+
+		if strings.HasSuffix(r.URL.Path, ".gz") {
+			fullPath := path.Join(srcPath, r.URL.Path)
+			f, err := os.Open(fullPath)
+			if err == nil {
+				defer f.Close()
+				log.Println("serving compressed file", "path", fullPath)
+				w.Header().Add("Content-Type", "application/gzip")
+				http.ServeContent(w, r, "", time.Now(), f)
+				return
+			}
+			if !os.IsNotExist(err) {
+				log.Fatal(err)
+			}
+		}
+
+		withGz.ServeHTTP(w, r)
+	})
+
+	http.Handle("/", fromCache)
 	http.ListenAndServe(fmt.Sprintf("0.0.0.0:%s", port), nil)
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+
+	"github.com/grafana/devtools/pkg/githubstats"
+	"github.com/grafana/devtools/pkg/log15adapter"
+	"github.com/grafana/devtools/pkg/streams"
+	"github.com/grafana/devtools/pkg/streams/log"
+	"github.com/grafana/devtools/pkg/streams/memorybus"
+	"github.com/grafana/devtools/pkg/streams/projections"
+)
+
+func main() {
+	var (
+		format     string
+		outputFile string
+	)
+	flag.StringVar(&format, "format", "dot", "output format, dot or mermaid")
+	flag.StringVar(&outputFile, "output", "", "file to write the graph to, defaults to stdout")
+	flag.Parse()
+
+	logger := log.New()
+	log15Logger := log15.New()
+	log15Logger.SetHandler(log15.LvlFilterHandler(
+		log15.LvlInfo, log15.StreamHandler(os.Stderr, log15adapter.GetConsoleFormat())))
+	logger.AddHandler(log15adapter.New(log15Logger))
+
+	projectionEngine := projections.New(memorybus.New(), streams.NewNoOpStreamPersister())
+	githubstats.RegisterProjections(projectionEngine)
+	topology := projectionEngine.Topology()
+
+	if topics := topology.UnsubscribedTopics(); len(topics) > 0 {
+		logger.Warn("topics without subscribers", "topics", strings.Join(topics, ","))
+	}
+
+	if topics := topology.UnpublishedTopics(); len(topics) > 0 {
+		logger.Warn("subscribed topics that are never published", "topics", strings.Join(topics, ","))
+	}
+
+	var out io.Writer = os.Stdout
+	if outputFile != "" {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			logger.Fatal("failed to create output file", "error", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var err error
+	switch format {
+	case "dot":
+		err = topology.WriteDot(out)
+	case "mermaid":
+		err = topology.WriteMermaid(out)
+	default:
+		logger.Fatal("unknown output format", "format", format)
+	}
+
+	if err != nil {
+		logger.Fatal("failed to write graph", "error", err)
+	}
+}
@@ -7,15 +7,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
+	"io/ioutil"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-xorm/xorm"
 	"github.com/grafana/devtools/pkg/common"
+	"github.com/grafana/devtools/pkg/ghevents"
 	"github.com/grafana/devtools/pkg/streams/log"
+	"github.com/grafana/devtools/pkg/streams/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -23,23 +27,37 @@ import (
 type ArchiveDownloader struct {
 	logger           log.Logger
 	engine           *xorm.Engine
-	url              string
-	orgNames         []string
+	source           ArchiveSource
+	filter           *EventFilter
 	startDate        time.Time
 	stopDate         time.Time
 	overrideAllFiles bool
 	numWorkers       int
 	eventCount       int64
 	filesWithErrors  []string
+	filesMu          sync.Mutex
 	skipErrors       bool
+	retryFailed      bool
+	maxAttempts      int
+	initialBackoff   time.Duration
+	maxBackoff       time.Duration
+	cache            *Cache
+	storage          eventStorage
+	// partitions of the github_event table, nil if it is not partitioned
+	partitions *Partitions
+	// files downloaded instead of the hours from start to stop date
+	files            []*common.ArchiveFile
+	progress         downloadProgress
+	progressInterval time.Duration
+	drainTimeout     time.Duration
 }
 
 // NewArchiveDownloader creates a new downloader
 func NewArchiveDownloader(
 	engine *xorm.Engine,
 	overrideAllFiles bool,
-	url string,
-	orgNames []string,
+	source ArchiveSource,
+	filter *EventFilter,
 	startDate, stopDate time.Time,
 	numWorkers int,
 	skipErrors bool,
@@ -48,40 +66,145 @@ func NewArchiveDownloader(
 	return &ArchiveDownloader{
 		logger:           logger.New("logger", "archive-downloader"),
 		engine:           engine,
-		url:              url,
-		orgNames:         orgNames,
+		source:           source,
+		filter:           filter,
 		startDate:        startDate,
 		stopDate:         stopDate,
 		overrideAllFiles: overrideAllFiles,
 		numWorkers:       numWorkers,
 		filesWithErrors:  make([]string, 0, 16),
 		skipErrors:       skipErrors,
+		maxAttempts:      DefaultMaxAttempts,
+		initialBackoff:   DefaultInitialBackoff,
+		maxBackoff:       DefaultMaxBackoff,
+		storage:          eventStorage{format: StorageJSON},
+		progressInterval: DefaultProgressInterval,
+		drainTimeout:     DefaultDrainTimeout,
 	}
 }
 
+// SetProgressInterval sets how often the progress is logged, 0 disabling it
+func (ad *ArchiveDownloader) SetProgressInterval(interval time.Duration) {
+	ad.progressInterval = interval
+}
+
+// SetDrainTimeout sets how long files being downloaded when the context of
+// DownloadEvents is done may take to finish. No files are started once the
+// context is done.
+func (ad *ArchiveDownloader) SetDrainTimeout(timeout time.Duration) {
+	ad.drainTimeout = timeout
+}
+
+// SetStorage sets the format events are stored in, and the name of the codec
+// compressing them in StorageCompressed
+func (ad *ArchiveDownloader) SetStorage(format StorageFormat, codecName string) error {
+	storage := eventStorage{format: format}
+	switch format {
+	case StorageJSON, StorageColumns:
+	case StorageCompressed:
+		codec, err := GetEventCodec(codecName)
+		if err != nil {
+			return err
+		}
+		storage.codec = codec
+	default:
+		return fmt.Errorf("unsupported storage format %q", format)
+	}
+
+	ad.storage = storage
+	return nil
+}
+
+// SetRetry sets how often a file is downloaded before it is recorded as
+// failed, and the backoff between the attempts
+func (ad *ArchiveDownloader) SetRetry(maxAttempts int, initialBackoff, maxBackoff time.Duration) {
+	ad.maxAttempts = maxAttempts
+	ad.initialBackoff = initialBackoff
+	ad.maxBackoff = maxBackoff
+}
+
+// SetCache keeps the downloaded files in cache and reads cached files
+// instead of downloading them
+func (ad *ArchiveDownloader) SetCache(cache *Cache) {
+	ad.cache = cache
+}
+
+// SetFiles only downloads files, e.g. the files of a directory being
+// imported, instead of the hours from the start to the stop date
+func (ad *ArchiveDownloader) SetFiles(files []*common.ArchiveFile) {
+	ad.files = files
+}
+
+// SetRetryFailed only downloads the files recorded as failed by earlier runs
+func (ad *ArchiveDownloader) SetRetryFailed(retryFailed bool) {
+	ad.retryFailed = retryFailed
+}
+
 // DownloadEvents start to download all archive events
 func (ad *ArchiveDownloader) DownloadEvents(ctx context.Context) error {
 	start := time.Now()
 
+	ctx, span := tracing.Start(ctx, "download events", ad.logger, "startDate", ad.startDate, "stopDate", ad.stopDate)
+	defer span.Finish()
+
 	ad.logger.Info("downloading events...")
 
-	var archFiles []*common.ArchiveFile
-	if !ad.overrideAllFiles {
-		ad.logger.Debug("reading stored archive files from the database...")
-		err := ad.engine.Find(&archFiles)
-		if err != nil {
+	if err := ad.initPartitions(); err != nil {
+		span.SetError(err)
+		return err
+	}
+
+	var urls []*common.ArchiveFile
+	if ad.files != nil {
+		urls = ad.files
+	} else if ad.retryFailed {
+		ad.logger.Debug("reading failed archive files from the database...")
+		var failedFiles []*common.FailedArchiveFile
+		if err := ad.engine.Find(&failedFiles); err != nil {
+			span.SetError(err)
 			return err
 		}
-		ad.logger.Debug("stored archive files read from the database", "archiveFiles", len(archFiles))
+		ad.logger.Debug("failed archive files read from the database", "failedFiles", len(failedFiles))
+		urls = ad.buildRetryUrls(failedFiles)
+	} else {
+		var archFiles []*common.ArchiveFile
+		if !ad.overrideAllFiles {
+			ad.logger.Debug("reading stored archive files from the database...")
+			err := ad.engine.Find(&archFiles)
+			if err != nil {
+				span.SetError(err)
+				return err
+			}
+			ad.logger.Debug("stored archive files read from the database", "archiveFiles", len(archFiles))
+		}
+
+		urls = ad.buildUrlsDownload(archFiles, ad.startDate, ad.stopDate)
 	}
 
-	urls := ad.buildUrlsDownload(archFiles, ad.startDate, ad.stopDate)
+	atomic.StoreInt64(&ad.eventCount, 0)
+	ad.progress.start(len(urls))
+
+	// files in flight when ctx is done are finished with workCtx, which is
+	// cancelled once they are done or the drain timeout is reached
+	workCtx, cancelWork := context.WithCancel(detachedContext{parent: ctx})
+	workDone := make(chan struct{})
+	var monitors sync.WaitGroup
+	monitors.Add(2)
+	go func() {
+		defer monitors.Done()
+		ad.drain(ctx, cancelWork, workDone)
+	}()
+	go func() {
+		defer monitors.Done()
+		ad.logProgress(ad.progressInterval, workDone)
+	}()
+
 	var downloadUrls = make(chan *common.ArchiveFile, 16)
 	wg := sync.WaitGroup{}
 
 	// start workers
 	for i := 0; i < ad.numWorkers; i++ {
-		ad.spawnWorker(ctx, i, &wg, downloadUrls)
+		ad.spawnWorker(ctx, workCtx, i, &wg, downloadUrls)
 	}
 
 	go func() {
@@ -99,8 +222,13 @@ func (ad *ArchiveDownloader) DownloadEvents(ctx context.Context) error {
 
 	// wait for all workers to complete
 	wg.Wait()
+	close(workDone)
+	monitors.Wait()
 
-	ad.logger.Info("events downloaded and filtered", "eventCount", ad.eventCount, "fileErrors", len(ad.filesWithErrors), "took", time.Since(start))
+	p := ad.Progress()
+	span.SetAttributes("files", len(urls), "eventCount", p.Events, "fileErrors", len(ad.filesWithErrors), "remainingFiles", p.RemainingFiles)
+	ad.logger.Info("events downloaded and filtered", "eventCount", p.Events, "completed", p.CompletedFiles, "fileErrors", len(ad.filesWithErrors),
+		"remaining", p.RemainingFiles, "bytes", p.Bytes, "took", time.Since(start))
 	if len(ad.filesWithErrors) > 0 {
 		ad.logger.Debug("failed downloads of dates", "dates", strings.Join(ad.filesWithErrors, ","))
 	}
@@ -108,6 +236,22 @@ func (ad *ArchiveDownloader) DownloadEvents(ctx context.Context) error {
 	return nil
 }
 
+// initPartitions creates the partitions of the months to download, if the
+// github_event table is partitioned
+func (ad *ArchiveDownloader) initPartitions() error {
+	partitions := NewPartitions(ad.engine)
+	enabled, err := partitions.Enabled()
+	if err != nil || !enabled {
+		return err
+	}
+
+	ad.partitions = partitions
+	if ad.retryFailed || ad.files != nil {
+		return nil
+	}
+	return partitions.EnsureRange(ad.startDate, ad.stopDate)
+}
+
 func (ad *ArchiveDownloader) buildUrlsDownload(archFiles []*common.ArchiveFile, st, stopDate time.Time) []*common.ArchiveFile {
 	var result []*common.ArchiveFile
 
@@ -130,8 +274,11 @@ func (ad *ArchiveDownloader) buildUrlsDownload(archFiles []*common.ArchiveFile,
 	return result
 }
 
+// spawnWorker starts a worker downloading files until downloadUrls is closed
+// or ctx is done. Files are downloaded with workCtx, so the file in flight
+// when ctx is done is finished.
 func (ad *ArchiveDownloader) spawnWorker(
-	ctx context.Context, index int, wg *sync.WaitGroup, downloadUrls chan *common.ArchiveFile,
+	ctx, workCtx context.Context, index int, wg *sync.WaitGroup, downloadUrls chan *common.ArchiveFile,
 ) {
 	wg.Add(1)
 	go func(workerID int) {
@@ -147,56 +294,103 @@ func (ad *ArchiveDownloader) spawnWorker(
 				logger.Debug("worker is complete")
 				return
 			case u, more := <-downloadUrls:
-				if !more {
+				if !more || ctx.Err() != nil {
 					return
 				}
 
-				if err := ad.download(ctx, u); err != nil {
+				start := time.Now()
+				atomic.AddInt64(&ad.progress.inFlight, 1)
+				attempts, err := retry(ctx, ad.maxAttempts, ad.initialBackoff, ad.maxBackoff, func() error {
+					err := ad.download(workCtx, u)
+					if err != nil && isRetryable(err) {
+						logger.Warn("failed to download file, retrying", "createdAt", u.CreatedAt, "error", err)
+					}
+					return err
+				})
+				atomic.AddInt64(&ad.progress.inFlight, -1)
+				if err != nil {
+					atomic.AddInt64(&ad.progress.failed, 1)
+					ad.filesMu.Lock()
 					ad.filesWithErrors = append(ad.filesWithErrors, fmt.Sprintf("%v", u.CreatedAt))
-					logger.Error("failed to download file", "createdAt", u.CreatedAt, "error", err)
+					ad.filesMu.Unlock()
+					logger.Error("failed to download file", "createdAt", u.CreatedAt, "attempts", attempts, "error", err)
+					downloadedFiles.WithLabelValues("error").Inc()
+
+					// files interrupted by the deadline are downloaded by the next
+					// run anyway, since they are not stored as archive files
+					interrupted := workCtx.Err() != nil || (ctx.Err() != nil && isRetryable(err))
+					if !interrupted {
+						if err := ad.saveFailedFile(u, attempts, err); err != nil {
+							logger.Error("failed to record failed file", "createdAt", u.CreatedAt, "error", err)
+						}
+					}
+				} else {
+					atomic.AddInt64(&ad.progress.completed, 1)
+					downloadedFiles.WithLabelValues("ok").Inc()
 				}
+				downloadDuration.WithLabelValues().Observe(time.Since(start).Seconds())
 			}
 		}
 	}(index)
 }
 
-func (ad *ArchiveDownloader) download(ctx context.Context, file *common.ArchiveFile) error {
+func (ad *ArchiveDownloader) download(ctx context.Context, file *common.ArchiveFile) (err error) {
 	start := time.Now()
 	ad.logger.Debug("downloading file...", "date", file.CreatedAt)
 
-	url := ad.buildDownloadURL(file)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return err
-	}
+	location := ad.source.Location(file)
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return errors.Wrap(err, "failed to download json file")
-	}
-	defer res.Body.Close()
+	ctx, span := tracing.Start(ctx, "download hour file", ad.logger, "date", file.CreatedAt, "location", location)
+	defer func() {
+		span.SetError(err)
+		span.Finish()
+	}()
 
-	ad.logger.Debug("file downloaded", "date", file.CreatedAt, "took", time.Since(start))
+	var body io.Reader
+	var cacheWriter *CacheWriter
+	if cached, err := ad.openCached(file); err == nil {
+		defer cached.Close()
+		body = &countingReader{r: cached, total: &ad.progress.bytes}
+		span.SetAttributes("cached", true)
+	} else {
+		rc, err := ad.source.Open(ctx, file)
+		if err != nil {
+			if se, ok := err.(*statusError); ok {
+				span.SetAttributes("statusCode", se.statusCode)
+			}
+			return err
+		}
+		defer rc.Close()
 
-	// bail out if the request didn't return 200. we will download this file next time
-	if res.StatusCode != 200 {
-		ad.logger.Warn("bad http status code for file", "date", file.CreatedAt, "statusCode", res.StatusCode)
-		return nil
+		ad.logger.Debug("file opened", "date", file.CreatedAt, "took", time.Since(start))
+
+		body = &countingReader{r: rc, counter: downloadedBytes.WithLabelValues(), total: &ad.progress.bytes}
+		if ad.cacheable() {
+			if cacheWriter, err = ad.cache.Create(cacheFileName(file)); err != nil {
+				return err
+			}
+			defer func() {
+				if cacheWriter != nil {
+					cacheWriter.Abort()
+				}
+			}()
+			body = io.TeeReader(body, cacheWriter)
+		}
 	}
 
-	// create reader that can reader gziped content
-	zipReader, err := gzip.NewReader(res.Body)
+	content, err := decompress(body)
 	if err != nil {
-		return errors.Wrap(err, "parsing compress content")
+		return &retryableError{err: errors.Wrap(err, "parsing compress content")}
 	}
-	defer zipReader.Close()
+	defer content.Close()
 
 	// decompress response body and send to workers.
-	bufferReader := bufio.NewReaderSize(zipReader, 2048*2048)
+	bufferReader := bufio.NewReaderSize(content, 2048*2048)
 
 	var (
 		s       string
 		lastErr error
+		events  []*common.GithubEvent
 	)
 
 	for {
@@ -210,12 +404,15 @@ func (ad *ArchiveDownloader) download(ctx context.Context, file *common.ArchiveF
 			}
 
 			if !isPrefix {
-				if err := ad.parseAndFilterEvent(s); err != nil {
+				event, err := ad.parseAndFilterEvent(s)
+				if err != nil {
 					ad.logger.Error("failed to process event", "error", err, "skip", ad.skipErrors)
 
 					if !ad.skipErrors {
 						lastErr = err
 					}
+				} else if event != nil {
+					events = append(events, event)
 				}
 			}
 
@@ -224,7 +421,7 @@ func (ad *ArchiveDownloader) download(ctx context.Context, file *common.ArchiveF
 
 		if err != io.EOF {
 			ad.logger.Error("failed to read line from file", "date", file.CreatedAt, "error", err)
-			break
+			return &retryableError{err: errors.Wrap(err, "failed to read line from file")}
 		}
 
 		if err == io.EOF {
@@ -236,69 +433,137 @@ func (ad *ArchiveDownloader) download(ctx context.Context, file *common.ArchiveF
 		return lastErr
 	}
 
-	return ad.saveFileIntoDatabase(file)
-}
+	if cacheWriter != nil {
+		// read what the gzip reader left, so the whole file is cached
+		if _, err := io.Copy(ioutil.Discard, body); err != nil {
+			return &retryableError{err: errors.Wrap(err, "failed to read file")}
+		}
+		err := cacheWriter.Commit()
+		cacheWriter = nil
+		if err != nil {
+			ad.logger.Warn("failed to cache file", "date", file.CreatedAt, "error", err)
+		}
+	}
 
-func (ad *ArchiveDownloader) buildDownloadURL(file *common.ArchiveFile) string {
-	ft := time.Unix(file.ID, 0).UTC()
-	return fmt.Sprintf(ad.url, ft.Year(), ft.Month(), ft.Day(), ft.Hour())
-}
+	if ad.partitions != nil {
+		// altering tables commits transactions on mysql, so partitions are
+		// created before storing the file
+		for _, e := range events {
+			if err := ad.partitions.Ensure(e.CreatedAt); err != nil {
+				return errors.Wrap(err, "failed to create partition")
+			}
+		}
+	}
 
-func (ad *ArchiveDownloader) parseAndFilterEvent(line string) error {
-	var ge common.GithubEventJSON
-	if err := json.Unmarshal([]byte(line), &ge); err != nil {
+	if err := ad.saveFileIntoDatabase(file, events); err != nil {
 		return err
 	}
 
-	if ge.Org == nil {
-		return nil
-	}
+	atomic.AddInt64(&ad.eventCount, int64(len(events)))
+	storedEvents.WithLabelValues().Add(float64(len(events)))
 
-	for _, v := range ad.orgNames {
-		if ge.Org.Login == v {
-			id, err := strconv.ParseInt(ge.ID, 10, 0)
-			if err != nil {
-				return err
-			}
+	return nil
+}
 
-			event := &common.GithubEvent{
-				ID:        id,
-				CreatedAt: ge.CreatedAt,
-				Data:      string(line),
-			}
+// cacheable returns whether the files of the source are cached. Files of
+// local sources are not, since they are read from disk anyway
+func (ad *ArchiveDownloader) cacheable() bool {
+	_, remote := ad.source.(*httpSource)
+	return ad.cache != nil && remote
+}
 
-			if err := ad.saveEventIntoDatabase(event); err != nil {
-				return err
-			}
+// openCached opens the cached file, returning an error if the files of the
+// source are not cached or the file is not cached
+func (ad *ArchiveDownloader) openCached(file *common.ArchiveFile) (*os.File, error) {
+	if !ad.cacheable() {
+		return nil, os.ErrNotExist
+	}
 
-			ad.eventCount++
-		}
+	return ad.cache.Open(cacheFileName(file))
+}
+
+// decompress returns the content of r, which is either gzip compressed or
+// plain json
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
 	}
 
-	return nil
+	return ioutil.NopCloser(br), nil
 }
 
-func (ad *ArchiveDownloader) saveFileIntoDatabase(file *common.ArchiveFile) error {
-	session := ad.engine.NewSession()
-	defer session.Close()
+// parseAndFilterEvent returns the event of line if it matches the filter
+func (ad *ArchiveDownloader) parseAndFilterEvent(line string) (*common.GithubEvent, error) {
+	var ge common.GithubEventJSON
+	if err := json.Unmarshal([]byte(line), &ge); err != nil || ge.ID == "" {
+		if !ghevents.IsLegacy([]byte(line)) {
+			if err == nil {
+				err = errors.New("event has no id")
+			}
+			return nil, err
+		}
+		if ge, err = legacyEventJSON(line); err != nil {
+			return nil, err
+		}
+	}
 
-	if err := session.Begin(); err != nil {
-		return err
+	if !ad.filter.Match(&ge) {
+		return nil, nil
 	}
 
-	//remove the file first to make development easier.
-	if _, err := session.Exec("DELETE FROM archive_file WHERE ID = ? ", file.ID); err != nil {
-		return err
+	id, err := strconv.ParseInt(ge.ID, 10, 0)
+	if err != nil {
+		return nil, err
 	}
 
-	if _, err := session.Insert(file); err != nil {
-		return err
+	event := &common.GithubEvent{
+		ID:        id,
+		CreatedAt: ge.CreatedAt,
+		Data:      line,
+		EventType: ge.Type,
+	}
+	if ge.Repo != nil {
+		event.RepoName = ge.Repo.Name
+	}
+	if ge.Actor != nil {
+		event.ActorLogin = ge.Actor.Login
+	}
+	if ge.Payload != nil {
+		event.EventAction = ge.Payload.Action
 	}
 
-	return session.Commit()
+	return event, ad.storage.encode(event)
 }
 
-func (ad *ArchiveDownloader) saveEventIntoDatabase(event *common.GithubEvent) error {
+// legacyEventJSON reads an event in the timeline format archived before 2015.
+// The line is stored as is and decoded by the reader with ghevents.Decode.
+func legacyEventJSON(line string) (common.GithubEventJSON, error) {
+	evt, err := ghevents.DecodeLegacy([]byte(line))
+	if err != nil {
+		return common.GithubEventJSON{}, err
+	}
+
+	ge := common.GithubEventJSON{ID: evt.ID, Type: evt.Type, CreatedAt: evt.CreatedAt}
+	if evt.Org != nil {
+		ge.Org = &common.OrgJSON{Login: evt.Org.Login}
+	}
+	if evt.Repo != nil {
+		ge.Repo = &common.RepoJSON{Name: evt.Repo.Name}
+	}
+	if evt.Actor != nil {
+		ge.Actor = &common.ActorJSON{Login: evt.Actor.Login}
+	}
+	if evt.Payload != nil && evt.Payload.Action != nil {
+		ge.Payload = &common.PayloadJSON{Action: *evt.Payload.Action}
+	}
+	return ge, nil
+}
+
+// saveFileIntoDatabase stores the events of the file and the file in one
+// transaction, so an hour is either stored completely or not at all.
+func (ad *ArchiveDownloader) saveFileIntoDatabase(file *common.ArchiveFile, events []*common.GithubEvent) error {
 	session := ad.engine.NewSession()
 	defer session.Close()
 
@@ -306,12 +571,20 @@ func (ad *ArchiveDownloader) saveEventIntoDatabase(event *common.GithubEvent) er
 		return err
 	}
 
-	//remove the event first to make development easier.
-	if _, err := session.Exec("DELETE FROM github_event WHERE ID = ? ", event.ID); err != nil {
+	if err := upsertEvents(session, ad.engine.Dialect().DBType(), ad.partitions != nil, events); err != nil {
+		return err
+	}
+
+	//remove the file first to make development easier.
+	if _, err := session.Exec("DELETE FROM archive_file WHERE ID = ? ", file.ID); err != nil {
+		return err
+	}
+
+	if _, err := session.Insert(file); err != nil {
 		return err
 	}
 
-	if _, err := session.Insert(event); err != nil {
+	if _, err := session.Exec("DELETE FROM failed_archive_file WHERE ID = ? ", file.ID); err != nil {
 		return err
 	}
 
@@ -1,10 +1,16 @@
 package archive
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/go-xorm/core"
 	"github.com/grafana/devtools/pkg/common"
+	"github.com/grafana/devtools/pkg/streams/log"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -63,7 +69,7 @@ func TestWritingArchiveFile(t *testing.T) {
 		engine: engine,
 	}
 
-	assert.NoError(t, ad.saveFileIntoDatabase(common.NewArchiveFile(2018, 1, 1, 1)))
+	assert.NoError(t, ad.saveFileIntoDatabase(common.NewArchiveFile(2018, 1, 1, 1), nil))
 }
 
 func TestWritingToDatabase(t *testing.T) {
@@ -85,9 +91,46 @@ func TestWritingToDatabase(t *testing.T) {
 		})
 	}
 
-	for _, etw := range eventsToWrite {
-		assert.NoError(t, ad.saveEventIntoDatabase(etw))
-	}
+	assert.NoError(t, ad.saveFileIntoDatabase(common.NewArchiveFile(2018, 1, 1, 2), eventsToWrite))
+
+	// writing the file again replaces its events
+	assert.NoError(t, ad.saveFileIntoDatabase(common.NewArchiveFile(2018, 1, 1, 2), eventsToWrite))
+
+	count, err := engine.Count(&common.GithubEvent{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(eventsToWrite)), count)
+}
+
+func TestUpsertEventsSQL(t *testing.T) {
+	columns := "id, created_at, data, event_type, repo_name, actor_login, event_action, payload"
+	row := "(?,?,?,?,?,?,?,?)"
+
+	assert.Equal(t,
+		"INSERT INTO github_event ("+columns+") VALUES "+row+","+row+" ON CONFLICT (id) DO UPDATE SET "+
+			"created_at = EXCLUDED.created_at, data = EXCLUDED.data, event_type = EXCLUDED.event_type, repo_name = EXCLUDED.repo_name, "+
+			"actor_login = EXCLUDED.actor_login, event_action = EXCLUDED.event_action, payload = EXCLUDED.payload",
+		upsertEventsSQL(core.POSTGRES, false, 2))
+	assert.Equal(t,
+		"INSERT INTO github_event ("+columns+") VALUES "+row+" ON DUPLICATE KEY UPDATE "+
+			"created_at = VALUES(created_at), data = VALUES(data), event_type = VALUES(event_type), repo_name = VALUES(repo_name), "+
+			"actor_login = VALUES(actor_login), event_action = VALUES(event_action), payload = VALUES(payload)",
+		upsertEventsSQL(core.MYSQL, false, 1))
+	assert.Equal(t,
+		"INSERT OR REPLACE INTO github_event ("+columns+") VALUES "+row,
+		upsertEventsSQL(core.SQLITE, false, 1))
+	assert.Contains(t, upsertEventsSQL(core.POSTGRES, true, 1), " ON CONFLICT (id, created_at) DO UPDATE SET ")
+}
+
+func TestDedupeEvents(t *testing.T) {
+	events := dedupeEvents([]*common.GithubEvent{
+		{ID: 1, Data: "first"},
+		{ID: 2, Data: "other"},
+		{ID: 1, Data: "last"},
+	})
+
+	assert.Len(t, events, 2)
+	assert.Equal(t, "last", events[0].Data)
+	assert.Equal(t, "other", events[1].Data)
 }
 
 func TestArchiveFileIdFormat(t *testing.T) {
@@ -101,3 +144,57 @@ func TestArchiveFileIdFormat(t *testing.T) {
 func fakeStopDate(days, hours int) time.Time {
 	return time.Date(2018, time.Month(1), days, hours, 0, 0, 0, time.UTC)
 }
+
+func TestBackoff(t *testing.T) {
+	for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 30 * time.Second} {
+		d := backoff(attempt, time.Second, 30*time.Second)
+		assert.True(t, d >= expected/2 && d <= expected, "attempt %d waited %v", attempt, d)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("retries retryable errors", func(t *testing.T) {
+		calls := 0
+		attempts, err := retry(context.Background(), 5, time.Millisecond, time.Millisecond, func() error {
+			calls++
+			if calls < 3 {
+				return &statusError{statusCode: 503}
+			}
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		attempts, err := retry(context.Background(), 3, time.Millisecond, time.Millisecond, func() error {
+			return &retryableError{err: errors.New("connection reset")}
+		})
+
+		assert.Error(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		attempts, err := retry(context.Background(), 3, time.Millisecond, time.Millisecond, func() error {
+			return &statusError{statusCode: 404}
+		})
+
+		assert.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestDownloadRecordsStatusCodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ad := &ArchiveDownloader{source: newHTTPSource(server.URL + "/%d-%02d-%02d-%d.json.gz"), logger: log.New()}
+	err := ad.download(context.Background(), common.NewArchiveFile(2018, 1, 1, 1))
+
+	assert.Equal(t, &statusError{statusCode: 503}, err)
+	assert.True(t, isRetryable(err))
+}
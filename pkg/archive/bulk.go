@@ -0,0 +1,112 @@
+package archive
+
+import (
+	"strings"
+
+	"github.com/go-xorm/core"
+	"github.com/go-xorm/xorm"
+	"github.com/grafana/devtools/pkg/common"
+)
+
+// upsertEvents inserts events in batches, replacing stored events with the
+// same id, using the upsert statement of the dialect. Partitioned tables are
+// keyed by id and created_at.
+func upsertEvents(session *xorm.Session, dbType core.DbType, partitioned bool, events []*common.GithubEvent) error {
+	events = dedupeEvents(events)
+	batchSize := eventBatchSize(dbType)
+
+	for start := 0; start < len(events); start += batchSize {
+		end := start + batchSize
+		if end > len(events) {
+			end = len(events)
+		}
+
+		batch := events[start:end]
+		args := make([]interface{}, 0, len(batch)*len(eventColumns))
+		for _, e := range batch {
+			var payload interface{}
+			if len(e.Payload) > 0 {
+				payload = e.Payload
+			}
+			args = append(args, e.ID, e.CreatedAt, e.Data,
+				nullString(e.EventType), nullString(e.RepoName), nullString(e.ActorLogin), nullString(e.EventAction), payload)
+		}
+
+		if _, err := session.Exec(upsertEventsSQL(dbType, partitioned, len(batch)), args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eventBatchSize returns the number of events per statement, keeping below
+// the limit of parameters per statement of sqlite and the packet size of
+// mysql.
+func eventBatchSize(dbType core.DbType) int {
+	switch dbType {
+	case core.SQLITE:
+		return 100
+	case core.MYSQL:
+		return 500
+	}
+
+	return 1000
+}
+
+var eventColumns = []string{"id", "created_at", "data", "event_type", "repo_name", "actor_login", "event_action", "payload"}
+
+func upsertEventsSQL(dbType core.DbType, partitioned bool, rows int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?,", len(eventColumns)), ",") + ")"
+	values := strings.TrimSuffix(strings.Repeat(row+",", rows), ",")
+	insert := "INSERT INTO github_event (" + strings.Join(eventColumns, ", ") + ") VALUES " + values
+
+	updates := []string{}
+	for _, col := range eventColumns[1:] {
+		switch dbType {
+		case core.POSTGRES:
+			updates = append(updates, col+" = EXCLUDED."+col)
+		case core.MYSQL:
+			updates = append(updates, col+" = VALUES("+col+")")
+		}
+	}
+
+	switch dbType {
+	case core.POSTGRES:
+		key := "id"
+		if partitioned {
+			key = "id, created_at"
+		}
+		return insert + " ON CONFLICT (" + key + ") DO UPDATE SET " + strings.Join(updates, ", ")
+	case core.MYSQL:
+		return insert + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	}
+
+	return "INSERT OR REPLACE" + strings.TrimPrefix(insert, "INSERT")
+}
+
+// nullString stores empty strings as NULL, e.g. columns not extracted in
+// the json storage format.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// dedupeEvents keeps the last of events with the same id, since postgres
+// fails to upsert a row twice in one statement.
+func dedupeEvents(events []*common.GithubEvent) []*common.GithubEvent {
+	index := map[int64]int{}
+	result := make([]*common.GithubEvent, 0, len(events))
+	for _, e := range events {
+		if n, exists := index[e.ID]; exists {
+			result[n] = e
+			continue
+		}
+		index[e.ID] = len(result)
+		result = append(result, e)
+	}
+
+	return result
+}
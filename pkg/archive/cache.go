@@ -0,0 +1,330 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/devtools/pkg/common"
+)
+
+// Cache keeps downloaded archive files on disk, so later runs, e.g. filtering
+// another org, do not download them again. Files are stored by the sha256 of
+// their content in objects and referenced by their name in refs. When the
+// cache grows beyond its size limit, the least recently used files are
+// evicted.
+type Cache struct {
+	dir      string
+	maxBytes int64
+	readOnly bool
+	mu       sync.Mutex
+	refs     map[string]string
+	objects  map[string]*cacheObject
+	size     int64
+}
+
+type cacheObject struct {
+	size     int64
+	lastUsed time.Time
+}
+
+// NewCache opens the cache in dir, creating it if it does not exist.
+// maxBytes limits the size of the cached files, 0 meaning no limit.
+func NewCache(dir string, maxBytes int64) (*Cache, error) {
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		refs:     map[string]string{},
+		objects:  map[string]*cacheObject{},
+	}
+
+	for _, d := range []string{c.objectsDir(), c.refsDir(), c.tmpDir()} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// OpenCacheReadOnly opens the cache in dir to only open files from it, e.g.
+// to serve the files of a cache another process is writing to. Unlike
+// NewCache it leaves the files in dir as they are and looks up the refs on
+// disk on every Open, so it sees the files added or evicted by the writing
+// process. Size reports 0 and Create fails.
+func OpenCacheReadOnly(dir string) (*Cache, error) {
+	c := &Cache{dir: dir, readOnly: true}
+
+	if _, err := os.Stat(c.refsDir()); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Cache) objectsDir() string { return filepath.Join(c.dir, "objects") }
+func (c *Cache) refsDir() string    { return filepath.Join(c.dir, "refs") }
+func (c *Cache) tmpDir() string     { return filepath.Join(c.dir, "tmp") }
+
+func (c *Cache) objectPath(sum string) string {
+	return filepath.Join(c.objectsDir(), sum[:2], sum)
+}
+
+// load reads the refs and objects stored by earlier runs, removing objects
+// no ref points to and refs to missing objects.
+func (c *Cache) load() error {
+	err := filepath.Walk(c.objectsDir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		c.objects[info.Name()] = &cacheObject{size: info.Size(), lastUsed: info.ModTime()}
+		c.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	refs, err := ioutil.ReadDir(c.refsDir())
+	if err != nil {
+		return err
+	}
+	referenced := map[string]bool{}
+	for _, ref := range refs {
+		path := filepath.Join(c.refsDir(), ref.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum := strings.TrimSpace(string(data))
+		if _, exists := c.objects[sum]; !exists {
+			os.Remove(path)
+			continue
+		}
+		c.refs[ref.Name()] = sum
+		referenced[sum] = true
+	}
+
+	for sum := range c.objects {
+		if !referenced[sum] {
+			c.removeObject(sum)
+		}
+	}
+
+	// leftovers of writes that were interrupted
+	tmp, err := ioutil.ReadDir(c.tmpDir())
+	if err != nil {
+		return err
+	}
+	for _, f := range tmp {
+		os.Remove(filepath.Join(c.tmpDir(), f.Name()))
+	}
+
+	return c.evict()
+}
+
+// Open opens the cached file name, e.g. 2019-01-01-15.json.gz. Returns an
+// error satisfying os.IsNotExist if the file is not cached.
+func (c *Cache) Open(name string) (*os.File, error) {
+	if c.readOnly {
+		return c.openReadOnly(name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sum, exists := c.refs[name]
+	if !exists {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	path := c.objectPath(sum)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	c.objects[sum].lastUsed = now
+	os.Chtimes(path, now, now)
+
+	return f, nil
+}
+
+// openReadOnly opens the file name through its ref on disk. A file evicted
+// meanwhile is reported as not existing.
+func (c *Cache) openReadOnly(name string) (*os.File, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.refsDir(), filepath.Base(name)))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := strings.TrimSpace(string(data))
+	if len(sum) < 2 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	return os.Open(c.objectPath(sum))
+}
+
+// Size returns the size of the cached files in bytes.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Create returns a writer for the file name, which is added to the cache when
+// committed.
+func (c *Cache) Create(name string) (*CacheWriter, error) {
+	if c.readOnly {
+		return nil, fmt.Errorf("cannot add %s to cache opened read only", name)
+	}
+
+	f, err := ioutil.TempFile(c.tmpDir(), "download")
+	if err != nil {
+		return nil, err
+	}
+
+	return &CacheWriter{cache: c, name: name, f: f, hash: sha256.New()}, nil
+}
+
+func (c *Cache) add(name string, tmpPath string, sum string, size int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.objects[sum]; exists {
+		os.Remove(tmpPath)
+	} else {
+		path := c.objectPath(sum)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			return err
+		}
+		c.objects[sum] = &cacheObject{size: size}
+		c.size += size
+	}
+	c.objects[sum].lastUsed = time.Now()
+
+	if err := ioutil.WriteFile(filepath.Join(c.refsDir(), name), []byte(sum), 0644); err != nil {
+		return err
+	}
+	old, exists := c.refs[name]
+	c.refs[name] = sum
+	if exists && old != sum {
+		c.removeUnreferenced(old)
+	}
+
+	return c.evict()
+}
+
+// evict removes the least recently used objects until the cache fits its
+// size limit.
+func (c *Cache) evict() error {
+	if c.maxBytes <= 0 || c.size <= c.maxBytes {
+		return nil
+	}
+
+	sums := []string{}
+	for sum := range c.objects {
+		sums = append(sums, sum)
+	}
+	sort.Slice(sums, func(i, j int) bool {
+		return c.objects[sums[i]].lastUsed.Before(c.objects[sums[j]].lastUsed)
+	})
+
+	for _, sum := range sums {
+		if c.size <= c.maxBytes {
+			break
+		}
+
+		for name, ref := range c.refs {
+			if ref == sum {
+				delete(c.refs, name)
+				if err := os.Remove(filepath.Join(c.refsDir(), name)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+		c.removeObject(sum)
+	}
+
+	return nil
+}
+
+func (c *Cache) removeUnreferenced(sum string) {
+	for _, ref := range c.refs {
+		if ref == sum {
+			return
+		}
+	}
+	c.removeObject(sum)
+}
+
+func (c *Cache) removeObject(sum string) {
+	if obj, exists := c.objects[sum]; exists {
+		c.size -= obj.size
+		delete(c.objects, sum)
+	}
+	os.Remove(c.objectPath(sum))
+}
+
+// CacheWriter writes a file to the cache. The file is only added by Commit,
+// so files that failed to download are never cached.
+type CacheWriter struct {
+	cache *Cache
+	name  string
+	f     *os.File
+	hash  hash.Hash
+	size  int64
+}
+
+func (w *CacheWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+// Commit adds the written file to the cache.
+func (w *CacheWriter) Commit() error {
+	if err := w.f.Close(); err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+
+	sum := hex.EncodeToString(w.hash.Sum(nil))
+	if err := w.cache.add(w.name, w.f.Name(), sum, w.size); err != nil {
+		os.Remove(w.f.Name())
+		return fmt.Errorf("failed to add %s to cache: %v", w.name, err)
+	}
+
+	return nil
+}
+
+// Abort discards the written file.
+func (w *CacheWriter) Abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// cacheFileName returns the name of the archive file as used by GH Archive,
+// e.g. 2019-01-01-15.json.gz.
+func cacheFileName(file *common.ArchiveFile) string {
+	t := time.Unix(file.ID, 0).UTC()
+	return fmt.Sprintf("%d-%02d-%02d-%d.json.gz", t.Year(), t.Month(), t.Day(), t.Hour())
+}
@@ -0,0 +1,127 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeToCache(t *testing.T, c *Cache, name, content string) {
+	w, err := c.Create(name)
+	if err != nil {
+		t.Fatalf("error creating cache file: %v", err)
+	}
+	w.Write([]byte(content))
+	assert.NoError(t, w.Commit())
+}
+
+func readFromCache(t *testing.T, c *Cache, name string) string {
+	f, err := c.Open(name)
+	if err != nil {
+		t.Fatalf("error opening cache file: %v", err)
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func openCache(t *testing.T, dir string, maxBytes int64) *Cache {
+	c, err := NewCache(dir, maxBytes)
+	if err != nil {
+		t.Fatalf("error opening cache: %v", err)
+	}
+	return c
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive-cache")
+	if err != nil {
+		t.Fatalf("error creating cache dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("stores and opens files", func(t *testing.T) {
+		c := openCache(t, dir, 0)
+
+		writeToCache(t, c, "2019-01-01-0.json.gz", "hour 0")
+		assert.Equal(t, "hour 0", readFromCache(t, c, "2019-01-01-0.json.gz"))
+
+		_, err := c.Open("2019-01-01-1.json.gz")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("stores equal content once", func(t *testing.T) {
+		c := openCache(t, dir, 0)
+
+		writeToCache(t, c, "2019-01-01-1.json.gz", "hour 0")
+		assert.Equal(t, int64(len("hour 0")), c.Size())
+	})
+
+	t.Run("aborted files are not cached", func(t *testing.T) {
+		c := openCache(t, dir, 0)
+
+		w, err := c.Create("2019-01-01-2.json.gz")
+		if err != nil {
+			t.Fatalf("error creating cache file: %v", err)
+		}
+		w.Write([]byte("partial"))
+		w.Abort()
+
+		_, err = c.Open("2019-01-01-2.json.gz")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("evicts the least recently used files", func(t *testing.T) {
+		c := openCache(t, dir, 25)
+
+		writeToCache(t, c, "2019-01-02-0.json.gz", strings.Repeat("a", 10))
+		time.Sleep(10 * time.Millisecond)
+		writeToCache(t, c, "2019-01-02-1.json.gz", strings.Repeat("b", 10))
+		time.Sleep(10 * time.Millisecond)
+		readFromCache(t, c, "2019-01-02-0.json.gz")
+		writeToCache(t, c, "2019-01-02-2.json.gz", strings.Repeat("c", 10))
+
+		assert.Equal(t, int64(20), c.Size())
+		_, err := c.Open("2019-01-02-1.json.gz")
+		assert.True(t, os.IsNotExist(err))
+		assert.Equal(t, strings.Repeat("a", 10), readFromCache(t, c, "2019-01-02-0.json.gz"))
+	})
+
+	t.Run("reopens files of earlier runs", func(t *testing.T) {
+		c := openCache(t, dir, 0)
+
+		assert.Equal(t, int64(20), c.Size())
+		assert.Equal(t, strings.Repeat("c", 10), readFromCache(t, c, "2019-01-02-2.json.gz"))
+	})
+
+	t.Run("read only cache sees files of the writing cache and leaves downloads alone", func(t *testing.T) {
+		c := openCache(t, dir, 25)
+		w, err := c.Create("2019-01-03-0.json.gz")
+		if err != nil {
+			t.Fatalf("error creating cache file: %v", err)
+		}
+		w.Write([]byte("download"))
+
+		readOnly, err := OpenCacheReadOnly(dir)
+		if err != nil {
+			t.Fatalf("error opening cache: %v", err)
+		}
+		_, err = readOnly.Open("2019-01-03-0.json.gz")
+		assert.True(t, os.IsNotExist(err))
+		_, err = readOnly.Create("2019-01-03-1.json.gz")
+		assert.Error(t, err)
+
+		assert.NoError(t, w.Commit())
+		assert.Equal(t, "download", readFromCache(t, readOnly, "2019-01-03-0.json.gz"))
+
+		// evicted by the writing cache
+		_, err = readOnly.Open("2019-01-02-0.json.gz")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
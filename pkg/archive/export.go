@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/xorm"
+	"github.com/grafana/devtools/pkg/common"
+	"github.com/grafana/devtools/pkg/streams/log"
+)
+
+// ArchiveExporter writes stored events to hourly files in the layout of GH
+// Archive, e.g. 2019-01-01-15.json.gz with one event per line, so they can be
+// imported into another database, read by a file:// archive source or served
+// by local-gharchive-server.
+type ArchiveExporter struct {
+	logger log.Logger
+	engine *xorm.Engine
+}
+
+// NewArchiveExporter creates a new exporter
+func NewArchiveExporter(logger log.Logger, engine *xorm.Engine) *ArchiveExporter {
+	return &ArchiveExporter{
+		logger: logger.New("logger", "archive-exporter"),
+		engine: engine,
+	}
+}
+
+// Export writes the files of the hours from from until to into dir. A file is
+// written for every hour with a stored archive file or stored events, so
+// hours without matching events are imported as downloaded too. A zero from
+// starts at the oldest stored event, a zero to ends now. Returns the number
+// of files and events written.
+func (ae *ArchiveExporter) Export(ctx context.Context, dir string, from, to time.Time) (int, int64, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, 0, err
+	}
+
+	if from.IsZero() {
+		months, err := storedMonths(ae.engine)
+		if err != nil || len(months) == 0 {
+			return 0, 0, err
+		}
+		from = months[0]
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	var archFiles []*common.ArchiveFile
+	if err := ae.engine.Where("id >= ? AND id < ?", from.Unix(), to.Unix()).Find(&archFiles); err != nil {
+		return 0, 0, err
+	}
+	stored := map[int64]bool{}
+	for _, f := range archFiles {
+		stored[f.ID] = true
+	}
+
+	files, events := 0, int64(0)
+	start := time.Now()
+	ae.logger.Info("exporting events...", "from", from, "to", to, "dir", dir)
+
+	for hour := from.UTC().Truncate(time.Hour); hour.Before(to); hour = hour.Add(time.Hour) {
+		if err := ctx.Err(); err != nil {
+			return files, events, err
+		}
+
+		var rawEvents []*common.GithubEvent
+		err := ae.engine.Where("created_at >= ? AND created_at < ?", hour, hour.Add(time.Hour)).OrderBy("id").Find(&rawEvents)
+		if err != nil {
+			return files, events, err
+		}
+
+		file := common.NewArchiveFile(hour.Year(), int(hour.Month()), hour.Day(), hour.Hour())
+		if len(rawEvents) == 0 && !stored[file.ID] {
+			continue
+		}
+
+		if err := writeHourFile(filepath.Join(dir, cacheFileName(file)), rawEvents); err != nil {
+			return files, events, err
+		}
+
+		ae.logger.Debug("hour exported", "date", hour, "eventCount", len(rawEvents))
+		files++
+		events += int64(len(rawEvents))
+	}
+
+	ae.logger.Info("events exported", "files", files, "eventCount", events, "took", time.Since(start))
+	return files, events, nil
+}
+
+// writeHourFile writes the json of events to path, gzip compressed. The file
+// is written to a temporary file first, so interrupted exports leave no
+// partial files behind.
+func writeHourFile(path string, events []*common.GithubEvent) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".export")
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(f)
+	for _, e := range events {
+		data, err := eventData(e)
+		if err == nil {
+			_, err = zw.Write(append(data, '\n'))
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+	}
+
+	err = zw.Close()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// ExportedFiles returns the hours of the files in dir named like GH Archive
+// files, e.g. 2019-01-01-15.json.gz or 2019-01-01-15.json, from from until to.
+// Zero times leave the range unbounded.
+func ExportedFiles(dir string, from, to time.Time) ([]*common.ArchiveFile, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[int64]bool{}
+	result := []*common.ArchiveFile{}
+	for _, entry := range entries {
+		file, ok := parseArchiveFileName(entry.Name())
+		if !ok || seen[file.ID] {
+			continue
+		}
+		if (!from.IsZero() && file.ID < from.Unix()) || (!to.IsZero() && file.ID >= to.Unix()) {
+			continue
+		}
+
+		seen[file.ID] = true
+		result = append(result, file)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// parseArchiveFileName returns the hour of a file named like GH Archive files
+func parseArchiveFileName(name string) (*common.ArchiveFile, bool) {
+	base := strings.TrimSuffix(name, ".gz")
+	if !strings.HasSuffix(base, ".json") {
+		return nil, false
+	}
+	base = strings.TrimSuffix(base, ".json")
+
+	var year, month, day, hour int
+	if n, err := fmt.Sscanf(base, "%d-%d-%d-%d", &year, &month, &day, &hour); err != nil || n != 4 {
+		return nil, false
+	}
+
+	// only names GH Archive would use, e.g. not 2019-1-1-15.json
+	file := common.NewArchiveFile(year, month, day, hour)
+	if cacheFileName(file) != base+".json.gz" {
+		return nil, false
+	}
+	return file, true
+}
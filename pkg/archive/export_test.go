@@ -0,0 +1,100 @@
+package archive
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/common"
+	"github.com/grafana/devtools/pkg/streams/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArchiveFileName(t *testing.T) {
+	for name, expected := range map[string]*common.ArchiveFile{
+		"2019-01-01-15.json.gz": common.NewArchiveFile(2019, 1, 1, 15),
+		"2019-01-01-0.json":     common.NewArchiveFile(2019, 1, 1, 0),
+		"2019-1-1-15.json.gz":   nil,
+		"2019-01-01-05.json.gz": nil,
+		"2019-01-01-15.txt":     nil,
+		"index.json":            nil,
+	} {
+		file, ok := parseArchiveFileName(name)
+		assert.Equal(t, expected != nil, ok, name)
+		if expected != nil {
+			assert.Equal(t, expected.ID, file.ID, name)
+		}
+	}
+}
+
+func TestExportAndImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	from, err := InitDatabase("sqlite3", filepath.Join(dir, "from.db"))
+	if err != nil {
+		t.Fatalf("error initialising database: %v", err)
+	}
+
+	ad := &ArchiveDownloader{engine: from, filter: &EventFilter{}}
+	var events []*common.GithubEvent
+	for i, name := range []string{"org pr", "org star", "personal issue"} {
+		if i == 1 {
+			assert.NoError(t, ad.SetStorage(StorageCompressed, "deflate"))
+		}
+		event, err := ad.parseAndFilterEvent(sampleArchiveLines[name])
+		assert.NoError(t, err)
+		events = append(events, event)
+	}
+	assert.NoError(t, ad.saveFileIntoDatabase(common.NewArchiveFile(2019, 1, 1, 10), events))
+	// an hour without matching events
+	assert.NoError(t, ad.saveFileIntoDatabase(common.NewArchiveFile(2019, 1, 1, 11), nil))
+	// an hour outside of the exported range
+	assert.NoError(t, ad.saveFileIntoDatabase(common.NewArchiveFile(2019, 1, 2, 0), nil))
+
+	exportDir := filepath.Join(dir, "export")
+	exporter := NewArchiveExporter(log.New(), from)
+	files, count, err := exporter.Export(context.Background(), exportDir,
+		time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, files)
+	assert.Equal(t, int64(3), count)
+
+	source, err := NewArchiveSource(exportDir)
+	assert.NoError(t, err)
+	content, err := readSource(t, source, common.NewArchiveFile(2019, 1, 1, 10))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{sampleArchiveLines["org pr"], sampleArchiveLines["org star"], sampleArchiveLines["personal issue"]},
+		strings.Split(strings.TrimSpace(content), "\n"))
+	content, err = readSource(t, source, common.NewArchiveFile(2019, 1, 1, 11))
+	assert.NoError(t, err)
+	assert.Equal(t, "", content)
+
+	exported, err := ExportedFiles(exportDir, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, exported, 2)
+
+	to, err := InitDatabase("sqlite3", filepath.Join(dir, "to.db"))
+	if err != nil {
+		t.Fatalf("error initialising database: %v", err)
+	}
+
+	importer := NewArchiveDownloader(to, true, source, &EventFilter{}, time.Time{}, time.Time{}, 2, false, log.New())
+	importer.SetFiles(exported)
+	assert.NoError(t, importer.DownloadEvents(context.Background()))
+
+	eventCount, err := to.Count(&common.GithubEvent{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), eventCount)
+
+	var archFiles []*common.ArchiveFile
+	assert.NoError(t, to.OrderBy("id").Find(&archFiles))
+	assert.Len(t, archFiles, 2)
+}
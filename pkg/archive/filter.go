@@ -0,0 +1,116 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/grafana/devtools/pkg/common"
+)
+
+// FilterList includes and excludes values by glob patterns, e.g.
+// grafana/*-datasource for repos. Patterns are matched with path.Match.
+type FilterList struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// EventFilter selects the events stored in the archive database.
+//
+// An event is stored if its org or its repo is included, and its actor and
+// its type are included, and none of them is excluded. Empty include lists
+// include everything, except that orgs and repos are only included by
+// everything when both are empty, so repos of personal accounts can be
+// added to orgs.
+type EventFilter struct {
+	Orgs   FilterList `json:"orgs"`
+	Repos  FilterList `json:"repos"`
+	Actors FilterList `json:"actors"`
+	Types  FilterList `json:"types"`
+}
+
+// NewOrgFilter creates a filter storing the events of orgs
+func NewOrgFilter(orgs ...string) *EventFilter {
+	return &EventFilter{Orgs: FilterList{Include: orgs}}
+}
+
+// LoadEventFilter reads a filter from a json file, e.g.
+//
+//	{"orgs": {"include": ["grafana"]}, "types": {"exclude": ["WatchEvent"]}}
+func LoadEventFilter(path string) (*EventFilter, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &EventFilter{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("failed to parse filter %s: %v", path, err)
+	}
+
+	return f, f.Validate()
+}
+
+// Validate returns an error for invalid patterns
+func (f *EventFilter) Validate() error {
+	for _, list := range []FilterList{f.Orgs, f.Repos, f.Actors, f.Types} {
+		for _, pattern := range append(append([]string{}, list.Include...), list.Exclude...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid filter pattern %q: %v", pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Match returns whether the event is stored
+func (f *EventFilter) Match(e *common.GithubEventJSON) bool {
+	org, repo, actor := "", "", ""
+	if e.Org != nil {
+		org = e.Org.Login
+	}
+	if e.Repo != nil {
+		repo = e.Repo.Name
+	}
+	if e.Actor != nil {
+		actor = e.Actor.Login
+	}
+
+	if f.Orgs.excludes(org) || f.Repos.excludes(repo) || f.Actors.excludes(actor) || f.Types.excludes(e.Type) {
+		return false
+	}
+
+	if len(f.Orgs.Include) > 0 || len(f.Repos.Include) > 0 {
+		if !matchAny(f.Orgs.Include, org) && !matchAny(f.Repos.Include, repo) {
+			return false
+		}
+	}
+
+	return f.Actors.includes(actor) && f.Types.includes(e.Type)
+}
+
+func (l FilterList) includes(value string) bool {
+	return len(l.Include) == 0 || matchAny(l.Include, value)
+}
+
+func (l FilterList) excludes(value string) bool {
+	return matchAny(l.Exclude, value)
+}
+
+// matchAny returns whether value matches one of patterns. Empty values, e.g.
+// the org of events of personal repos, match no pattern.
+func matchAny(patterns []string, value string) bool {
+	if value == "" {
+		return false
+	}
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+
+	return false
+}
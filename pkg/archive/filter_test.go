@@ -0,0 +1,123 @@
+package archive
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/devtools/pkg/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var sampleArchiveLines = map[string]string{
+	"org pr":         `{"id":"1","type":"PullRequestEvent","actor":{"id":1,"login":"alice"},"repo":{"id":1,"name":"grafana/grafana"},"org":{"id":1,"login":"grafana"},"created_at":"2019-01-01T10:00:00Z"}`,
+	"org star":       `{"id":"2","type":"WatchEvent","actor":{"id":2,"login":"bob"},"repo":{"id":1,"name":"grafana/grafana"},"org":{"id":1,"login":"grafana"},"created_at":"2019-01-01T10:00:00Z"}`,
+	"org bot push":   `{"id":"3","type":"PushEvent","actor":{"id":3,"login":"dependabot[bot]"},"repo":{"id":2,"name":"grafana/loki"},"org":{"id":1,"login":"grafana"},"created_at":"2019-01-01T10:00:00Z"}`,
+	"personal issue": `{"id":"4","type":"IssuesEvent","actor":{"id":1,"login":"alice"},"repo":{"id":3,"name":"alice/clock-panel"},"created_at":"2019-01-01T10:00:00Z"}`,
+	"other org pr":   `{"id":"5","type":"PullRequestEvent","actor":{"id":1,"login":"alice"},"repo":{"id":4,"name":"prometheus/prometheus"},"org":{"id":2,"login":"prometheus"},"created_at":"2019-01-01T10:00:00Z"}`,
+}
+
+func matchingSamples(t *testing.T, filter *EventFilter) []string {
+	result := []string{}
+	for _, name := range []string{"org pr", "org star", "org bot push", "personal issue", "other org pr"} {
+		var ge common.GithubEventJSON
+		if err := json.Unmarshal([]byte(sampleArchiveLines[name]), &ge); err != nil {
+			t.Fatalf("error parsing sample %s: %v", name, err)
+		}
+		if filter.Match(&ge) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func TestEventFilter(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		filter   *EventFilter
+		expected []string
+	}{
+		{
+			desc:     "org filter",
+			filter:   NewOrgFilter("grafana"),
+			expected: []string{"org pr", "org star", "org bot push"},
+		},
+		{
+			desc:     "empty filter matches all events",
+			filter:   &EventFilter{},
+			expected: []string{"org pr", "org star", "org bot push", "personal issue", "other org pr"},
+		},
+		{
+			desc: "repos are added to orgs",
+			filter: &EventFilter{
+				Orgs:  FilterList{Include: []string{"grafana"}},
+				Repos: FilterList{Include: []string{"*/*-panel"}},
+			},
+			expected: []string{"org pr", "org star", "org bot push", "personal issue"},
+		},
+		{
+			desc: "excluded repos",
+			filter: &EventFilter{
+				Orgs:  FilterList{Include: []string{"grafana"}},
+				Repos: FilterList{Exclude: []string{"grafana/loki"}},
+			},
+			expected: []string{"org pr", "org star"},
+		},
+		{
+			desc: "excluded actors and event types",
+			filter: &EventFilter{
+				Orgs:   FilterList{Include: []string{"grafana"}},
+				Actors: FilterList{Exclude: []string{"*\\[bot\\]"}},
+				Types:  FilterList{Exclude: []string{"WatchEvent"}},
+			},
+			expected: []string{"org pr"},
+		},
+		{
+			desc: "included actors and event types",
+			filter: &EventFilter{
+				Actors: FilterList{Include: []string{"alice"}},
+				Types:  FilterList{Include: []string{"PullRequestEvent", "IssuesEvent"}},
+			},
+			expected: []string{"org pr", "personal issue", "other org pr"},
+		},
+		{
+			desc:     "excluded orgs",
+			filter:   &EventFilter{Orgs: FilterList{Exclude: []string{"prom*"}}},
+			expected: []string{"org pr", "org star", "org bot push", "personal issue"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.NoError(t, tc.filter.Validate())
+			assert.Equal(t, tc.expected, matchingSamples(t, tc.filter))
+		})
+	}
+}
+
+func TestLoadEventFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "event-filter")
+	if err != nil {
+		t.Fatalf("error creating dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("valid filter", func(t *testing.T) {
+		path := filepath.Join(dir, "filter.json")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(`{"orgs": {"include": ["grafana"]}, "types": {"exclude": ["WatchEvent"]}}`), 0644))
+
+		filter, err := LoadEventFilter(path)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"org pr", "org bot push"}, matchingSamples(t, filter))
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.json")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(`{"repos": {"include": ["grafana/["]}}`), 0644))
+
+		_, err := LoadEventFilter(path)
+		assert.Error(t, err)
+	})
+}
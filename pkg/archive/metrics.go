@@ -0,0 +1,44 @@
+package archive
+
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/grafana/devtools/pkg/streams/metrics"
+)
+
+var (
+	downloadedBytes = metrics.NewCounterVec(
+		"devtools_archive_download_bytes_total",
+		"Number of compressed bytes downloaded from the github archive.")
+	downloadedFiles = metrics.NewCounterVec(
+		"devtools_archive_downloaded_files_total",
+		"Number of archive hour files processed, by status ok or error.",
+		"status")
+	downloadDuration = metrics.NewHistogramVec(
+		"devtools_archive_download_duration_seconds",
+		"Time it takes to download, filter and store an archive hour file.",
+		metrics.DefBuckets)
+	storedEvents = metrics.NewCounterVec(
+		"devtools_archive_stored_events_total",
+		"Number of events matching the org filter stored in the archive database.")
+)
+
+// countingReader counts the bytes read from r in counter and total, if they
+// are set.
+type countingReader struct {
+	r       io.Reader
+	counter *metrics.Counter
+	total   *int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if cr.counter != nil {
+		cr.counter.Add(float64(n))
+	}
+	if cr.total != nil {
+		atomic.AddInt64(cr.total, int64(n))
+	}
+	return n, err
+}
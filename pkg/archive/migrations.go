@@ -8,18 +8,50 @@ import (
 
 type RawSQLMigration struct {
 	migrator.MigrationBase
-	sql string
+	sql    string
+	sqlite string
 }
 
 func NewRawSQLMigration(sql string) *RawSQLMigration {
 	return &RawSQLMigration{sql: sql}
 }
 
+// Sqlite sets the sql run on sqlite instead, e.g. since sqlite can't alter
+// constraints of tables.
+func (m *RawSQLMigration) Sqlite(sql string) *RawSQLMigration {
+	m.sqlite = sql
+	return m
+}
+
 func (m *RawSQLMigration) Sql(dialect migrator.Dialect) string {
+	if m.sqlite != "" && dialect.DriverName() == migrator.SQLITE {
+		return m.sqlite
+	}
 	return m.sql
 }
 
-func InitDatabase(dbType string, connectionString string) (*xorm.Engine, error) {
+// DatabaseOption changes how InitDatabase sets up the archive database
+type DatabaseOption func(*databaseOptions)
+
+type databaseOptions struct {
+	partitionByMonth bool
+}
+
+// PartitionByMonth partitions the github_event table by month, natively on
+// postgres and by range on mysql. Existing events are moved into the
+// partitions of their months.
+func PartitionByMonth() DatabaseOption {
+	return func(o *databaseOptions) {
+		o.partitionByMonth = true
+	}
+}
+
+func InitDatabase(dbType string, connectionString string, options ...DatabaseOption) (*xorm.Engine, error) {
+	var opts databaseOptions
+	for _, o := range options {
+		o(&opts)
+	}
+
 	x, err := xorm.NewEngine(dbType, connectionString)
 	x.SetColumnMapper(core.GonicMapper{})
 	if err != nil {
@@ -63,9 +95,49 @@ func InitDatabase(dbType string, connectionString string) (*xorm.Engine, error)
 
 	mig.AddMigration("create github event table", migrator.NewAddTableMigration(githubEvent))
 
-	githubEventPkey := NewRawSQLMigration("ALTER TABLE github_event ADD PRIMARY KEY (id)")
+	githubEventPkey := NewRawSQLMigration("ALTER TABLE github_event ADD PRIMARY KEY (id)").
+		Sqlite("CREATE UNIQUE INDEX IF NOT EXISTS UQE_github_event_id ON github_event (id)")
 
 	mig.AddMigration("add primary key to github event table", githubEventPkey)
 
-	return x, mig.Start()
+	for _, col := range []*migrator.Column{
+		{Name: "event_type", Type: migrator.DB_NVarchar, Length: 64, Nullable: true},
+		{Name: "repo_name", Type: migrator.DB_NVarchar, Length: 255, Nullable: true},
+		{Name: "actor_login", Type: migrator.DB_NVarchar, Length: 255, Nullable: true},
+		{Name: "event_action", Type: migrator.DB_NVarchar, Length: 64, Nullable: true},
+		{Name: "payload", Type: migrator.DB_MediumBlob, Nullable: true},
+	} {
+		mig.AddMigration("add "+col.Name+" column to github event table", migrator.NewAddColumnMigration(githubEvent, col))
+	}
+
+	mig.AddMigration("add event type index to github event table", migrator.NewAddIndexMigration(githubEvent, &migrator.Index{
+		Cols: []string{"event_type"},
+	}))
+
+	mig.AddMigration("add created at index to github event table", migrator.NewAddIndexMigration(githubEvent, &migrator.Index{
+		Cols: []string{"created_at"},
+	}))
+
+	failedArchiveFile := migrator.Table{
+		Name: "failed_archive_file",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true},
+			{Name: "created_at", Type: migrator.DB_DateTime},
+			{Name: "reason", Type: migrator.DB_Text},
+			{Name: "attempts", Type: migrator.DB_Int},
+			{Name: "last_attempt_at", Type: migrator.DB_DateTime},
+		},
+	}
+
+	mig.AddMigration("create failed archive file table", migrator.NewAddTableMigration(failedArchiveFile))
+
+	if err := mig.Start(); err != nil {
+		return x, err
+	}
+
+	if opts.partitionByMonth {
+		return x, partitionGithubEvent(x)
+	}
+
+	return x, nil
 }
@@ -0,0 +1,345 @@
+package archive
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-xorm/core"
+	"github.com/go-xorm/xorm"
+	"github.com/grafana/devtools/pkg/common"
+)
+
+const (
+	partitionMonthFormat = "200601"
+	partitionTimeFormat  = "2006-01-02 15:04:05"
+	// mysqlMaxPartition holds the events newer than the last monthly
+	// partition on mysql
+	mysqlMaxPartition = "p_max"
+)
+
+// Partition is a partition of the github_event table
+type Partition struct {
+	Name string
+	// From and To are the range of created_at of the events in the partition,
+	// To being exclusive. A zero time means the range is unbounded, e.g. for
+	// the first and last partition on mysql.
+	From time.Time
+	To   time.Time
+}
+
+func (p Partition) overlaps(from, to time.Time) bool {
+	return (to.IsZero() || p.From.IsZero() || p.From.Before(to)) &&
+		(from.IsZero() || p.To.IsZero() || p.To.After(from))
+}
+
+// Partitions manages the monthly partitions of the github_event table. On
+// postgres every month is a partition of a declaratively partitioned table,
+// and events of months without partition fail to be stored. On mysql the
+// table is partitioned by range, with the last partition holding the events
+// newer than the last month.
+type Partitions struct {
+	engine *xorm.Engine
+	dbType core.DbType
+	mu     sync.Mutex
+	// names of the partitions known to exist
+	created map[string]bool
+}
+
+// NewPartitions creates the manager of the partitions of the github_event
+// table stored in engine
+func NewPartitions(engine *xorm.Engine) *Partitions {
+	return &Partitions{
+		engine:  engine,
+		dbType:  engine.Dialect().DBType(),
+		created: map[string]bool{},
+	}
+}
+
+// Enabled returns whether the github_event table is partitioned
+func (p *Partitions) Enabled() (bool, error) {
+	switch p.dbType {
+	case core.POSTGRES:
+		rows, err := p.engine.QueryString(
+			"SELECT c.relname FROM pg_partitioned_table pt JOIN pg_class c ON c.oid = pt.partrelid WHERE c.relname = 'github_event'")
+		return len(rows) > 0, err
+	case core.MYSQL:
+		partitions, err := p.List()
+		return len(partitions) > 0, err
+	}
+
+	return false, nil
+}
+
+// List returns the partitions ordered by their range
+func (p *Partitions) List() ([]Partition, error) {
+	var result []Partition
+
+	switch p.dbType {
+	case core.POSTGRES:
+		rows, err := p.engine.QueryString(`SELECT c.relname AS name FROM pg_inherits i
+			JOIN pg_class c ON c.oid = i.inhrelid
+			JOIN pg_class t ON t.oid = i.inhparent
+			WHERE t.relname = 'github_event'`)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			month, err := time.Parse(partitionMonthFormat, strings.TrimPrefix(row["name"], "github_event_p"))
+			if err != nil {
+				return nil, fmt.Errorf("unexpected partition %s of github_event", row["name"])
+			}
+			result = append(result, Partition{Name: row["name"], From: month, To: month.AddDate(0, 1, 0)})
+		}
+
+		sort.Slice(result, func(i, j int) bool { return result[i].From.Before(result[j].From) })
+	case core.MYSQL:
+		rows, err := p.engine.QueryString(`SELECT PARTITION_NAME AS name, PARTITION_DESCRIPTION AS description
+			FROM information_schema.PARTITIONS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'github_event' AND PARTITION_NAME IS NOT NULL
+			ORDER BY PARTITION_ORDINAL_POSITION`)
+		if err != nil {
+			return nil, err
+		}
+
+		var from time.Time
+		for _, row := range rows {
+			partition := Partition{Name: row["name"], From: from}
+			if description := strings.Trim(row["description"], "'"); description != "MAXVALUE" {
+				if partition.To, err = time.Parse(partitionTimeFormat, description); err != nil {
+					return nil, fmt.Errorf("unexpected range of partition %s of github_event: %s", row["name"], row["description"])
+				}
+			}
+			result = append(result, partition)
+			from = partition.To
+		}
+	}
+
+	return result, nil
+}
+
+// EnsureRange creates the partitions of the months from and to are in, and
+// the months between
+func (p *Partitions) EnsureRange(from, to time.Time) error {
+	for month := monthStart(from); !month.After(to); month = month.AddDate(0, 1, 0) {
+		if err := p.Ensure(month); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ensure creates the partition of the month t is in, if it does not exist
+func (p *Partitions) Ensure(t time.Time) error {
+	month := monthStart(t)
+	name := partitionName(p.dbType, month)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.created[name] {
+		return nil
+	}
+
+	switch p.dbType {
+	case core.POSTGRES:
+		if _, err := p.engine.Exec(createPartitionSQL(month)); err != nil {
+			return err
+		}
+	case core.MYSQL:
+		partitions, err := p.List()
+		if err != nil {
+			return err
+		}
+		if sql := reorganizePartitionSQL(partitions, month); sql != "" {
+			if _, err := p.engine.Exec(sql); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("monthly partitions are not supported on %s", p.dbType)
+	}
+
+	p.created[name] = true
+	return nil
+}
+
+// Drop removes the partition and its events
+func (p *Partitions) Drop(partition Partition) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	switch p.dbType {
+	case core.POSTGRES:
+		_, err = p.engine.Exec("DROP TABLE " + partition.Name)
+	case core.MYSQL:
+		_, err = p.engine.Exec("ALTER TABLE github_event DROP PARTITION " + partition.Name)
+	default:
+		err = fmt.Errorf("monthly partitions are not supported on %s", p.dbType)
+	}
+
+	delete(p.created, partition.Name)
+	return err
+}
+
+// PartitionsBefore returns the partitions with events older than cutoff only
+func PartitionsBefore(partitions []Partition, cutoff time.Time) []Partition {
+	var result []Partition
+	for _, p := range partitions {
+		if !p.To.IsZero() && !p.To.After(cutoff) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// RetentionCutoff returns the start of the oldest month kept when keeping the
+// month of now and the months before it
+func RetentionCutoff(now time.Time, months int) time.Time {
+	return monthStart(now).AddDate(0, -months, 0)
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(dbType core.DbType, month time.Time) string {
+	if dbType == core.POSTGRES {
+		return "github_event_p" + month.Format(partitionMonthFormat)
+	}
+	return "p" + month.Format(partitionMonthFormat)
+}
+
+func createPartitionSQL(month time.Time) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF github_event FOR VALUES FROM ('%s') TO ('%s')",
+		partitionName(core.POSTGRES, month), month.Format(partitionTimeFormat), month.AddDate(0, 1, 0).Format(partitionTimeFormat))
+}
+
+// reorganizePartitionSQL splits the month off the mysql partition holding
+// it. Events older than the month stay in the new partition, since the
+// ranges of mysql partitions only have an upper bound. Returns an empty
+// string if the month has its partition.
+func reorganizePartitionSQL(partitions []Partition, month time.Time) string {
+	name := partitionName(core.MYSQL, month)
+	end := month.AddDate(0, 1, 0)
+
+	for _, p := range partitions {
+		if p.Name == name {
+			return ""
+		}
+		if p.To.IsZero() || p.To.After(month) {
+			to := "MAXVALUE"
+			if !p.To.IsZero() {
+				to = "'" + p.To.Format(partitionTimeFormat) + "'"
+			}
+			return fmt.Sprintf("ALTER TABLE github_event REORGANIZE PARTITION %s INTO (PARTITION %s VALUES LESS THAN ('%s'), PARTITION %s VALUES LESS THAN (%s))",
+				p.Name, name, end.Format(partitionTimeFormat), p.Name, to)
+		}
+	}
+
+	return ""
+}
+
+// partitionTableSQL returns the statements partitioning the github_event
+// table by month, moving its events into the partitions of months.
+func partitionTableSQL(dbType core.DbType, months []time.Time) ([]string, error) {
+	switch dbType {
+	case core.POSTGRES:
+		// the primary key of a partitioned table has to include the partition
+		// key, and index names are unique per schema, so both are added once
+		// the unpartitioned table is dropped
+		statements := []string{
+			"ALTER TABLE github_event RENAME TO github_event_unpartitioned",
+			"CREATE TABLE github_event (LIKE github_event_unpartitioned INCLUDING DEFAULTS) PARTITION BY RANGE (created_at)",
+		}
+		for _, month := range months {
+			statements = append(statements, createPartitionSQL(month))
+		}
+		return append(statements,
+			"INSERT INTO github_event SELECT * FROM github_event_unpartitioned",
+			"DROP TABLE github_event_unpartitioned",
+			"ALTER TABLE github_event ADD PRIMARY KEY (id, created_at)",
+			`CREATE INDEX "IDX_github_event_event_type" ON github_event (event_type)`,
+			`CREATE INDEX "IDX_github_event_created_at" ON github_event (created_at)`,
+		), nil
+	case core.MYSQL:
+		partitions := []string{}
+		for _, month := range months {
+			partitions = append(partitions, fmt.Sprintf("PARTITION %s VALUES LESS THAN ('%s')",
+				partitionName(core.MYSQL, month), month.AddDate(0, 1, 0).Format(partitionTimeFormat)))
+		}
+		partitions = append(partitions, "PARTITION "+mysqlMaxPartition+" VALUES LESS THAN (MAXVALUE)")
+
+		return []string{
+			"ALTER TABLE github_event DROP PRIMARY KEY, ADD PRIMARY KEY (id, created_at)",
+			"ALTER TABLE github_event PARTITION BY RANGE COLUMNS(created_at) (" + strings.Join(partitions, ", ") + ")",
+		}, nil
+	}
+
+	return nil, fmt.Errorf("monthly partitions are not supported on %s", dbType)
+}
+
+// partitionGithubEvent partitions the github_event table by month, unless it
+// is partitioned already
+func partitionGithubEvent(engine *xorm.Engine) error {
+	p := NewPartitions(engine)
+	dbType := engine.Dialect().DBType()
+	if dbType != core.POSTGRES && dbType != core.MYSQL {
+		return fmt.Errorf("monthly partitions are not supported on %s", dbType)
+	}
+
+	enabled, err := p.Enabled()
+	if err != nil || enabled {
+		return err
+	}
+
+	months, err := storedMonths(engine)
+	if err != nil {
+		return err
+	}
+
+	statements, err := partitionTableSQL(dbType, months)
+	if err != nil {
+		return err
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+
+	// postgres runs the statements in one transaction, mysql commits every
+	// statement altering a table implicitly
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	for _, sql := range statements {
+		if _, err := session.Exec(sql); err != nil {
+			return fmt.Errorf("failed to partition github_event: %v", err)
+		}
+	}
+
+	return session.Commit()
+}
+
+// storedMonths returns the months from the oldest to the newest stored event
+func storedMonths(engine *xorm.Engine) ([]time.Time, error) {
+	var oldest, newest []*common.GithubEvent
+	if err := engine.Cols("created_at").OrderBy("created_at").Limit(1).Find(&oldest); err != nil {
+		return nil, err
+	}
+	if err := engine.Cols("created_at").OrderBy("created_at DESC").Limit(1).Find(&newest); err != nil {
+		return nil, err
+	}
+	if len(oldest) == 0 {
+		return nil, nil
+	}
+
+	var months []time.Time
+	for month := monthStart(oldest[0].CreatedAt); !month.After(newest[0].CreatedAt); month = month.AddDate(0, 1, 0) {
+		months = append(months, month)
+	}
+	return months, nil
+}
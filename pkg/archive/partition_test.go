@@ -0,0 +1,137 @@
+package archive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-xorm/core"
+	"github.com/grafana/devtools/pkg/common"
+	"github.com/grafana/devtools/pkg/ghevents"
+	"github.com/grafana/devtools/pkg/streams/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestPartitionTableSQL(t *testing.T) {
+	months := []time.Time{month(2018, 12), month(2019, 1)}
+
+	statements, err := partitionTableSQL(core.POSTGRES, months)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"ALTER TABLE github_event RENAME TO github_event_unpartitioned",
+		"CREATE TABLE github_event (LIKE github_event_unpartitioned INCLUDING DEFAULTS) PARTITION BY RANGE (created_at)",
+		"CREATE TABLE IF NOT EXISTS github_event_p201812 PARTITION OF github_event FOR VALUES FROM ('2018-12-01 00:00:00') TO ('2019-01-01 00:00:00')",
+		"CREATE TABLE IF NOT EXISTS github_event_p201901 PARTITION OF github_event FOR VALUES FROM ('2019-01-01 00:00:00') TO ('2019-02-01 00:00:00')",
+		"INSERT INTO github_event SELECT * FROM github_event_unpartitioned",
+		"DROP TABLE github_event_unpartitioned",
+		"ALTER TABLE github_event ADD PRIMARY KEY (id, created_at)",
+		`CREATE INDEX "IDX_github_event_event_type" ON github_event (event_type)`,
+		`CREATE INDEX "IDX_github_event_created_at" ON github_event (created_at)`,
+	}, statements)
+
+	statements, err = partitionTableSQL(core.MYSQL, months)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"ALTER TABLE github_event DROP PRIMARY KEY, ADD PRIMARY KEY (id, created_at)",
+		"ALTER TABLE github_event PARTITION BY RANGE COLUMNS(created_at) (" +
+			"PARTITION p201812 VALUES LESS THAN ('2019-01-01 00:00:00'), " +
+			"PARTITION p201901 VALUES LESS THAN ('2019-02-01 00:00:00'), " +
+			"PARTITION p_max VALUES LESS THAN (MAXVALUE))",
+	}, statements)
+
+	_, err = partitionTableSQL(core.SQLITE, months)
+	assert.Error(t, err)
+}
+
+func TestReorganizePartitionSQL(t *testing.T) {
+	partitions := []Partition{
+		{Name: "p201812", To: month(2019, 1)},
+		{Name: "p201901", From: month(2019, 1), To: month(2019, 2)},
+		{Name: "p_max", From: month(2019, 2)},
+	}
+
+	assert.Equal(t, "", reorganizePartitionSQL(partitions, month(2019, 1)))
+	assert.Equal(t,
+		"ALTER TABLE github_event REORGANIZE PARTITION p_max INTO (PARTITION p201903 VALUES LESS THAN ('2019-04-01 00:00:00'), PARTITION p_max VALUES LESS THAN (MAXVALUE))",
+		reorganizePartitionSQL(partitions, month(2019, 3)))
+	assert.Equal(t,
+		"ALTER TABLE github_event REORGANIZE PARTITION p201812 INTO (PARTITION p201811 VALUES LESS THAN ('2018-12-01 00:00:00'), PARTITION p201812 VALUES LESS THAN ('2019-01-01 00:00:00'))",
+		reorganizePartitionSQL(partitions, month(2018, 11)))
+}
+
+func TestRetention(t *testing.T) {
+	now := time.Date(2019, 4, 15, 10, 0, 0, 0, time.UTC)
+	cutoff := RetentionCutoff(now, 2)
+	assert.Equal(t, month(2019, 2), cutoff)
+
+	partitions := []Partition{
+		{Name: "p201812", To: month(2019, 1)},
+		{Name: "p201901", From: month(2019, 1), To: month(2019, 2)},
+		{Name: "p201902", From: month(2019, 2), To: month(2019, 3)},
+		{Name: "p_max", From: month(2019, 3)},
+	}
+
+	names := []string{}
+	for _, p := range PartitionsBefore(partitions, cutoff) {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"p201812", "p201901"}, names)
+
+	assert.True(t, partitions[0].overlaps(time.Time{}, month(2019, 1)))
+	assert.False(t, partitions[0].overlaps(month(2019, 1), time.Time{}))
+	assert.True(t, partitions[3].overlaps(month(2019, 5), month(2019, 6)))
+	assert.False(t, partitions[2].overlaps(month(2019, 3), month(2019, 6)))
+}
+
+func TestPartitionsOnSqlite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "partitions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = InitDatabase("sqlite3", filepath.Join(dir, "partitioned.db"), PartitionByMonth())
+	assert.Error(t, err)
+
+	engine, err := InitDatabase("sqlite3", filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatalf("error initialising database: %v", err)
+	}
+
+	partitions := NewPartitions(engine)
+	enabled, err := partitions.Enabled()
+	assert.NoError(t, err)
+	assert.False(t, enabled)
+	assert.Error(t, partitions.Ensure(month(2019, 1)))
+
+	ad := &ArchiveDownloader{engine: engine}
+	events := []*common.GithubEvent{}
+	for i, createdAt := range []time.Time{month(2018, 12), month(2019, 1), month(2019, 1).Add(time.Hour), month(2019, 2)} {
+		events = append(events, &common.GithubEvent{
+			ID:        int64(i + 1),
+			CreatedAt: createdAt,
+			Data:      fmt.Sprintf(`{"id":"%d","type":"PushEvent"}`, i+1),
+		})
+	}
+	assert.NoError(t, ad.saveFileIntoDatabase(common.NewArchiveFile(2019, 1, 1, 0), events))
+
+	// unpartitioned tables are read with the time range in one query
+	reader := NewArchiveReader(log.New(), engine, 1)
+	reader.SetTimeRange(month(2019, 1), month(2019, 2))
+	read, errs := reader.ReadAllEvents()
+	ids := []string{}
+	for e := range read {
+		ids = append(ids, e.(*ghevents.Event).ID)
+	}
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"2", "3"}, ids)
+}
@@ -0,0 +1,162 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultProgressInterval is how often the progress of downloads is
+	// logged.
+	DefaultProgressInterval = 30 * time.Second
+	// DefaultDrainTimeout is how long files being downloaded when the
+	// deadline is reached may take to finish.
+	DefaultDrainTimeout = 30 * time.Second
+)
+
+// Progress is a snapshot of the progress of DownloadEvents
+type Progress struct {
+	StartedAt      time.Time `json:"startedAt"`
+	TotalFiles     int64     `json:"totalFiles"`
+	CompletedFiles int64     `json:"completedFiles"`
+	FailedFiles    int64     `json:"failedFiles"`
+	RemainingFiles int64     `json:"remainingFiles"`
+	InFlightFiles  int64     `json:"inFlightFiles"`
+	Bytes          int64     `json:"bytes"`
+	Events         int64     `json:"events"`
+	// Draining is set once the deadline is reached and only the files in
+	// flight are finished
+	Draining bool          `json:"draining"`
+	Elapsed  time.Duration `json:"-"`
+	// ETA estimates the time until all files are processed from the time
+	// the processed files took, 0 until the first file is processed
+	ETA time.Duration `json:"-"`
+}
+
+// MarshalJSON writes the durations in seconds
+func (p Progress) MarshalJSON() ([]byte, error) {
+	type progress Progress
+	return json.Marshal(struct {
+		progress
+		ElapsedSeconds float64 `json:"elapsedSeconds"`
+		ETASeconds     float64 `json:"etaSeconds"`
+	}{progress(p), p.Elapsed.Seconds(), p.ETA.Seconds()})
+}
+
+// downloadProgress counts the files and bytes of DownloadEvents, updated by
+// the workers
+type downloadProgress struct {
+	// unix nanoseconds, 0 before the first DownloadEvents
+	startedAt int64
+	total     int64
+	completed int64
+	failed    int64
+	inFlight  int64
+	bytes     int64
+	draining  int32
+}
+
+// start resets the progress for DownloadEvents downloading total files
+func (p *downloadProgress) start(total int) {
+	for _, counter := range []*int64{&p.completed, &p.failed, &p.inFlight, &p.bytes} {
+		atomic.StoreInt64(counter, 0)
+	}
+	atomic.StoreInt32(&p.draining, 0)
+	atomic.StoreInt64(&p.total, int64(total))
+	atomic.StoreInt64(&p.startedAt, time.Now().UnixNano())
+}
+
+// Progress returns the progress of the running or last DownloadEvents
+func (ad *ArchiveDownloader) Progress() Progress {
+	p := &ad.progress
+	progress := Progress{
+		TotalFiles:     atomic.LoadInt64(&p.total),
+		CompletedFiles: atomic.LoadInt64(&p.completed),
+		FailedFiles:    atomic.LoadInt64(&p.failed),
+		InFlightFiles:  atomic.LoadInt64(&p.inFlight),
+		Bytes:          atomic.LoadInt64(&p.bytes),
+		Events:         atomic.LoadInt64(&ad.eventCount),
+		Draining:       atomic.LoadInt32(&p.draining) == 1,
+	}
+	startedAt := atomic.LoadInt64(&p.startedAt)
+	if startedAt == 0 {
+		return progress
+	}
+	progress.StartedAt = time.Unix(0, startedAt)
+
+	processed := progress.CompletedFiles + progress.FailedFiles
+	progress.RemainingFiles = progress.TotalFiles - processed
+	progress.Elapsed = time.Since(progress.StartedAt)
+	if processed > 0 {
+		progress.ETA = progress.Elapsed / time.Duration(processed) * time.Duration(progress.RemainingFiles)
+	}
+
+	return progress
+}
+
+// StatusHandler serves the progress of downloads as json
+func (ad *ArchiveDownloader) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ad.Progress())
+	})
+}
+
+// logProgress logs the progress every interval until done is closed
+func (ad *ArchiveDownloader) logProgress(interval time.Duration, done <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p := ad.Progress()
+			ad.logger.Info("download progress",
+				"completed", p.CompletedFiles, "failed", p.FailedFiles, "remaining", p.RemainingFiles, "total", p.TotalFiles,
+				"bytes", p.Bytes, "eventCount", p.Events, "elapsed", p.Elapsed.Round(time.Second), "eta", p.ETA.Round(time.Second))
+		case <-done:
+			return
+		}
+	}
+}
+
+// drain cancels work once ctx is done and the files in flight did not finish
+// within the drain timeout, or when done is closed.
+func (ad *ArchiveDownloader) drain(ctx context.Context, cancelWork context.CancelFunc, done <-chan struct{}) {
+	defer cancelWork()
+
+	select {
+	case <-ctx.Done():
+	case <-done:
+		return
+	}
+
+	atomic.StoreInt32(&ad.progress.draining, 1)
+	ad.logger.Info("deadline reached, finishing files in flight",
+		"inFlight", atomic.LoadInt64(&ad.progress.inFlight), "drainTimeout", ad.drainTimeout)
+
+	select {
+	case <-time.After(ad.drainTimeout):
+		ad.logger.Warn("files in flight did not finish within the drain timeout, cancelling them",
+			"inFlight", atomic.LoadInt64(&ad.progress.inFlight))
+	case <-done:
+	}
+}
+
+// detachedContext keeps the values of a context, e.g. its tracing span,
+// without being cancelled with it
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,105 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/common"
+	"github.com/grafana/devtools/pkg/streams/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgress(t *testing.T) {
+	ad := &ArchiveDownloader{}
+	assert.Equal(t, Progress{}, ad.Progress())
+
+	ad.progress.start(10)
+	atomic.StoreInt64(&ad.progress.startedAt, time.Now().Add(-4*time.Minute).UnixNano())
+	atomic.StoreInt64(&ad.progress.completed, 3)
+	atomic.StoreInt64(&ad.progress.failed, 1)
+	atomic.StoreInt64(&ad.progress.bytes, 1024)
+	atomic.StoreInt64(&ad.eventCount, 42)
+
+	p := ad.Progress()
+	assert.Equal(t, int64(6), p.RemainingFiles)
+	assert.Equal(t, int64(1024), p.Bytes)
+	assert.Equal(t, int64(42), p.Events)
+	// 4 files took 4 minutes, so the 6 remaining files take 6 minutes
+	assert.InDelta(t, (6 * time.Minute).Seconds(), p.ETA.Seconds(), 1)
+
+	res := httptest.NewRecorder()
+	ad.StatusHandler().ServeHTTP(res, httptest.NewRequest("GET", "/status", nil))
+	var status map[string]interface{}
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &status))
+	assert.Equal(t, float64(3), status["completedFiles"])
+	assert.Equal(t, float64(6), status["remainingFiles"])
+	assert.InDelta(t, 360, status["etaSeconds"], 1)
+}
+
+func TestDownloadDrainsFilesInFlight(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	engine, err := InitDatabase("sqlite3", filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatalf("error initialising database: %v", err)
+	}
+
+	// the first file is still being downloaded when the deadline is reached
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write(gzipped(sampleArchiveLines["org pr"] + "\n"))
+	}))
+	defer server.Close()
+
+	files := []*common.ArchiveFile{common.NewArchiveFile(2019, 1, 1, 10), common.NewArchiveFile(2019, 1, 1, 11)}
+	ad := NewArchiveDownloader(engine, true, newHTTPSource(server.URL+"/%d-%02d-%02d-%d.json.gz"), &EventFilter{},
+		time.Time{}, time.Time{}, 1, false, log.New())
+	ad.SetFiles(files)
+	ad.SetProgressInterval(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, ad.DownloadEvents(ctx))
+
+	var archFiles []*common.ArchiveFile
+	assert.NoError(t, engine.Find(&archFiles))
+	assert.Len(t, archFiles, 1)
+	assert.Equal(t, files[0].ID, archFiles[0].ID)
+
+	failed, err := engine.Count(&common.FailedArchiveFile{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), failed)
+
+	p := ad.Progress()
+	assert.True(t, p.Draining)
+	assert.Equal(t, int64(1), p.CompletedFiles)
+	assert.Equal(t, int64(1), p.RemainingFiles)
+	assert.Equal(t, int64(1), p.Events)
+
+	// files not finished within the drain timeout are cancelled and not
+	// recorded as failed
+	ad.SetDrainTimeout(10 * time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ad.SetFiles(files[1:])
+	assert.NoError(t, ad.DownloadEvents(ctx))
+
+	archFiles = nil
+	assert.NoError(t, engine.Find(&archFiles))
+	assert.Len(t, archFiles, 1)
+	failed, err = engine.Count(&common.FailedArchiveFile{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), failed)
+}
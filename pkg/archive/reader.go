@@ -1,6 +1,7 @@
 package archive
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"strings"
@@ -20,6 +21,9 @@ type ArchiveReader struct {
 	logger    log.Logger
 	engine    *xorm.Engine
 	batchSize int64
+	types     []string
+	from      time.Time
+	to        time.Time
 }
 
 // NewArchiveReader creates a new reader
@@ -31,6 +35,92 @@ func NewArchiveReader(logger log.Logger, engine *xorm.Engine, batchSize int64) *
 	}
 }
 
+// SetEventTypes limits the events read to types, e.g. PushEvent. Events
+// stored with extracted columns are filtered by the database, others after
+// being decoded.
+func (ar *ArchiveReader) SetEventTypes(types ...string) {
+	ar.types = types
+}
+
+// SetTimeRange limits the events read to those created from from until to,
+// to being exclusive. A zero time leaves the range unbounded. Only the
+// partitions of the range are read if the github_event table is partitioned.
+func (ar *ArchiveReader) SetTimeRange(from, to time.Time) {
+	ar.from = from
+	ar.to = to
+}
+
+// readRanges returns the time ranges read one after another, one per
+// partition of the time range, so every query reads a single partition.
+func (ar *ArchiveReader) readRanges() ([][2]time.Time, error) {
+	partitions := NewPartitions(ar.engine)
+	enabled, err := partitions.Enabled()
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return [][2]time.Time{{ar.from, ar.to}}, nil
+	}
+
+	list, err := partitions.List()
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := [][2]time.Time{}
+	for _, p := range list {
+		if !p.overlaps(ar.from, ar.to) {
+			continue
+		}
+
+		r := [2]time.Time{p.From, p.To}
+		if !ar.from.IsZero() && (r[0].IsZero() || r[0].Before(ar.from)) {
+			r[0] = ar.from
+		}
+		if !ar.to.IsZero() && (r[1].IsZero() || r[1].After(ar.to)) {
+			r[1] = ar.to
+		}
+		ranges = append(ranges, r)
+	}
+
+	ar.logger.Debug("reading partitions of time range", "from", ar.from, "to", ar.to, "partitions", len(ranges))
+	return ranges, nil
+}
+
+// query returns a session selecting the events of the time range and the
+// configured types. Events without extracted columns have no event_type and
+// are selected too.
+func (ar *ArchiveReader) query(from, to time.Time) *xorm.Session {
+	session := ar.engine.NewSession()
+	if !from.IsZero() {
+		session = session.And("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		session = session.And("created_at < ?", to)
+	}
+	if len(ar.types) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ar.types)), ",")
+		args := make([]interface{}, len(ar.types))
+		for i, t := range ar.types {
+			args[i] = t
+		}
+		session = session.And("(event_type IN ("+placeholders+") OR event_type IS NULL)", args...)
+	}
+	return session
+}
+
+func (ar *ArchiveReader) includesType(eventType string) bool {
+	if len(ar.types) == 0 {
+		return true
+	}
+	for _, t := range ar.types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
 // ReadAllEvents reads all events stored in archive database
 func (ar *ArchiveReader) ReadAllEvents() (streams.Readable, <-chan error) {
 	r, w := streams.New()
@@ -41,59 +131,22 @@ func (ar *ArchiveReader) ReadAllEvents() (streams.Readable, <-chan error) {
 
 	go func() {
 		defer wg.Done()
-		totalRows := int64(0)
-		offset := int64(0)
-
-		totalRows, err := ar.engine.Count(&common.GithubEvent{})
+		ranges, err := ar.readRanges()
 		if err != nil {
 			outErr <- err
 			return
 		}
 
-		totalPages := totalRows / ar.batchSize
 		readEvents := int64(0)
-
 		start := time.Now()
-		ar.logger.Info("reading events from archive database...", "totalEvents", totalRows, "totalPages", totalPages)
-
-		for n := int64(0); n <= totalPages; n++ {
-			if n > 0 {
-				offset = n * ar.batchSize
-			}
 
-			startBatch := time.Now()
-			ar.logger.Debug("reading batch of events from archive database...", "batchSize", ar.batchSize, "offset", offset)
-			var rawEvents []*common.GithubEvent
-			err := ar.engine.OrderBy("id").Limit(int(ar.batchSize), int(offset)).Find(&rawEvents)
+		for _, r := range ranges {
+			read, err := ar.readRange(w, outErr, r[0], r[1])
+			readEvents += read
 			if err != nil {
 				outErr <- err
 				return
 			}
-
-			ar.logger.Debug("batch of events read from archive database", "batchSize", ar.batchSize, "offset", offset, "eventCount", len(rawEvents), "took", time.Since(startBatch))
-
-			startDecode := time.Now()
-			ar.logger.Debug("deserializing json of event batch...")
-
-			for _, rawEvent := range rawEvents {
-				reader := strings.NewReader(rawEvent.Data)
-				d := json.NewDecoder(reader)
-				for {
-					var evt ghevents.Event
-					err := d.Decode(&evt)
-					if err == io.EOF {
-						break
-					} else if err != nil {
-						outErr <- err
-						break
-					}
-
-					w <- &evt
-					readEvents++
-				}
-			}
-
-			ar.logger.Debug("json of event batch deserialized", "took", time.Since(startDecode))
 		}
 
 		ar.logger.Info("events read from archive database", "readEvents", readEvents, "took", time.Since(start))
@@ -107,3 +160,79 @@ func (ar *ArchiveReader) ReadAllEvents() (streams.Readable, <-chan error) {
 
 	return r, outErr
 }
+
+// readRange reads the events created from from until to in batches.
+func (ar *ArchiveReader) readRange(w chan<- streams.T, outErr chan<- error, from, to time.Time) (int64, error) {
+	offset := int64(0)
+
+	countSession := ar.query(from, to)
+	totalRows, err := countSession.Count(&common.GithubEvent{})
+	countSession.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	totalPages := totalRows / ar.batchSize
+	readEvents := int64(0)
+
+	ar.logger.Info("reading events from archive database...", "from", from, "to", to, "totalEvents", totalRows, "totalPages", totalPages)
+
+	for n := int64(0); n <= totalPages; n++ {
+		if n > 0 {
+			offset = n * ar.batchSize
+		}
+
+		startBatch := time.Now()
+		ar.logger.Debug("reading batch of events from archive database...", "batchSize", ar.batchSize, "offset", offset)
+		var rawEvents []*common.GithubEvent
+		session := ar.query(from, to)
+		// the ids of legacy events are hashes, only created_at orders them
+		err := session.OrderBy("created_at, id").Limit(int(ar.batchSize), int(offset)).Find(&rawEvents)
+		session.Close()
+		if err != nil {
+			return readEvents, err
+		}
+
+		ar.logger.Debug("batch of events read from archive database", "batchSize", ar.batchSize, "offset", offset, "eventCount", len(rawEvents), "took", time.Since(startBatch))
+
+		startDecode := time.Now()
+		ar.logger.Debug("deserializing json of event batch...")
+
+		for _, rawEvent := range rawEvents {
+			data, err := eventData(rawEvent)
+			if err != nil {
+				outErr <- err
+				continue
+			}
+
+			d := json.NewDecoder(bytes.NewReader(data))
+			for {
+				var raw json.RawMessage
+				err := d.Decode(&raw)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					outErr <- err
+					break
+				}
+
+				evt, err := ghevents.Decode(raw)
+				if err != nil {
+					outErr <- err
+					continue
+				}
+
+				if !ar.includesType(evt.Type) {
+					continue
+				}
+
+				w <- evt
+				readEvents++
+			}
+		}
+
+		ar.logger.Debug("json of event batch deserialized", "took", time.Since(startDecode))
+	}
+
+	return readEvents, nil
+}
@@ -0,0 +1,140 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/grafana/devtools/pkg/common"
+)
+
+const (
+	// DefaultMaxAttempts is how often a file is downloaded before it is
+	// recorded as failed.
+	DefaultMaxAttempts = 5
+	// DefaultInitialBackoff is the wait before the second attempt, which
+	// doubles for every following attempt.
+	DefaultInitialBackoff = time.Second
+	// DefaultMaxBackoff limits the wait between attempts.
+	DefaultMaxBackoff = time.Minute
+)
+
+// statusError is returned for responses other than 200.
+type statusError struct {
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("bad http status code %d", e.statusCode)
+}
+
+// retryableError marks errors worth another attempt, e.g. a connection reset
+// while reading the response.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+// isRetryable returns whether err might not occur on another attempt.
+// Responses are retried on server errors and rate limiting, but not on
+// other client errors, e.g. 404 for hours that were never archived.
+func isRetryable(err error) bool {
+	switch e := err.(type) {
+	case *statusError:
+		return e.statusCode >= 500 || e.statusCode == http.StatusTooManyRequests
+	case *retryableError:
+		return true
+	}
+
+	return false
+}
+
+// backoff returns the wait after the failed attempt, counting from 1. The
+// wait doubles for every attempt, up to max, and is jittered between half and
+// all of it so workers failing together do not retry together.
+func backoff(attempt int, initial, max time.Duration) time.Duration {
+	d := initial
+	for n := 1; n < attempt && d < max; n++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// retry calls fn until it succeeds, fails with an error that is not
+// retryable, maxAttempts is reached or ctx is done. Returns the number of
+// attempts and the last error.
+func retry(ctx context.Context, maxAttempts int, initial, max time.Duration, fn func() error) (int, error) {
+	attempts := 0
+	for {
+		err := fn()
+		attempts++
+		if err == nil || !isRetryable(err) || attempts >= maxAttempts {
+			return attempts, err
+		}
+
+		select {
+		case <-time.After(backoff(attempts, initial, max)):
+		case <-ctx.Done():
+			return attempts, err
+		}
+	}
+}
+
+// saveFailedFile records a file that failed after attempts, adding them to
+// the attempts of earlier runs.
+func (ad *ArchiveDownloader) saveFailedFile(file *common.ArchiveFile, attempts int, reason error) error {
+	session := ad.engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	failed := &common.FailedArchiveFile{}
+	exists, err := session.ID(file.ID).Get(failed)
+	if err != nil {
+		return err
+	}
+	if exists {
+		attempts += failed.Attempts
+		if _, err := session.Exec("DELETE FROM failed_archive_file WHERE ID = ? ", file.ID); err != nil {
+			return err
+		}
+	}
+
+	failed = &common.FailedArchiveFile{
+		ID:            file.ID,
+		CreatedAt:     file.CreatedAt,
+		Reason:        reason.Error(),
+		Attempts:      attempts,
+		LastAttemptAt: time.Now().UTC(),
+	}
+	if _, err := session.Insert(failed); err != nil {
+		return err
+	}
+
+	return session.Commit()
+}
+
+// buildRetryUrls returns the files of the failed hours.
+func (ad *ArchiveDownloader) buildRetryUrls(failedFiles []*common.FailedArchiveFile) []*common.ArchiveFile {
+	result := []*common.ArchiveFile{}
+	for _, f := range failedFiles {
+		result = append(result, &common.ArchiveFile{ID: f.ID, CreatedAt: f.CreatedAt})
+	}
+
+	return result
+}
@@ -0,0 +1,269 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/devtools/pkg/common"
+	"github.com/pkg/errors"
+)
+
+// ArchiveSource opens the archive files of hours
+type ArchiveSource interface {
+	// Open opens the file of an hour, which is either gzip compressed or
+	// plain json
+	Open(ctx context.Context, file *common.ArchiveFile) (io.ReadCloser, error)
+	// Location describes where the file of an hour is read from, e.g. its url
+	Location(file *common.ArchiveFile) string
+}
+
+// NewArchiveSource creates the source for location by its scheme:
+//   - http:// and https:// download the files, location being a template of
+//     the url with the year, month, day and hour of the file, e.g.
+//     https://data.githubarchive.org/%d-%02d-%02d-%d.json.gz
+//   - file:// reads files named like GH Archive files, e.g.
+//     2019-01-01-15.json.gz or 2019-01-01-15.json, from a directory, or from a
+//     tar bundle if the path ends with .tar, .tar.gz or .tgz
+//   - tar:// reads the files from a tar bundle
+//
+// Locations without scheme are read like file://.
+func NewArchiveSource(location string) (ArchiveSource, error) {
+	// url templates are not valid urls, e.g. %d-%02d is an invalid escape
+	scheme, p := "", location
+	if i := strings.Index(location, "://"); i >= 0 {
+		scheme, p = location[:i], filepath.FromSlash(location[i+3:])
+	}
+
+	switch scheme {
+	case "http", "https":
+		return newHTTPSource(location), nil
+	case "file", "":
+		if isTarBundle(p) {
+			return newTarSource(p), nil
+		}
+		return newDirSource(p), nil
+	case "tar":
+		return newTarSource(p), nil
+	}
+
+	return nil, fmt.Errorf("unsupported archive source scheme %q", scheme)
+}
+
+func isTarBundle(p string) bool {
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(p, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveFileNames returns the names the file of an hour might have, e.g.
+// 2019-01-01-15.json.gz and 2019-01-01-15.json
+func archiveFileNames(file *common.ArchiveFile) []string {
+	name := cacheFileName(file)
+	return []string{name, strings.TrimSuffix(name, ".gz")}
+}
+
+type httpSource struct {
+	urlTemplate string
+}
+
+func newHTTPSource(urlTemplate string) *httpSource {
+	return &httpSource{urlTemplate: urlTemplate}
+}
+
+func (s *httpSource) Location(file *common.ArchiveFile) string {
+	ft := time.Unix(file.ID, 0).UTC()
+	return fmt.Sprintf(s.urlTemplate, ft.Year(), ft.Month(), ft.Day(), ft.Hour())
+}
+
+func (s *httpSource) Open(ctx context.Context, file *common.ArchiveFile) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Location(file), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, &retryableError{err: errors.Wrap(err, "failed to download json file")}
+	}
+
+	// bail out if the request didn't return 200. the file is recorded as
+	// failed and downloaded again by the next run
+	if res.StatusCode != 200 {
+		res.Body.Close()
+		return nil, &statusError{statusCode: res.StatusCode}
+	}
+
+	return res.Body, nil
+}
+
+// dirSource reads the files from a directory
+type dirSource struct {
+	dir string
+}
+
+func newDirSource(dir string) *dirSource {
+	return &dirSource{dir: dir}
+}
+
+func (s *dirSource) Location(file *common.ArchiveFile) string {
+	return filepath.Join(s.dir, cacheFileName(file))
+}
+
+func (s *dirSource) Open(ctx context.Context, file *common.ArchiveFile) (io.ReadCloser, error) {
+	for _, name := range archiveFileNames(file) {
+		f, err := os.Open(filepath.Join(s.dir, name))
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("archive file %s not found", s.Location(file))
+}
+
+// tarSource reads the files from a tar bundle, which may be gzip compressed.
+// Entries are matched by their base name, so the files may be in any
+// directory of the bundle.
+type tarSource struct {
+	path string
+	once sync.Once
+	// offsets and sizes of the entries of uncompressed bundles, by name
+	entries map[string][2]int64
+	err     error
+}
+
+func newTarSource(path string) *tarSource {
+	return &tarSource{path: path}
+}
+
+func (s *tarSource) Location(file *common.ArchiveFile) string {
+	return s.path + ":" + cacheFileName(file)
+}
+
+func (s *tarSource) compressed() bool {
+	return !strings.HasSuffix(s.path, ".tar")
+}
+
+func (s *tarSource) Open(ctx context.Context, file *common.ArchiveFile) (io.ReadCloser, error) {
+	names := archiveFileNames(file)
+	if s.compressed() {
+		return s.scan(names)
+	}
+
+	s.once.Do(s.index)
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	for _, name := range names {
+		entry, exists := s.entries[name]
+		if !exists {
+			continue
+		}
+
+		f, err := os.Open(s.path)
+		if err != nil {
+			return nil, err
+		}
+		return &sectionReadCloser{Reader: io.NewSectionReader(f, entry[0], entry[1]), f: f}, nil
+	}
+
+	return nil, fmt.Errorf("archive file %s not found", s.Location(file))
+}
+
+// index records where the entries of an uncompressed bundle are, so they can
+// be read without reading the bundle up to them.
+func (s *tarSource) index() {
+	f, err := os.Open(s.path)
+	if err != nil {
+		s.err = err
+		return
+	}
+	defer f.Close()
+
+	s.entries = map[string][2]int64{}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			s.err = errors.Wrap(err, "failed to read tar bundle")
+			return
+		}
+
+		// the reader is positioned at the data of the entry
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			s.err = err
+			return
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			s.entries[path.Base(hdr.Name)] = [2]int64{offset, hdr.Size}
+		}
+	}
+}
+
+// scan reads a compressed bundle up to the first entry named like one of
+// names.
+func (s *tarSource) scan(names []string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "failed to read tar bundle")
+	}
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "failed to read tar bundle")
+		}
+
+		for _, name := range names {
+			if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == name {
+				return &sectionReadCloser{Reader: tr, f: f}, nil
+			}
+		}
+	}
+
+	f.Close()
+	return nil, fmt.Errorf("archive file %s not found in %s", names[0], s.path)
+}
+
+type sectionReadCloser struct {
+	io.Reader
+	f *os.File
+}
+
+func (r *sectionReadCloser) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/devtools/pkg/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipped(content string) []byte {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	w.Write([]byte(content))
+	w.Close()
+	return buf.Bytes()
+}
+
+func writeTar(t *testing.T, path string, compress bool, files map[string][]byte) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for name, data := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+		tw.Write(data)
+	}
+	assert.NoError(t, tw.Close())
+
+	data := buf.Bytes()
+	if compress {
+		data = gzipped(string(data))
+	}
+	assert.NoError(t, ioutil.WriteFile(path, data, 0644))
+}
+
+func readSource(t *testing.T, source ArchiveSource, file *common.ArchiveFile) (string, error) {
+	rc, err := source.Open(context.Background(), file)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	content, err := decompress(rc)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(content)
+	return string(data), err
+}
+
+func TestArchiveSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive-source")
+	if err != nil {
+		t.Fatalf("error creating dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	gzFile := common.NewArchiveFile(2019, 1, 1, 1)
+	plainFile := common.NewArchiveFile(2019, 1, 1, 2)
+	missingFile := common.NewArchiveFile(2019, 1, 1, 3)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "2019-01-01-1.json.gz"), gzipped("hour 1"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "2019-01-01-2.json"), []byte("hour 2"), 0644))
+
+	bundle := map[string][]byte{
+		"fixtures/2019-01-01-1.json.gz": gzipped("hour 1"),
+		"fixtures/2019-01-01-2.json":    []byte("hour 2"),
+	}
+	writeTar(t, filepath.Join(dir, "bundle.tar"), false, bundle)
+	writeTar(t, filepath.Join(dir, "bundle.tar.gz"), true, bundle)
+
+	for _, location := range []string{
+		"file://" + dir,
+		dir,
+		"file://" + filepath.Join(dir, "bundle.tar"),
+		"tar://" + filepath.Join(dir, "bundle.tar.gz"),
+	} {
+		t.Run(location, func(t *testing.T) {
+			source, err := NewArchiveSource(location)
+			assert.NoError(t, err)
+
+			content, err := readSource(t, source, gzFile)
+			assert.NoError(t, err)
+			assert.Equal(t, "hour 1", content)
+
+			content, err = readSource(t, source, plainFile)
+			assert.NoError(t, err)
+			assert.Equal(t, "hour 2", content)
+
+			_, err = readSource(t, source, missingFile)
+			assert.Error(t, err)
+			assert.False(t, isRetryable(err))
+		})
+	}
+
+	t.Run("http", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/2019-01-01-1.json.gz" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(gzipped("hour 1"))
+		}))
+		defer server.Close()
+
+		source, err := NewArchiveSource(server.URL + "/%d-%02d-%02d-%d.json.gz")
+		assert.NoError(t, err)
+		assert.IsType(t, &httpSource{}, source)
+
+		content, err := readSource(t, source, gzFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "hour 1", content)
+
+		_, err = readSource(t, source, missingFile)
+		assert.Equal(t, &statusError{statusCode: 404}, err)
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		_, err := NewArchiveSource("ftp://example.com/%d-%02d-%02d-%d.json.gz")
+		assert.Error(t, err)
+	})
+}
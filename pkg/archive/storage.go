@@ -0,0 +1,139 @@
+package archive
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/grafana/devtools/pkg/common"
+)
+
+// StorageFormat is how events are stored in the github_event table
+type StorageFormat string
+
+const (
+	// StorageJSON stores the json of events in the data column
+	StorageJSON StorageFormat = "json"
+	// StorageColumns stores the json and extracts the type, repo, actor and
+	// action of events into columns, which reads can filter on
+	StorageColumns StorageFormat = "columns"
+	// StorageCompressed extracts the columns and stores the json compressed
+	// in the payload column
+	StorageCompressed StorageFormat = "compressed"
+)
+
+// EventCodec compresses the json of events stored as StorageCompressed
+type EventCodec interface {
+	// Name selects the codec, e.g. with the eventCodec flag
+	Name() string
+	// ID is stored as first byte of payloads, so payloads of all codecs can be
+	// read regardless of the codec events are written with
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]EventCodec{}
+	codecIDs = map[byte]EventCodec{}
+)
+
+// RegisterEventCodec makes a codec available by its name and id. Only deflate
+// is registered by default, other codecs such as zstd are not built in.
+func RegisterEventCodec(codec EventCodec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if _, exists := codecIDs[codec.ID()]; exists {
+		panic(fmt.Sprintf("event codec id %d registered twice", codec.ID()))
+	}
+	codecs[codec.Name()] = codec
+	codecIDs[codec.ID()] = codec
+}
+
+// GetEventCodec returns the codec registered by name
+func GetEventCodec(name string) (EventCodec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	codec, exists := codecs[name]
+	if !exists {
+		return nil, fmt.Errorf("event codec %q not registered", name)
+	}
+	return codec, nil
+}
+
+func init() {
+	RegisterEventCodec(deflateCodec{})
+}
+
+// deflateCodec compresses with compress/flate, which needs no dependency
+type deflateCodec struct{}
+
+func (deflateCodec) Name() string { return "deflate" }
+func (deflateCodec) ID() byte     { return 1 }
+
+func (deflateCodec) Compress(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, err := flate.NewWriter(buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (deflateCodec) Decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// eventStorage writes events in a storage format
+type eventStorage struct {
+	format StorageFormat
+	codec  EventCodec
+}
+
+// encode sets the columns of the event that are stored in the format
+func (s eventStorage) encode(event *common.GithubEvent) error {
+	switch s.format {
+	case StorageCompressed:
+		payload, err := s.codec.Compress([]byte(event.Data))
+		if err != nil {
+			return err
+		}
+		event.Payload = append([]byte{s.codec.ID()}, payload...)
+		event.Data = ""
+	case StorageColumns:
+	default:
+		event.EventType, event.RepoName, event.ActorLogin, event.EventAction = "", "", "", ""
+	}
+
+	return nil
+}
+
+// eventData returns the json of a stored event, decompressing its payload if
+// it was stored compressed
+func eventData(event *common.GithubEvent) ([]byte, error) {
+	if len(event.Payload) == 0 {
+		return []byte(event.Data), nil
+	}
+
+	codecsMu.RLock()
+	codec, exists := codecIDs[event.Payload[0]]
+	codecsMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("event %d is compressed with unknown codec id %d", event.ID, event.Payload[0])
+	}
+
+	return codec.Decompress(event.Payload[1:])
+}
@@ -0,0 +1,202 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/common"
+	"github.com/grafana/devtools/pkg/ghevents"
+	"github.com/grafana/devtools/pkg/streams/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeflateCodec(t *testing.T) {
+	codec, err := GetEventCodec("deflate")
+	assert.NoError(t, err)
+
+	data := []byte(sampleArchiveLines["org pr"])
+	compressed, err := codec.Compress(data)
+	assert.NoError(t, err)
+
+	decompressed, err := codec.Decompress(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, data, decompressed)
+
+	_, err = GetEventCodec("zstd")
+	assert.Error(t, err)
+}
+
+func TestEventStorage(t *testing.T) {
+	ad := &ArchiveDownloader{filter: &EventFilter{}}
+	line := sampleArchiveLines["org pr"]
+
+	assert.NoError(t, ad.SetStorage(StorageJSON, ""))
+	event, err := ad.parseAndFilterEvent(line)
+	assert.NoError(t, err)
+	assert.Equal(t, line, event.Data)
+	assert.Equal(t, "", event.EventType)
+	assert.Nil(t, event.Payload)
+
+	assert.NoError(t, ad.SetStorage(StorageColumns, ""))
+	event, err = ad.parseAndFilterEvent(line)
+	assert.NoError(t, err)
+	assert.Equal(t, line, event.Data)
+	assert.Equal(t, "PullRequestEvent", event.EventType)
+	assert.Equal(t, "grafana/grafana", event.RepoName)
+	assert.Equal(t, "alice", event.ActorLogin)
+	assert.Nil(t, event.Payload)
+
+	assert.NoError(t, ad.SetStorage(StorageCompressed, "deflate"))
+	event, err = ad.parseAndFilterEvent(line)
+	assert.NoError(t, err)
+	assert.Equal(t, "", event.Data)
+	assert.Equal(t, "PullRequestEvent", event.EventType)
+	data, err := eventData(event)
+	assert.NoError(t, err)
+	assert.Equal(t, line, string(data))
+
+	assert.Error(t, ad.SetStorage(StorageCompressed, "zstd"))
+	assert.Error(t, ad.SetStorage("parquet", ""))
+
+	_, err = eventData(&common.GithubEvent{Payload: []byte{255, 1, 2}})
+	assert.Error(t, err)
+}
+
+func TestReadingStoredEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	engine, err := InitDatabase("sqlite3", filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatalf("error initialising database: %v", err)
+	}
+
+	// events of earlier runs stored as json, without extracted columns, are
+	// read next to compressed events
+	ad := &ArchiveDownloader{engine: engine, filter: &EventFilter{}}
+	file := common.NewArchiveFile(2019, 1, 1, 10)
+	events := []*common.GithubEvent{}
+	for i, name := range []string{"org pr", "org star", "org bot push", "personal issue"} {
+		if i == 2 {
+			assert.NoError(t, ad.SetStorage(StorageCompressed, "deflate"))
+		}
+		event, err := ad.parseAndFilterEvent(sampleArchiveLines[name])
+		assert.NoError(t, err)
+		events = append(events, event)
+	}
+	assert.NoError(t, ad.saveFileIntoDatabase(file, events))
+
+	readTypes := func(types ...string) []string {
+		reader := NewArchiveReader(log.New(), engine, 2)
+		reader.SetEventTypes(types...)
+		events, errs := reader.ReadAllEvents()
+
+		result := []string{}
+		for e := range events {
+			result = append(result, e.(*ghevents.Event).Type)
+		}
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	assert.Equal(t, []string{"IssuesEvent", "PullRequestEvent", "PushEvent", "WatchEvent"}, readTypes())
+	assert.Equal(t, []string{"PullRequestEvent", "PushEvent"}, readTypes("PushEvent", "PullRequestEvent"))
+	assert.Equal(t, []string{"IssuesEvent"}, readTypes("IssuesEvent"))
+}
+
+func TestReadingLegacyEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	engine, err := InitDatabase("sqlite3", filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatalf("error initialising database: %v", err)
+	}
+
+	legacy := `{"created_at":"2013-12-05T02:30:11-08:00","payload":{"action":"opened","issue":1234,"number":5},"public":true,"type":"IssuesEvent","actor":"alice","actor_attributes":{"login":"alice"},"repository":{"id":1,"name":"grafana","owner":"grafana","organization":"grafana"}}`
+	otherOrg := `{"created_at":"2013-12-05T02:30:11-08:00","payload":{},"public":true,"type":"WatchEvent","actor":"bob","repository":{"id":2,"name":"prometheus","owner":"prometheus","organization":"prometheus"}}`
+
+	ad := &ArchiveDownloader{engine: engine, filter: &EventFilter{Orgs: FilterList{Include: []string{"grafana"}}}}
+	assert.NoError(t, ad.SetStorage(StorageColumns, ""))
+	event, err := ad.parseAndFilterEvent(legacy)
+	assert.NoError(t, err)
+	assert.True(t, event.ID < 0)
+	assert.Equal(t, "grafana/grafana", event.RepoName)
+	assert.Equal(t, "alice", event.ActorLogin)
+	assert.Equal(t, "opened", event.EventAction)
+	assert.Equal(t, time.Date(2013, 12, 5, 10, 30, 11, 0, time.UTC), event.CreatedAt)
+
+	filtered, err := ad.parseAndFilterEvent(otherOrg)
+	assert.NoError(t, err)
+	assert.Nil(t, filtered)
+
+	_, err = ad.parseAndFilterEvent(`{"type":"PushEvent"}`)
+	assert.Error(t, err)
+
+	// events are stored as archived and decoded into the current format
+	assert.NoError(t, ad.saveFileIntoDatabase(common.NewArchiveFile(2013, 12, 5, 10), []*common.GithubEvent{event}))
+	events, errs := NewArchiveReader(log.New(), engine, 2).ReadAllEvents()
+	read := []*ghevents.Event{}
+	for e := range events {
+		read = append(read, e.(*ghevents.Event))
+	}
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Len(t, read, 1)
+	assert.Equal(t, strconv.FormatInt(event.ID, 10), read[0].ID)
+	assert.Equal(t, "grafana", read[0].Org.Login)
+	assert.Equal(t, 5, read[0].Payload.Issue.Number)
+}
+
+func TestReadingLegacyEventsInCreatedOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	engine, err := InitDatabase("sqlite3", filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatalf("error initialising database: %v", err)
+	}
+
+	opened := `{"created_at":"2013-12-05T02:30:11-08:00","payload":{"action":"opened","issue":1234,"number":5},"public":true,"type":"IssuesEvent","actor":"alice","actor_attributes":{"login":"alice"},"repository":{"id":1,"name":"grafana","owner":"grafana","organization":"grafana"}}`
+	closed := `{"created_at":"2013-12-05T02:45:00-08:00","payload":{"action":"closed","issue":1234,"number":5},"public":true,"type":"IssuesEvent","actor":"alice","actor_attributes":{"login":"alice"},"repository":{"id":1,"name":"grafana","owner":"grafana","organization":"grafana"}}`
+
+	ad := &ArchiveDownloader{engine: engine, filter: &EventFilter{}}
+	assert.NoError(t, ad.SetStorage(StorageColumns, ""))
+	events := []*common.GithubEvent{}
+	for _, data := range []string{closed, opened} {
+		event, err := ad.parseAndFilterEvent(data)
+		assert.NoError(t, err)
+		events = append(events, event)
+	}
+	// the ids of legacy events are hashes, here the closed event sorts first
+	assert.True(t, events[0].ID < events[1].ID)
+	assert.NoError(t, ad.saveFileIntoDatabase(common.NewArchiveFile(2013, 12, 5, 10), events))
+
+	read, errs := NewArchiveReader(log.New(), engine, 1).ReadAllEvents()
+	actions := []string{}
+	for e := range read {
+		actions = append(actions, *e.(*ghevents.Event).Payload.Action)
+	}
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"opened", "closed"}, actions)
+}
@@ -19,21 +19,57 @@ func NewArchiveFile(year, month, day, hour int) *ArchiveFile {
 	}
 }
 
-// GithubEvent is the database model of an event
+// FailedArchiveFile is the database model of an archive file that could not
+// be downloaded, which is retried by later runs
+type FailedArchiveFile struct {
+	ID            int64
+	CreatedAt     time.Time
+	Reason        string
+	Attempts      int
+	LastAttemptAt time.Time
+}
+
+// GithubEvent is the database model of an event. Depending on the storage
+// format the json is stored in Data or compressed in Payload, and the type,
+// repo, actor and action are extracted into columns.
 type GithubEvent struct {
-	ID        int64
-	Data      string
-	CreatedAt time.Time
+	ID          int64
+	Data        string
+	CreatedAt   time.Time
+	EventType   string
+	RepoName    string
+	ActorLogin  string
+	EventAction string
+	Payload     []byte
 }
 
 // GithubEventJSON is the root json model of an event
 type GithubEventJSON struct {
-	ID        string    `json:"id"`
-	Org       *OrgJSON  `json:"org"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        string       `json:"id"`
+	Type      string       `json:"type"`
+	Org       *OrgJSON     `json:"org"`
+	Repo      *RepoJSON    `json:"repo"`
+	Actor     *ActorJSON   `json:"actor"`
+	Payload   *PayloadJSON `json:"payload"`
+	CreatedAt time.Time    `json:"created_at"`
 }
 
 // OrgJSON is the json model from archive events
 type OrgJSON struct {
 	Login string `json:"login"`
 }
+
+// RepoJSON is the json model from archive events
+type RepoJSON struct {
+	Name string `json:"name"`
+}
+
+// PayloadJSON is the json model from archive events
+type PayloadJSON struct {
+	Action string `json:"action"`
+}
+
+// ActorJSON is the json model from archive events
+type ActorJSON struct {
+	Login string `json:"login"`
+}
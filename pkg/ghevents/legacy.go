@@ -0,0 +1,263 @@
+package ghevents
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+)
+
+// legacyEvent is the timeline format of events archived before 2015. Events
+// have no id, the actor is a login with its details in actor_attributes, and
+// the repo is a repository object naming its owner and organization.
+type legacyEvent struct {
+	Type            string            `json:"type"`
+	Public          bool              `json:"public"`
+	CreatedAt       string            `json:"created_at"`
+	Actor           json.RawMessage   `json:"actor"`
+	ActorAttributes *legacyActor      `json:"actor_attributes"`
+	Repository      *legacyRepository `json:"repository"`
+	Payload         *legacyPayload    `json:"payload"`
+}
+
+type legacyActor struct {
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+type legacyRepository struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Owner        string `json:"owner"`
+	Organization string `json:"organization"`
+}
+
+// legacyPayload holds the fields of payloads of all event types. Objects
+// that were ids in early payloads, e.g. the issue of IssuesEvent, are decoded
+// once their form is known.
+type legacyPayload struct {
+	PushID       *int            `json:"push_id"`
+	Size         *int            `json:"size"`
+	Ref          *string         `json:"ref"`
+	Head         *string         `json:"head"`
+	Before       *string         `json:"before"`
+	Action       *string         `json:"action"`
+	RefType      *string         `json:"ref_type"`
+	MasterBranch *string         `json:"master_branch"`
+	Description  *string         `json:"description"`
+	Number       *int            `json:"number"`
+	IssueID      *int            `json:"issue_id"`
+	CommentID    *int            `json:"comment_id"`
+	Shas         [][]interface{} `json:"shas"`
+	Commits      *[]Commit       `json:"commits"`
+	Pages        *[]Page         `json:"pages"`
+	DistinctSize *int            `json:"distinct_size"`
+	Issue        json.RawMessage `json:"issue"`
+	Comment      json.RawMessage `json:"comment"`
+	PullRequest  json.RawMessage `json:"pull_request"`
+	Forkee       json.RawMessage `json:"forkee"`
+	Release      json.RawMessage `json:"release"`
+	Member       json.RawMessage `json:"member"`
+}
+
+// legacyTimeFormats are the formats of created_at in the timeline format
+var legacyTimeFormats = []string{time.RFC3339, "2006/01/02 15:04:05 -0700"}
+
+// Decode decodes an event in the current format or in the timeline format
+// archived before 2015.
+func Decode(data []byte) (*Event, error) {
+	var evt Event
+	err := json.Unmarshal(data, &evt)
+	if (err != nil || evt.Actor == nil) && IsLegacy(data) {
+		return DecodeLegacy(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &evt, nil
+}
+
+// IsLegacy returns whether data is an event in the timeline format archived
+// before 2015
+func IsLegacy(data []byte) bool {
+	var probe struct {
+		Actor           json.RawMessage `json:"actor"`
+		ActorAttributes json.RawMessage `json:"actor_attributes"`
+		Repository      json.RawMessage `json:"repository"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+
+	return len(probe.ActorAttributes) > 0 || len(probe.Repository) > 0 ||
+		bytes.HasPrefix(bytes.TrimSpace(probe.Actor), []byte(`"`))
+}
+
+// LegacyEventID returns the id of an event in the timeline format, which has
+// none, derived from its json. The ids are negative, so they never collide
+// with the ids github assigns to events, and don't follow the order the events
+// were created in.
+func LegacyEventID(data []byte) int64 {
+	h := fnv.New64a()
+	h.Write(bytes.TrimSpace(data))
+	return -int64(h.Sum64()>>1) - 1
+}
+
+// DecodeLegacy decodes an event in the timeline format archived before 2015
+// into the current format
+func DecodeLegacy(data []byte) (*Event, error) {
+	var le legacyEvent
+	if err := json.Unmarshal(data, &le); err != nil {
+		return nil, err
+	}
+
+	evt := &Event{
+		ID:     strconv.FormatInt(LegacyEventID(data), 10),
+		Type:   le.Type,
+		Public: le.Public,
+	}
+
+	createdAt, err := parseLegacyTime(le.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	evt.CreatedAt = createdAt
+
+	actor := &Actor{}
+	if len(le.Actor) > 0 && le.Actor[0] == '"' {
+		if err := json.Unmarshal(le.Actor, &actor.Login); err != nil {
+			return nil, err
+		}
+	}
+	if le.ActorAttributes != nil {
+		if actor.Login == "" {
+			actor.Login = le.ActorAttributes.Login
+		}
+		actor.Name = le.ActorAttributes.Name
+	}
+	if actor.Login != "" {
+		evt.Actor = actor
+	}
+
+	if r := le.Repository; r != nil {
+		evt.Repo = &Repo{ID: r.ID, Name: r.Name}
+		if r.Owner != "" {
+			evt.Repo.Name = r.Owner + "/" + r.Name
+		}
+		if r.Organization != "" {
+			evt.Org = &Org{Login: r.Organization}
+		}
+	}
+
+	if le.Payload != nil {
+		evt.Payload = le.Payload.normalize()
+	}
+
+	return evt, nil
+}
+
+func parseLegacyTime(value string) (time.Time, error) {
+	for _, format := range legacyTimeFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported created_at %q of legacy event", value)
+}
+
+// normalize converts the payload into the current format. Objects of the
+// payload that fail to decode, e.g. due to fields of other types in early
+// payloads, are left out rather than failing the event.
+func (lp *legacyPayload) normalize() *Payload {
+	p := &Payload{
+		PushID:       lp.PushID,
+		Size:         lp.Size,
+		Ref:          lp.Ref,
+		Head:         lp.Head,
+		Before:       lp.Before,
+		Action:       lp.Action,
+		RefType:      lp.RefType,
+		MasterBranch: lp.MasterBranch,
+		Description:  lp.Description,
+		Number:       lp.Number,
+		Commits:      lp.Commits,
+		Pages:        lp.Pages,
+		DistinctSize: lp.DistinctSize,
+	}
+
+	// pushes list their commits as [sha, email, message, name, distinct]
+	if lp.Shas != nil && p.Commits == nil {
+		commits := make([]Commit, 0, len(lp.Shas))
+		distinct := 0
+		for _, sha := range lp.Shas {
+			c := Commit{Distinct: true}
+			for i, v := range sha {
+				s, _ := v.(string)
+				switch i {
+				case 0:
+					c.SHA = s
+				case 1:
+					c.Author.Email = s
+				case 2:
+					c.Message = s
+				case 3:
+					c.Author.Name = s
+				case 4:
+					c.Distinct, _ = v.(bool)
+				}
+			}
+			if c.Distinct {
+				distinct++
+			}
+			commits = append(commits, c)
+		}
+		p.Commits = &commits
+		if p.DistinctSize == nil {
+			p.DistinctSize = &distinct
+		}
+	}
+	if p.DistinctSize == nil && p.Size != nil {
+		size := *p.Size
+		p.DistinctSize = &size
+	}
+
+	// early issue and comment events only reference the issue and comment
+	var issueID int
+	if issue := (&Issue{}); isObject(lp.Issue) && json.Unmarshal(lp.Issue, issue) == nil {
+		p.Issue = issue
+	} else if len(lp.Issue) > 0 && json.Unmarshal(lp.Issue, &issueID) == nil {
+		p.Issue = &Issue{ID: issueID}
+	} else if lp.IssueID != nil {
+		p.Issue = &Issue{ID: *lp.IssueID}
+	}
+	if p.Issue != nil && p.Issue.Number == 0 && lp.Number != nil {
+		p.Issue.Number = *lp.Number
+	}
+
+	if comment := (&Comment{}); isObject(lp.Comment) && json.Unmarshal(lp.Comment, comment) == nil {
+		p.Comment = comment
+	} else if lp.CommentID != nil {
+		p.Comment = &Comment{ID: *lp.CommentID}
+	}
+
+	if pr := (&PullRequest{}); isObject(lp.PullRequest) && json.Unmarshal(lp.PullRequest, pr) == nil {
+		p.PullRequest = pr
+	}
+	if forkee := (&Forkee{}); isObject(lp.Forkee) && json.Unmarshal(lp.Forkee, forkee) == nil {
+		p.Forkee = forkee
+	}
+	if release := (&Release{}); isObject(lp.Release) && json.Unmarshal(lp.Release, release) == nil {
+		p.Release = release
+	}
+	if member := (&Actor{}); isObject(lp.Member) && json.Unmarshal(lp.Member, member) == nil {
+		p.Member = member
+	}
+
+	return p
+}
+
+func isObject(raw json.RawMessage) bool {
+	return len(raw) > 0 && raw[0] == '{'
+}
@@ -0,0 +1,56 @@
+package ghevents
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	legacyPush  = `{"created_at":"2013-12-05T02:30:11-08:00","payload":{"shas":[["3d8d3d4","torkel@example.com","Initial commit","Torkel",true],["5c1f2e9","torkel@example.com","Merge","Torkel",false]],"size":2,"ref":"refs/heads/master","head":"5c1f2e9"},"public":true,"type":"PushEvent","url":"https://github.com/torkelo/grafana/compare/3d8d3d4...5c1f2e9","actor":"torkelo","actor_attributes":{"login":"torkelo","type":"User","name":"Torkel"},"repository":{"id":15111821,"name":"grafana","url":"https://github.com/torkelo/grafana","owner":"torkelo","private":false}}`
+	legacyIssue = `{"created_at":"2011/02/12 14:34:20 -0800","payload":{"action":"opened","issue":1234,"number":5},"public":true,"type":"IssuesEvent","actor":"alice","actor_attributes":{"login":"alice"},"repository":{"id":1,"name":"grafana","owner":"grafana","organization":"grafana"}}`
+	modernPush  = `{"id":"1","type":"PushEvent","actor":{"id":1,"login":"alice"},"repo":{"id":1,"name":"grafana/grafana"},"payload":{"size":1},"created_at":"2019-01-01T10:00:00Z"}`
+)
+
+func TestDecodeLegacy(t *testing.T) {
+	assert.True(t, IsLegacy([]byte(legacyPush)))
+	assert.True(t, IsLegacy([]byte(legacyIssue)))
+	assert.False(t, IsLegacy([]byte(modernPush)))
+
+	evt, err := Decode([]byte(legacyPush))
+	assert.NoError(t, err)
+	assert.Equal(t, "PushEvent", evt.Type)
+	assert.Equal(t, time.Date(2013, 12, 5, 10, 30, 11, 0, time.UTC), evt.CreatedAt)
+	assert.Equal(t, "torkelo", evt.Actor.Login)
+	assert.Equal(t, "torkelo/grafana", evt.Repo.Name)
+	assert.Equal(t, 15111821, evt.Repo.ID)
+	assert.Nil(t, evt.Org)
+	assert.Len(t, *evt.Payload.Commits, 2)
+	assert.Equal(t, "3d8d3d4", (*evt.Payload.Commits)[0].SHA)
+	assert.Equal(t, "torkel@example.com", (*evt.Payload.Commits)[0].Author.Email)
+	assert.Equal(t, 1, *evt.Payload.DistinctSize)
+
+	// ids are stable and never collide with github's
+	id, err := Decode([]byte(legacyPush))
+	assert.NoError(t, err)
+	assert.Equal(t, evt.ID, id.ID)
+	assert.True(t, LegacyEventID([]byte(legacyPush)) < 0)
+
+	evt, err = Decode([]byte(legacyIssue))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2011, 2, 12, 22, 34, 20, 0, time.UTC), evt.CreatedAt)
+	assert.Equal(t, "grafana", evt.Org.Login)
+	assert.Equal(t, "grafana/grafana", evt.Repo.Name)
+	assert.Equal(t, "opened", *evt.Payload.Action)
+	assert.Equal(t, 1234, evt.Payload.Issue.ID)
+	assert.Equal(t, 5, evt.Payload.Issue.Number)
+
+	evt, err = Decode([]byte(modernPush))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", evt.ID)
+	assert.Equal(t, "grafana/grafana", evt.Repo.Name)
+
+	_, err = DecodeLegacy([]byte(`{"type":"PushEvent","actor":"alice","created_at":"yesterday"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package githubstats
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/grafana/devtools/pkg/ghevents"
+	"github.com/grafana/devtools/pkg/streams"
+)
+
+// Codecs returns codecs for the topics whose messages can be stored outside
+// of process memory, e.g. by a disk backed or networked bus.
+func Codecs() map[string]streams.Codec {
+	eventCodec := streams.NewEasyJSONCodec(&ghevents.Event{})
+
+	return map[string]streams.Codec{
+		GithubEventStream:       eventCodec,
+		IssuesEventStream:       eventCodec,
+		PullRequestEventStream:  eventCodec,
+		IssueCommentEventStream: eventCodec,
+		PushEventStream:         eventCodec,
+		ReleaseEventStream:      eventCodec,
+		ForkEventStream:         eventCodec,
+		WatchEventStream:        eventCodec,
+		pullRequestViewStream:   streams.NewJSONCodec(&pullRequestViewState{}),
+		issuesViewStream:        streams.NewJSONCodec(&issuesViewState{}),
+	}
+}
+
+type pullRequestViewJSON struct {
+	ID       int       `json:"id"`
+	Repo     string    `json:"repo"`
+	OpenedBy string    `json:"openedBy"`
+	OpenedAt time.Time `json:"openedAt"`
+	ClosedAt time.Time `json:"closedAt"`
+	Closed   bool      `json:"closed"`
+	Merged   bool      `json:"merged"`
+}
+
+func (s *pullRequestViewState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&pullRequestViewJSON{
+		ID:       s.id,
+		Repo:     s.repo,
+		OpenedBy: s.openedBy,
+		OpenedAt: s.openedAt,
+		ClosedAt: s.closedAt,
+		Closed:   s.closed,
+		Merged:   s.merged,
+	})
+}
+
+func (s *pullRequestViewState) UnmarshalJSON(data []byte) error {
+	var v pullRequestViewJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*s = pullRequestViewState{
+		id:       v.ID,
+		repo:     v.Repo,
+		openedBy: v.OpenedBy,
+		openedAt: v.OpenedAt,
+		closedAt: v.ClosedAt,
+		closed:   v.Closed,
+		merged:   v.Merged,
+	}
+
+	return nil
+}
+
+type issuesViewJSON struct {
+	ID       int       `json:"id"`
+	Repo     string    `json:"repo"`
+	OpenedBy string    `json:"openedBy"`
+	OpenedAt time.Time `json:"openedAt"`
+	ClosedAt time.Time `json:"closedAt"`
+	Closed   bool      `json:"closed"`
+}
+
+func (s *issuesViewState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&issuesViewJSON{
+		ID:       s.id,
+		Repo:     s.repo,
+		OpenedBy: s.openedBy,
+		OpenedAt: s.openedAt,
+		ClosedAt: s.closedAt,
+		Closed:   s.closed,
+	})
+}
+
+func (s *issuesViewState) UnmarshalJSON(data []byte) error {
+	var v issuesViewJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*s = issuesViewState{
+		id:       v.ID,
+		repo:     v.Repo,
+		openedBy: v.OpenedBy,
+		openedAt: v.OpenedAt,
+		closedAt: v.ClosedAt,
+		closed:   v.Closed,
+	}
+
+	return nil
+}
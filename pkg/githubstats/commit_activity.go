@@ -8,16 +8,33 @@ import (
 )
 
 const (
-	DailyCommitActivityStream                        = "d_commits"
-	WeeklyCommitActivityStream                       = "w_commits"
-	MonthlyCommitActivityStream                      = "m_commits"
-	QuarterlyCommitActivityStream                    = "q_commits"
-	YearlyCommitActivityStream                       = "y_commits"
-	SevenDaysMovingAverageCommitActivityStream       = "d7_commits"
+	PeriodsCommitActivityStream                      = "periods_commits"
 	TwentyFourHoursMovingAverageCommitActivityStream = "h24_commits"
 	CommitActivityStream                             = "all_commits"
 )
 
+// The periods used to be published to a topic each, they are now all
+// published to CommitActivityStream.
+const (
+	// Deprecated: use CommitActivityStream, whose states have Period d.
+	DailyCommitActivityStream = "d_commits"
+
+	// Deprecated: use CommitActivityStream, whose states have Period w.
+	WeeklyCommitActivityStream = "w_commits"
+
+	// Deprecated: use CommitActivityStream, whose states have Period m.
+	MonthlyCommitActivityStream = "m_commits"
+
+	// Deprecated: use CommitActivityStream, whose states have Period q.
+	QuarterlyCommitActivityStream = "q_commits"
+
+	// Deprecated: use CommitActivityStream, whose states have Period y.
+	YearlyCommitActivityStream = "y_commits"
+
+	// Deprecated: use CommitActivityStream, whose states have Period d7.
+	SevenDaysMovingAverageCommitActivityStream = "d7_commits"
+)
+
 type CommitActivityState struct {
 	Time    time.Time `persist:",primarykey"`
 	Period  string    `persist:",primarykey"`
@@ -26,12 +43,7 @@ type CommitActivityState struct {
 }
 
 type CommitActivityProjections struct {
-	daily                        *projections.StreamProjection
-	weekly                       *projections.StreamProjection
-	monthly                      *projections.StreamProjection
-	quarterly                    *projections.StreamProjection
-	yearly                       *projections.StreamProjection
-	sevenDaysMovingAverage       *projections.StreamProjection
+	periods                      *projections.StreamProjection
 	twentyFourHoursMovingAverage *projections.StreamProjection
 	all                          *projections.StreamProjection
 }
@@ -39,53 +51,15 @@ type CommitActivityProjections struct {
 func NewCommitActivityProjections() *CommitActivityProjections {
 	p := &CommitActivityProjections{}
 
-	p.daily = projections.
-		FromStream(PushEventStream).
-		Daily(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(DailyCommitActivityStream).
-		Build()
-
-	p.weekly = projections.
-		FromStream(PushEventStream).
-		Weekly(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(WeeklyCommitActivityStream).
-		Build()
-
-	p.monthly = projections.
-		FromStream(PushEventStream).
-		Monthly(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(MonthlyCommitActivityStream).
-		Build()
-
-	p.quarterly = projections.
-		FromStream(PushEventStream).
-		Quarterly(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(QuarterlyCommitActivityStream).
-		Build()
-
-	p.yearly = projections.
-		FromStream(PushEventStream).
-		Yearly(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(YearlyCommitActivityStream).
-		Build()
-
-	p.sevenDaysMovingAverage = projections.
+	p.periods = projections.
 		FromStream(PushEventStream).
-		Daily(fromCreatedDate, partitionByRepo).
+		Periods(fromCreatedDate, projections.Daily, projections.Weekly, projections.Monthly, projections.Quarterly, projections.Yearly).
+		PartitionBy(partitionByRepo).
 		Init(p.init).
 		Apply(p.apply).
-		Window(6, 0, "d7", p.applyMovingAverage).
-		ToStream(SevenDaysMovingAverageCommitActivityStream).
+		Merge(p.merge).
+		Windows(projections.Daily, projections.RollingAverage(7, "d7", "Commits")).
+		ToStream(PeriodsCommitActivityStream).
 		Build()
 
 	p.twentyFourHoursMovingAverage = projections.
@@ -93,18 +67,13 @@ func NewCommitActivityProjections() *CommitActivityProjections {
 		Hourly(fromCreatedDate, partitionByRepo).
 		Init(p.init).
 		Apply(p.apply).
-		Window(23, 0, "h24", p.applyMovingAverage).
+		Windows(projections.RollingAverage(24, "h24", "Commits")).
 		ToStream(TwentyFourHoursMovingAverageCommitActivityStream).
 		Build()
 
 	p.all = projections.
 		FromStreams(
-			DailyCommitActivityStream,
-			WeeklyCommitActivityStream,
-			MonthlyCommitActivityStream,
-			QuarterlyCommitActivityStream,
-			YearlyCommitActivityStream,
-			SevenDaysMovingAverageCommitActivityStream,
+			PeriodsCommitActivityStream,
 			TwentyFourHoursMovingAverageCommitActivityStream,
 		).
 		ToStream(CommitActivityStream).
@@ -129,17 +98,12 @@ func (p *CommitActivityProjections) apply(state *CommitActivityState, evt *gheve
 	}
 }
 
-func (p *CommitActivityProjections) applyMovingAverage(state *CommitActivityState, msg *CommitActivityState, windowSize int) {
-	state.Commits += msg.Commits / float64(windowSize)
+func (p *CommitActivityProjections) merge(target, source *CommitActivityState) {
+	target.Commits += source.Commits
 }
 
 func (p *CommitActivityProjections) Register(engine projections.StreamProjectionEngine) {
-	engine.Register(p.daily)
-	engine.Register(p.weekly)
-	engine.Register(p.monthly)
-	engine.Register(p.quarterly)
-	engine.Register(p.yearly)
-	engine.Register(p.sevenDaysMovingAverage)
+	engine.Register(p.periods)
 	engine.Register(p.twentyFourHoursMovingAverage)
 	engine.Register(p.all)
 }
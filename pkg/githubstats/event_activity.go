@@ -7,14 +7,28 @@ import (
 	"github.com/grafana/devtools/pkg/streams/projections"
 )
 
+const EventsActivityStream = "all_events"
+
+// The periods used to be published to a topic each, they are now all
+// published to EventsActivityStream.
 const (
-	DailyEventsActivityStream                  = "d_events"
-	WeeklyEventsActivityStream                 = "w_events"
-	MonthlyEventsActivityStream                = "m_events"
-	QuarterlyEventsActivityStream              = "q_events"
-	YearlyEventsActivityStream                 = "y_events"
+	// Deprecated: use EventsActivityStream, whose states have Period d.
+	DailyEventsActivityStream = "d_events"
+
+	// Deprecated: use EventsActivityStream, whose states have Period w.
+	WeeklyEventsActivityStream = "w_events"
+
+	// Deprecated: use EventsActivityStream, whose states have Period m.
+	MonthlyEventsActivityStream = "m_events"
+
+	// Deprecated: use EventsActivityStream, whose states have Period q.
+	QuarterlyEventsActivityStream = "q_events"
+
+	// Deprecated: use EventsActivityStream, whose states have Period y.
+	YearlyEventsActivityStream = "y_events"
+
+	// Deprecated: use EventsActivityStream, whose states have Period d7.
 	SevenDaysMovingAverageEventsActivityStream = "d7_events"
-	EventsActivityStream                       = "all_events"
 )
 
 type EventsActivityState struct {
@@ -26,81 +40,20 @@ type EventsActivityState struct {
 }
 
 type EventsActivityProjections struct {
-	daily                  *projections.StreamProjection
-	weekly                 *projections.StreamProjection
-	monthly                *projections.StreamProjection
-	quarterly              *projections.StreamProjection
-	yearly                 *projections.StreamProjection
-	sevenDaysMovingAverage *projections.StreamProjection
-	all                    *projections.StreamProjection
+	activity *projections.StreamProjection
 }
 
 func NewEventsActivityProjections() *EventsActivityProjections {
 	p := &EventsActivityProjections{}
-	p.daily = projections.
-		FromStream(GithubEventStream).
-		Filter(filterAndPatchRepos).
-		Daily(fromCreatedDate, partitionByRepo, p.partitionByEventType).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(DailyEventsActivityStream).
-		Build()
-
-	p.weekly = projections.
-		FromStream(GithubEventStream).
-		Filter(filterAndPatchRepos).
-		Weekly(fromCreatedDate, partitionByRepo, p.partitionByEventType).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(WeeklyEventsActivityStream).
-		Build()
-
-	p.monthly = projections.
-		FromStream(GithubEventStream).
-		Filter(filterAndPatchRepos).
-		Monthly(fromCreatedDate, partitionByRepo, p.partitionByEventType).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(MonthlyEventsActivityStream).
-		Build()
-
-	p.quarterly = projections.
+	p.activity = projections.
 		FromStream(GithubEventStream).
 		Filter(filterAndPatchRepos).
-		Quarterly(fromCreatedDate, partitionByRepo, p.partitionByEventType).
+		Periods(fromCreatedDate, projections.Daily, projections.Weekly, projections.Monthly, projections.Quarterly, projections.Yearly).
+		PartitionBy(partitionByRepo, p.partitionByEventType).
 		Init(p.init).
 		Apply(p.apply).
-		ToStream(QuarterlyEventsActivityStream).
-		Build()
-
-	p.yearly = projections.
-		FromStream(GithubEventStream).
-		Filter(filterAndPatchRepos).
-		Yearly(fromCreatedDate, partitionByRepo, p.partitionByEventType).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(YearlyEventsActivityStream).
-		Build()
-
-	p.sevenDaysMovingAverage = projections.
-		FromStream(GithubEventStream).
-		Filter(filterAndPatchRepos).
-		Daily(fromCreatedDate, partitionByRepo, p.partitionByEventType).
-		Init(p.init).
-		Apply(p.apply).
-		Window(6, 0, "d7", p.applyMovingAverage).
-		ToStream(SevenDaysMovingAverageEventsActivityStream).
-		Build()
-
-	p.all = projections.
-		FromStreams(
-			DailyEventsActivityStream,
-			WeeklyEventsActivityStream,
-			MonthlyEventsActivityStream,
-			QuarterlyEventsActivityStream,
-			YearlyEventsActivityStream,
-			SevenDaysMovingAverageEventsActivityStream,
-		).
+		Merge(p.merge).
+		Windows(projections.Daily, projections.RollingAverage(7, "d7", "Count")).
 		ToStream(EventsActivityStream).
 		Persist("events_activity", &EventsActivityState{}).
 		Build()
@@ -121,16 +74,10 @@ func (p *EventsActivityProjections) apply(state *EventsActivityState, evt *gheve
 	state.Count++
 }
 
-func (p *EventsActivityProjections) applyMovingAverage(state *EventsActivityState, msg *EventsActivityState, windowSize int) {
-	state.Count += msg.Count / float64(windowSize)
+func (p *EventsActivityProjections) merge(target, source *EventsActivityState) {
+	target.Count += source.Count
 }
 
 func (p *EventsActivityProjections) Register(engine projections.StreamProjectionEngine) {
-	engine.Register(p.daily)
-	engine.Register(p.weekly)
-	engine.Register(p.monthly)
-	engine.Register(p.quarterly)
-	engine.Register(p.yearly)
-	engine.Register(p.sevenDaysMovingAverage)
-	engine.Register(p.all)
+	engine.Register(p.activity)
 }
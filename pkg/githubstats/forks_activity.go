@@ -7,13 +7,25 @@ import (
 	"github.com/grafana/devtools/pkg/streams/projections"
 )
 
+const ForksActivityStream = "all_forks"
+
+// The periods used to be published to a topic each, they are now all
+// published to ForksActivityStream.
 const (
-	DailyForksActivityStream     = "d_forks"
-	WeeklyForksActivityStream    = "w_forks"
-	MonthlyForksActivityStream   = "m_forks"
+	// Deprecated: use ForksActivityStream, whose states have Period d.
+	DailyForksActivityStream = "d_forks"
+
+	// Deprecated: use ForksActivityStream, whose states have Period w.
+	WeeklyForksActivityStream = "w_forks"
+
+	// Deprecated: use ForksActivityStream, whose states have Period m.
+	MonthlyForksActivityStream = "m_forks"
+
+	// Deprecated: use ForksActivityStream, whose states have Period q.
 	QuarterlyForksActivityStream = "q_forks"
-	YearlyForksActivityStream    = "y_forks"
-	ForksActivityStream          = "all_forks"
+
+	// Deprecated: use ForksActivityStream, whose states have Period y.
+	YearlyForksActivityStream = "y_forks"
 )
 
 type ForksActivityState struct {
@@ -24,69 +36,27 @@ type ForksActivityState struct {
 }
 
 type ForksActivityProjections struct {
-	daily     *projections.StreamProjection
-	weekly    *projections.StreamProjection
-	monthly   *projections.StreamProjection
-	quarterly *projections.StreamProjection
-	yearly    *projections.StreamProjection
-	all       *projections.StreamProjection
+	activity *projections.StreamProjection
 }
 
+// NewForksActivityProjections counts per period and repo and publishes the
+// cumulative count up to each partition. The cumulative sums are windows over
+// the rolled up counts of each period, since a cumulative count can't be
+// rolled up itself.
 func NewForksActivityProjections() *ForksActivityProjections {
 	p := &ForksActivityProjections{}
-	p.daily = projections.
-		FromStream(ForkEventStream).
-		Daily(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		Window(-1, 0, "d", p.applyCummalativeSum).
-		ToStream(DailyForksActivityStream).
-		Build()
-
-	p.weekly = projections.
+	p.activity = projections.
 		FromStream(ForkEventStream).
-		Weekly(fromCreatedDate, partitionByRepo).
+		Periods(fromCreatedDate, projections.Daily, projections.Weekly, projections.Monthly, projections.Quarterly, projections.Yearly).
+		PartitionBy(partitionByRepo).
 		Init(p.init).
 		Apply(p.apply).
-		Window(-1, 0, "w", p.applyCummalativeSum).
-		ToStream(WeeklyForksActivityStream).
-		Build()
-
-	p.monthly = projections.
-		FromStream(ForkEventStream).
-		Monthly(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		Window(-1, 0, "m", p.applyCummalativeSum).
-		ToStream(MonthlyForksActivityStream).
-		Build()
-
-	p.quarterly = projections.
-		FromStream(ForkEventStream).
-		Quarterly(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		Window(-1, 0, "q", p.applyCummalativeSum).
-		ToStream(QuarterlyForksActivityStream).
-		Build()
-
-	p.yearly = projections.
-		FromStream(ForkEventStream).
-		Yearly(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		Window(-1, 0, "y", p.applyCummalativeSum).
-		ToStream(YearlyForksActivityStream).
-		Build()
-
-	p.all = projections.
-		FromStreams(
-			DailyForksActivityStream,
-			WeeklyForksActivityStream,
-			MonthlyForksActivityStream,
-			QuarterlyForksActivityStream,
-			YearlyForksActivityStream,
-		).
+		Merge(p.merge).
+		Windows(projections.Daily, projections.CumulativeSum("d", "Count")).
+		Windows(projections.Weekly, projections.CumulativeSum("w", "Count")).
+		Windows(projections.Monthly, projections.CumulativeSum("m", "Count")).
+		Windows(projections.Quarterly, projections.CumulativeSum("q", "Count")).
+		Windows(projections.Yearly, projections.CumulativeSum("y", "Count")).
 		ToStream(ForksActivityStream).
 		Persist("forks_activity", &ForksActivityState{}).
 		Build()
@@ -106,15 +76,10 @@ func (p *ForksActivityProjections) apply(state *ForksActivityState, evt *ghevent
 	state.Count++
 }
 
-func (p *ForksActivityProjections) applyCummalativeSum(state *ForksActivityState, msg *ForksActivityState, windowSize int) {
-	state.Count += msg.Count
+func (p *ForksActivityProjections) merge(target, source *ForksActivityState) {
+	target.Count += source.Count
 }
 
 func (p *ForksActivityProjections) Register(engine projections.StreamProjectionEngine) {
-	engine.Register(p.daily)
-	engine.Register(p.weekly)
-	engine.Register(p.monthly)
-	engine.Register(p.quarterly)
-	engine.Register(p.yearly)
-	engine.Register(p.all)
+	engine.Register(p.activity)
 }
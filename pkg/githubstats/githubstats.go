@@ -1,6 +1,8 @@
 package githubstats
 
 import (
+	"fmt"
+
 	"github.com/grafana/devtools/pkg/streams/projections"
 )
 
@@ -239,20 +241,66 @@ var githubLogins = []string{
 	"zuchka",
 }
 
+type projectionGroup struct {
+	name     string
+	register func(pe projections.StreamProjectionEngine)
+}
+
+var projectionGroups = []projectionGroup{
+	{"split_by_event_type", func(pe projections.StreamProjectionEngine) { NewSplitByEventTypeProjections().Register(pe) }},
+	{"issues_activity", func(pe projections.StreamProjectionEngine) { NewIssuesActivityProjections().Register(pe) }},
+	{"pr_activity", func(pe projections.StreamProjectionEngine) { NewPullRequestActivityProjections().Register(pe) }},
+	{"issue_comments_activity", func(pe projections.StreamProjectionEngine) { NewIssueCommentsActivityProjections().Register(pe) }},
+	{"pr_comments_activity", func(pe projections.StreamProjectionEngine) { NewPullRequestCommentsActivityProjections().Register(pe) }},
+	{"events_activity", func(pe projections.StreamProjectionEngine) { NewEventsActivityProjections().Register(pe) }},
+	{"release_annotation", func(pe projections.StreamProjectionEngine) { NewReleaseAnnotationProjections().Register(pe) }},
+	{"commit_activity", func(pe projections.StreamProjectionEngine) { NewCommitActivityProjections().Register(pe) }},
+	{"forks_activity", func(pe projections.StreamProjectionEngine) { NewForksActivityProjections().Register(pe) }},
+	{"stargazers_activity", func(pe projections.StreamProjectionEngine) { NewStargazersActivityProjections().Register(pe) }},
+	{"pr_age", func(pe projections.StreamProjectionEngine) { NewPullRequestAgeProjections().Register(pe) }},
+	{"pr_opened_to_merged", func(pe projections.StreamProjectionEngine) { NewPullRequestOpenedToMergedProjections().Register(pe) }},
+	{"issues_age", func(pe projections.StreamProjectionEngine) { NewIssuesAgeProjections().Register(pe) }},
+}
+
+// ProjectionGroupNames returns the names of the projection groups that can be
+// registered using RegisterProjectionGroups.
+func ProjectionGroupNames() []string {
+	names := []string{}
+	for _, g := range projectionGroups {
+		names = append(names, g.name)
+	}
+	return names
+}
+
+// RegisterProjections registers all projection groups.
 func RegisterProjections(pe projections.StreamProjectionEngine) {
-	NewSplitByEventTypeProjections().Register(pe)
-	NewIssuesActivityProjections().Register(pe)
-	NewPullRequestActivityProjections().Register(pe)
-	NewIssueCommentsActivityProjections().Register(pe)
-	NewPullRequestCommentsActivityProjections().Register(pe)
-	NewEventsActivityProjections().Register(pe)
-	NewReleaseAnnotationProjections().Register(pe)
-	NewCommitActivityProjections().Register(pe)
-	NewForksActivityProjections().Register(pe)
-	NewStargazersActivityProjections().Register(pe)
-	NewPullRequestAgeProjections().Register(pe)
-	NewPullRequestOpenedToMergedProjections().Register(pe)
-	NewIssuesAgeProjections().Register(pe)
+	if err := RegisterProjectionGroups(pe, ProjectionGroupNames()...); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterProjectionGroups registers the named projection groups only, e.g. to
+// run the expensive groups in separate processes using a networked bus.
+func RegisterProjectionGroups(pe projections.StreamProjectionEngine, names ...string) error {
+	known := map[string]bool{}
+	for _, g := range projectionGroups {
+		known[g.name] = true
+	}
+
+	selected := map[string]bool{}
+	for _, name := range names {
+		if !known[name] {
+			return fmt.Errorf("unknown projection group %s", name)
+		}
+		selected[name] = true
+	}
+
+	pe.RegisterInput(GithubEventStream)
+	for _, g := range projectionGroups {
+		if selected[g.name] {
+			g.register(pe)
+		}
+	}
 
 	for _, login := range githubLogins {
 		userLoginGroupMap[login] = "Grafana Labs"
@@ -314,4 +362,6 @@ func RegisterProjections(pe projections.StreamProjectionEngine) {
 		"grafana/datasource-plugin-kairosdb":    "grafana/kairosdb-datasource",
 		"grafana/panel-plugin-piechart":         "grafana/piechart-panel",
 	}
+
+	return nil
 }
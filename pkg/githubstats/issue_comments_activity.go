@@ -7,14 +7,28 @@ import (
 	"github.com/grafana/devtools/pkg/streams/projections"
 )
 
+const IssueCommentsActivityStream = "all_issue_comments"
+
+// The periods used to be published to a topic each, they are now all
+// published to IssueCommentsActivityStream.
 const (
-	DailyIssueCommentsActivityStream                  = "d_issue_comments"
-	WeeklyIssueCommentsActivityStream                 = "w_issue_comments"
-	MonthlyIssueCommentsActivityStream                = "m_issue_comments"
-	QuarterlyIssueCommentsActivityStream              = "q_issue_comments"
-	YearlyIssueCommentsActivityStream                 = "y_issue_comments"
+	// Deprecated: use IssueCommentsActivityStream, whose states have Period d.
+	DailyIssueCommentsActivityStream = "d_issue_comments"
+
+	// Deprecated: use IssueCommentsActivityStream, whose states have Period w.
+	WeeklyIssueCommentsActivityStream = "w_issue_comments"
+
+	// Deprecated: use IssueCommentsActivityStream, whose states have Period m.
+	MonthlyIssueCommentsActivityStream = "m_issue_comments"
+
+	// Deprecated: use IssueCommentsActivityStream, whose states have Period q.
+	QuarterlyIssueCommentsActivityStream = "q_issue_comments"
+
+	// Deprecated: use IssueCommentsActivityStream, whose states have Period y.
+	YearlyIssueCommentsActivityStream = "y_issue_comments"
+
+	// Deprecated: use IssueCommentsActivityStream, whose states have Period d7.
 	SevenDaysMovingAverageIssueCommentsActivityStream = "d7_issue_comments"
-	IssueCommentsActivityStream                       = "all_issue_comments"
 )
 
 type IssueCommentsActivityState struct {
@@ -26,81 +40,20 @@ type IssueCommentsActivityState struct {
 }
 
 type IssueCommentsActivityProjections struct {
-	daily                  *projections.StreamProjection
-	sevenDaysMovingAverage *projections.StreamProjection
-	weekly                 *projections.StreamProjection
-	monthly                *projections.StreamProjection
-	quarterly              *projections.StreamProjection
-	yearly                 *projections.StreamProjection
-	all                    *projections.StreamProjection
+	activity *projections.StreamProjection
 }
 
 func NewIssueCommentsActivityProjections() *IssueCommentsActivityProjections {
 	p := &IssueCommentsActivityProjections{}
-	p.daily = projections.
-		FromStream(IssueCommentEventStream).
-		Filter(p.filterIssueComments).
-		Daily(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(DailyIssueCommentsActivityStream).
-		Build()
-
-	p.weekly = projections.
-		FromStream(IssueCommentEventStream).
-		Filter(p.filterIssueComments).
-		Weekly(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(WeeklyIssueCommentsActivityStream).
-		Build()
-
-	p.monthly = projections.
-		FromStream(IssueCommentEventStream).
-		Filter(p.filterIssueComments).
-		Monthly(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(MonthlyIssueCommentsActivityStream).
-		Build()
-
-	p.quarterly = projections.
+	p.activity = projections.
 		FromStream(IssueCommentEventStream).
 		Filter(p.filterIssueComments).
-		Quarterly(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
+		Periods(fromCreatedDate, projections.Daily, projections.Weekly, projections.Monthly, projections.Quarterly, projections.Yearly).
+		PartitionBy(partitionByRepo, p.partitionByAuthoredBy).
 		Init(p.init).
 		Apply(p.apply).
-		ToStream(QuarterlyIssueCommentsActivityStream).
-		Build()
-
-	p.yearly = projections.
-		FromStream(IssueCommentEventStream).
-		Filter(p.filterIssueComments).
-		Yearly(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(YearlyIssueCommentsActivityStream).
-		Build()
-
-	p.sevenDaysMovingAverage = projections.
-		FromStream(IssueCommentEventStream).
-		Filter(p.filterIssueComments).
-		Daily(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
-		Init(p.init).
-		Apply(p.apply).
-		Window(6, 0, "d7", p.applyMovingAverage).
-		ToStream(SevenDaysMovingAverageIssueCommentsActivityStream).
-		Build()
-
-	p.all = projections.
-		FromStreams(
-			DailyIssueCommentsActivityStream,
-			WeeklyIssueCommentsActivityStream,
-			MonthlyIssueCommentsActivityStream,
-			QuarterlyIssueCommentsActivityStream,
-			YearlyIssueCommentsActivityStream,
-			SevenDaysMovingAverageIssueCommentsActivityStream,
-		).
+		Merge(p.merge).
+		Windows(projections.Daily, projections.RollingAverage(7, "d7", "Count")).
 		ToStream(IssueCommentsActivityStream).
 		Persist("issue_comments_activity", &IssueCommentsActivityState{}).
 		Build()
@@ -131,16 +84,10 @@ func (p *IssueCommentsActivityProjections) apply(state *IssueCommentsActivitySta
 	state.Count++
 }
 
-func (p *IssueCommentsActivityProjections) applyMovingAverage(state *IssueCommentsActivityState, msg *IssueCommentsActivityState, windowSize int) {
-	state.Count += msg.Count / float64(windowSize)
+func (p *IssueCommentsActivityProjections) merge(target, source *IssueCommentsActivityState) {
+	target.Count += source.Count
 }
 
 func (p *IssueCommentsActivityProjections) Register(engine projections.StreamProjectionEngine) {
-	engine.Register(p.daily)
-	engine.Register(p.weekly)
-	engine.Register(p.monthly)
-	engine.Register(p.quarterly)
-	engine.Register(p.yearly)
-	engine.Register(p.sevenDaysMovingAverage)
-	engine.Register(p.all)
+	engine.Register(p.activity)
 }
@@ -7,14 +7,28 @@ import (
 	"github.com/grafana/devtools/pkg/streams/projections"
 )
 
+const IssuesActivityStream = "all_issues"
+
+// The periods used to be published to a topic each, they are now all
+// published to IssuesActivityStream.
 const (
-	DailyIssuesActivityStream                  = "d_issues"
-	WeeklyIssuesActivityStream                 = "w_issues"
-	MonthlyIssuesActivityStream                = "m_issues"
-	QuarterlyIssuesActivityStream              = "q_issues"
-	YearlyIssuesActivityStream                 = "y_issues"
+	// Deprecated: use IssuesActivityStream, whose states have Period d.
+	DailyIssuesActivityStream = "d_issues"
+
+	// Deprecated: use IssuesActivityStream, whose states have Period w.
+	WeeklyIssuesActivityStream = "w_issues"
+
+	// Deprecated: use IssuesActivityStream, whose states have Period m.
+	MonthlyIssuesActivityStream = "m_issues"
+
+	// Deprecated: use IssuesActivityStream, whose states have Period q.
+	QuarterlyIssuesActivityStream = "q_issues"
+
+	// Deprecated: use IssuesActivityStream, whose states have Period y.
+	YearlyIssuesActivityStream = "y_issues"
+
+	// Deprecated: use IssuesActivityStream, whose states have Period d7.
 	SevenDaysMovingAverageIssuesActivityStream = "d7_issues"
-	IssuesActivityStream                       = "all_issues"
 )
 
 type IssuesActivityState struct {
@@ -27,81 +41,20 @@ type IssuesActivityState struct {
 }
 
 type IssuesActivityProjections struct {
-	daily                  *projections.StreamProjection
-	sevenDaysMovingAverage *projections.StreamProjection
-	weekly                 *projections.StreamProjection
-	monthly                *projections.StreamProjection
-	quarterly              *projections.StreamProjection
-	yearly                 *projections.StreamProjection
-	all                    *projections.StreamProjection
+	activity *projections.StreamProjection
 }
 
 func NewIssuesActivityProjections() *IssuesActivityProjections {
 	p := &IssuesActivityProjections{}
-	p.daily = projections.
-		FromStream(IssuesEventStream).
-		Filter(filterByOpenedAndClosedActions).
-		Daily(fromCreatedDate, partitionByRepo, p.partitionByIssueAuthor).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(DailyIssuesActivityStream).
-		Build()
-
-	p.weekly = projections.
-		FromStream(IssuesEventStream).
-		Filter(filterByOpenedAndClosedActions).
-		Weekly(fromCreatedDate, partitionByRepo, p.partitionByIssueAuthor).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(WeeklyIssuesActivityStream).
-		Build()
-
-	p.monthly = projections.
-		FromStream(IssuesEventStream).
-		Filter(filterByOpenedAndClosedActions).
-		Monthly(fromCreatedDate, partitionByRepo, p.partitionByIssueAuthor).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(MonthlyIssuesActivityStream).
-		Build()
-
-	p.quarterly = projections.
+	p.activity = projections.
 		FromStream(IssuesEventStream).
 		Filter(filterByOpenedAndClosedActions).
-		Quarterly(fromCreatedDate, partitionByRepo, p.partitionByIssueAuthor).
+		Periods(fromCreatedDate, projections.Daily, projections.Weekly, projections.Monthly, projections.Quarterly, projections.Yearly).
+		PartitionBy(partitionByRepo, p.partitionByIssueAuthor).
 		Init(p.init).
 		Apply(p.apply).
-		ToStream(QuarterlyIssuesActivityStream).
-		Build()
-
-	p.yearly = projections.
-		FromStream(IssuesEventStream).
-		Filter(filterByOpenedAndClosedActions).
-		Yearly(fromCreatedDate, partitionByRepo, p.partitionByIssueAuthor).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(YearlyIssuesActivityStream).
-		Build()
-
-	p.sevenDaysMovingAverage = projections.
-		FromStream(IssuesEventStream).
-		Filter(filterByOpenedAndClosedActions).
-		Daily(fromCreatedDate, partitionByRepo, p.partitionByIssueAuthor).
-		Init(p.init).
-		Apply(p.apply).
-		Window(6, 0, "d7", p.applyMovingAverage).
-		ToStream(SevenDaysMovingAverageIssuesActivityStream).
-		Build()
-
-	p.all = projections.
-		FromStreams(
-			DailyIssuesActivityStream,
-			WeeklyIssuesActivityStream,
-			MonthlyIssuesActivityStream,
-			QuarterlyIssuesActivityStream,
-			YearlyIssuesActivityStream,
-			SevenDaysMovingAverageIssuesActivityStream,
-		).
+		Merge(p.merge).
+		Windows(projections.Daily, projections.RollingAverage(7, "d7", "Opened", "Closed")).
 		ToStream(IssuesActivityStream).
 		Persist("issues_activity", &IssuesActivityState{}).
 		Build()
@@ -132,17 +85,11 @@ func (p *IssuesActivityProjections) apply(state *IssuesActivityState, evt *gheve
 	}
 }
 
-func (p *IssuesActivityProjections) applyMovingAverage(state *IssuesActivityState, msg *IssuesActivityState, windowSize int) {
-	state.Opened += msg.Opened / float64(windowSize)
-	state.Closed += msg.Closed / float64(windowSize)
+func (p *IssuesActivityProjections) merge(target, source *IssuesActivityState) {
+	target.Opened += source.Opened
+	target.Closed += source.Closed
 }
 
 func (p *IssuesActivityProjections) Register(engine projections.StreamProjectionEngine) {
-	engine.Register(p.daily)
-	engine.Register(p.weekly)
-	engine.Register(p.monthly)
-	engine.Register(p.quarterly)
-	engine.Register(p.yearly)
-	engine.Register(p.sevenDaysMovingAverage)
-	engine.Register(p.all)
+	engine.Register(p.activity)
 }
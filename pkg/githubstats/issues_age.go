@@ -64,14 +64,28 @@ func (p *issuesViewProjections) register(engine projections.StreamProjectionEngi
 	engine.Register(p.view)
 }
 
+const IssuesAgeStream = "all_issues_age"
+
+// The periods used to be published to a topic each, they are now all
+// published to IssuesAgeStream.
 const (
-	DailyIssuesAgeStream                  = "d_issues_age"
-	WeeklyIssuesAgeStream                 = "w_issues_age"
-	MonthlyIssuesAgeStream                = "m_issues_age"
-	QuarterlyIssuesAgeStream              = "q_issues_age"
-	YearlyIssuesAgeStream                 = "y_issues_age"
+	// Deprecated: use IssuesAgeStream, whose states have Period d.
+	DailyIssuesAgeStream = "d_issues_age"
+
+	// Deprecated: use IssuesAgeStream, whose states have Period w.
+	WeeklyIssuesAgeStream = "w_issues_age"
+
+	// Deprecated: use IssuesAgeStream, whose states have Period m.
+	MonthlyIssuesAgeStream = "m_issues_age"
+
+	// Deprecated: use IssuesAgeStream, whose states have Period q.
+	QuarterlyIssuesAgeStream = "q_issues_age"
+
+	// Deprecated: use IssuesAgeStream, whose states have Period y.
+	YearlyIssuesAgeStream = "y_issues_age"
+
+	// Deprecated: use IssuesAgeStream, whose states have Period d7.
 	SevenDaysMovingAverageIssuesAgeStream = "d7_issues_age"
-	IssuesAgeStream                       = "all_issues_age"
 )
 
 type IssuesAgeState struct {
@@ -84,14 +98,8 @@ type IssuesAgeState struct {
 }
 
 type IssuesAgeProjections struct {
-	ViewProjections        *issuesViewProjections
-	daily                  *projections.StreamProjection
-	sevenDaysMovingAverage *projections.StreamProjection
-	weekly                 *projections.StreamProjection
-	monthly                *projections.StreamProjection
-	quarterly              *projections.StreamProjection
-	yearly                 *projections.StreamProjection
-	all                    *projections.StreamProjection
+	ViewProjections *issuesViewProjections
+	age             *projections.StreamProjection
 }
 
 func NewIssuesAgeProjections() *IssuesAgeProjections {
@@ -99,76 +107,16 @@ func NewIssuesAgeProjections() *IssuesAgeProjections {
 
 	p.ViewProjections = newIssuesViewProjections()
 
-	p.daily = projections.
+	p.age = projections.
 		FromStream(issuesViewStream).
 		Filter(p.filterByClosed).
-		Daily(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
+		Periods(p.partitionByClosedAt, projections.Daily, projections.Weekly, projections.Monthly, projections.Quarterly, projections.Yearly).
+		PartitionBy(p.partitionByRepo, p.partitionByProposedBy).
 		Init(p.init).
 		Apply(p.apply).
+		Merge(p.merge).
 		Done(p.done).
-		ToStream(DailyIssuesAgeStream).
-		Build()
-
-	p.weekly = projections.
-		FromStream(issuesViewStream).
-		Filter(p.filterByClosed).
-		Weekly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(WeeklyIssuesAgeStream).
-		Build()
-
-	p.monthly = projections.
-		FromStream(issuesViewStream).
-		Filter(p.filterByClosed).
-		Monthly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(MonthlyIssuesAgeStream).
-		Build()
-
-	p.quarterly = projections.
-		FromStream(issuesViewStream).
-		Filter(p.filterByClosed).
-		Quarterly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(QuarterlyIssuesAgeStream).
-		Build()
-
-	p.yearly = projections.
-		FromStream(issuesViewStream).
-		Filter(p.filterByClosed).
-		Yearly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(YearlyIssuesAgeStream).
-		Build()
-
-	p.sevenDaysMovingAverage = projections.
-		FromStream(issuesViewStream).
-		Filter(p.filterByClosed).
-		Daily(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		Window(6, 0, "d7", p.applyMovingAverage).
-		ToStream(SevenDaysMovingAverageIssuesAgeStream).
-		Build()
-
-	p.all = projections.
-		FromStreams(
-			DailyIssuesAgeStream,
-			WeeklyIssuesAgeStream,
-			MonthlyIssuesAgeStream,
-			QuarterlyIssuesAgeStream,
-			YearlyIssuesAgeStream,
-			SevenDaysMovingAverageIssuesAgeStream,
-		).
+		Windows(projections.Daily, projections.RollingPercentile(7, 0.5, "d7", "MedianAge")).
 		ToStream(IssuesAgeStream).
 		Persist("issues_age", &IssuesAgeState{}).
 		Build()
@@ -210,6 +158,10 @@ func (p *IssuesAgeProjections) apply(state *IssuesAgeState, viewState *issuesVie
 	state.ageItems = append(state.ageItems, viewState.closedAt.Sub(viewState.openedAt).Seconds())
 }
 
+func (p *IssuesAgeProjections) merge(target, source *IssuesAgeState) {
+	target.ageItems = append(target.ageItems, source.ageItems...)
+}
+
 func (p *IssuesAgeProjections) done(stateArr []projections.ProjectionState) {
 	for _, s := range stateArr {
 		ageState := s.(*IssuesAgeState)
@@ -217,17 +169,11 @@ func (p *IssuesAgeProjections) done(stateArr []projections.ProjectionState) {
 	}
 }
 
-func (p *IssuesAgeProjections) applyMovingAverage(state *IssuesAgeState, msg *IssuesAgeState, windowSize int) {
-	state.MedianAge += msg.MedianAge / float64(windowSize)
+func (s *IssuesAgeState) Samples() []float64 {
+	return s.ageItems
 }
 
 func (p *IssuesAgeProjections) Register(engine projections.StreamProjectionEngine) {
 	p.ViewProjections.register(engine)
-	engine.Register(p.daily)
-	engine.Register(p.weekly)
-	engine.Register(p.monthly)
-	engine.Register(p.quarterly)
-	engine.Register(p.yearly)
-	engine.Register(p.sevenDaysMovingAverage)
-	engine.Register(p.all)
+	engine.Register(p.age)
 }
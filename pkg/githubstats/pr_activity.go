@@ -7,14 +7,28 @@ import (
 	"github.com/grafana/devtools/pkg/streams/projections"
 )
 
+const PullRequestActivityStream = "all_prs"
+
+// The periods used to be published to a topic each, they are now all
+// published to PullRequestActivityStream.
 const (
-	DailyPullRequestActivityStream                  = "d_prs"
-	WeeklyPullRequestActivityStream                 = "w_prs"
-	MonthlyPullRequestActivityStream                = "m_prs"
-	QuarterlyPullRequestActivityStream              = "q_prs"
-	YearlyPullRequestActivityStream                 = "y_prs"
+	// Deprecated: use PullRequestActivityStream, whose states have Period d.
+	DailyPullRequestActivityStream = "d_prs"
+
+	// Deprecated: use PullRequestActivityStream, whose states have Period w.
+	WeeklyPullRequestActivityStream = "w_prs"
+
+	// Deprecated: use PullRequestActivityStream, whose states have Period m.
+	MonthlyPullRequestActivityStream = "m_prs"
+
+	// Deprecated: use PullRequestActivityStream, whose states have Period q.
+	QuarterlyPullRequestActivityStream = "q_prs"
+
+	// Deprecated: use PullRequestActivityStream, whose states have Period y.
+	YearlyPullRequestActivityStream = "y_prs"
+
+	// Deprecated: use PullRequestActivityStream, whose states have Period d7.
 	SevenDaysMovingAveragePullRequestActivityStream = "d7_prs"
-	PullRequestActivityStream                       = "all_prs"
 )
 
 type PullRequestActivityState struct {
@@ -28,81 +42,20 @@ type PullRequestActivityState struct {
 }
 
 type PullRequestActivityProjections struct {
-	daily                  *projections.StreamProjection
-	sevenDaysMovingAverage *projections.StreamProjection
-	weekly                 *projections.StreamProjection
-	monthly                *projections.StreamProjection
-	quarterly              *projections.StreamProjection
-	yearly                 *projections.StreamProjection
-	all                    *projections.StreamProjection
+	activity *projections.StreamProjection
 }
 
 func NewPullRequestActivityProjections() *PullRequestActivityProjections {
 	p := &PullRequestActivityProjections{}
-	p.daily = projections.
-		FromStream(PullRequestEventStream).
-		Filter(filterByOpenedAndClosedActions).
-		Daily(fromCreatedDate, partitionByRepo, p.partitionByPrAuthor).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(DailyPullRequestActivityStream).
-		Build()
-
-	p.weekly = projections.
-		FromStream(PullRequestEventStream).
-		Filter(filterByOpenedAndClosedActions).
-		Weekly(fromCreatedDate, partitionByRepo, p.partitionByPrAuthor).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(WeeklyPullRequestActivityStream).
-		Build()
-
-	p.monthly = projections.
-		FromStream(PullRequestEventStream).
-		Filter(filterByOpenedAndClosedActions).
-		Monthly(fromCreatedDate, partitionByRepo, p.partitionByPrAuthor).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(MonthlyPullRequestActivityStream).
-		Build()
-
-	p.quarterly = projections.
+	p.activity = projections.
 		FromStream(PullRequestEventStream).
 		Filter(filterByOpenedAndClosedActions).
-		Quarterly(fromCreatedDate, partitionByRepo, p.partitionByPrAuthor).
+		Periods(fromCreatedDate, projections.Daily, projections.Weekly, projections.Monthly, projections.Quarterly, projections.Yearly).
+		PartitionBy(partitionByRepo, p.partitionByPrAuthor).
 		Init(p.init).
 		Apply(p.apply).
-		ToStream(QuarterlyPullRequestActivityStream).
-		Build()
-
-	p.yearly = projections.
-		FromStream(PullRequestEventStream).
-		Filter(filterByOpenedAndClosedActions).
-		Yearly(fromCreatedDate, partitionByRepo, p.partitionByPrAuthor).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(YearlyPullRequestActivityStream).
-		Build()
-
-	p.sevenDaysMovingAverage = projections.
-		FromStream(PullRequestEventStream).
-		Filter(filterByOpenedAndClosedActions).
-		Daily(fromCreatedDate, partitionByRepo, p.partitionByPrAuthor).
-		Init(p.init).
-		Apply(p.apply).
-		Window(6, 0, "d7", p.applyMovingAverage).
-		ToStream(SevenDaysMovingAveragePullRequestActivityStream).
-		Build()
-
-	p.all = projections.
-		FromStreams(
-			DailyPullRequestActivityStream,
-			WeeklyPullRequestActivityStream,
-			MonthlyPullRequestActivityStream,
-			QuarterlyPullRequestActivityStream,
-			YearlyPullRequestActivityStream,
-			SevenDaysMovingAveragePullRequestActivityStream,
-		).
+		Merge(p.merge).
+		Windows(projections.Daily, projections.RollingAverage(7, "d7", "Opened", "Merged", "ClosedWithUnmergedCommits")).
 		ToStream(PullRequestActivityStream).
 		Persist("pr_activity", &PullRequestActivityState{}).
 		Build()
@@ -137,18 +90,12 @@ func (p *PullRequestActivityProjections) apply(state *PullRequestActivityState,
 	}
 }
 
-func (p *PullRequestActivityProjections) applyMovingAverage(state *PullRequestActivityState, msg *PullRequestActivityState, windowSize int) {
-	state.Opened += msg.Opened / float64(windowSize)
-	state.Merged += msg.Merged / float64(windowSize)
-	state.ClosedWithUnmergedCommits += msg.ClosedWithUnmergedCommits / float64(windowSize)
+func (p *PullRequestActivityProjections) merge(target, source *PullRequestActivityState) {
+	target.Opened += source.Opened
+	target.Merged += source.Merged
+	target.ClosedWithUnmergedCommits += source.ClosedWithUnmergedCommits
 }
 
 func (p *PullRequestActivityProjections) Register(engine projections.StreamProjectionEngine) {
-	engine.Register(p.daily)
-	engine.Register(p.weekly)
-	engine.Register(p.monthly)
-	engine.Register(p.quarterly)
-	engine.Register(p.yearly)
-	engine.Register(p.sevenDaysMovingAverage)
-	engine.Register(p.all)
+	engine.Register(p.activity)
 }
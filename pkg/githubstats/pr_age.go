@@ -66,14 +66,28 @@ func (p *pullRequestViewProjections) register(engine projections.StreamProjectio
 	engine.Register(p.view)
 }
 
+const PullRequestAgeStream = "all_pr_age"
+
+// The periods used to be published to a topic each, they are now all
+// published to PullRequestAgeStream.
 const (
-	DailyPullRequestAgeStream                  = "d_pr_age"
-	WeeklyPullRequestAgeStream                 = "w_pr_age"
-	MonthlyPullRequestAgeStream                = "m_pr_age"
-	QuarterlyPullRequestAgeStream              = "q_pr_age"
-	YearlyPullRequestAgeStream                 = "y_pr_age"
+	// Deprecated: use PullRequestAgeStream, whose states have Period d.
+	DailyPullRequestAgeStream = "d_pr_age"
+
+	// Deprecated: use PullRequestAgeStream, whose states have Period w.
+	WeeklyPullRequestAgeStream = "w_pr_age"
+
+	// Deprecated: use PullRequestAgeStream, whose states have Period m.
+	MonthlyPullRequestAgeStream = "m_pr_age"
+
+	// Deprecated: use PullRequestAgeStream, whose states have Period q.
+	QuarterlyPullRequestAgeStream = "q_pr_age"
+
+	// Deprecated: use PullRequestAgeStream, whose states have Period y.
+	YearlyPullRequestAgeStream = "y_pr_age"
+
+	// Deprecated: use PullRequestAgeStream, whose states have Period d7.
 	SevenDaysMovingAveragePullRequestAgeStream = "d7_pr_age"
-	PullRequestAgeStream                       = "all_pr_age"
 )
 
 type PullRequestAgeState struct {
@@ -86,14 +100,8 @@ type PullRequestAgeState struct {
 }
 
 type PullRequestAgeProjections struct {
-	ViewProjections        *pullRequestViewProjections
-	daily                  *projections.StreamProjection
-	sevenDaysMovingAverage *projections.StreamProjection
-	weekly                 *projections.StreamProjection
-	monthly                *projections.StreamProjection
-	quarterly              *projections.StreamProjection
-	yearly                 *projections.StreamProjection
-	all                    *projections.StreamProjection
+	ViewProjections *pullRequestViewProjections
+	age             *projections.StreamProjection
 }
 
 func NewPullRequestAgeProjections() *PullRequestAgeProjections {
@@ -101,76 +109,16 @@ func NewPullRequestAgeProjections() *PullRequestAgeProjections {
 
 	p.ViewProjections = newPullRequestViewProjections()
 
-	p.daily = projections.
-		FromStream(pullRequestViewStream).
-		Filter(p.filterByOpened).
-		Daily(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(DailyPullRequestAgeStream).
-		Build()
-
-	p.weekly = projections.
-		FromStream(pullRequestViewStream).
-		Filter(p.filterByOpened).
-		Weekly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(WeeklyPullRequestAgeStream).
-		Build()
-
-	p.monthly = projections.
-		FromStream(pullRequestViewStream).
-		Filter(p.filterByOpened).
-		Monthly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(MonthlyPullRequestAgeStream).
-		Build()
-
-	p.quarterly = projections.
-		FromStream(pullRequestViewStream).
-		Filter(p.filterByOpened).
-		Quarterly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(QuarterlyPullRequestAgeStream).
-		Build()
-
-	p.yearly = projections.
+	p.age = projections.
 		FromStream(pullRequestViewStream).
 		Filter(p.filterByOpened).
-		Yearly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
+		Periods(p.partitionByClosedAt, projections.Daily, projections.Weekly, projections.Monthly, projections.Quarterly, projections.Yearly).
+		PartitionBy(p.partitionByRepo, p.partitionByProposedBy).
 		Init(p.init).
 		Apply(p.apply).
+		Merge(p.merge).
 		Done(p.done).
-		ToStream(YearlyPullRequestAgeStream).
-		Build()
-
-	p.sevenDaysMovingAverage = projections.
-		FromStream(pullRequestViewStream).
-		Filter(p.filterByOpened).
-		Daily(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		Window(6, 0, "d7", p.applyMovingAverage).
-		ToStream(SevenDaysMovingAveragePullRequestAgeStream).
-		Build()
-
-	p.all = projections.
-		FromStreams(
-			DailyPullRequestAgeStream,
-			WeeklyPullRequestAgeStream,
-			MonthlyPullRequestAgeStream,
-			QuarterlyPullRequestAgeStream,
-			YearlyPullRequestAgeStream,
-			SevenDaysMovingAveragePullRequestAgeStream,
-		).
+		Windows(projections.Daily, projections.RollingPercentile(7, 0.5, "d7", "MedianAge")).
 		ToStream(PullRequestAgeStream).
 		Persist("pr_age", &PullRequestAgeState{}).
 		Build()
@@ -215,6 +163,10 @@ func (p *PullRequestAgeProjections) apply(state *PullRequestAgeState, viewState
 	state.ageItems = append(state.ageItems, viewState.closedAt.Sub(viewState.openedAt).Seconds())
 }
 
+func (p *PullRequestAgeProjections) merge(target, source *PullRequestAgeState) {
+	target.ageItems = append(target.ageItems, source.ageItems...)
+}
+
 func (p *PullRequestAgeProjections) done(stateArr []projections.ProjectionState) {
 	for _, s := range stateArr {
 		ageState := s.(*PullRequestAgeState)
@@ -222,29 +174,37 @@ func (p *PullRequestAgeProjections) done(stateArr []projections.ProjectionState)
 	}
 }
 
-func (p *PullRequestAgeProjections) applyMovingAverage(state *PullRequestAgeState, msg *PullRequestAgeState, windowSize int) {
-	state.MedianAge += msg.MedianAge / float64(windowSize)
+func (s *PullRequestAgeState) Samples() []float64 {
+	return s.ageItems
 }
 
 func (p *PullRequestAgeProjections) Register(engine projections.StreamProjectionEngine) {
 	p.ViewProjections.register(engine)
-	engine.Register(p.daily)
-	engine.Register(p.weekly)
-	engine.Register(p.monthly)
-	engine.Register(p.quarterly)
-	engine.Register(p.yearly)
-	engine.Register(p.sevenDaysMovingAverage)
-	engine.Register(p.all)
+	engine.Register(p.age)
 }
 
+const PullRequestOpenedToMergedStream = "all_pr_otm"
+
+// The periods used to be published to a topic each, they are now all
+// published to PullRequestOpenedToMergedStream.
 const (
-	DailyPullRequestOpenedToMergedStream                  = "d_pr_otm"
-	WeeklyPullRequestOpenedToMergedStream                 = "w_pr_otm"
-	MonthlyPullRequestOpenedToMergedStream                = "m_pr_otm"
-	QuarterlyPullRequestOpenedToMergedStream              = "q_pr_otm"
-	YearlyPullRequestOpenedToMergedStream                 = "y_pr_otm"
+	// Deprecated: use PullRequestOpenedToMergedStream, whose states have Period d.
+	DailyPullRequestOpenedToMergedStream = "d_pr_otm"
+
+	// Deprecated: use PullRequestOpenedToMergedStream, whose states have Period w.
+	WeeklyPullRequestOpenedToMergedStream = "w_pr_otm"
+
+	// Deprecated: use PullRequestOpenedToMergedStream, whose states have Period m.
+	MonthlyPullRequestOpenedToMergedStream = "m_pr_otm"
+
+	// Deprecated: use PullRequestOpenedToMergedStream, whose states have Period q.
+	QuarterlyPullRequestOpenedToMergedStream = "q_pr_otm"
+
+	// Deprecated: use PullRequestOpenedToMergedStream, whose states have Period y.
+	YearlyPullRequestOpenedToMergedStream = "y_pr_otm"
+
+	// Deprecated: use PullRequestOpenedToMergedStream, whose states have Period d7.
 	SevenDaysMovingAveragePullRequestOpenedToMergedStream = "d7_pr_otm"
-	PullRequestOpenedToMergedStream                       = "all_pr_otm"
 )
 
 type PullRequestOpenedToMergedState struct {
@@ -259,88 +219,27 @@ type PullRequestOpenedToMergedState struct {
 }
 
 type PullRequestOpenedToMergedProjections struct {
-	ViewProjections        *pullRequestViewProjections
-	daily                  *projections.StreamProjection
-	sevenDaysMovingAverage *projections.StreamProjection
-	weekly                 *projections.StreamProjection
-	monthly                *projections.StreamProjection
-	quarterly              *projections.StreamProjection
-	yearly                 *projections.StreamProjection
-	all                    *projections.StreamProjection
+	ViewProjections *pullRequestViewProjections
+	age             *projections.StreamProjection
 }
 
 func NewPullRequestOpenedToMergedProjections() *PullRequestOpenedToMergedProjections {
 	p := &PullRequestOpenedToMergedProjections{}
 
-	p.daily = projections.
+	p.age = projections.
 		FromStream(pullRequestViewStream).
 		Filter(p.filterByMerged).
-		Daily(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
+		Periods(p.partitionByClosedAt, projections.Daily, projections.Weekly, projections.Monthly, projections.Quarterly, projections.Yearly).
+		PartitionBy(p.partitionByRepo, p.partitionByProposedBy).
 		Init(p.init).
 		Apply(p.apply).
+		Merge(p.merge).
 		Done(p.done).
-		ToStream(DailyPullRequestOpenedToMergedStream).
-		Build()
-
-	p.weekly = projections.
-		FromStream(pullRequestViewStream).
-		Filter(p.filterByMerged).
-		Weekly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(WeeklyPullRequestOpenedToMergedStream).
-		Build()
-
-	p.monthly = projections.
-		FromStream(pullRequestViewStream).
-		Filter(p.filterByMerged).
-		Monthly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(MonthlyPullRequestOpenedToMergedStream).
-		Build()
-
-	p.quarterly = projections.
-		FromStream(pullRequestViewStream).
-		Filter(p.filterByMerged).
-		Quarterly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(QuarterlyPullRequestOpenedToMergedStream).
-		Build()
-
-	p.yearly = projections.
-		FromStream(pullRequestViewStream).
-		Filter(p.filterByMerged).
-		Yearly(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		ToStream(YearlyPullRequestOpenedToMergedStream).
-		Build()
-
-	p.sevenDaysMovingAverage = projections.
-		FromStream(pullRequestViewStream).
-		Filter(p.filterByMerged).
-		Daily(p.partitionByClosedAt, p.partitionByRepo, p.partitionByProposedBy).
-		Init(p.init).
-		Apply(p.apply).
-		Done(p.done).
-		Window(6, 0, "d7", p.applyMovingAverage).
-		ToStream(SevenDaysMovingAveragePullRequestOpenedToMergedStream).
-		Build()
-
-	p.all = projections.
-		FromStreams(
-			DailyPullRequestOpenedToMergedStream,
-			WeeklyPullRequestOpenedToMergedStream,
-			MonthlyPullRequestOpenedToMergedStream,
-			QuarterlyPullRequestOpenedToMergedStream,
-			YearlyPullRequestOpenedToMergedStream,
-			SevenDaysMovingAveragePullRequestOpenedToMergedStream,
+		Windows(
+			projections.Daily,
+			projections.RollingPercentile(7, 0.15, "d7", "Percentile15"),
+			projections.RollingPercentile(7, 0.5, "d7", "Percentile50"),
+			projections.RollingPercentile(7, 0.85, "d7", "Percentile85"),
 		).
 		ToStream(PullRequestOpenedToMergedStream).
 		Persist("pr_opened_to_merged", &PullRequestOpenedToMergedState{}).
@@ -383,6 +282,10 @@ func (p *PullRequestOpenedToMergedProjections) apply(state *PullRequestOpenedToM
 	state.ageItems = append(state.ageItems, viewState.closedAt.Sub(viewState.openedAt).Seconds())
 }
 
+func (p *PullRequestOpenedToMergedProjections) merge(target, source *PullRequestOpenedToMergedState) {
+	target.ageItems = append(target.ageItems, source.ageItems...)
+}
+
 func (p *PullRequestOpenedToMergedProjections) done(stateArr []projections.ProjectionState) {
 	for _, s := range stateArr {
 		ageState := s.(*PullRequestOpenedToMergedState)
@@ -392,18 +295,10 @@ func (p *PullRequestOpenedToMergedProjections) done(stateArr []projections.Proje
 	}
 }
 
-func (p *PullRequestOpenedToMergedProjections) applyMovingAverage(state *PullRequestOpenedToMergedState, msg *PullRequestOpenedToMergedState, windowSize int) {
-	state.Percentile15 += msg.Percentile15 / float64(windowSize)
-	state.Percentile50 += msg.Percentile50 / float64(windowSize)
-	state.Percentile85 += msg.Percentile85 / float64(windowSize)
+func (s *PullRequestOpenedToMergedState) Samples() []float64 {
+	return s.ageItems
 }
 
 func (p *PullRequestOpenedToMergedProjections) Register(engine projections.StreamProjectionEngine) {
-	engine.Register(p.daily)
-	engine.Register(p.weekly)
-	engine.Register(p.monthly)
-	engine.Register(p.quarterly)
-	engine.Register(p.yearly)
-	engine.Register(p.sevenDaysMovingAverage)
-	engine.Register(p.all)
+	engine.Register(p.age)
 }
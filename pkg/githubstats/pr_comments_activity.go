@@ -7,14 +7,28 @@ import (
 	"github.com/grafana/devtools/pkg/streams/projections"
 )
 
+const PullRequestCommentsActivityStream = "all_pr_comments"
+
+// The periods used to be published to a topic each, they are now all
+// published to PullRequestCommentsActivityStream.
 const (
-	DailyPullRequestCommentsActivityStream                  = "d_pr_comments"
-	WeeklyPullRequestCommentsActivityStream                 = "w_pr_comments"
-	MonthlyPullRequestCommentsActivityStream                = "m_pr_comments"
-	QuarterlyPullRequestCommentsActivityStream              = "q_pr_comments"
-	YearlyPullRequestCommentsActivityStream                 = "y_pr_comments"
+	// Deprecated: use PullRequestCommentsActivityStream, whose states have Period d.
+	DailyPullRequestCommentsActivityStream = "d_pr_comments"
+
+	// Deprecated: use PullRequestCommentsActivityStream, whose states have Period w.
+	WeeklyPullRequestCommentsActivityStream = "w_pr_comments"
+
+	// Deprecated: use PullRequestCommentsActivityStream, whose states have Period m.
+	MonthlyPullRequestCommentsActivityStream = "m_pr_comments"
+
+	// Deprecated: use PullRequestCommentsActivityStream, whose states have Period q.
+	QuarterlyPullRequestCommentsActivityStream = "q_pr_comments"
+
+	// Deprecated: use PullRequestCommentsActivityStream, whose states have Period y.
+	YearlyPullRequestCommentsActivityStream = "y_pr_comments"
+
+	// Deprecated: use PullRequestCommentsActivityStream, whose states have Period d7.
 	SevenDaysMovingAveragePullRequestCommentsActivityStream = "d7_pr_comments"
-	PullRequestCommentsActivityStream                       = "all_pr_comments"
 )
 
 type PullRequestCommentsActivityState struct {
@@ -26,81 +40,20 @@ type PullRequestCommentsActivityState struct {
 }
 
 type PullRequestCommentsActivityProjections struct {
-	daily                  *projections.StreamProjection
-	sevenDaysMovingAverage *projections.StreamProjection
-	weekly                 *projections.StreamProjection
-	monthly                *projections.StreamProjection
-	quarterly              *projections.StreamProjection
-	yearly                 *projections.StreamProjection
-	all                    *projections.StreamProjection
+	activity *projections.StreamProjection
 }
 
 func NewPullRequestCommentsActivityProjections() *PullRequestCommentsActivityProjections {
 	p := &PullRequestCommentsActivityProjections{}
-	p.daily = projections.
-		FromStream(IssueCommentEventStream).
-		Filter(p.filterPullRequestComments).
-		Daily(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(DailyPullRequestCommentsActivityStream).
-		Build()
-
-	p.weekly = projections.
-		FromStream(IssueCommentEventStream).
-		Filter(p.filterPullRequestComments).
-		Weekly(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(WeeklyPullRequestCommentsActivityStream).
-		Build()
-
-	p.monthly = projections.
-		FromStream(IssueCommentEventStream).
-		Filter(p.filterPullRequestComments).
-		Monthly(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(MonthlyPullRequestCommentsActivityStream).
-		Build()
-
-	p.quarterly = projections.
+	p.activity = projections.
 		FromStream(IssueCommentEventStream).
 		Filter(p.filterPullRequestComments).
-		Quarterly(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
+		Periods(fromCreatedDate, projections.Daily, projections.Weekly, projections.Monthly, projections.Quarterly, projections.Yearly).
+		PartitionBy(partitionByRepo, p.partitionByAuthoredBy).
 		Init(p.init).
 		Apply(p.apply).
-		ToStream(QuarterlyPullRequestCommentsActivityStream).
-		Build()
-
-	p.yearly = projections.
-		FromStream(IssueCommentEventStream).
-		Filter(p.filterPullRequestComments).
-		Yearly(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
-		Init(p.init).
-		Apply(p.apply).
-		ToStream(YearlyPullRequestCommentsActivityStream).
-		Build()
-
-	p.sevenDaysMovingAverage = projections.
-		FromStream(IssueCommentEventStream).
-		Filter(p.filterPullRequestComments).
-		Daily(fromCreatedDate, partitionByRepo, p.partitionByAuthoredBy).
-		Init(p.init).
-		Apply(p.apply).
-		Window(6, 0, "d7", p.applyMovingAverage).
-		ToStream(SevenDaysMovingAveragePullRequestCommentsActivityStream).
-		Build()
-
-	p.all = projections.
-		FromStreams(
-			DailyPullRequestCommentsActivityStream,
-			WeeklyPullRequestCommentsActivityStream,
-			MonthlyPullRequestCommentsActivityStream,
-			QuarterlyPullRequestCommentsActivityStream,
-			YearlyPullRequestCommentsActivityStream,
-			SevenDaysMovingAveragePullRequestCommentsActivityStream,
-		).
+		Merge(p.merge).
+		Windows(projections.Daily, projections.RollingAverage(7, "d7", "Count")).
 		ToStream(PullRequestCommentsActivityStream).
 		Persist("pr_comments_activity", &PullRequestCommentsActivityState{}).
 		Build()
@@ -132,16 +85,10 @@ func (p *PullRequestCommentsActivityProjections) apply(state *PullRequestComment
 	state.Count++
 }
 
-func (p *PullRequestCommentsActivityProjections) applyMovingAverage(state *PullRequestCommentsActivityState, msg *PullRequestCommentsActivityState, windowSize int) {
-	state.Count += msg.Count / float64(windowSize)
+func (p *PullRequestCommentsActivityProjections) merge(target, source *PullRequestCommentsActivityState) {
+	target.Count += source.Count
 }
 
 func (p *PullRequestCommentsActivityProjections) Register(engine projections.StreamProjectionEngine) {
-	engine.Register(p.daily)
-	engine.Register(p.weekly)
-	engine.Register(p.monthly)
-	engine.Register(p.quarterly)
-	engine.Register(p.yearly)
-	engine.Register(p.sevenDaysMovingAverage)
-	engine.Register(p.all)
+	engine.Register(p.activity)
 }
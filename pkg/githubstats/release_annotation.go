@@ -1,6 +1,7 @@
 package githubstats
 
 import (
+	"sort"
 	"strings"
 	"time"
 
@@ -61,3 +62,28 @@ func (p *ReleaseAnnotationProjections) apply(state *ReleaseAnnotationState, evt
 func (p *ReleaseAnnotationProjections) Register(engine projections.StreamProjectionEngine) {
 	engine.Register(p.releaseAnnotation)
 }
+
+// ReleaseDates returns the sorted publish dates of the releases, excluding
+// prereleases, of the release events, e.g. to partition time series by
+// release windows using projections.NewReleaseWindowPartitioner.
+func ReleaseDates(events []*ghevents.Event) []time.Time {
+	dates := []time.Time{}
+	for _, evt := range events {
+		if evt.Type != ReleaseEventStream || evt.Payload.Release == nil || evt.Payload.Release.PublishedAt == nil {
+			continue
+		}
+
+		release := evt.Payload.Release
+		if release.Prerelease || strings.Contains(release.TagName, "beta") || strings.Contains(release.TagName, "rc") {
+			continue
+		}
+
+		dates = append(dates, *release.PublishedAt)
+	}
+
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	return dates
+}
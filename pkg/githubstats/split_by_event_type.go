@@ -25,7 +25,15 @@ func NewSplitByEventTypeProjections() *SplitByEventTypeProjections {
 	p.split = projections.
 		FromStream(GithubEventStream).
 		Filter(filterAndPatchRepos).
-		ToStreams(p.toStreams).
+		ToStreams(p.toStreams,
+			IssuesEventStream,
+			PullRequestEventStream,
+			IssueCommentEventStream,
+			PushEventStream,
+			ReleaseEventStream,
+			ForkEventStream,
+			WatchEventStream,
+		).
 		Build()
 
 	return p
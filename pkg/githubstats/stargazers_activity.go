@@ -7,13 +7,25 @@ import (
 	"github.com/grafana/devtools/pkg/streams/projections"
 )
 
+const StargazersActivityStream = "all_stars"
+
+// The periods used to be published to a topic each, they are now all
+// published to StargazersActivityStream.
 const (
-	DailyStargazersActivityStream     = "d_stars"
-	WeeklyStargazersActivityStream    = "w_stars"
-	MonthlyStargazersActivityStream   = "m_stars"
+	// Deprecated: use StargazersActivityStream, whose states have Period d.
+	DailyStargazersActivityStream = "d_stars"
+
+	// Deprecated: use StargazersActivityStream, whose states have Period w.
+	WeeklyStargazersActivityStream = "w_stars"
+
+	// Deprecated: use StargazersActivityStream, whose states have Period m.
+	MonthlyStargazersActivityStream = "m_stars"
+
+	// Deprecated: use StargazersActivityStream, whose states have Period q.
 	QuarterlyStargazersActivityStream = "q_stars"
-	YearlyStargazersActivityStream    = "y_stars"
-	StargazersActivityStream          = "all_stars"
+
+	// Deprecated: use StargazersActivityStream, whose states have Period y.
+	YearlyStargazersActivityStream = "y_stars"
 )
 
 type StargazersActivityState struct {
@@ -24,69 +36,27 @@ type StargazersActivityState struct {
 }
 
 type StargazersActivityProjections struct {
-	daily     *projections.StreamProjection
-	weekly    *projections.StreamProjection
-	monthly   *projections.StreamProjection
-	quarterly *projections.StreamProjection
-	yearly    *projections.StreamProjection
-	all       *projections.StreamProjection
+	activity *projections.StreamProjection
 }
 
+// NewStargazersActivityProjections counts per period and repo and publishes the
+// cumulative count up to each partition. The cumulative sums are windows over
+// the rolled up counts of each period, since a cumulative count can't be
+// rolled up itself.
 func NewStargazersActivityProjections() *StargazersActivityProjections {
 	p := &StargazersActivityProjections{}
-	p.daily = projections.
-		FromStream(WatchEventStream).
-		Daily(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		Window(-1, 0, "d", p.applyCummalativeSum).
-		ToStream(DailyStargazersActivityStream).
-		Build()
-
-	p.weekly = projections.
+	p.activity = projections.
 		FromStream(WatchEventStream).
-		Weekly(fromCreatedDate, partitionByRepo).
+		Periods(fromCreatedDate, projections.Daily, projections.Weekly, projections.Monthly, projections.Quarterly, projections.Yearly).
+		PartitionBy(partitionByRepo).
 		Init(p.init).
 		Apply(p.apply).
-		Window(-1, 0, "w", p.applyCummalativeSum).
-		ToStream(WeeklyStargazersActivityStream).
-		Build()
-
-	p.monthly = projections.
-		FromStream(WatchEventStream).
-		Monthly(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		Window(-1, 0, "m", p.applyCummalativeSum).
-		ToStream(MonthlyStargazersActivityStream).
-		Build()
-
-	p.quarterly = projections.
-		FromStream(WatchEventStream).
-		Quarterly(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		Window(-1, 0, "q", p.applyCummalativeSum).
-		ToStream(QuarterlyStargazersActivityStream).
-		Build()
-
-	p.yearly = projections.
-		FromStream(WatchEventStream).
-		Yearly(fromCreatedDate, partitionByRepo).
-		Init(p.init).
-		Apply(p.apply).
-		Window(-1, 0, "y", p.applyCummalativeSum).
-		ToStream(YearlyStargazersActivityStream).
-		Build()
-
-	p.all = projections.
-		FromStreams(
-			DailyStargazersActivityStream,
-			WeeklyStargazersActivityStream,
-			MonthlyStargazersActivityStream,
-			QuarterlyStargazersActivityStream,
-			YearlyStargazersActivityStream,
-		).
+		Merge(p.merge).
+		Windows(projections.Daily, projections.CumulativeSum("d", "Count")).
+		Windows(projections.Weekly, projections.CumulativeSum("w", "Count")).
+		Windows(projections.Monthly, projections.CumulativeSum("m", "Count")).
+		Windows(projections.Quarterly, projections.CumulativeSum("q", "Count")).
+		Windows(projections.Yearly, projections.CumulativeSum("y", "Count")).
 		ToStream(StargazersActivityStream).
 		Persist("stargazers_activity", &StargazersActivityState{}).
 		Build()
@@ -106,15 +76,10 @@ func (p *StargazersActivityProjections) apply(state *StargazersActivityState, ev
 	state.Count++
 }
 
-func (p *StargazersActivityProjections) applyCummalativeSum(state *StargazersActivityState, msg *StargazersActivityState, windowSize int) {
-	state.Count += msg.Count
+func (p *StargazersActivityProjections) merge(target, source *StargazersActivityState) {
+	target.Count += source.Count
 }
 
 func (p *StargazersActivityProjections) Register(engine projections.StreamProjectionEngine) {
-	engine.Register(p.daily)
-	engine.Register(p.weekly)
-	engine.Register(p.monthly)
-	engine.Register(p.quarterly)
-	engine.Register(p.yearly)
-	engine.Register(p.all)
+	engine.Register(p.activity)
 }
@@ -1,11 +1,10 @@
 package githubstats
 
 import (
-	"math"
-	"sort"
 	"time"
 
 	"github.com/grafana/devtools/pkg/ghevents"
+	"github.com/grafana/devtools/pkg/streams/projections"
 )
 
 var skipRepos = []string{}
@@ -70,20 +69,5 @@ func mapUserLoginToGroup(login string) string {
 }
 
 func percentile(k float64, values []float64) float64 {
-	if len(values) == 0 {
-		return 0
-	}
-	sort.Float64s(values)
-	index := k * float64(len(values))
-
-	if index != float64(int64(index)) {
-		index = math.Round(index)
-		if int(index) == 0 {
-			return values[int(index)]
-		}
-		return values[int(index)-1]
-	}
-
-	slice := values[int(index)-1 : int(index)+1]
-	return (slice[0] + slice[1]) / 2
+	return projections.Percentile(k, values)
 }
@@ -0,0 +1,78 @@
+package streams
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/mailru/easyjson"
+)
+
+// Codec encodes and decodes messages for buses that move messages out of
+// process memory.
+type Codec interface {
+	Encode(msg T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+type jsonCodec struct {
+	msgType reflect.Type
+}
+
+// NewJSONCodec creates a codec that encodes messages as JSON. Messages are
+// decoded into new values of the same type as template, which must be a
+// pointer, e.g. &ghevents.Event{}.
+func NewJSONCodec(template interface{}) Codec {
+	t := reflect.TypeOf(template)
+	if t.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("json codec template must be a pointer, got %s", t))
+	}
+
+	return &jsonCodec{msgType: t.Elem()}
+}
+
+func (c *jsonCodec) Encode(msg T) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (c *jsonCodec) Decode(data []byte) (T, error) {
+	msg := reflect.New(c.msgType).Interface()
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+type easyJSONCodec struct {
+	msgType reflect.Type
+}
+
+// NewEasyJSONCodec creates a codec that encodes messages as JSON using the
+// code generated by easyjson. template must be a pointer to a type
+// implementing easyjson.Unmarshaler, e.g. &ghevents.Event{}.
+func NewEasyJSONCodec(template interface{}) Codec {
+	if _, ok := template.(easyjson.Unmarshaler); !ok {
+		panic(fmt.Sprintf("easyjson codec template must implement easyjson.Unmarshaler, got %T", template))
+	}
+
+	return &easyJSONCodec{msgType: reflect.TypeOf(template).Elem()}
+}
+
+func (c *easyJSONCodec) Encode(msg T) ([]byte, error) {
+	m, ok := msg.(easyjson.Marshaler)
+	if !ok {
+		return nil, fmt.Errorf("message of type %T does not implement easyjson.Marshaler", msg)
+	}
+
+	return easyjson.Marshal(m)
+}
+
+func (c *easyJSONCodec) Decode(data []byte) (T, error) {
+	msg := reflect.New(c.msgType).Interface()
+	if err := easyjson.Unmarshal(data, msg.(easyjson.Unmarshaler)); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
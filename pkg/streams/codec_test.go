@@ -0,0 +1,46 @@
+package streams
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/ghevents"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCodecs(t *testing.T) {
+	Convey("Test codecs", t, func() {
+		evt := &ghevents.Event{
+			ID:        "1",
+			Type:      "PushEvent",
+			CreatedAt: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+			Repo:      &ghevents.Repo{ID: 2, Name: "grafana/grafana"},
+		}
+
+		Convey("JSON codec should decode encoded message", func() {
+			codec := NewJSONCodec(&ghevents.Event{})
+			data, err := codec.Encode(evt)
+			So(err, ShouldBeNil)
+
+			decoded, err := codec.Decode(data)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, evt)
+		})
+
+		Convey("easyjson codec should decode encoded message", func() {
+			codec := NewEasyJSONCodec(&ghevents.Event{})
+			data, err := codec.Encode(evt)
+			So(err, ShouldBeNil)
+
+			decoded, err := codec.Decode(data)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, evt)
+		})
+
+		Convey("easyjson codec should fail to encode message not generated by easyjson", func() {
+			codec := NewEasyJSONCodec(&ghevents.Event{})
+			_, err := codec.Encode(1)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
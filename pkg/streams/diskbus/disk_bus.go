@@ -0,0 +1,567 @@
+package diskbus
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	"github.com/grafana/devtools/pkg/streams/log"
+)
+
+// DefaultSegmentSize is the size in bytes after which a new segment file is
+// started for a topic.
+const DefaultSegmentSize int64 = 64 * 1024 * 1024
+
+// DiskBus is a bus that stores the messages published to topics with a
+// registered codec in append-only segment files, one directory per topic.
+// Subscribers keep track of their consumed offset per topic, which means that
+// a run using the same data directory resumes from unconsumed publications.
+// Topics without a registered codec are passed through in memory.
+//
+// Like the in memory bus, a subscription ends when a stream has been received
+// for each of its topics. Unconsumed publications of a previous run are
+// replaced by the publications of the current run for topics declared with
+// DeclarePublisher, and delivered otherwise.
+type DiskBus struct {
+	logger         log.Logger
+	dir            string
+	segmentSize    int64
+	codecsMu       sync.RWMutex
+	codecs         map[string]streams.Codec
+	topicsMu       sync.Mutex
+	topics         map[string]*topicLog
+	subscriptionMu sync.RWMutex
+	subscriptions  []*subscription
+	declared       map[string]bool
+	started        bool
+	resumed        chan bool
+	errMu          sync.Mutex
+	err            error
+}
+
+// New creates a disk bus storing its topics in dir.
+func New(dir string) (*DiskBus, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &DiskBus{
+		logger:        log.New(),
+		dir:           dir,
+		segmentSize:   DefaultSegmentSize,
+		codecs:        map[string]streams.Codec{},
+		topics:        map[string]*topicLog{},
+		subscriptions: []*subscription{},
+		declared:      map[string]bool{},
+		resumed:       make(chan bool),
+	}, nil
+}
+
+func (bus *DiskBus) SetLogger(logger log.Logger) {
+	bus.logger = logger.New("logger", "disk-bus")
+}
+
+// SetSegmentSize sets the size in bytes after which a new segment file is
+// started.
+func (bus *DiskBus) SetSegmentSize(size int64) {
+	bus.segmentSize = size
+}
+
+// RegisterCodec stores messages published to topic on disk using codec.
+func (bus *DiskBus) RegisterCodec(topic string, codec streams.Codec) {
+	bus.codecsMu.Lock()
+	defer bus.codecsMu.Unlock()
+	bus.codecs[topic] = codec
+}
+
+func (bus *DiskBus) getCodec(topic string) streams.Codec {
+	bus.codecsMu.RLock()
+	defer bus.codecsMu.RUnlock()
+	return bus.codecs[topic]
+}
+
+func (bus *DiskBus) Subscribe(topics []string, fn streams.SubscribeFunc) error {
+	bus.subscriptionMu.Lock()
+	defer bus.subscriptionMu.Unlock()
+
+	if bus.started {
+		return fmt.Errorf("you cannot subscribe after bus have been started")
+	}
+
+	// consumer ids must be stable between runs to be able to resume
+	name := strings.Join(topics, ",")
+	n := 0
+	for _, s := range bus.subscriptions {
+		if strings.Join(s.Topics, ",") == name {
+			n++
+		}
+	}
+	id := fmt.Sprintf("%s-%d", consumerIDChars.ReplaceAllString(name, "_"), n)
+
+	bus.subscriptions = append(bus.subscriptions, newSubscription(id, topics, fn))
+	bus.logger.Debug("subscription added", "topics", name, "consumer", id)
+
+	return nil
+}
+
+// DeclarePublisher declares that toTopics are published by this run, which
+// replaces their unconsumed publications of previous runs.
+func (bus *DiskBus) DeclarePublisher(fromTopics []string, toTopics []string) {
+	bus.subscriptionMu.Lock()
+	defer bus.subscriptionMu.Unlock()
+
+	for _, topic := range toTopics {
+		bus.declared[topic] = true
+	}
+}
+
+func (bus *DiskBus) isDeclared(topic string) bool {
+	bus.subscriptionMu.RLock()
+	defer bus.subscriptionMu.RUnlock()
+	return bus.declared[topic]
+}
+
+var consumerIDChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+func (bus *DiskBus) subscriptionsByTopic(topic string) []*subscription {
+	bus.subscriptionMu.RLock()
+	defer bus.subscriptionMu.RUnlock()
+
+	result := []*subscription{}
+	for _, s := range bus.subscriptions {
+		if s.HasTopic(topic) {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+func (bus *DiskBus) Publish(topic string, stream streams.Readable) error {
+	codec := bus.getCodec(topic)
+
+	if codec == nil {
+		bus.publishInMemory(topic, stream)
+		return nil
+	}
+
+	l, err := bus.topicLog(topic)
+	if err != nil {
+		go stream.Drain()
+		bus.fail(fmt.Errorf("failed to open topic %s: %v", topic, err))
+		bus.closeTopic(topic)
+		return err
+	}
+
+	go bus.writePublication(topic, l, codec, stream)
+
+	return nil
+}
+
+func (bus *DiskBus) publishInMemory(topic string, stream streams.Readable) {
+	subscriptions := bus.subscriptionsByTopic(topic)
+
+	if len(subscriptions) == 0 {
+		bus.logger.Debug("no subscribers for published topic, draining messages in stream", "topic", topic)
+		go stream.Drain()
+		return
+	}
+
+	splitStreams := stream.Split(len(subscriptions))
+	for n, s := range subscriptions {
+		splitStream := splitStreams[n]
+		if !s.AddReadyStream(topic, func() streams.Readable { return splitStream }) {
+			go splitStream.Drain()
+		}
+	}
+}
+
+func (bus *DiskBus) writePublication(topic string, l *topicLog, codec streams.Codec, stream streams.Readable) {
+	start := time.Now()
+	l.publishMu.Lock()
+
+	var writeErr error
+	msgCount := 0
+
+	for msg := range stream {
+		if writeErr != nil {
+			continue
+		}
+
+		data, err := codec.Encode(msg)
+		if err != nil {
+			bus.logger.Error("failed to encode message, skipping it", "topic", topic, "error", err)
+			bus.fail(fmt.Errorf("failed to encode message of topic %s: %v", topic, err))
+			continue
+		}
+
+		if err := l.append(recordTypeMessage, data); err != nil {
+			writeErr = err
+			continue
+		}
+		msgCount++
+	}
+
+	var offset int64
+	if writeErr == nil {
+		offset, writeErr = l.commit()
+	}
+
+	if writeErr != nil {
+		bus.logger.Error("failed to write publication to disk, discarding it", "topic", topic, "error", writeErr)
+		if err := l.rollback(); err != nil {
+			bus.logger.Error("failed to rollback publication", "topic", topic, "error", err)
+		}
+		l.publishMu.Unlock()
+		bus.fail(fmt.Errorf("failed to write publication of topic %s: %v", topic, writeErr))
+		bus.closeTopic(topic)
+		return
+	}
+
+	l.publishMu.Unlock()
+	bus.logger.Debug("publication written to disk", "topic", topic, "messages", msgCount, "offset", offset, "took", time.Since(start))
+
+	for _, s := range bus.subscriptionsByTopic(topic) {
+		go bus.deliver(s, topic, l)
+	}
+}
+
+// deliver hands the oldest publication of topic not yet consumed by s over to
+// the subscription.
+func (bus *DiskBus) deliver(s *subscription, topic string, l *topicLog) {
+	accepted := s.AddReadyStream(topic, func() streams.Readable {
+		return bus.readPublication(s, topic, l)
+	})
+
+	if !accepted {
+		bus.logger.Info("subscription already received a publication of topic, leaving publication for the next run", "topic", topic, "consumer", s.id)
+	}
+}
+
+func (bus *DiskBus) readPublication(s *subscription, topic string, l *topicLog) streams.Readable {
+	r, w := streams.New()
+	codec := bus.getCodec(topic)
+
+	go func() {
+		defer w.Close()
+
+		// stale publications skipped by resume are not read
+		<-bus.resumed
+
+		offset, err := l.consumerOffset(s.id)
+		if err != nil {
+			bus.logger.Error("failed to read consumer offset", "topic", topic, "consumer", s.id, "error", err)
+			bus.fail(fmt.Errorf("failed to read consumer offset of topic %s: %v", topic, err))
+			return
+		}
+		if skipped, exists := s.getOffsets()[topic]; exists && skipped > offset {
+			offset = skipped
+		}
+
+		next, err := l.readPublication(offset, func(payload []byte) {
+			msg, err := codec.Decode(payload)
+			if err != nil {
+				bus.logger.Error("failed to decode message, skipping it", "topic", topic, "consumer", s.id, "error", err)
+				bus.fail(fmt.Errorf("failed to decode message of topic %s: %v", topic, err))
+				return
+			}
+			w <- msg
+		})
+
+		if err != nil {
+			bus.logger.Error("failed to read publication from disk", "topic", topic, "consumer", s.id, "offset", offset, "error", err)
+			bus.fail(fmt.Errorf("failed to read publication of topic %s: %v", topic, err))
+			return
+		}
+
+		s.setOffset(topic, next)
+	}()
+
+	return r
+}
+
+func (bus *DiskBus) topicLog(topic string) (*topicLog, error) {
+	bus.topicsMu.Lock()
+	defer bus.topicsMu.Unlock()
+
+	if l, exists := bus.topics[topic]; exists {
+		return l, nil
+	}
+
+	l, err := openTopicLog(filepath.Join(bus.dir, url.PathEscape(topic)), bus.segmentSize)
+	if err != nil {
+		return nil, err
+	}
+
+	bus.topics[topic] = l
+
+	return l, nil
+}
+
+func (bus *DiskBus) Start() <-chan bool {
+	done := make(chan bool, 1)
+
+	bus.subscriptionMu.Lock()
+	bus.started = true
+	subscriptions := append([]*subscription{}, bus.subscriptions...)
+	bus.subscriptionMu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(subscriptions))
+
+	for _, s := range subscriptions {
+		go func(s *subscription) {
+			bus.run(s)
+			wg.Done()
+		}(s)
+
+		bus.resume(s)
+	}
+	close(bus.resumed)
+
+	go func() {
+		wg.Wait()
+		done <- bus.Err() == nil
+		close(done)
+	}()
+
+	return done
+}
+
+// Err returns why the bus failed, or nil. The bus fails when a publication
+// cannot be written, read or decoded, its subscribers then miss messages.
+func (bus *DiskBus) Err() error {
+	bus.errMu.Lock()
+	defer bus.errMu.Unlock()
+
+	return bus.err
+}
+
+// fail records err, Start then reports that the bus failed once all
+// subscriptions completed. Only the first error is kept.
+func (bus *DiskBus) fail(err error) {
+	bus.errMu.Lock()
+	defer bus.errMu.Unlock()
+
+	if bus.err == nil {
+		bus.err = err
+	}
+}
+
+// closeTopic ends the wait of the subscriptions of a topic whose publication
+// was lost.
+func (bus *DiskBus) closeTopic(topic string) {
+	for _, s := range bus.subscriptionsByTopic(topic) {
+		s.CloseTopic(topic)
+	}
+}
+
+// resume delivers publications stored by a previous run that s has not
+// consumed yet, unless the topic is declared to be published by this run, in
+// which case they are skipped.
+func (bus *DiskBus) resume(s *subscription) {
+	for _, topic := range s.Topics {
+		if bus.getCodec(topic) == nil {
+			continue
+		}
+
+		l, err := bus.topicLog(topic)
+		if err != nil {
+			bus.logger.Error("failed to open topic", "topic", topic, "error", err)
+			bus.fail(fmt.Errorf("failed to open topic %s: %v", topic, err))
+			continue
+		}
+
+		offset, err := l.consumerOffset(s.id)
+		if err != nil {
+			bus.logger.Error("failed to read consumer offset", "topic", topic, "consumer", s.id, "error", err)
+			bus.fail(fmt.Errorf("failed to read consumer offset of topic %s: %v", topic, err))
+			continue
+		}
+
+		if offset < l.startOffset && bus.isDeclared(topic) {
+			bus.logger.Info("skipping unconsumed publications of previous run, topic is published again", "topic", topic, "consumer", s.id, "offset", offset, "skippedTo", l.startOffset)
+			s.setOffset(topic, l.startOffset)
+			continue
+		}
+
+		if offset < l.committedOffset() {
+			bus.logger.Info("resuming unconsumed publication of previous run", "topic", topic, "consumer", s.id, "offset", offset)
+			go bus.deliver(s, topic, l)
+		}
+	}
+}
+
+func (bus *DiskBus) run(s *subscription) {
+	<-s.Ready
+	start := time.Now()
+	bus.logger.Debug("starting to publish messages to subscriber...", "topics", strings.Join(s.Topics, ","))
+
+	s.Run(bus)
+
+	bus.logger.Debug("sending of messages to subscriber done", "topics", strings.Join(s.Topics, ","), "took", time.Since(start))
+
+	// offsets are only stored once the subscriber is done to not lose messages
+	// when the process dies while they are being processed. Messages are
+	// therefore delivered at least once: publications of an interrupted run
+	// are delivered again by the next run, or replaced if it publishes the
+	// topic again.
+	for topic, offset := range s.getOffsets() {
+		l, err := bus.topicLog(topic)
+		if err == nil {
+			err = l.storeConsumerOffset(s.id, offset)
+		}
+
+		if err != nil {
+			bus.logger.Error("failed to store consumer offset", "topic", topic, "consumer", s.id, "error", err)
+		}
+	}
+}
+
+// Close closes all open segment files.
+func (bus *DiskBus) Close() error {
+	bus.topicsMu.Lock()
+	defer bus.topicsMu.Unlock()
+
+	var lastErr error
+	for topic, l := range bus.topics {
+		if err := l.close(); err != nil {
+			lastErr = err
+		}
+		delete(bus.topics, topic)
+	}
+
+	return lastErr
+}
+
+// TopicInfo describes a topic stored on disk.
+type TopicInfo struct {
+	Name            string
+	Segments        int
+	CommittedOffset int64
+	ConsumerOffsets map[string]int64
+}
+
+// Topics returns the names of the topics stored in the data directory.
+func (bus *DiskBus) Topics() ([]string, error) {
+	files, err := ioutil.ReadDir(bus.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := []string{}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+
+		topic, err := url.PathUnescape(f.Name())
+		if err != nil {
+			continue
+		}
+		topics = append(topics, topic)
+	}
+
+	sort.Strings(topics)
+
+	return topics, nil
+}
+
+// Describe returns information about the segments and consumers of topic.
+func (bus *DiskBus) Describe(topic string) (*TopicInfo, error) {
+	l, err := bus.topicLog(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &TopicInfo{
+		Name:            topic,
+		CommittedOffset: l.committedOffset(),
+		ConsumerOffsets: map[string]int64{},
+	}
+
+	segments, err := listSegments(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	info.Segments = len(segments)
+
+	files, err := ioutil.ReadDir(filepath.Join(l.dir, consumersDir))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), offsetExt) {
+			continue
+		}
+
+		id := strings.TrimSuffix(f.Name(), offsetExt)
+		offset, err := l.consumerOffset(id)
+		if err != nil {
+			return nil, err
+		}
+		info.ConsumerOffsets[id] = offset
+	}
+
+	return info, nil
+}
+
+// ReadAll reads all committed messages of topic. Messages are decoded using
+// the codec registered for topic, or returned as raw []byte if there is none.
+func (bus *DiskBus) ReadAll(topic string) (streams.Readable, <-chan error) {
+	r, w := streams.New()
+	outErr := make(chan error, 1)
+
+	go func() {
+		defer close(outErr)
+		defer w.Close()
+
+		l, err := bus.topicLog(topic)
+		if err != nil {
+			outErr <- err
+			return
+		}
+
+		codec := bus.getCodec(topic)
+		committed := l.committedOffset()
+
+		err = l.scan(0, func(offset int64, recordType byte, payload []byte) bool {
+			if offset >= committed {
+				return false
+			}
+
+			if recordType != recordTypeMessage {
+				return true
+			}
+
+			if codec == nil {
+				w <- payload
+				return true
+			}
+
+			msg, err := codec.Decode(payload)
+			if err != nil {
+				bus.logger.Error("failed to decode message, skipping it", "topic", topic, "error", err)
+				return true
+			}
+			w <- msg
+
+			return true
+		})
+
+		if err != nil {
+			outErr <- err
+		}
+	}()
+
+	return r, outErr
+}
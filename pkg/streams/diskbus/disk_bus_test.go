@@ -0,0 +1,257 @@
+package diskbus
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testMessage struct {
+	Value int
+}
+
+func TestDiskBus(t *testing.T) {
+	Convey("Test disk bus", t, func() {
+		dir, err := ioutil.TempDir("", "diskbus")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		bus, err := New(dir)
+		So(err, ShouldBeNil)
+		bus.RegisterCodec("stream-1", streams.NewJSONCodec(&testMessage{}))
+
+		collect := func(received *[]streams.T) streams.SubscribeFunc {
+			return func(p streams.Publisher, stream streams.Readable) {
+				for msg := range stream {
+					*received = append(*received, msg)
+				}
+			}
+		}
+
+		Convey("Publish to topic with codec should store messages and send them to subscriber", func() {
+			received := []streams.T{}
+			bus.Subscribe([]string{"stream-1"}, collect(&received))
+
+			startBusAndRun(bus, func() {
+				bus.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}, &testMessage{Value: 2}))
+			})
+
+			So(received, ShouldResemble, []streams.T{&testMessage{Value: 1}, &testMessage{Value: 2}})
+
+			info, err := bus.Describe("stream-1")
+			So(err, ShouldBeNil)
+			So(info.CommittedOffset, ShouldBeGreaterThan, 0)
+			So(info.ConsumerOffsets, ShouldResemble, map[string]int64{"stream-1-0": info.CommittedOffset})
+		})
+
+		Convey("Publish to topic without codec should send messages in memory", func() {
+			received := []streams.T{}
+			bus.Subscribe([]string{"stream-2"}, collect(&received))
+
+			startBusAndRun(bus, func() {
+				bus.Publish("stream-2", streams.NewFromRange(0, 2))
+			})
+
+			So(received, ShouldResemble, []streams.T{0, 1, 2})
+
+			topics, err := bus.Topics()
+			So(err, ShouldBeNil)
+			So(topics, ShouldBeEmpty)
+		})
+
+		Convey("Publish larger than segment size should roll segments and be readable", func() {
+			bus.SetSegmentSize(64)
+			received := []streams.T{}
+			bus.Subscribe([]string{"stream-1"}, collect(&received))
+
+			messages := []interface{}{}
+			for n := 0; n < 20; n++ {
+				messages = append(messages, &testMessage{Value: n})
+			}
+
+			startBusAndRun(bus, func() {
+				bus.Publish("stream-1", streams.NewFrom(messages...))
+			})
+
+			So(received, ShouldHaveLength, 20)
+
+			info, err := bus.Describe("stream-1")
+			So(err, ShouldBeNil)
+			So(info.Segments, ShouldBeGreaterThan, 1)
+
+			all, errors := bus.ReadAll("stream-1")
+			read := []streams.T{}
+			for msg := range all {
+				read = append(read, msg)
+			}
+			So(<-errors, ShouldBeNil)
+			So(read, ShouldResemble, received)
+		})
+
+		Convey("Subscriber of new bus should resume from unconsumed publication stored on disk", func() {
+			startBusAndRun(bus, func() {
+				bus.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}))
+			})
+			<-time.After(50 * time.Millisecond)
+			So(bus.Close(), ShouldBeNil)
+
+			resumed, err := New(dir)
+			So(err, ShouldBeNil)
+			resumed.RegisterCodec("stream-1", streams.NewJSONCodec(&testMessage{}))
+
+			received := []streams.T{}
+			resumed.Subscribe([]string{"stream-1"}, collect(&received))
+			<-resumed.Start()
+
+			So(received, ShouldResemble, []streams.T{&testMessage{Value: 1}})
+
+			info, err := resumed.Describe("stream-1")
+			So(err, ShouldBeNil)
+			So(info.ConsumerOffsets["stream-1-0"], ShouldEqual, info.CommittedOffset)
+		})
+
+		Convey("Resumed subscriber should get publication of declared topic published again instead of stale one", func() {
+			startBusAndRun(bus, func() {
+				bus.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}))
+			})
+			<-time.After(50 * time.Millisecond)
+			So(bus.Close(), ShouldBeNil)
+
+			resumed, err := New(dir)
+			So(err, ShouldBeNil)
+			resumed.RegisterCodec("stream-1", streams.NewJSONCodec(&testMessage{}))
+			resumed.DeclarePublisher(nil, []string{"stream-1"})
+
+			received := []streams.T{}
+			resumed.Subscribe([]string{"stream-1"}, collect(&received))
+			startBusAndRun(resumed, func() {
+				resumed.Publish("stream-1", streams.NewFrom(&testMessage{Value: 2}))
+			})
+
+			So(received, ShouldResemble, []streams.T{&testMessage{Value: 2}})
+
+			info, err := resumed.Describe("stream-1")
+			So(err, ShouldBeNil)
+			So(info.ConsumerOffsets["stream-1-0"], ShouldEqual, info.CommittedOffset)
+		})
+
+		Convey("Resumed subscriber should get stale publication first and leave publication of undeclared topic for next run", func() {
+			startBusAndRun(bus, func() {
+				bus.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}))
+			})
+			<-time.After(50 * time.Millisecond)
+			So(bus.Close(), ShouldBeNil)
+
+			resumed, err := New(dir)
+			So(err, ShouldBeNil)
+			resumed.RegisterCodec("stream-1", streams.NewJSONCodec(&testMessage{}))
+
+			received := []streams.T{}
+			resumed.Subscribe([]string{"stream-1"}, collect(&received))
+			startBusAndRun(resumed, func() {
+				resumed.Publish("stream-1", streams.NewFrom(&testMessage{Value: 2}))
+			})
+			<-time.After(50 * time.Millisecond)
+			So(received, ShouldResemble, []streams.T{&testMessage{Value: 1}})
+			So(resumed.Close(), ShouldBeNil)
+
+			next, err := New(dir)
+			So(err, ShouldBeNil)
+			next.RegisterCodec("stream-1", streams.NewJSONCodec(&testMessage{}))
+
+			received = []streams.T{}
+			next.Subscribe([]string{"stream-1"}, collect(&received))
+			<-next.Start()
+			So(received, ShouldResemble, []streams.T{&testMessage{Value: 2}})
+		})
+
+		Convey("Messages that fail to decode should fail the bus", func() {
+			bus.RegisterCodec("stream-3", &failingDecodeCodec{streams.NewJSONCodec(&testMessage{})})
+			received := []streams.T{}
+			bus.Subscribe([]string{"stream-3"}, collect(&received))
+
+			done := bus.Start()
+			bus.Publish("stream-3", streams.NewFrom(&testMessage{Value: 1}))
+
+			So(<-done, ShouldBeFalse)
+			So(received, ShouldBeEmpty)
+			So(bus.Err().Error(), ShouldEqual, "failed to decode message of topic stream-3: invalid message")
+		})
+	})
+}
+
+type failingDecodeCodec struct {
+	streams.Codec
+}
+
+func (c *failingDecodeCodec) Decode(data []byte) (streams.T, error) {
+	return nil, fmt.Errorf("invalid message")
+}
+
+func TestTopicLog(t *testing.T) {
+	Convey("Test topic log", t, func() {
+		dir, err := ioutil.TempDir("", "topiclog")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		l, err := openTopicLog(dir, 32)
+		So(err, ShouldBeNil)
+
+		So(l.append(recordTypeMessage, []byte(`{"value":1}`)), ShouldBeNil)
+		committed, err := l.commit()
+		So(err, ShouldBeNil)
+
+		Convey("Reopening log should discard incomplete publication", func() {
+			So(l.append(recordTypeMessage, []byte(`{"value":2}`)), ShouldBeNil)
+			So(l.append(recordTypeMessage, []byte(`{"value":3}`)), ShouldBeNil)
+			So(l.close(), ShouldBeNil)
+
+			reopened, err := openTopicLog(dir, 32)
+			So(err, ShouldBeNil)
+			So(reopened.committedOffset(), ShouldEqual, committed)
+
+			payloads := []string{}
+			next, err := reopened.readPublication(0, func(payload []byte) {
+				payloads = append(payloads, string(payload))
+			})
+			So(err, ShouldBeNil)
+			So(next, ShouldEqual, committed)
+			So(payloads, ShouldResemble, []string{`{"value":1}`})
+		})
+
+		Convey("Rollback should discard current publication", func() {
+			So(l.append(recordTypeMessage, []byte(`{"value":2}`)), ShouldBeNil)
+			So(l.rollback(), ShouldBeNil)
+			So(l.append(recordTypeMessage, []byte(`{"value":3}`)), ShouldBeNil)
+			end, err := l.commit()
+			So(err, ShouldBeNil)
+
+			payloads := []string{}
+			next, err := l.readPublication(committed, func(payload []byte) {
+				payloads = append(payloads, string(payload))
+			})
+			So(err, ShouldBeNil)
+			So(next, ShouldEqual, end)
+			So(payloads, ShouldResemble, []string{`{"value":3}`})
+		})
+	})
+}
+
+func startBusAndRun(bus streams.Bus, fn func()) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		<-bus.Start()
+		wg.Done()
+	}()
+
+	fn()
+	wg.Wait()
+}
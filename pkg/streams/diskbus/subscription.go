@@ -0,0 +1,41 @@
+package diskbus
+
+import (
+	"sync"
+
+	"github.com/grafana/devtools/pkg/streams"
+)
+
+// subscription is a subscription with the consumer id its offsets are stored
+// by.
+type subscription struct {
+	*streams.Subscription
+	id        string
+	offsetsMu sync.Mutex
+	offsets   map[string]int64
+}
+
+func newSubscription(id string, topics []string, subscribeFn streams.SubscribeFunc) *subscription {
+	return &subscription{
+		Subscription: streams.NewSubscription(topics, subscribeFn),
+		id:           id,
+		offsets:      map[string]int64{},
+	}
+}
+
+func (s *subscription) setOffset(topic string, offset int64) {
+	s.offsetsMu.Lock()
+	defer s.offsetsMu.Unlock()
+	s.offsets[topic] = offset
+}
+
+func (s *subscription) getOffsets() map[string]int64 {
+	s.offsetsMu.Lock()
+	defer s.offsetsMu.Unlock()
+
+	offsets := map[string]int64{}
+	for topic, offset := range s.offsets {
+		offsets[topic] = offset
+	}
+	return offsets
+}
@@ -0,0 +1,397 @@
+package diskbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	recordTypeMessage byte = iota
+	recordTypeEndOfPublication
+)
+
+const (
+	recordHeaderSize = 9
+	segmentExt       = ".seg"
+	offsetExt        = ".offset"
+	consumersDir     = "consumers"
+)
+
+// topicLog is an append-only log of records stored in segment files. Each
+// segment file is named by the offset of its first record. Messages of a
+// publication are followed by an end of publication record, only offsets up
+// to the last end of publication record are considered committed.
+type topicLog struct {
+	dir         string
+	segmentSize int64
+	publishMu   sync.Mutex
+	mu          sync.Mutex
+	segments    []int64
+	active      *os.File
+	writer      *bufio.Writer
+	activeBase  int64
+	end         int64
+	committed   int64
+	// startOffset is the committed offset when the log was opened, the end
+	// of the publications of previous runs
+	startOffset int64
+}
+
+func openTopicLog(dir string, segmentSize int64) (*topicLog, error) {
+	if err := os.MkdirAll(filepath.Join(dir, consumersDir), 0755); err != nil {
+		return nil, err
+	}
+
+	l := &topicLog{
+		dir:         dir,
+		segmentSize: segmentSize,
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	l.segments = segments
+
+	if err := l.recover(); err != nil {
+		return nil, err
+	}
+	l.startOffset = l.committed
+
+	return l, nil
+}
+
+func listSegments(dir string) ([]int64, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := []int64{}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), segmentExt) {
+			continue
+		}
+
+		base, err := strconv.ParseInt(strings.TrimSuffix(f.Name(), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, base)
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+
+	return segments, nil
+}
+
+func (l *topicLog) segmentPath(base int64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", base, segmentExt))
+}
+
+// recover finds the offset of the last committed publication and removes
+// anything written after it, e.g. a publication interrupted by a crash.
+func (l *topicLog) recover() error {
+	committed := int64(0)
+
+	err := l.scan(0, func(offset int64, recordType byte, payload []byte) bool {
+		if recordType == recordTypeEndOfPublication {
+			committed = offset + recordHeaderSize
+		}
+		return true
+	})
+	if err != nil && err != io.ErrUnexpectedEOF && err != errCorruptRecord {
+		return err
+	}
+
+	return l.truncate(committed)
+}
+
+// truncate removes everything written after offset and opens the segment
+// containing offset for writing.
+func (l *topicLog) truncate(offset int64) error {
+	retained := []int64{}
+	for _, base := range l.segments {
+		if base >= offset && !(base == 0 && offset == 0) {
+			if err := os.Remove(l.segmentPath(base)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		retained = append(retained, base)
+	}
+	l.segments = retained
+
+	if len(l.segments) == 0 {
+		l.segments = []int64{0}
+	}
+
+	l.activeBase = l.segments[len(l.segments)-1]
+	f, err := os.OpenFile(l.segmentPath(l.activeBase), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Truncate(offset - l.activeBase); err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return err
+	}
+
+	l.active = f
+	l.writer = bufio.NewWriterSize(f, 64*1024)
+	l.end = offset
+	l.committed = offset
+
+	return nil
+}
+
+// rollback discards the messages of the current publication.
+func (l *topicLog) rollback() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.writer.Flush()
+	if err := l.active.Close(); err != nil {
+		return err
+	}
+
+	return l.truncate(l.committed)
+}
+
+var errCorruptRecord = fmt.Errorf("corrupt record")
+
+// scan reads records starting at offset and calls fn for each of them until fn
+// returns false or the end of the log is reached.
+func (l *topicLog) scan(offset int64, fn func(offset int64, recordType byte, payload []byte) bool) error {
+	l.mu.Lock()
+	segments := append([]int64{}, l.segments...)
+	l.mu.Unlock()
+
+	for n, base := range segments {
+		next := int64(-1)
+		if n+1 < len(segments) {
+			next = segments[n+1]
+		}
+
+		if next != -1 && offset >= next {
+			continue
+		}
+
+		cont, err := l.scanSegment(base, offset, fn)
+		if err != nil {
+			return err
+		}
+
+		if !cont {
+			return nil
+		}
+
+		if next != -1 {
+			offset = next
+		}
+	}
+
+	return nil
+}
+
+func (l *topicLog) scanSegment(base, offset int64, fn func(offset int64, recordType byte, payload []byte) bool) (bool, error) {
+	f, err := os.Open(l.segmentPath(base))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset-base, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	r := bufio.NewReaderSize(f, 64*1024)
+	header := make([]byte, recordHeaderSize)
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return true, nil
+			}
+			return false, err
+		}
+
+		length := binary.BigEndian.Uint32(header[1:5])
+		checksum := binary.BigEndian.Uint32(header[5:9])
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF {
+				return false, io.ErrUnexpectedEOF
+			}
+			return false, err
+		}
+
+		if crc32.ChecksumIEEE(payload) != checksum {
+			return false, errCorruptRecord
+		}
+
+		if !fn(offset, header[0], payload) {
+			return false, nil
+		}
+
+		offset += recordHeaderSize + int64(length)
+	}
+}
+
+func (l *topicLog) append(recordType byte, payload []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.end > l.activeBase && l.end-l.activeBase >= l.segmentSize {
+		if err := l.roll(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, recordHeaderSize+len(payload))
+	record[0] = recordType
+	binary.BigEndian.PutUint32(record[1:5], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[5:9], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+
+	if _, err := l.writer.Write(record); err != nil {
+		return err
+	}
+
+	l.end += int64(len(record))
+
+	return nil
+}
+
+func (l *topicLog) roll() error {
+	if err := l.writer.Flush(); err != nil {
+		return err
+	}
+
+	if err := l.active.Sync(); err != nil {
+		return err
+	}
+
+	if err := l.active.Close(); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.segmentPath(l.end), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	l.active = f
+	l.writer.Reset(f)
+	l.activeBase = l.end
+	l.segments = append(l.segments, l.end)
+
+	return nil
+}
+
+// commit ends the current publication and flushes it to disk. Returns the
+// offset after the end of the publication.
+func (l *topicLog) commit() (int64, error) {
+	if err := l.append(recordTypeEndOfPublication, []byte{}); err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.writer.Flush(); err != nil {
+		return 0, err
+	}
+
+	if err := l.active.Sync(); err != nil {
+		return 0, err
+	}
+
+	l.committed = l.end
+
+	return l.committed, nil
+}
+
+func (l *topicLog) committedOffset() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.committed
+}
+
+// readPublication calls fn with the payload of each message of the
+// publication starting at offset and returns the offset after its end.
+func (l *topicLog) readPublication(offset int64, fn func(payload []byte)) (int64, error) {
+	l.mu.Lock()
+	committed := l.committed
+	l.mu.Unlock()
+
+	if offset >= committed {
+		return offset, fmt.Errorf("no committed publication at offset %d", offset)
+	}
+
+	next := offset
+	err := l.scan(offset, func(recordOffset int64, recordType byte, payload []byte) bool {
+		next = recordOffset + recordHeaderSize + int64(len(payload))
+		if recordType == recordTypeEndOfPublication {
+			return false
+		}
+
+		fn(payload)
+		return true
+	})
+
+	return next, err
+}
+
+func (l *topicLog) consumerOffsetPath(consumerID string) string {
+	return filepath.Join(l.dir, consumersDir, consumerID+offsetExt)
+}
+
+func (l *topicLog) consumerOffset(consumerID string) (int64, error) {
+	data, err := ioutil.ReadFile(l.consumerOffsetPath(consumerID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func (l *topicLog) storeConsumerOffset(consumerID string, offset int64) error {
+	path := l.consumerOffsetPath(consumerID)
+	tmpPath := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmpPath, []byte(strconv.FormatInt(offset, 10)), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func (l *topicLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.writer.Flush(); err != nil {
+		return err
+	}
+
+	return l.active.Close()
+}
@@ -0,0 +1,210 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oddContextKey is added, with a nil value, to log messages having a context
+// with an odd number of items.
+const oddContextKey = "log_error"
+
+var reservedJSONKeys = map[string]bool{
+	"time":   true,
+	"level":  true,
+	"msg":    true,
+	"caller": true,
+}
+
+// NewJSONHandler writes log messages of at least useLogLevel to w, one JSON
+// object per line with the keys time (RFC3339), level, msg, caller and the
+// key/value pairs of the context. Context keys clashing with these are
+// prefixed with ctx_.
+func NewJSONHandler(w io.Writer, useLogLevel LogLevel) *LogHandler {
+	var mu sync.Mutex
+
+	return &LogHandler{
+		CatchAllHandler: func(logLevel LogLevel, msg string, ctx ...interface{}) {
+			if logLevel < useLogLevel {
+				return
+			}
+
+			line := formatJSON(time.Now(), logLevel, msg, caller(), ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			w.Write(line)
+		},
+	}
+}
+
+func formatJSON(t time.Time, logLevel LogLevel, msg string, caller string, ctx []interface{}) []byte {
+	if len(ctx)%2 != 0 {
+		ctx = append(ctx, nil, oddContextKey, "odd number of context items, added nil value")
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	writeJSONField(buf, "time", t.Format(time.RFC3339Nano))
+	buf.WriteByte(',')
+	writeJSONField(buf, "level", logLevel.String())
+	buf.WriteByte(',')
+	writeJSONField(buf, "msg", msg)
+	if caller != "" {
+		buf.WriteByte(',')
+		writeJSONField(buf, "caller", caller)
+	}
+
+	for n := 0; n < len(ctx); n += 2 {
+		key, ok := ctx[n].(string)
+		if !ok {
+			key = fmt.Sprintf("%v", ctx[n])
+		}
+		if reservedJSONKeys[key] {
+			key = "ctx_" + key
+		}
+
+		buf.WriteByte(',')
+		writeJSONField(buf, key, ctx[n+1])
+	}
+
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+	buf.Write(jsonValue(value))
+}
+
+func jsonValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case time.Time:
+		value = v.Format(time.RFC3339Nano)
+	case time.Duration:
+		value = v.String()
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+
+	return data
+}
+
+var logPackageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// caller returns file:line of the first caller outside of this package, i.e.
+// the code calling the logger.
+func caller() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if filepath.Dir(frame.File) != logPackageDir || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+		}
+
+		if !more {
+			return ""
+		}
+	}
+}
+
+// NewLevelFilterHandler passes log messages of at least useLogLevel to
+// handler.
+func NewLevelFilterHandler(useLogLevel LogLevel, handler *LogHandler) *LogHandler {
+	filter := func(logLevel LogLevel, fn LogHandlerFunc) LogHandlerFunc {
+		if logLevel < useLogLevel {
+			return nil
+		}
+		return fn
+	}
+
+	result := &LogHandler{
+		DebugHandler: filter(LogLevelDebug, handler.DebugHandler),
+		InfoHandler:  filter(LogLevelInfo, handler.InfoHandler),
+		WarnHandler:  filter(LogLevelWarning, handler.WarnHandler),
+		ErrorHandler: filter(LogLevelError, handler.ErrorHandler),
+		FatalHandler: filter(LogLevelFatal, handler.FatalHandler),
+	}
+
+	if handler.CatchAllHandler != nil {
+		result.CatchAllHandler = func(logLevel LogLevel, msg string, ctx ...interface{}) {
+			if logLevel < useLogLevel {
+				return
+			}
+			handler.CatchAllHandler(logLevel, msg, ctx...)
+		}
+	}
+
+	return result
+}
+
+// NewMultiHandler fans log messages out to all handlers. Combined with
+// NewLevelFilterHandler each handler, e.g. stdout and a file, can use its own
+// log level.
+func NewMultiHandler(handlers ...*LogHandler) *LogHandler {
+	multi := func(get func(h *LogHandler) LogHandlerFunc) LogHandlerFunc {
+		fns := []LogHandlerFunc{}
+		for _, h := range handlers {
+			if h != nil && get(h) != nil {
+				fns = append(fns, get(h))
+			}
+		}
+
+		if len(fns) == 0 {
+			return nil
+		}
+
+		return func(msg string, ctx ...interface{}) {
+			for _, fn := range fns {
+				fn(msg, ctx...)
+			}
+		}
+	}
+
+	result := &LogHandler{
+		DebugHandler: multi(func(h *LogHandler) LogHandlerFunc { return h.DebugHandler }),
+		InfoHandler:  multi(func(h *LogHandler) LogHandlerFunc { return h.InfoHandler }),
+		WarnHandler:  multi(func(h *LogHandler) LogHandlerFunc { return h.WarnHandler }),
+		ErrorHandler: multi(func(h *LogHandler) LogHandlerFunc { return h.ErrorHandler }),
+		FatalHandler: multi(func(h *LogHandler) LogHandlerFunc { return h.FatalHandler }),
+	}
+
+	catchAll := []CatchAllLogHandlerFunc{}
+	for _, h := range handlers {
+		if h != nil && h.CatchAllHandler != nil {
+			catchAll = append(catchAll, h.CatchAllHandler)
+		}
+	}
+
+	if len(catchAll) > 0 {
+		result.CatchAllHandler = func(logLevel LogLevel, msg string, ctx ...interface{}) {
+			for _, fn := range catchAll {
+				fn(logLevel, msg, ctx...)
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,96 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONHandler(t *testing.T) {
+	Convey("Test JSON handler", t, func() {
+		buf := &bytes.Buffer{}
+		logger := New()
+		logger.AddHandler(NewJSONHandler(buf, LogLevelInfo))
+
+		readLines := func() []map[string]interface{} {
+			result := []map[string]interface{}{}
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				m := map[string]interface{}{}
+				So(json.Unmarshal([]byte(line), &m), ShouldBeNil)
+				result = append(result, m)
+			}
+			return result
+		}
+
+		Convey("Should write context as key/value pairs", func() {
+			logger.New("logger", "test").Info("downloaded", "files", 2, "took", time.Second, "error", errors.New("failed"))
+
+			lines := readLines()
+			So(lines, ShouldHaveLength, 1)
+			So(lines[0]["level"], ShouldEqual, "info")
+			So(lines[0]["msg"], ShouldEqual, "downloaded")
+			So(lines[0]["logger"], ShouldEqual, "test")
+			So(lines[0]["files"], ShouldEqual, 2)
+			So(lines[0]["took"], ShouldEqual, "1s")
+			So(lines[0]["error"], ShouldEqual, "failed")
+			So(lines[0]["caller"], ShouldStartWith, "json_handler_test.go:")
+
+			_, err := time.Parse(time.RFC3339, lines[0]["time"].(string))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Should filter by log level", func() {
+			logger.Debug("hidden")
+			logger.Warn("shown")
+
+			lines := readLines()
+			So(lines, ShouldHaveLength, 1)
+			So(lines[0]["msg"], ShouldEqual, "shown")
+		})
+
+		Convey("Should handle odd context and reserved keys", func() {
+			logger.Info("odd", "msg", "other", "key")
+
+			lines := readLines()
+			So(lines[0]["msg"], ShouldEqual, "odd")
+			So(lines[0]["ctx_msg"], ShouldEqual, "other")
+			So(lines[0], ShouldContainKey, "key")
+			So(lines[0]["key"], ShouldBeNil)
+			So(lines[0], ShouldContainKey, oddContextKey)
+		})
+	})
+}
+
+func TestMultiHandler(t *testing.T) {
+	Convey("Test multi handler", t, func() {
+		debugBuf := &bytes.Buffer{}
+		errorBuf := &bytes.Buffer{}
+		infoMessages := []string{}
+
+		logger := New()
+		logger.AddHandler(NewMultiHandler(
+			NewJSONHandler(debugBuf, LogLevelDebug),
+			NewJSONHandler(errorBuf, LogLevelError),
+			NewLevelFilterHandler(LogLevelInfo, &LogHandler{
+				DebugHandler: func(msg string, ctx ...interface{}) { infoMessages = append(infoMessages, msg) },
+				InfoHandler:  func(msg string, ctx ...interface{}) { infoMessages = append(infoMessages, msg) },
+			}),
+		))
+
+		logger.Debug("debug")
+		logger.Info("info")
+		logger.Error("error")
+
+		So(strings.Count(debugBuf.String(), "\n"), ShouldEqual, 3)
+		So(strings.Count(errorBuf.String(), "\n"), ShouldEqual, 1)
+		So(infoMessages, ShouldResemble, []string{"info"})
+	})
+}
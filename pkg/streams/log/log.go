@@ -206,3 +206,25 @@ func (l *subLogger) newContext(ctx []interface{}) []interface{} {
 	resultCtx = append(resultCtx, ctx...)
 	return resultCtx
 }
+
+type contextProvider interface {
+	logContext() []interface{}
+}
+
+// Context returns the key/value pairs logger adds to each log message, e.g.
+// to attach them to other instrumentation like spans.
+func Context(logger Logger) []interface{} {
+	if p, ok := logger.(contextProvider); ok {
+		return p.logContext()
+	}
+
+	return []interface{}{}
+}
+
+func (l *RootLogger) logContext() []interface{} {
+	return l.newContext(nil)
+}
+
+func (l *subLogger) logContext() []interface{} {
+	return l.root.newContext(l.context)
+}
@@ -15,39 +15,97 @@ type InMemoryBus struct {
 	Subscriptions  StreamSubscriptionCollection
 	subscriptionMu sync.RWMutex
 	started        bool
+	longLived      bool
+	closedTopics   map[string]bool
+	publishers     []*declaredPublisher
+	readyTimeout   time.Duration
+	active         int
+	done           chan bool
+	doneOnce       sync.Once
+	errMu          sync.Mutex
+	err            error
 }
 
 func New() *InMemoryBus {
 	return &InMemoryBus{
 		logger:        log.New(),
 		Subscriptions: StreamSubscriptionCollection{},
+		closedTopics:  map[string]bool{},
+		done:          make(chan bool, 1),
 	}
 }
 
+// NewLongLived creates a bus where topics can be published repeatedly and
+// subscribers can join after the bus has been started. A subscription only
+// receives streams published after it joined and ends when all of its topics
+// have been closed using CloseTopic.
+func NewLongLived() *InMemoryBus {
+	bus := New()
+	bus.longLived = true
+	return bus
+}
+
 func (bus *InMemoryBus) SetLogger(logger log.Logger) {
 	bus.logger = logger.New("logger", "memory-bus")
 }
 
+// SetReadyTimeout sets how long a subscription may wait for its first
+// published stream. A subscription not ready in time fails the bus. Zero
+// waits forever. The timeout starts with the bus, so it must also cover the
+// time the subscribers publishing to the subscription take to finish.
+func (bus *InMemoryBus) SetReadyTimeout(timeout time.Duration) {
+	bus.readyTimeout = timeout
+}
+
 func (bus *InMemoryBus) Subscribe(topics []string, fn streams.SubscribeFunc) error {
-	if bus.started {
+	bus.subscriptionMu.Lock()
+	defer bus.subscriptionMu.Unlock()
+
+	if bus.started && !bus.longLived {
 		return fmt.Errorf("you cannot subscribe after bus have been started")
 	}
 
-	bus.subscriptionMu.Lock()
-	bus.Subscriptions = append(bus.Subscriptions, NewStreamSubscription(topics, fn))
-	bus.subscriptionMu.Unlock()
+	subscription := NewStreamSubscription(topics, fn)
+	subscription.SetMessageCounter(func(topic string) func() {
+		return messagesOut.WithLabelValues(topic).Inc
+	})
+	if bus.longLived {
+		subscription.SetLongLived()
+	}
+	for _, topic := range topics {
+		if bus.closedTopics[topic] {
+			subscription.CloseTopic(topic)
+		}
+	}
+	bus.Subscriptions = append(bus.Subscriptions, subscription)
+
+	if bus.started {
+		bus.active++
+		go bus.run(subscription)
+	}
 
-	bus.logger.Debug("subscription added", "topics", strings.Join(topics, ","))
+	bus.logger.Debug("subscription added", "topics", strings.Join(topics, ","), "started", bus.started)
 
 	return nil
 }
 
 func (bus *InMemoryBus) Publish(topic string, stream streams.Readable) error {
 	bus.subscriptionMu.RLock()
-	defer bus.subscriptionMu.RUnlock()
-	subscriptionCount := bus.Subscriptions.countByTopic(topic)
+	closed := bus.closedTopics[topic]
+	subscriptions := StreamSubscriptionCollection{}
+	for _, subscription := range bus.Subscriptions {
+		if subscription.HasTopic(topic) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	bus.subscriptionMu.RUnlock()
 
-	if subscriptionCount == 0 {
+	if closed {
+		go stream.Drain()
+		return fmt.Errorf("cannot publish to closed topic %s", topic)
+	}
+
+	if len(subscriptions) == 0 {
 		bus.logger.Debug("no subscribers for published topic, draining messages in stream", "topic", topic)
 		go func() {
 			stream.Drain()
@@ -55,60 +113,142 @@ func (bus *InMemoryBus) Publish(topic string, stream streams.Readable) error {
 		return nil
 	}
 
-	streams := stream.Split(subscriptionCount)
-	streamIndex := 0
+	in := messagesIn.WithLabelValues(topic)
+	splitStreams := streams.SplitObserved(len(subscriptions), stream, func(streams.T) { in.Inc() })
 
-	for _, subscription := range bus.Subscriptions {
-		if subscription.hasTopic(topic) {
-			subscription.addReadyStream(streams[streamIndex])
-			streamIndex++
+	for n, subscription := range subscriptions {
+		stream := splitStreams[n]
+		if !subscription.AddReadyStream(topic, func() streams.Readable { return stream }) {
+			bus.logger.Debug("subscription already completed, draining messages in stream", "topic", topic, "topics", strings.Join(subscription.Topics, ","))
+			go stream.Drain()
 		}
 	}
 
 	return nil
 }
 
+// CloseTopic marks topic as closed. Subscriptions end once all of their
+// topics have been closed or, unless the bus is long lived, published.
+// Publishing to a closed topic returns an error.
+func (bus *InMemoryBus) CloseTopic(topic string) {
+	bus.subscriptionMu.Lock()
+	defer bus.subscriptionMu.Unlock()
+
+	bus.closedTopics[topic] = true
+
+	for _, subscription := range bus.Subscriptions {
+		if subscription.HasTopic(topic) {
+			subscription.CloseTopic(topic)
+		}
+	}
+
+	bus.logger.Debug("topic closed", "topic", topic)
+}
+
+// Start runs the subscriptions. The returned channel receives true once all
+// subscriptions completed, or false if the bus failed, e.g. due to invalid
+// subscriptions, in which case Err returns why.
 func (bus *InMemoryBus) Start() <-chan bool {
-	done := make(chan bool)
-	var wg sync.WaitGroup
-	wg.Add(len(bus.Subscriptions))
+	if err := bus.Validate(); err != nil {
+		bus.logger.Error("invalid subscriptions, bus will never complete", "error", err)
+		bus.fail(err)
+		return bus.done
+	}
+
+	bus.subscriptionMu.Lock()
+	defer bus.subscriptionMu.Unlock()
+
+	bus.started = true
+	bus.active += len(bus.Subscriptions)
 
 	for _, cs := range bus.Subscriptions {
-		go func(cs *StreamSubscription) {
-			<-cs.Ready
-			start := time.Now()
-			bus.logger.Debug("starting to publish messages to subscriber...", "topics", strings.Join(cs.Topics, ","))
-			in, out := streams.New()
-
-			go func() {
-				cs.SubscribeFn(bus, in)
-				bus.logger.Debug("sending of messages to subscriber done", "topics", strings.Join(cs.Topics, ","), "took", time.Since(start))
-				wg.Done()
-			}()
-
-			var wg2 sync.WaitGroup
-			wg2.Add(len(cs.Topics))
-
-			go func() {
-				for publishedStream := range cs.PublishedStreams {
-					go func(publishedStream streams.Readable) {
-						for msg := range publishedStream {
-							out <- msg
-						}
-						wg2.Done()
-					}(publishedStream)
-				}
-			}()
-
-			wg2.Wait()
-			close(out)
-		}(cs)
-	}
-
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-
-	return done
+		go bus.run(cs)
+	}
+
+	if bus.active == 0 {
+		bus.finish(nil)
+	}
+
+	return bus.done
+}
+
+// Err returns why the bus failed, or nil.
+func (bus *InMemoryBus) Err() error {
+	bus.errMu.Lock()
+	defer bus.errMu.Unlock()
+
+	return bus.err
+}
+
+// fail ends all subscriptions and completes the bus with err. Streams
+// published afterwards are drained, so publishers do not block.
+func (bus *InMemoryBus) fail(err error) {
+	bus.subscriptionMu.RLock()
+	subscriptions := append(StreamSubscriptionCollection{}, bus.Subscriptions...)
+	bus.subscriptionMu.RUnlock()
+
+	for _, cs := range subscriptions {
+		cs.Abandon()
+	}
+
+	bus.finish(err)
+}
+
+// finish completes the bus, failed if err is set. Only the first call has an
+// effect.
+func (bus *InMemoryBus) finish(err error) {
+	bus.doneOnce.Do(func() {
+		bus.errMu.Lock()
+		bus.err = err
+		bus.errMu.Unlock()
+
+		bus.done <- err == nil
+		close(bus.done)
+	})
+}
+
+func (bus *InMemoryBus) run(cs *StreamSubscription) {
+	if err := bus.waitUntilReady(cs); err != nil {
+		bus.logger.Error("subscription not ready, no stream published to any of its topics", "topics", strings.Join(cs.Topics, ","), "timeout", bus.readyTimeout)
+		bus.fail(err)
+		return
+	}
+
+	start := time.Now()
+	bus.logger.Debug("starting to publish messages to subscriber...", "topics", strings.Join(cs.Topics, ","))
+
+	cs.Run(bus)
+
+	bus.logger.Debug("sending of messages to subscriber done", "topics", strings.Join(cs.Topics, ","), "took", time.Since(start))
+	subscriptionDuration.WithLabelValues(strings.Join(cs.Topics, ",")).Observe(time.Since(start).Seconds())
+	bus.subscriptionDone()
+}
+
+func (bus *InMemoryBus) subscriptionDone() {
+	bus.subscriptionMu.Lock()
+	defer bus.subscriptionMu.Unlock()
+
+	bus.active--
+	if bus.active == 0 {
+		bus.finish(nil)
+	}
+}
+
+// waitUntilReady waits until a stream is published to the subscription, or
+// returns an error once the ready timeout expires.
+func (bus *InMemoryBus) waitUntilReady(cs *StreamSubscription) error {
+	if bus.readyTimeout <= 0 {
+		<-cs.Ready
+		return nil
+	}
+
+	timer := time.NewTimer(bus.readyTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-cs.Ready:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("subscription to %s not ready within %s", strings.Join(cs.Topics, ","), bus.readyTimeout)
+	}
 }
@@ -1,6 +1,7 @@
 package memorybus
 
 import (
+	"sort"
 	"sync"
 	"testing"
 	"time"
@@ -86,6 +87,103 @@ func TestInMemoryBus(t *testing.T) {
 
 			So(receivedMessages, ShouldResemble, []streams.T{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
 		})
+
+		Convey("Subscribe after bus have been started should return error", func() {
+			<-bus.Start()
+			err := bus.Subscribe([]string{"stream-1"}, func(p streams.Publisher, stream streams.Readable) {})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Close topic that is never published should end subscription", func() {
+			receivedMessages := []streams.T{}
+			bus.Subscribe([]string{"stream-1", "stream-2"}, func(p streams.Publisher, stream streams.Readable) {
+				for msg := range stream {
+					receivedMessages = append(receivedMessages, msg)
+				}
+			})
+
+			startBusAndRun(bus, func() {
+				bus.Publish("stream-1", streams.NewFromRange(0, 2))
+				bus.CloseTopic("stream-2")
+			})
+
+			So(receivedMessages, ShouldResemble, []streams.T{0, 1, 2})
+			So(bus.Publish("stream-2", streams.NewFrom("msg")), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Test long lived in memory bus", t, func() {
+		bus := NewLongLived()
+
+		Convey("Publish to topic multiple times should send all messages to subscriber until topic is closed", func() {
+			var mu sync.Mutex
+			receivedMessages := []streams.T{}
+			bus.Subscribe([]string{"stream-1"}, func(p streams.Publisher, stream streams.Readable) {
+				for msg := range stream {
+					mu.Lock()
+					receivedMessages = append(receivedMessages, msg)
+					mu.Unlock()
+				}
+			})
+
+			startBusAndRun(bus, func() {
+				bus.Publish("stream-1", streams.NewFromRange(0, 4))
+				bus.Publish("stream-1", streams.NewFromRange(5, 9))
+				<-time.After(10 * time.Millisecond)
+				bus.CloseTopic("stream-1")
+			})
+
+			sort.Slice(receivedMessages, func(i, j int) bool { return receivedMessages[i].(int) < receivedMessages[j].(int) })
+			So(receivedMessages, ShouldResemble, []streams.T{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+		})
+
+		Convey("Subscribe after bus have been started should receive later publications", func() {
+			var mu sync.Mutex
+			firstMessages := []streams.T{}
+			bus.Subscribe([]string{"stream-1"}, func(p streams.Publisher, stream streams.Readable) {
+				for msg := range stream {
+					mu.Lock()
+					firstMessages = append(firstMessages, msg)
+					mu.Unlock()
+				}
+			})
+
+			lateMessages := []streams.T{}
+			lateDone := make(chan bool)
+
+			startBusAndRun(bus, func() {
+				bus.Publish("stream-1", streams.NewFromRange(0, 2))
+				<-time.After(10 * time.Millisecond)
+
+				err := bus.Subscribe([]string{"stream-1"}, func(p streams.Publisher, stream streams.Readable) {
+					for msg := range stream {
+						lateMessages = append(lateMessages, msg)
+					}
+					close(lateDone)
+				})
+				So(err, ShouldBeNil)
+
+				bus.Publish("stream-1", streams.NewFromRange(3, 4))
+				<-time.After(10 * time.Millisecond)
+				bus.CloseTopic("stream-1")
+			})
+			<-lateDone
+
+			So(firstMessages, ShouldResemble, []streams.T{0, 1, 2, 3, 4})
+			So(lateMessages, ShouldResemble, []streams.T{3, 4})
+		})
+
+		Convey("Subscribe to closed topic should end subscription without messages", func() {
+			bus.CloseTopic("stream-1")
+			done := make(chan bool)
+			bus.Subscribe([]string{"stream-1"}, func(p streams.Publisher, stream streams.Readable) {
+				stream.Drain()
+				close(done)
+			})
+
+			<-bus.Start()
+			<-done
+		})
 	})
 }
 
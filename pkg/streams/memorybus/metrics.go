@@ -0,0 +1,19 @@
+package memorybus
+
+import "github.com/grafana/devtools/pkg/streams/metrics"
+
+var (
+	messagesIn = metrics.NewCounterVec(
+		"devtools_bus_messages_in_total",
+		"Number of messages published to a topic of the in memory bus.",
+		"topic")
+	messagesOut = metrics.NewCounterVec(
+		"devtools_bus_messages_out_total",
+		"Number of messages of a topic delivered to subscriptions of the in memory bus.",
+		"topic")
+	subscriptionDuration = metrics.NewHistogramVec(
+		"devtools_bus_subscription_duration_seconds",
+		"Time from a subscription of the in memory bus starting to receive messages until its subscriber is done.",
+		metrics.DefBuckets,
+		"topics")
+)
@@ -0,0 +1,28 @@
+package memorybus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/grafana/devtools/pkg/streams"
+	"github.com/grafana/devtools/pkg/streams/metrics"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("Test in memory bus metrics", t, func() {
+		bus := New()
+		bus.Subscribe([]string{"metrics-topic"}, func(p streams.Publisher, stream streams.Readable) { stream.Drain() })
+		bus.Subscribe([]string{"metrics-topic"}, func(p streams.Publisher, stream streams.Readable) { stream.Drain() })
+
+		done := bus.Start()
+		bus.Publish("metrics-topic", streams.NewFromRange(1, 3))
+		<-done
+
+		var buf bytes.Buffer
+		So(metrics.DefaultRegistry.WriteText(&buf), ShouldBeNil)
+		So(buf.String(), ShouldContainSubstring, "devtools_bus_messages_in_total{topic=\"metrics-topic\"} 3\n")
+		So(buf.String(), ShouldContainSubstring, "devtools_bus_messages_out_total{topic=\"metrics-topic\"} 6\n")
+		So(buf.String(), ShouldContainSubstring, "devtools_bus_subscription_duration_seconds_count{topics=\"metrics-topic\"} 2\n")
+	})
+}
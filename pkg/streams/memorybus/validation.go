@@ -0,0 +1,150 @@
+package memorybus
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/devtools/pkg/streams"
+)
+
+type declaredPublisher struct {
+	fromTopics []string
+	toTopics   []string
+}
+
+// ValidationError describes why the subscriptions of a bus would never
+// complete.
+type ValidationError struct {
+	UnpublishedTopics []string
+	Cycles            [][]string
+}
+
+func (e *ValidationError) Error() string {
+	parts := []string{}
+
+	if len(e.UnpublishedTopics) > 0 {
+		parts = append(parts, fmt.Sprintf("subscribed topics that are never published: %s", strings.Join(e.UnpublishedTopics, ", ")))
+	}
+
+	for _, cycle := range e.Cycles {
+		parts = append(parts, fmt.Sprintf("subscription cycle: %s", strings.Join(cycle, " -> ")))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// DeclarePublisher declares that toTopics will be published, either from
+// outside of the bus or by a subscriber of fromTopics.
+func (bus *InMemoryBus) DeclarePublisher(fromTopics []string, toTopics []string) {
+	bus.subscriptionMu.Lock()
+	defer bus.subscriptionMu.Unlock()
+
+	bus.publishers = append(bus.publishers, &declaredPublisher{
+		fromTopics: fromTopics,
+		toTopics:   toTopics,
+	})
+}
+
+// Validate verifies that every subscribed topic has a declared publisher and
+// that no topic depends on itself. Validation is skipped when no publishers
+// have been declared. Subscribed topics are not verified if a publisher
+// declared streams.AnyTopic.
+func (bus *InMemoryBus) Validate() error {
+	bus.subscriptionMu.RLock()
+	defer bus.subscriptionMu.RUnlock()
+
+	if len(bus.publishers) == 0 {
+		return nil
+	}
+
+	published := map[string]bool{}
+	edges := map[string][]string{}
+	for _, p := range bus.publishers {
+		toTopics := []string{}
+		for _, to := range p.toTopics {
+			published[to] = true
+			if to != streams.AnyTopic {
+				toTopics = append(toTopics, to)
+			}
+		}
+		for _, from := range p.fromTopics {
+			edges[from] = append(edges[from], toTopics...)
+		}
+	}
+
+	unpublished := map[string]bool{}
+	for _, subscription := range bus.Subscriptions {
+		for _, topic := range subscription.Topics {
+			if !published[topic] && !published[streams.AnyTopic] {
+				unpublished[topic] = true
+			}
+		}
+	}
+
+	err := &ValidationError{
+		UnpublishedTopics: []string{},
+		Cycles:            findCycles(edges),
+	}
+
+	for topic := range unpublished {
+		err.UnpublishedTopics = append(err.UnpublishedTopics, topic)
+	}
+	sort.Strings(err.UnpublishedTopics)
+
+	if len(err.UnpublishedTopics) == 0 && len(err.Cycles) == 0 {
+		return nil
+	}
+
+	return err
+}
+
+func findCycles(edges map[string][]string) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	topics := []string{}
+	for topic := range edges {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	state := map[string]int{}
+	path := []string{}
+	cycles := [][]string{}
+
+	var visit func(topic string)
+	visit = func(topic string) {
+		state[topic] = visiting
+		path = append(path, topic)
+
+		for _, next := range edges[topic] {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case visiting:
+				for n := len(path) - 1; n >= 0; n-- {
+					if path[n] == next {
+						cycle := append([]string{}, path[n:]...)
+						cycles = append(cycles, append(cycle, next))
+						break
+					}
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[topic] = visited
+	}
+
+	for _, topic := range topics {
+		if state[topic] == unvisited {
+			visit(topic)
+		}
+	}
+
+	return cycles
+}
@@ -0,0 +1,109 @@
+package memorybus
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	"github.com/grafana/devtools/pkg/streams/log"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInMemoryBusValidation(t *testing.T) {
+	Convey("Test in memory bus validation", t, func() {
+		bus := New()
+		noop := func(p streams.Publisher, stream streams.Readable) {
+			stream.Drain()
+		}
+
+		Convey("Without declared publishers validation should be skipped", func() {
+			bus.Subscribe([]string{"stream-1"}, noop)
+			So(bus.Validate(), ShouldBeNil)
+		})
+
+		Convey("With all subscribed topics published should be valid", func() {
+			bus.DeclarePublisher(nil, []string{"stream-1"})
+			bus.DeclarePublisher([]string{"stream-1"}, []string{"stream-2"})
+			bus.Subscribe([]string{"stream-1"}, noop)
+			bus.Subscribe([]string{"stream-2"}, noop)
+			So(bus.Validate(), ShouldBeNil)
+		})
+
+		Convey("With subscribed topic never published should name the topic", func() {
+			bus.DeclarePublisher(nil, []string{"stream-1"})
+			bus.Subscribe([]string{"stream-1", "stream-typo"}, noop)
+
+			err := bus.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(*ValidationError).UnpublishedTopics, ShouldResemble, []string{"stream-typo"})
+			So(err.Error(), ShouldEqual, "subscribed topics that are never published: stream-typo")
+		})
+
+		Convey("With publisher of any topic should not report unpublished topics", func() {
+			bus.DeclarePublisher(nil, []string{"stream-1"})
+			bus.DeclarePublisher([]string{"stream-1"}, []string{streams.AnyTopic})
+			bus.Subscribe([]string{"stream-1"}, noop)
+			bus.Subscribe([]string{"stream-split"}, noop)
+			So(bus.Validate(), ShouldBeNil)
+		})
+
+		Convey("With cycle in subscriptions should report the cycle", func() {
+			bus.DeclarePublisher(nil, []string{"stream-1"})
+			bus.DeclarePublisher([]string{"stream-1", "stream-3"}, []string{"stream-2"})
+			bus.DeclarePublisher([]string{"stream-2"}, []string{"stream-3"})
+			bus.Subscribe([]string{"stream-1", "stream-3"}, noop)
+			bus.Subscribe([]string{"stream-2"}, noop)
+
+			err := bus.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(*ValidationError).Cycles, ShouldResemble, [][]string{{"stream-2", "stream-3", "stream-2"}})
+		})
+
+		Convey("Start with invalid subscriptions should fail the bus", func() {
+			bus.DeclarePublisher(nil, []string{"stream-1"})
+			bus.Subscribe([]string{"stream-typo"}, noop)
+
+			So(<-bus.Start(), ShouldBeFalse)
+			So(bus.Err(), ShouldHaveSameTypeAs, &ValidationError{})
+		})
+
+		Convey("Subscription not ready within timeout should fail the bus", func() {
+			logger := log.New()
+			var mu sync.Mutex
+			errors := []string{}
+			logger.AddHandler(&log.LogHandler{
+				ErrorHandler: func(msg string, ctx ...interface{}) {
+					mu.Lock()
+					defer mu.Unlock()
+					errors = append(errors, msg)
+				},
+			})
+			bus.SetLogger(logger)
+			bus.SetReadyTimeout(10 * time.Millisecond)
+			bus.Subscribe([]string{"stream-1"}, noop)
+			bus.Subscribe([]string{"stream-2"}, noop)
+
+			done := bus.Start()
+			So(bus.Publish("stream-1", streams.NewFrom("msg")), ShouldBeNil)
+			So(<-done, ShouldBeFalse)
+			So(bus.Err().Error(), ShouldEqual, "subscription to stream-2 not ready within 10ms")
+
+			// streams published after the failure are drained
+			So(bus.Publish("stream-2", streams.NewFrom("msg")), ShouldBeNil)
+
+			mu.Lock()
+			defer mu.Unlock()
+			So(errors, ShouldResemble, []string{"subscription not ready, no stream published to any of its topics"})
+		})
+
+		Convey("Completed bus should succeed", func() {
+			bus.Subscribe([]string{"stream-1"}, noop)
+
+			done := bus.Start()
+			bus.Publish("stream-1", streams.NewFrom("msg"))
+			So(<-done, ShouldBeTrue)
+			So(bus.Err(), ShouldBeNil)
+		})
+	})
+}
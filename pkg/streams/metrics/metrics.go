@@ -0,0 +1,412 @@
+// Package metrics implements the counters, gauges and histograms the pipeline
+// reports about itself, exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, in seconds, suitable for
+// durations from a few milliseconds to several minutes.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// ExponentialBuckets returns count buckets, the first being start and each
+// following factor times the previous one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for n := range buckets {
+		buckets[n] = start
+		start *= factor
+	}
+	return buckets
+}
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// family is a metric with a name, help text and label names, holding one
+// series per combination of label values.
+type family struct {
+	name       string
+	help       string
+	metricType metricType
+	labelNames []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*series
+}
+
+type series struct {
+	mu          sync.Mutex
+	labelValues []string
+	value       float64
+	bucketCount []uint64
+	count       uint64
+}
+
+func newFamily(name, help string, t metricType, buckets []float64, labelNames []string) *family {
+	return &family{
+		name:       name,
+		help:       help,
+		metricType: t,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     map[string]*series{},
+	}
+}
+
+func (f *family) withLabelValues(values []string) *series {
+	if len(values) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labelNames), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, exists := f.series[key]
+	if !exists {
+		s = &series{labelValues: append([]string{}, values...)}
+		if f.metricType == histogramType {
+			s.bucketCount = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+func (f *family) write(w io.Writer) error {
+	f.mu.Lock()
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	f.mu.Unlock()
+
+	if len(all) == 0 {
+		return nil
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labelValues, "\xff") < strings.Join(all[j].labelValues, "\xff")
+	})
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.metricType); err != nil {
+		return err
+	}
+
+	for _, s := range all {
+		s.mu.Lock()
+		value, count := s.value, s.count
+		bucketCount := append([]uint64{}, s.bucketCount...)
+		s.mu.Unlock()
+
+		if f.metricType != histogramType {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), formatValue(value)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		cumulative := uint64(0)
+		for n, upperBound := range f.buckets {
+			cumulative += bucketCount[n]
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "le", formatValue(upperBound)), cumulative); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "le", "+Inf"), count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), formatValue(value)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_count%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	pairs := []string{}
+	for n, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(values[n])))
+	}
+
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+// Counter is a value that only increases.
+type Counter struct {
+	s *series
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v, which must not be negative, to the counter.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("counter cannot decrease")
+	}
+
+	c.s.mu.Lock()
+	c.s.value += v
+	c.s.mu.Unlock()
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	s *series
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	g.s.mu.Lock()
+	g.s.value = v
+	g.s.mu.Unlock()
+}
+
+// Add adds v to the gauge.
+func (g *Gauge) Add(v float64) {
+	g.s.mu.Lock()
+	g.s.value += v
+	g.s.mu.Unlock()
+}
+
+// Histogram counts observations in configurable buckets.
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+
+	for n, upperBound := range h.buckets {
+		if v <= upperBound {
+			h.s.bucketCount[n]++
+			break
+		}
+	}
+	h.s.value += v
+	h.s.count++
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	f *family
+}
+
+// WithLabelValues returns the counter for the label values, in the order of
+// the label names.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return &Counter{s: v.f.withLabelValues(values)}
+}
+
+// GaugeVec is a gauge partitioned by label values.
+type GaugeVec struct {
+	f *family
+}
+
+// WithLabelValues returns the gauge for the label values, in the order of the
+// label names.
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return &Gauge{s: v.f.withLabelValues(values)}
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	f *family
+}
+
+// WithLabelValues returns the histogram for the label values, in the order of
+// the label names.
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return &Histogram{s: v.f.withLabelValues(values), buckets: v.f.buckets}
+}
+
+// Registry holds metrics and writes them in the Prometheus text format.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// DefaultRegistry is the registry the pipeline packages register their
+// metrics in.
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) register(f *family) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.families[f.name]; exists {
+		panic("duplicate metric " + f.name)
+	}
+	r.families[f.name] = f
+
+	return f
+}
+
+// NewCounterVec registers a counter partitioned by labelNames.
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{f: r.register(newFamily(name, help, counterType, nil, labelNames))}
+}
+
+// NewGaugeVec registers a gauge partitioned by labelNames.
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{f: r.register(newFamily(name, help, gaugeType, nil, labelNames))}
+}
+
+// NewHistogramVec registers a histogram with buckets, sorted upper bounds,
+// partitioned by labelNames.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{f: r.register(newFamily(name, help, histogramType, buckets, labelNames))}
+}
+
+// WriteText writes all metrics with at least one series in the Prometheus
+// text format, sorted by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := []string{}
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	families := []*family{}
+	for _, name := range names {
+		families = append(families, r.families[name])
+	}
+	r.mu.Unlock()
+
+	for _, f := range families {
+		if err := f.write(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Handler returns a handler serving the metrics, e.g. on /metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// WriteTextFile writes the metrics to path, replacing it atomically, which is
+// what the node exporter textfile collector expects from batch jobs.
+func (r *Registry) WriteTextFile(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if err := r.WriteText(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// NewCounterVec registers a counter in the default registry.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labelNames...)
+}
+
+// NewGaugeVec registers a gauge in the default registry.
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return DefaultRegistry.NewGaugeVec(name, help, labelNames...)
+}
+
+// NewHistogramVec registers a histogram in the default registry.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labelNames...)
+}
+
+// Handler serves the metrics of the default registry.
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+// WriteTextFile writes the metrics of the default registry to path.
+func WriteTextFile(path string) error {
+	return DefaultRegistry.WriteTextFile(path)
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("Test metrics", t, func() {
+		r := NewRegistry()
+
+		Convey("Counters and gauges should be written in text format", func() {
+			c := r.NewCounterVec("test_messages_total", "Number of messages.", "topic")
+			c.WithLabelValues("b").Add(2)
+			c.WithLabelValues("a").Inc()
+			c.WithLabelValues("a").Inc()
+
+			g := r.NewGaugeVec("test_partitions", "Number of\npartitions.", "projection")
+			g.WithLabelValues(`with "quotes"`).Set(3)
+
+			r.NewCounterVec("test_unused_total", "Not written.")
+
+			var buf bytes.Buffer
+			So(r.WriteText(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, `# HELP test_messages_total Number of messages.
+# TYPE test_messages_total counter
+test_messages_total{topic="a"} 2
+test_messages_total{topic="b"} 2
+# HELP test_partitions Number of\npartitions.
+# TYPE test_partitions gauge
+test_partitions{projection="with \"quotes\""} 3
+`)
+		})
+
+		Convey("Histograms should be written with cumulative buckets", func() {
+			h := r.NewHistogramVec("test_duration_seconds", "Duration.", []float64{1, 5})
+			h.WithLabelValues().Observe(0.5)
+			h.WithLabelValues().Observe(2)
+			h.WithLabelValues().Observe(10)
+
+			var buf bytes.Buffer
+			So(r.WriteText(&buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="1"} 1
+test_duration_seconds_bucket{le="5"} 2
+test_duration_seconds_bucket{le="+Inf"} 3
+test_duration_seconds_sum 12.5
+test_duration_seconds_count 3
+`)
+		})
+
+		Convey("Metrics should be served over http and written to file", func() {
+			r.NewCounterVec("test_total", "Test.").WithLabelValues().Inc()
+
+			rec := httptest.NewRecorder()
+			r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+			So(rec.Body.String(), ShouldContainSubstring, "test_total 1\n")
+
+			dir, err := ioutil.TempDir("", "metrics")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "devtools.prom")
+			So(r.WriteTextFile(path), ShouldBeNil)
+			content, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, rec.Body.String())
+		})
+
+		Convey("Registering a metric twice should panic", func() {
+			r.NewCounterVec("test_total", "Test.")
+			So(func() { r.NewCounterVec("test_total", "Test.") }, ShouldPanic)
+		})
+	})
+}
@@ -0,0 +1,371 @@
+package netbus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	"github.com/grafana/devtools/pkg/streams/log"
+)
+
+// Bus is a bus client that publishes and subscribes to topics with a
+// registered codec through a coordinator Server, which makes it possible to
+// run subscribers of the same topics in different processes. Topics without a
+// registered codec are passed through in memory between the publishers and
+// subscribers of this process.
+//
+// Like the in memory bus, a subscription ends when a stream has been received
+// for each of its topics.
+type Bus struct {
+	logger         log.Logger
+	url            string
+	runID          string
+	client         *http.Client
+	codecsMu       sync.RWMutex
+	codecs         map[string]streams.Codec
+	subscriptionMu sync.RWMutex
+	subscriptions  []*streams.Subscription
+	started        bool
+	publishingMu   sync.Mutex
+	publishingCond *sync.Cond
+	publishing     int
+	errMu          sync.Mutex
+	err            error
+}
+
+// New creates a bus client using the coordinator at serverURL, e.g.
+// http://localhost:8090.
+func New(serverURL string) *Bus {
+	bus := &Bus{
+		logger:        log.New(),
+		url:           strings.TrimSuffix(serverURL, "/"),
+		client:        &http.Client{},
+		codecs:        map[string]streams.Codec{},
+		subscriptions: []*streams.Subscription{},
+	}
+	bus.publishingCond = sync.NewCond(&bus.publishingMu)
+
+	return bus
+}
+
+func (bus *Bus) SetLogger(logger log.Logger) {
+	bus.logger = logger.New("logger", "net-bus")
+}
+
+// SetRun sets the ID of the run the bus takes part in. Publications are only
+// received by subscribers of the same run, so each run of the processes
+// sharing a coordinator has to use a new ID, e.g. a timestamp.
+func (bus *Bus) SetRun(run string) {
+	bus.runID = run
+}
+
+// SetHTTPClient sets the client used to connect to the coordinator. The client
+// must not have a timeout since subscriptions are kept open until all of
+// their topics have been received.
+func (bus *Bus) SetHTTPClient(client *http.Client) {
+	bus.client = client
+}
+
+// RegisterCodec publishes and subscribes to topic through the coordinator
+// using codec to encode the messages.
+func (bus *Bus) RegisterCodec(topic string, codec streams.Codec) {
+	bus.codecsMu.Lock()
+	defer bus.codecsMu.Unlock()
+	bus.codecs[topic] = codec
+}
+
+func (bus *Bus) getCodec(topic string) streams.Codec {
+	bus.codecsMu.RLock()
+	defer bus.codecsMu.RUnlock()
+	return bus.codecs[topic]
+}
+
+func (bus *Bus) Subscribe(topics []string, fn streams.SubscribeFunc) error {
+	bus.subscriptionMu.Lock()
+	defer bus.subscriptionMu.Unlock()
+
+	if bus.started {
+		return fmt.Errorf("you cannot subscribe after bus have been started")
+	}
+
+	bus.subscriptions = append(bus.subscriptions, streams.NewSubscription(topics, fn))
+	bus.logger.Debug("subscription added", "topics", strings.Join(topics, ","))
+
+	return nil
+}
+
+func (bus *Bus) subscriptionsByTopic(topic string) []*streams.Subscription {
+	bus.subscriptionMu.RLock()
+	defer bus.subscriptionMu.RUnlock()
+
+	result := []*streams.Subscription{}
+	for _, s := range bus.subscriptions {
+		if s.HasTopic(topic) {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+func (bus *Bus) Publish(topic string, stream streams.Readable) error {
+	codec := bus.getCodec(topic)
+
+	if codec == nil {
+		bus.publishInMemory(topic, stream)
+		return nil
+	}
+
+	bus.publishingMu.Lock()
+	bus.publishing++
+	bus.publishingMu.Unlock()
+
+	go bus.publishRemote(topic, codec, stream)
+
+	return nil
+}
+
+func (bus *Bus) publishInMemory(topic string, stream streams.Readable) {
+	subscriptions := bus.subscriptionsByTopic(topic)
+
+	if len(subscriptions) == 0 {
+		bus.logger.Debug("no subscribers for published topic, draining messages in stream", "topic", topic)
+		go stream.Drain()
+		return
+	}
+
+	splitStreams := stream.Split(len(subscriptions))
+	for n, s := range subscriptions {
+		splitStream := splitStreams[n]
+		if !s.AddReadyStream(topic, func() streams.Readable { return splitStream }) {
+			go splitStream.Drain()
+		}
+	}
+}
+
+func (bus *Bus) publishRemote(topic string, codec streams.Codec, stream streams.Readable) {
+	defer func() {
+		bus.publishingMu.Lock()
+		bus.publishing--
+		bus.publishingCond.Broadcast()
+		bus.publishingMu.Unlock()
+	}()
+
+	start := time.Now()
+	body, pw := io.Pipe()
+
+	go func() {
+		w := bufio.NewWriter(pw)
+		var writeErr error
+
+		// the stream is always drained to not block its publisher
+		for msg := range stream {
+			if writeErr != nil {
+				continue
+			}
+
+			data, err := codec.Encode(msg)
+			if err != nil {
+				// aborts the publication so that subscribers don't take the
+				// messages sent so far for all of them
+				writeErr = fmt.Errorf("failed to encode message of topic %s: %v", topic, err)
+				bus.fail(writeErr)
+				continue
+			}
+
+			writeErr = writeMessage(w, data)
+		}
+
+		if writeErr == nil {
+			writeErr = w.Flush()
+		}
+		pw.CloseWithError(writeErr)
+	}()
+
+	query := url.Values{"run": {bus.runID}, "topic": {topic}}
+	resp, err := bus.client.Post(bus.url+"/publish?"+query.Encode(), "application/octet-stream", body)
+	if err != nil {
+		body.CloseWithError(err)
+		bus.fail(fmt.Errorf("failed to publish topic %s: %v", topic, err))
+		bus.logger.Error("failed to publish topic", "topic", topic, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		body.CloseWithError(fmt.Errorf("publish rejected"))
+		bus.fail(fmt.Errorf("failed to publish topic %s: %s", topic, strings.TrimSpace(string(msg))))
+		bus.logger.Error("failed to publish topic", "topic", topic, "status", resp.StatusCode, "error", strings.TrimSpace(string(msg)))
+		return
+	}
+
+	bus.logger.Debug("topic published", "topic", topic, "took", time.Since(start))
+}
+
+// Start connects the subscriptions to the coordinator. The returned channel
+// receives true once all subscriptions have ended and all publications to the
+// coordinator have been sent, or false if a publication, subscription or
+// message failed, see Err.
+func (bus *Bus) Start() <-chan bool {
+	done := make(chan bool, 1)
+
+	bus.subscriptionMu.Lock()
+	bus.started = true
+	subscriptions := append([]*streams.Subscription{}, bus.subscriptions...)
+	bus.subscriptionMu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(subscriptions))
+
+	for _, s := range subscriptions {
+		go func(s *streams.Subscription) {
+			bus.run(s)
+			wg.Done()
+		}(s)
+
+		remoteTopics := []string{}
+		for _, topic := range s.Topics {
+			if bus.getCodec(topic) != nil {
+				remoteTopics = append(remoteTopics, topic)
+			}
+		}
+
+		if len(remoteTopics) > 0 {
+			go bus.receive(s, remoteTopics)
+		}
+	}
+
+	go func() {
+		wg.Wait()
+
+		bus.publishingMu.Lock()
+		for bus.publishing > 0 {
+			bus.publishingCond.Wait()
+		}
+		bus.publishingMu.Unlock()
+
+		done <- bus.Err() == nil
+		close(done)
+	}()
+
+	return done
+}
+
+// Err returns why the bus failed, or nil.
+func (bus *Bus) Err() error {
+	bus.errMu.Lock()
+	defer bus.errMu.Unlock()
+
+	return bus.err
+}
+
+// fail records err, Start then reports that the bus failed once all
+// subscriptions completed. Only the first error is kept.
+func (bus *Bus) fail(err error) {
+	bus.errMu.Lock()
+	defer bus.errMu.Unlock()
+
+	if bus.err == nil {
+		bus.err = err
+	}
+}
+
+// receive reads the publications of topics from the coordinator and hands
+// them over to s.
+func (bus *Bus) receive(s *streams.Subscription, topics []string) {
+	query := url.Values{"run": {bus.runID}, "topic": topics}
+	pending := map[string]bool{}
+	for _, topic := range topics {
+		pending[topic] = true
+	}
+
+	writers := map[string]streams.Writable{}
+	defer func() {
+		for _, w := range writers {
+			w.Close()
+		}
+
+		// make sure the subscription ends even if the connection fails, the
+		// bus has been failed by then
+		for topic := range pending {
+			s.CloseTopic(topic)
+		}
+	}()
+
+	resp, err := bus.client.Get(bus.url + "/subscribe?" + query.Encode())
+	if err != nil {
+		bus.fail(fmt.Errorf("failed to subscribe to topics %s: %v", strings.Join(topics, ","), err))
+		bus.logger.Error("failed to subscribe", "topics", strings.Join(topics, ","), "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bus.fail(fmt.Errorf("failed to subscribe to topics %s: status %d", strings.Join(topics, ","), resp.StatusCode))
+		bus.logger.Error("failed to subscribe", "topics", strings.Join(topics, ","), "status", resp.StatusCode)
+		return
+	}
+
+	reader := bufio.NewReader(resp.Body)
+
+	for len(pending) > 0 || len(writers) > 0 {
+		kind, topic, payload, err := readFrame(reader)
+		if err != nil {
+			bus.fail(fmt.Errorf("subscription connection of topics %s failed: %v", strings.Join(topics, ","), err))
+			bus.logger.Error("subscription connection failed", "topics", strings.Join(topics, ","), "error", err)
+			return
+		}
+
+		switch kind {
+		case frameStart:
+			r, w := streams.New()
+			if s.AddReadyStream(topic, func() streams.Readable { return r }) {
+				writers[topic] = w
+			} else {
+				w.Close()
+			}
+			delete(pending, topic)
+		case frameMessage:
+			w, exists := writers[topic]
+			if !exists {
+				continue
+			}
+
+			msg, err := bus.getCodec(topic).Decode(payload)
+			if err != nil {
+				bus.fail(fmt.Errorf("failed to decode message of topic %s: %v", topic, err))
+				bus.logger.Error("failed to decode message, skipping it", "topic", topic, "error", err)
+				continue
+			}
+			w <- msg
+		case frameEnd, frameError:
+			if kind == frameError {
+				bus.fail(fmt.Errorf("%s", payload))
+				bus.logger.Error("publication aborted by its publisher", "topic", topic, "error", string(payload))
+			}
+
+			if w, exists := writers[topic]; exists {
+				w.Close()
+				delete(writers, topic)
+			}
+		}
+	}
+}
+
+func (bus *Bus) run(s *streams.Subscription) {
+	<-s.Ready
+	start := time.Now()
+	bus.logger.Debug("starting to publish messages to subscriber...", "topics", strings.Join(s.Topics, ","))
+
+	s.Run(bus)
+
+	bus.logger.Debug("sending of messages to subscriber done", "topics", strings.Join(s.Topics, ","), "took", time.Since(start))
+}
@@ -0,0 +1,319 @@
+package netbus
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testMessage struct {
+	Value int
+}
+
+func TestNetBus(t *testing.T) {
+	Convey("Test networked bus", t, func() {
+		server := NewServer()
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+
+		newBus := func() *Bus {
+			bus := New(httpServer.URL)
+			bus.RegisterCodec("stream-1", streams.NewJSONCodec(&testMessage{}))
+			bus.RegisterCodec("stream-2", streams.NewJSONCodec(&testMessage{}))
+			return bus
+		}
+
+		var mu sync.Mutex
+		collect := func(received *[]streams.T) streams.SubscribeFunc {
+			return func(p streams.Publisher, stream streams.Readable) {
+				for msg := range stream {
+					mu.Lock()
+					*received = append(*received, msg)
+					mu.Unlock()
+				}
+			}
+		}
+
+		Convey("Subscribers in other processes should receive published messages", func() {
+			publisher := newBus()
+			subscriber1 := newBus()
+			subscriber2 := newBus()
+
+			received1 := []streams.T{}
+			received2 := []streams.T{}
+			subscriber1.Subscribe([]string{"stream-1"}, collect(&received1))
+			subscriber2.Subscribe([]string{"stream-1"}, collect(&received2))
+
+			done1 := subscriber1.Start()
+			done2 := subscriber2.Start()
+
+			startBusAndRun(publisher, func() {
+				publisher.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}, &testMessage{Value: 2}))
+			})
+			<-done1
+			<-done2
+
+			expected := []streams.T{&testMessage{Value: 1}, &testMessage{Value: 2}}
+			So(received1, ShouldResemble, expected)
+			So(received2, ShouldResemble, expected)
+
+			So(server.Topics(), ShouldResemble, []TopicStatus{
+				{Topic: "stream-1", Published: true, Complete: true, Messages: 2},
+			})
+		})
+
+		Convey("Subscriber connecting after publication should receive published messages", func() {
+			publisher := newBus()
+			startBusAndRun(publisher, func() {
+				publisher.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}))
+			})
+
+			subscriber := newBus()
+			received := []streams.T{}
+			subscriber.Subscribe([]string{"stream-1"}, collect(&received))
+			<-subscriber.Start()
+
+			So(received, ShouldResemble, []streams.T{&testMessage{Value: 1}})
+		})
+
+		Convey("Subscription of several topics should end when all topics have been published", func() {
+			subscriber := newBus()
+			received := []streams.T{}
+			subscriber.Subscribe([]string{"stream-1", "stream-2"}, collect(&received))
+			done := subscriber.Start()
+
+			publisher := newBus()
+			startBusAndRun(publisher, func() {
+				publisher.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}))
+				publisher.Publish("stream-2", streams.NewFrom(&testMessage{Value: 2}, &testMessage{Value: 3}))
+			})
+			<-done
+
+			So(received, ShouldHaveLength, 3)
+		})
+
+		Convey("Subscriber should be able to publish to other processes", func() {
+			projection := newBus()
+			projection.Subscribe([]string{"stream-1"}, func(p streams.Publisher, stream streams.Readable) {
+				out, in := streams.New()
+				p.Publish("stream-2", out)
+				for msg := range stream {
+					in <- &testMessage{Value: msg.(*testMessage).Value * 10}
+				}
+				in.Close()
+			})
+			projectionDone := projection.Start()
+
+			subscriber := newBus()
+			received := []streams.T{}
+			subscriber.Subscribe([]string{"stream-2"}, collect(&received))
+			subscriberDone := subscriber.Start()
+
+			publisher := newBus()
+			startBusAndRun(publisher, func() {
+				publisher.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}, &testMessage{Value: 2}))
+			})
+			<-projectionDone
+			<-subscriberDone
+
+			So(received, ShouldResemble, []streams.T{&testMessage{Value: 10}, &testMessage{Value: 20}})
+		})
+
+		Convey("Publish to topic without codec should send messages in memory", func() {
+			bus := newBus()
+			received := []streams.T{}
+			bus.Subscribe([]string{"local"}, collect(&received))
+
+			startBusAndRun(bus, func() {
+				bus.Publish("local", streams.NewFromRange(0, 2))
+			})
+
+			So(received, ShouldResemble, []streams.T{0, 1, 2})
+			So(server.Topics(), ShouldBeEmpty)
+		})
+
+		Convey("Publishing a complete topic again should replace it for later subscribers", func() {
+			publisher := newBus()
+			startBusAndRun(publisher, func() {
+				publisher.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}))
+			})
+			startBusAndRun(publisher, func() {
+				publisher.Publish("stream-1", streams.NewFrom(&testMessage{Value: 2}))
+			})
+
+			subscriber := newBus()
+			received := []streams.T{}
+			subscriber.Subscribe([]string{"stream-1"}, collect(&received))
+			<-subscriber.Start()
+
+			So(received, ShouldResemble, []streams.T{&testMessage{Value: 2}})
+		})
+
+		Convey("Subscriber of a run should not receive the publications of a previous run", func() {
+			previous := newBus()
+			previous.SetRun("run-1")
+			startBusAndRun(previous, func() {
+				previous.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}))
+			})
+
+			subscriber := newBus()
+			subscriber.SetRun("run-2")
+			received := []streams.T{}
+			subscriber.Subscribe([]string{"stream-1"}, collect(&received))
+			done := subscriber.Start()
+
+			publisher := newBus()
+			publisher.SetRun("run-2")
+			startBusAndRun(publisher, func() {
+				publisher.Publish("stream-1", streams.NewFrom(&testMessage{Value: 2}))
+			})
+			<-done
+
+			So(received, ShouldResemble, []streams.T{&testMessage{Value: 2}})
+			So(server.Topics(), ShouldResemble, []TopicStatus{
+				{Run: "run-1", Topic: "stream-1", Published: true, Complete: true, Messages: 1},
+				{Run: "run-2", Topic: "stream-1", Published: true, Complete: true, Messages: 1},
+			})
+		})
+
+		Convey("Publishing a topic being published should be rejected", func() {
+			body, w := io.Pipe()
+			defer w.Close()
+			go http.Post(httpServer.URL+"/publish?topic=stream-1", "application/octet-stream", body)
+			So(waitForTopics(server, func(topics []TopicStatus) bool {
+				return len(topics) == 1 && topics[0].Published
+			}), ShouldBeTrue)
+
+			resp, err := http.Post(httpServer.URL+"/publish?topic=stream-1", "application/octet-stream", strings.NewReader(""))
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			msg, _ := ioutil.ReadAll(resp.Body)
+			So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+			So(string(msg), ShouldEqual, "topic stream-1 has already been published\n")
+		})
+
+		Convey("Aborted publication should fail its subscribers", func() {
+			subscriber := newBus()
+			received := []streams.T{}
+			subscriber.Subscribe([]string{"stream-1"}, collect(&received))
+			done := subscriber.Start()
+
+			var body bytes.Buffer
+			So(writeMessage(&body, []byte(`{"Value":1}`)), ShouldBeNil)
+			// a message broken off after its header
+			body.Write([]byte{0, 0, 0, 10})
+			resp, err := http.Post(httpServer.URL+"/publish?topic=stream-1", "application/octet-stream", &body)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+
+			So(<-done, ShouldBeFalse)
+			So(subscriber.Err(), ShouldNotBeNil)
+			So(received, ShouldResemble, []streams.T{&testMessage{Value: 1}})
+			So(server.Topics()[0].Error, ShouldContainSubstring, "aborted after 1 messages")
+		})
+
+		Convey("Message that fails to encode should fail the publisher and its subscribers", func() {
+			subscriber := newBus()
+			subscriber.Subscribe([]string{"stream-1"}, func(p streams.Publisher, stream streams.Readable) { stream.Drain() })
+			subscriberDone := subscriber.Start()
+
+			publisher := newBus()
+			publisher.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}, make(chan int)))
+			publisherDone := publisher.Start()
+
+			So(<-publisherDone, ShouldBeFalse)
+			So(publisher.Err().Error(), ShouldContainSubstring, "failed to encode message of topic stream-1")
+			So(<-subscriberDone, ShouldBeFalse)
+		})
+
+		Convey("Message that fails to decode should fail the bus", func() {
+			var body bytes.Buffer
+			So(writeMessage(&body, []byte("not json")), ShouldBeNil)
+			resp, err := http.Post(httpServer.URL+"/publish?topic=stream-1", "application/octet-stream", &body)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+
+			subscriber := newBus()
+			received := []streams.T{}
+			subscriber.Subscribe([]string{"stream-1"}, collect(&received))
+
+			So(<-subscriber.Start(), ShouldBeFalse)
+			So(subscriber.Err().Error(), ShouldContainSubstring, "failed to decode message of topic stream-1")
+			So(received, ShouldBeEmpty)
+		})
+
+		Convey("Failed subscription should fail the bus", func() {
+			subscriber := New(httpServer.URL + "/unknown")
+			subscriber.RegisterCodec("stream-1", streams.NewJSONCodec(&testMessage{}))
+			subscriber.Subscribe([]string{"stream-1"}, func(p streams.Publisher, stream streams.Readable) { stream.Drain() })
+
+			So(<-subscriber.Start(), ShouldBeFalse)
+			So(subscriber.Err().Error(), ShouldContainSubstring, "status 404")
+		})
+
+		Convey("Rejected publication should fail the bus", func() {
+			publisher := New(httpServer.URL + "/unknown")
+			publisher.RegisterCodec("stream-1", streams.NewJSONCodec(&testMessage{}))
+			publisher.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}))
+
+			So(<-publisher.Start(), ShouldBeFalse)
+			So(publisher.Err().Error(), ShouldContainSubstring, "failed to publish topic stream-1")
+		})
+
+		Convey("Publication should be released after retention once subscribers received it", func() {
+			server.SetRetention(200 * time.Millisecond)
+
+			subscriber := newBus()
+			received := []streams.T{}
+			subscriber.Subscribe([]string{"stream-1"}, collect(&received))
+
+			publisher := newBus()
+			startBusAndRun(publisher, func() {
+				publisher.Publish("stream-1", streams.NewFrom(&testMessage{Value: 1}))
+			})
+			<-subscriber.Start()
+
+			So(received, ShouldResemble, []streams.T{&testMessage{Value: 1}})
+			So(server.Topics(), ShouldHaveLength, 1)
+
+			So(waitForTopics(server, func(topics []TopicStatus) bool { return len(topics) == 0 }), ShouldBeTrue)
+		})
+	})
+}
+
+func startBusAndRun(bus streams.Bus, fn func()) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		<-bus.Start()
+		wg.Done()
+	}()
+
+	fn()
+	wg.Wait()
+}
+
+// waitForTopics polls the topics of server until fn returns true for them.
+// Returns false if that does not happen within 5 seconds.
+func waitForTopics(server *Server, fn func(topics []TopicStatus) bool) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if fn(server.Topics()) {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return false
+}
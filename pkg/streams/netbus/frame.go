@@ -0,0 +1,103 @@
+package netbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxPayloadSize protects against allocating huge buffers when reading
+// corrupt or foreign data.
+const maxPayloadSize = 64 * 1024 * 1024
+
+// Frame kinds sent to subscribers. A publication of a topic is sent as a
+// start frame, followed by a message frame per message and an end frame, or
+// an error frame holding the error if the publication was aborted.
+const (
+	frameStart   byte = 1
+	frameMessage byte = 2
+	frameEnd     byte = 3
+	frameError   byte = 4
+)
+
+// writeMessage writes a length prefixed message payload, the format used in
+// the body of publish requests.
+func writeMessage(w io.Writer, payload []byte) error {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(payload)
+	return err
+}
+
+// readMessage reads a message written by writeMessage. Returns io.EOF if r
+// has no more messages.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxPayloadSize {
+		return nil, fmt.Errorf("message size %d exceeds max size %d", size, maxPayloadSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return payload, nil
+}
+
+// writeFrame writes a frame of kind for topic, sent to subscribers.
+func writeFrame(w io.Writer, kind byte, topic string, payload []byte) error {
+	var header [3]byte
+	header[0] = kind
+	binary.BigEndian.PutUint16(header[1:], uint16(len(topic)))
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, topic); err != nil {
+		return err
+	}
+
+	return writeMessage(w, payload)
+}
+
+// readFrame reads a frame written by writeFrame. Returns io.EOF if r has no
+// more frames.
+func readFrame(r *bufio.Reader) (byte, string, []byte, error) {
+	var header [3]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, "", nil, err
+	}
+
+	topic := make([]byte, binary.BigEndian.Uint16(header[1:]))
+	if _, err := io.ReadFull(r, topic); err != nil {
+		return 0, "", nil, unexpectedEOF(err)
+	}
+
+	payload, err := readMessage(r)
+	if err != nil {
+		return 0, "", nil, unexpectedEOF(err)
+	}
+
+	return header[0], string(topic), payload, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,432 @@
+package netbus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams/log"
+)
+
+// DefaultRetention is how long the coordinator keeps a complete publication
+// that no subscriber is receiving.
+const DefaultRetention = 10 * time.Minute
+
+// publication holds the encoded messages published to a topic. Messages are
+// kept in memory so that subscribers connecting after the publication has
+// started, or even completed, receive all of them.
+type publication struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	started  bool
+	complete bool
+	// err is why the publication was aborted, set when complete
+	err      error
+	messages [][]byte
+	// receiving is the number of subscribers being sent the publication
+	receiving    int
+	releaseTimer *time.Timer
+}
+
+func newPublication() *publication {
+	p := &publication{}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Server is the coordinator of a networked bus. Publishers post the encoded
+// messages of a topic to the server and subscribers receive them by
+// connecting to it, using the Bus client.
+//
+// Like the in memory bus a topic is published once per run. Clients send the
+// ID of their run, see Bus.SetRun, and only receive the publications of their
+// run, so subscribers of the next run never receive the retained publications
+// of a previous one. Published messages are kept in memory until the
+// publication is complete and no subscriber has been receiving it for the
+// retention period. Publishing a topic again once its publication is complete
+// replaces it, e.g. when a run is retried.
+type Server struct {
+	logger    log.Logger
+	mux       *http.ServeMux
+	retention time.Duration
+	topicsMu  sync.Mutex
+	topics    map[topicKey]*publication
+}
+
+// topicKey identifies the publication of a topic in a run.
+type topicKey struct {
+	run   string
+	topic string
+}
+
+// NewServer creates a new coordinator.
+func NewServer() *Server {
+	s := &Server{
+		logger:    log.New(),
+		mux:       http.NewServeMux(),
+		retention: DefaultRetention,
+		topics:    map[topicKey]*publication{},
+	}
+
+	s.mux.HandleFunc("/publish", s.handlePublish)
+	s.mux.HandleFunc("/subscribe", s.handleSubscribe)
+	s.mux.HandleFunc("/topics", s.handleTopics)
+
+	return s
+}
+
+func (s *Server) SetLogger(logger log.Logger) {
+	s.logger = logger.New("logger", "net-bus-server")
+}
+
+// SetRetention sets how long a complete publication is kept once no
+// subscriber is receiving it. Zero keeps publications for the lifetime of the
+// server.
+func (s *Server) SetRetention(retention time.Duration) {
+	s.retention = retention
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) publication(key topicKey) *publication {
+	s.topicsMu.Lock()
+	defer s.topicsMu.Unlock()
+
+	p, exists := s.topics[key]
+	if !exists {
+		p = newPublication()
+		s.topics[key] = p
+	}
+
+	return p
+}
+
+// startPublication starts publishing the topic of key, replacing a complete
+// publication of it.
+func (s *Server) startPublication(key topicKey) (*publication, error) {
+	s.topicsMu.Lock()
+	defer s.topicsMu.Unlock()
+
+	p, exists := s.topics[key]
+	if exists {
+		p.mu.Lock()
+		started, complete := p.started, p.complete
+		p.mu.Unlock()
+
+		if started && !complete {
+			return nil, fmt.Errorf("topic %s has already been published", key.topic)
+		}
+		if complete {
+			s.logger.Debug("replacing complete publication", "run", key.run, "topic", key.topic)
+			exists = false
+		}
+	}
+
+	if !exists {
+		p = newPublication()
+		s.topics[key] = p
+	}
+
+	p.mu.Lock()
+	p.started = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	return p, nil
+}
+
+// scheduleRelease releases p after the retention period if it is complete and
+// no subscriber is receiving it. Must be called with p.mu held.
+func (s *Server) scheduleRelease(key topicKey, p *publication) {
+	if s.retention <= 0 || !p.complete || p.receiving > 0 {
+		return
+	}
+
+	if p.releaseTimer != nil {
+		p.releaseTimer.Stop()
+	}
+	p.releaseTimer = time.AfterFunc(s.retention, func() {
+		s.release(key, p)
+	})
+}
+
+// release removes p unless a subscriber started receiving it in the meantime
+// or it has been replaced.
+func (s *Server) release(key topicKey, p *publication) {
+	s.topicsMu.Lock()
+	defer s.topicsMu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s.topics[key] != p || p.receiving > 0 {
+		return
+	}
+
+	delete(s.topics, key)
+	s.logger.Debug("publication released", "run", key.run, "topic", key.topic, "messages", len(p.messages))
+}
+
+func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	topic := r.URL.Query().Get("topic")
+	if topic == "" {
+		http.Error(w, "missing topic", http.StatusBadRequest)
+		return
+	}
+
+	key := topicKey{run: r.URL.Query().Get("run"), topic: topic}
+	p, err := s.startPublication(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	start := time.Now()
+	s.logger.Debug("receiving publication", "run", key.run, "topic", topic, "remote", r.RemoteAddr)
+
+	reader := bufio.NewReader(r.Body)
+	msgCount := 0
+	var readErr error
+
+	for {
+		payload, err := readMessage(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+
+		p.mu.Lock()
+		p.messages = append(p.messages, payload)
+		p.cond.Broadcast()
+		p.mu.Unlock()
+		msgCount++
+	}
+
+	p.mu.Lock()
+	p.complete = true
+	if readErr != nil {
+		p.err = fmt.Errorf("publication of topic %s aborted after %d messages: %v", topic, msgCount, readErr)
+	}
+	p.cond.Broadcast()
+	s.scheduleRelease(key, p)
+	p.mu.Unlock()
+
+	if readErr != nil {
+		s.logger.Error("publication aborted, subscribers are sent an error", "topic", topic, "messages", msgCount, "error", readErr)
+		http.Error(w, readErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.logger.Debug("publication received", "topic", topic, "messages", msgCount, "took", time.Since(start))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	topics := r.URL.Query()["topic"]
+	if len(topics) == 0 {
+		http.Error(w, "missing topic", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	run := r.URL.Query().Get("run")
+	s.logger.Debug("subscriber connected", "run", run, "topics", topics, "remote", r.RemoteAddr)
+
+	var writeMu sync.Mutex
+	writer := bufio.NewWriter(w)
+	write := func(kind byte, topic string, payload []byte, flush bool) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+
+		if err := writeFrame(writer, kind, topic, payload); err != nil {
+			return err
+		}
+
+		if !flush {
+			return nil
+		}
+
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	ctx := r.Context()
+	var wg sync.WaitGroup
+	wg.Add(len(topics))
+
+	for _, topic := range topics {
+		go func(topic string) {
+			defer wg.Done()
+			key := topicKey{run: run, topic: topic}
+			p := s.publication(key)
+			p.mu.Lock()
+			p.receiving++
+			if p.releaseTimer != nil {
+				p.releaseTimer.Stop()
+			}
+			p.mu.Unlock()
+
+			err := s.sendPublication(ctx.Done(), p, topic, write)
+
+			p.mu.Lock()
+			p.receiving--
+			s.scheduleRelease(key, p)
+			p.mu.Unlock()
+
+			if err != nil {
+				s.logger.Debug("stopped sending publication to subscriber", "topic", topic, "remote", r.RemoteAddr, "error", err)
+			}
+		}(topic)
+	}
+
+	wg.Wait()
+}
+
+type writeFrameFunc func(kind byte, topic string, payload []byte, flush bool) error
+
+// sendPublication waits for topic to be published and sends its messages as
+// they arrive, until the publication is complete or done is closed. An
+// aborted publication ends with an error frame instead of an end frame.
+func (s *Server) sendPublication(done <-chan struct{}, p *publication, topic string, write writeFrameFunc) error {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-done:
+			p.mu.Lock()
+			p.cond.Broadcast()
+			p.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	canceled := func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}
+
+	p.mu.Lock()
+	for !p.started && !canceled() {
+		p.cond.Wait()
+	}
+	p.mu.Unlock()
+
+	if canceled() {
+		return io.ErrClosedPipe
+	}
+
+	if err := write(frameStart, topic, nil, true); err != nil {
+		return err
+	}
+
+	sent := 0
+	for {
+		p.mu.Lock()
+		for sent == len(p.messages) && !p.complete && !canceled() {
+			p.cond.Wait()
+		}
+		messages := p.messages[sent:]
+		complete, pubErr := p.complete, p.err
+		p.mu.Unlock()
+
+		if canceled() {
+			return io.ErrClosedPipe
+		}
+
+		for n, payload := range messages {
+			if err := write(frameMessage, topic, payload, n == len(messages)-1); err != nil {
+				return err
+			}
+		}
+		sent += len(messages)
+
+		if complete && len(messages) == 0 {
+			if pubErr != nil {
+				return write(frameError, topic, []byte(pubErr.Error()), true)
+			}
+			return write(frameEnd, topic, nil, true)
+		}
+	}
+}
+
+// TopicStatus describes a topic of a run known to the server.
+type TopicStatus struct {
+	Run       string `json:"run,omitempty"`
+	Topic     string `json:"topic"`
+	Published bool   `json:"published"`
+	Complete  bool   `json:"complete"`
+	Messages  int    `json:"messages"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Topics returns the status of the topics that have been published or
+// subscribed to.
+func (s *Server) Topics() []TopicStatus {
+	s.topicsMu.Lock()
+	defer s.topicsMu.Unlock()
+
+	result := []TopicStatus{}
+	for key, p := range s.topics {
+		p.mu.Lock()
+		status := TopicStatus{
+			Run:       key.run,
+			Topic:     key.topic,
+			Published: p.started,
+			Complete:  p.complete,
+			Messages:  len(p.messages),
+		}
+		if p.err != nil {
+			status.Error = p.err.Error()
+		}
+		result = append(result, status)
+		p.mu.Unlock()
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Run != result[j].Run {
+			return result[i].Run < result[j].Run
+		}
+		return result[i].Topic < result[j].Topic
+	})
+
+	return result
+}
+
+func (s *Server) handleTopics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Topics()); err != nil {
+		s.logger.Error("failed to write topics", "error", err)
+	}
+}
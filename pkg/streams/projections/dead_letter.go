@@ -0,0 +1,107 @@
+package projections
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultDeadLetterTopic is the topic dead letters are published to when
+// persisted without setting a topic.
+const DefaultDeadLetterTopic = "dead_letters"
+
+// maxDeadLetterMessageLength limits the size of the encoded message stored in
+// a dead letter.
+const maxDeadLetterMessageLength = 4000
+
+// maxDeadLetterErrorLength limits the size of the error stored in a dead
+// letter.
+const maxDeadLetterErrorLength = 1024
+
+// FailureFunc is called for each message that a projection failed to handle,
+// either because the message caused a panic or an apply func returned an
+// error. The projection continues with the next message.
+type FailureFunc func(msg interface{}, err error, panicked bool)
+
+type failureHandler interface {
+	setFailureFunc(fn FailureFunc)
+}
+
+func (p *projection) setFailureFunc(fn FailureFunc) {
+	p.failureFn = fn
+}
+
+// handleMessage counts msg and calls fn to handle it. If a failure func has
+// been set, panics and errors are reported to it instead of stopping the
+// projection. State changed by fn before it failed is kept.
+func (p *projection) handleMessage(msg interface{}, fn func() error) {
+	if p.countFn != nil {
+		p.countFn()
+	}
+
+	if p.failureFn == nil {
+		fn()
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			p.failureFn(msg, fmt.Errorf("%v", r), true)
+		}
+	}()
+
+	if err := fn(); err != nil {
+		p.failureFn(msg, err, false)
+	}
+}
+
+// DeadLetter is published to the dead letter topic for each message that
+// failed in a projection.
+type DeadLetter struct {
+	ID         int64 `persist:",primarykey"`
+	Time       time.Time
+	Projection string
+	Message    string `persist:",length(4000)"`
+	Error      string `persist:",length(1024)"`
+	Panic      bool
+	Original   interface{} `persist:"-" json:"-"`
+}
+
+func newDeadLetter(id int64, projection string, msg interface{}, err error, panicked bool) *DeadLetter {
+	encoded, encodeErr := json.Marshal(msg)
+	if encodeErr != nil {
+		encoded = []byte(fmt.Sprintf("%+v", msg))
+	}
+
+	return &DeadLetter{
+		ID:         id,
+		Time:       time.Now(),
+		Projection: projection,
+		Message:    truncate(string(encoded), maxDeadLetterMessageLength),
+		Error:      truncate(err.Error(), maxDeadLetterErrorLength),
+		Panic:      panicked,
+		Original:   msg,
+	}
+}
+
+// truncate shortens s to at most max bytes without splitting a rune.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+
+	n := max
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// ProjectionFailures is the number of messages a projection failed to handle.
+type ProjectionFailures struct {
+	Projection string
+	Panics     int
+	Errors     int
+}
@@ -0,0 +1,118 @@
+package projections
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/grafana/devtools/pkg/streams"
+	"github.com/grafana/devtools/pkg/streams/memorybus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type deadLetterTestMessage struct {
+	Key   string
+	Value *int
+}
+
+type deadLetterTestState struct {
+	Key string
+	Sum int
+}
+
+func TestDeadLetters(t *testing.T) {
+	Convey("Test dead letters", t, func() {
+		bus := memorybus.New()
+		engine := New(bus, streams.NewNoOpStreamPersister())
+		engine.SetDeadLetterTopic("dead")
+		engine.RegisterInput("input")
+
+		one, two := 1, 2
+		input := streams.NewFrom(
+			&deadLetterTestMessage{Key: "a", Value: &one},
+			&deadLetterTestMessage{Key: "a"},
+			&deadLetterTestMessage{Key: "b", Value: &two},
+			&deadLetterTestMessage{Key: "error", Value: &two},
+		)
+
+		engine.Register(FromStream("input").
+			PartitionBy(func(msg interface{}) (string, interface{}) {
+				return "key", msg.(*deadLetterTestMessage).Key
+			}).
+			Init(func(key string) *deadLetterTestState {
+				return &deadLetterTestState{Key: key}
+			}).
+			Apply(func(state *deadLetterTestState, msg *deadLetterTestMessage) error {
+				if msg.Key == "error" {
+					return fmt.Errorf("invalid key")
+				}
+				state.Sum += *msg.Value
+				return nil
+			}).
+			ToStream("output").
+			Build())
+
+		var mu sync.Mutex
+		output := []streams.T{}
+		bus.Subscribe([]string{"output"}, func(p streams.Publisher, stream streams.Readable) {
+			for msg := range stream {
+				mu.Lock()
+				output = append(output, msg)
+				mu.Unlock()
+			}
+		})
+
+		deadLetters := []*DeadLetter{}
+		bus.Subscribe([]string{"dead"}, func(p streams.Publisher, stream streams.Readable) {
+			for msg := range stream {
+				mu.Lock()
+				deadLetters = append(deadLetters, msg.(*DeadLetter))
+				mu.Unlock()
+			}
+		})
+
+		done := bus.Start()
+		bus.Publish("input", input)
+		<-done
+
+		Convey("Projection should continue after failed messages", func() {
+			So(output, ShouldHaveLength, 3)
+			So(output[0], ShouldResemble, &deadLetterTestState{Key: "a", Sum: 1})
+			So(output[1], ShouldResemble, &deadLetterTestState{Key: "b", Sum: 2})
+		})
+
+		Convey("Failed messages should be published to dead letter topic", func() {
+			So(deadLetters, ShouldHaveLength, 2)
+
+			So(deadLetters[0].ID, ShouldEqual, 1)
+			So(deadLetters[0].Projection, ShouldEqual, "output")
+			So(deadLetters[0].Panic, ShouldBeTrue)
+			So(deadLetters[0].Message, ShouldEqual, `{"Key":"a","Value":null}`)
+			So(deadLetters[0].Original.(*deadLetterTestMessage).Key, ShouldEqual, "a")
+
+			So(deadLetters[1].ID, ShouldEqual, 2)
+			So(deadLetters[1].Panic, ShouldBeFalse)
+			So(deadLetters[1].Error, ShouldEqual, "invalid key")
+		})
+
+		Convey("Failure summary should count failed messages", func() {
+			So(engine.FailureSummary(), ShouldResemble, []ProjectionFailures{
+				{Projection: "output", Panics: 1, Errors: 1},
+			})
+		})
+	})
+}
+
+func TestNewDeadLetter(t *testing.T) {
+	Convey("Long messages and errors should be truncated without splitting runes", t, func() {
+		dl := newDeadLetter(1, "output", strings.Repeat("é", 3000), errors.New(strings.Repeat("€", 500)), false)
+
+		So(utf8.ValidString(dl.Message), ShouldBeTrue)
+		So(dl.Message, ShouldHaveLength, maxDeadLetterMessageLength-1)
+		So(utf8.ValidString(dl.Error), ShouldBeTrue)
+		So(dl.Error, ShouldHaveLength, maxDeadLetterErrorLength-1)
+	})
+}
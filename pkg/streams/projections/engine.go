@@ -1,11 +1,15 @@
 package projections
 
 import (
+	"context"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/grafana/devtools/pkg/streams"
 	"github.com/grafana/devtools/pkg/streams/log"
+	"github.com/grafana/devtools/pkg/streams/tracing"
 )
 
 type FilterFunc func(msg interface{}) bool
@@ -14,22 +18,41 @@ type SplitToStreamsFunc func(s []ProjectionState) map[string][]ProjectionState
 
 type StreamProjectionEngine interface {
 	SetLogger(logger log.Logger)
+	SetContext(ctx context.Context)
 	Register(streamProjection *StreamProjection)
+	RegisterInput(topic string)
+	Topology() *Topology
+	SetDeadLetterTopic(topic string)
+	PersistDeadLetters(name string) error
+	FailureSummary() []ProjectionFailures
 }
 
 type streamProjectionEngine struct {
-	logger      log.Logger
-	bus         streams.Bus
-	persister   streams.StreamPersister
-	projections map[string]Projection
+	logger          log.Logger
+	ctx             context.Context
+	bus             streams.Bus
+	persister       streams.StreamPersister
+	projections     []*StreamProjection
+	inputs          []string
+	deadLetterTopic string
+	failuresMu      sync.Mutex
+	failures        map[string]*ProjectionFailures
+	deadLetterCount int64
+	deadLetters     streams.Writable
+	deadLetterOnce  sync.Once
+	running         int
+	finished        int
 }
 
 func New(bus streams.Bus, persister streams.StreamPersister) StreamProjectionEngine {
 	return &streamProjectionEngine{
 		logger:      log.New(),
+		ctx:         context.Background(),
 		bus:         bus,
 		persister:   persister,
-		projections: map[string]Projection{},
+		projections: []*StreamProjection{},
+		inputs:      []string{},
+		failures:    map[string]*ProjectionFailures{},
 	}
 }
 
@@ -37,11 +60,20 @@ func (e *streamProjectionEngine) SetLogger(logger log.Logger) {
 	e.logger = logger.New("logger", "stream-projections")
 }
 
+// SetContext sets the context of the projections registered after the call,
+// which tracing spans of running and persisting projections are children of.
+func (e *streamProjectionEngine) SetContext(ctx context.Context) {
+	e.ctx = ctx
+}
+
 func (e *streamProjectionEngine) Register(streamProjection *StreamProjection) {
 	e.logger.Debug("registering stream...", "fromStreams", strings.Join(streamProjection.FromStreams, ","))
 
+	// topics of a split func without declared names are only known at runtime
+	dynamicTopics := streamProjection.ToStreams != nil && len(streamProjection.ToStreamNames) == 0
+
 	if streamProjection.PersistTo != "" {
-		topic := "persist_to_" + streamProjection.PersistTo
+		topic := persistTopic(streamProjection.PersistTo)
 		if streamProjection.ToStreams != nil {
 			oldToStreams := streamProjection.ToStreams
 			streamProjection.ToStreams = func(state []ProjectionState) map[string][]ProjectionState {
@@ -57,16 +89,177 @@ func (e *streamProjectionEngine) Register(streamProjection *StreamProjection) {
 			}
 		}
 		e.persister.Register(streamProjection.PersistTo, streamProjection.PersistObject)
+		ctx := e.ctx
 		e.bus.Subscribe([]string{topic}, func(p streams.Publisher, stream streams.Readable) {
 			e.logger.Debug("persisting projection stream", "name", streamProjection.PersistTo)
+			_, span := tracing.Start(ctx, "persist "+streamProjection.PersistTo, e.logger, "table", streamProjection.PersistTo)
 			if err := e.persister.Persist(streamProjection.PersistTo, stream); err != nil {
 				e.logger.Error("failed to persist projection stream", "error", err)
+				span.SetError(err)
 			}
+			span.Finish()
 
 			e.logger.Debug("projection stream persisted", "name", streamProjection.PersistTo)
 		})
 	}
-	e.bus.Subscribe(streamProjection.createSubscriber(e.logger))
+	name := streamProjection.name()
+	if h, ok := streamProjection.Projection.(failureHandler); ok {
+		h.setFailureFunc(func(msg interface{}, err error, panicked bool) {
+			e.handleFailure(name, msg, err, panicked)
+		})
+	}
+
+	topics, subscribeFn := streamProjection.createSubscriber(e.ctx, e.logger)
+	e.bus.Subscribe(topics, func(p streams.Publisher, stream streams.Readable) {
+		e.projectionStarted(p)
+		subscribeFn(p, stream)
+		e.projectionFinished()
+	})
+	e.projections = append(e.projections, streamProjection)
+
+	if registry, ok := e.bus.(streams.PublisherRegistry); ok {
+		toStreams := streamProjection.declaredTopics()
+		if dynamicTopics {
+			toStreams = append(toStreams, streams.AnyTopic)
+		}
+		registry.DeclarePublisher(streamProjection.FromStreams, toStreams)
+	}
+}
+
+// RegisterInput declares a topic that is published from outside of the
+// engine, e.g. the raw events read from the archive database.
+func (e *streamProjectionEngine) RegisterInput(topic string) {
+	e.inputs = append(e.inputs, topic)
+
+	if registry, ok := e.bus.(streams.PublisherRegistry); ok {
+		registry.DeclarePublisher(nil, []string{topic})
+	}
+}
+
+// Topology returns the graph of topics, projections and persisters registered
+// in the engine.
+func (e *streamProjectionEngine) Topology() *Topology {
+	return newTopology(e.inputs, e.projections)
+}
+
+// SetDeadLetterTopic publishes a DeadLetter to topic for each message that
+// a projection failed to handle. Must be called before registering
+// projections. Without a dead letter topic failed messages are only logged.
+func (e *streamProjectionEngine) SetDeadLetterTopic(topic string) {
+	e.deadLetterTopic = topic
+
+	if registry, ok := e.bus.(streams.PublisherRegistry); ok {
+		registry.DeclarePublisher(nil, []string{topic})
+	}
+}
+
+// PersistDeadLetters persists the dead letters using the name of the stream
+// persister, publishing them to DefaultDeadLetterTopic unless another topic
+// has been set.
+func (e *streamProjectionEngine) PersistDeadLetters(name string) error {
+	if e.deadLetterTopic == "" {
+		e.SetDeadLetterTopic(DefaultDeadLetterTopic)
+	}
+
+	if err := e.persister.Register(name, &DeadLetter{}); err != nil {
+		return err
+	}
+
+	return e.bus.Subscribe([]string{e.deadLetterTopic}, func(p streams.Publisher, stream streams.Readable) {
+		if err := e.persister.Persist(name, stream); err != nil {
+			e.logger.Error("failed to persist dead letters", "error", err)
+		}
+	})
+}
+
+// FailureSummary returns the number of failed messages per projection, sorted
+// by projection.
+func (e *streamProjectionEngine) FailureSummary() []ProjectionFailures {
+	e.failuresMu.Lock()
+	defer e.failuresMu.Unlock()
+
+	result := []ProjectionFailures{}
+	for _, f := range e.failures {
+		result = append(result, *f)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Projection < result[j].Projection
+	})
+
+	return result
+}
+
+func (e *streamProjectionEngine) handleFailure(projection string, msg interface{}, err error, panicked bool) {
+	e.failuresMu.Lock()
+	f, exists := e.failures[projection]
+	if !exists {
+		f = &ProjectionFailures{Projection: projection}
+		e.failures[projection] = f
+	}
+
+	reason := "error"
+	if panicked {
+		f.Panics++
+		reason = "panic"
+	} else {
+		f.Errors++
+	}
+	failedMessages.WithLabelValues(projection, reason).Inc()
+
+	e.deadLetterCount++
+	id := e.deadLetterCount
+	deadLetters := e.deadLetters
+	e.failuresMu.Unlock()
+
+	e.logger.Debug("projection failed to handle message", "projection", projection, "panic", panicked, "error", err)
+
+	if deadLetters != nil {
+		deadLetters <- newDeadLetter(id, projection, msg, err, panicked)
+	}
+}
+
+// projectionStarted publishes the dead letter stream when the first
+// projection starts running.
+func (e *streamProjectionEngine) projectionStarted(p streams.Publisher) {
+	e.deadLetterOnce.Do(func() {
+		if e.deadLetterTopic == "" {
+			return
+		}
+
+		r, w := streams.New()
+
+		e.failuresMu.Lock()
+		e.deadLetters = w
+		e.failuresMu.Unlock()
+
+		if err := p.Publish(e.deadLetterTopic, r); err != nil {
+			e.logger.Error("failed to publish dead letters", "topic", e.deadLetterTopic, "error", err)
+		}
+	})
+
+	e.failuresMu.Lock()
+	e.running++
+	e.failuresMu.Unlock()
+}
+
+// projectionFinished closes the dead letter stream when all registered
+// projections have finished.
+func (e *streamProjectionEngine) projectionFinished() {
+	e.failuresMu.Lock()
+	defer e.failuresMu.Unlock()
+
+	e.running--
+	e.finished++
+
+	if e.running == 0 && e.finished == len(e.projections) && e.deadLetters != nil {
+		e.deadLetters.Close()
+		e.deadLetters = nil
+	}
+}
+
+func persistTopic(persistTo string) string {
+	return "persist_to_" + persistTo
 }
 
 func FromStream(name string) *StreamProjectionBuilder {
@@ -82,18 +275,52 @@ func FromStreams(names ...string) *StreamProjectionBuilder {
 type StreamProjection struct {
 	FromStreams   []string
 	ToStreams     SplitToStreamsFunc
+	ToStreamNames []string
 	Projection    Projection
 	PersistTo     string
 	PersistObject interface{}
 }
 
-func (sp *StreamProjection) createSubscriber(logger log.Logger) ([]string, streams.SubscribeFunc) {
+func (sp *StreamProjection) createSubscriber(ctx context.Context, logger log.Logger) ([]string, streams.SubscribeFunc) {
 	subscribeFn := func(publisher streams.Publisher, stream streams.Readable) {
 		fromStreams := strings.Join(sp.FromStreams, ", ")
+		name := sp.name()
 		start := time.Now()
+		_, span := tracing.Start(ctx, "run projection "+name, logger, "fromStreams", fromStreams)
 		logger.Debug("running stream projection...", "fromStreams", fromStreams)
-		state := sp.Projection.Run(stream)
+		msgCount := int64(0)
+		counter := messagesIn.WithLabelValues(name)
+		count := func() {
+			counter.Inc()
+			msgCount++
+		}
+		// projections of this package count in their own loop, others get a
+		// counting stage
+		in := stream
+		if c, ok := sp.Projection.(messageCounter); ok {
+			c.setMessageCounter(count)
+		} else {
+			in = stream.Map(func(msg streams.T) streams.T {
+				count()
+				return msg
+			})
+		}
+		if ep, ok := sp.Projection.(emittingProjection); ok && ep.emitting() {
+			partitionCount := sp.runEmitting(ep, in, publisher, logger)
+			span.SetAttributes("messages", msgCount, "partitions", partitionCount)
+			span.Finish()
+			logger.Debug("stream projection done", "fromStreams", fromStreams, "took", time.Since(start))
+			runDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+			partitions.WithLabelValues(name).Set(float64(partitionCount))
+			return
+		}
+
+		state := sp.Projection.Run(in)
+		span.SetAttributes("messages", msgCount, "partitions", len(state))
+		span.Finish()
 		logger.Debug("stream projection done", "fromStreams", fromStreams, "took", time.Since(start))
+		runDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		partitions.WithLabelValues(name).Set(float64(len(state)))
 
 		if sp.ToStreams != nil {
 			outputStreams := sp.ToStreams(state)
@@ -111,6 +338,7 @@ func (sp *StreamProjection) createSubscriber(logger log.Logger) ([]string, strea
 					}
 
 					logger.Debug("stream projection state published", "topic", topic, "fromStreams", fromStreams, "messages", msgCount)
+					messagesOut.WithLabelValues(name, topic).Add(float64(msgCount))
 
 					close(out)
 				}(topic, items)
@@ -120,10 +348,136 @@ func (sp *StreamProjection) createSubscriber(logger log.Logger) ([]string, strea
 	return sp.FromStreams, subscribeFn
 }
 
-func newStreamProjection(fromStreams []string, toStreamsFn SplitToStreamsFunc, persistTo string, persistObj interface{}, p Projection) *StreamProjection {
+// runEmitting runs a projection publishing states while running, e.g. with a
+// watermark. Each topic is published once and its states are queued, so
+// publishing never blocks the projection. Returns the number of emitted
+// states.
+func (sp *StreamProjection) runEmitting(ep emittingProjection, in streams.Readable, publisher streams.Publisher, logger log.Logger) int {
+	name := sp.name()
+	queues := map[string]*stateQueue{}
+	wg := sync.WaitGroup{}
+	queue := func(topic string) *stateQueue {
+		q, exists := queues[topic]
+		if !exists {
+			q = newStateQueue()
+			queues[topic] = q
+			out := make(chan streams.T, 1)
+			publisher.Publish(topic, out)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				msgCount := q.drain(out)
+				logger.Debug("stream projection state published", "topic", topic, "messages", msgCount)
+				messagesOut.WithLabelValues(name, topic).Add(float64(msgCount))
+				close(out)
+			}()
+		}
+		return q
+	}
+
+	count := 0
+	ep.RunEmitting(in, func(states []ProjectionState) {
+		count += len(states)
+		if sp.ToStreams == nil {
+			return
+		}
+		for topic, items := range sp.ToStreams(states) {
+			queue(topic).push(items)
+		}
+	})
+
+	// publish the declared topics nothing was emitted to as well, since
+	// subscribers wait for all their topics
+	for _, topic := range sp.declaredTopics() {
+		queue(topic)
+	}
+	for _, q := range queues {
+		q.close()
+	}
+	wg.Wait()
+
+	return count
+}
+
+// stateQueue is an unbounded queue of states published to a topic.
+type stateQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []ProjectionState
+	closed bool
+}
+
+func newStateQueue() *stateQueue {
+	q := &stateQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *stateQueue) push(items []ProjectionState) {
+	q.mu.Lock()
+	q.items = append(q.items, items...)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+func (q *stateQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// drain sends the queued states to out until the queue is closed and empty.
+func (q *stateQueue) drain(out chan<- streams.T) int64 {
+	count := int64(0)
+	for {
+		q.mu.Lock()
+		for len(q.items) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		items := q.items
+		q.items = nil
+		closed := q.closed
+		q.mu.Unlock()
+
+		for _, item := range items {
+			out <- item
+			count++
+		}
+		if closed && len(items) == 0 {
+			return count
+		}
+	}
+}
+
+// name identifies the projection in logs and dead letters.
+// declaredTopics returns the topics the projection publishes to, including
+// the topic of its persister.
+func (sp *StreamProjection) declaredTopics() []string {
+	topics := append([]string{}, sp.ToStreamNames...)
+	if sp.PersistTo != "" {
+		topics = append(topics, persistTopic(sp.PersistTo))
+	}
+	return topics
+}
+
+func (sp *StreamProjection) name() string {
+	if sp.PersistTo != "" {
+		return sp.PersistTo
+	}
+
+	if len(sp.ToStreamNames) > 0 {
+		return strings.Join(sp.ToStreamNames, ",")
+	}
+
+	return "from " + strings.Join(sp.FromStreams, ",")
+}
+
+func newStreamProjection(fromStreams []string, toStreamsFn SplitToStreamsFunc, toStreamNames []string, persistTo string, persistObj interface{}, p Projection) *StreamProjection {
 	return &StreamProjection{
 		FromStreams:   fromStreams,
 		ToStreams:     toStreamsFn,
+		ToStreamNames: toStreamNames,
 		Projection:    p,
 		PersistTo:     persistTo,
 		PersistObject: persistObj,
@@ -0,0 +1,53 @@
+package projections
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/grafana/devtools/pkg/streams"
+	"github.com/grafana/devtools/pkg/streams/memorybus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEngine(t *testing.T) {
+	Convey("Test stream projection engine", t, func() {
+		Convey("Split func without declared names should not fail bus validation", func() {
+			bus := memorybus.New()
+			engine := New(bus, streams.NewNoOpStreamPersister())
+			engine.RegisterInput("input")
+			engine.Register(FromStream("input").
+				ToStreams(func(states []ProjectionState) map[string][]ProjectionState {
+					split := map[string][]ProjectionState{"odd": {}, "even": {}}
+					for _, s := range states {
+						topic := "odd"
+						if s.(int)%2 == 0 {
+							topic = "even"
+						}
+						split[topic] = append(split[topic], s)
+					}
+					return split
+				}).
+				Build())
+
+			var mu sync.Mutex
+			received := map[string]int{}
+			for _, topic := range []string{"odd", "even"} {
+				topic := topic
+				bus.Subscribe([]string{topic}, func(p streams.Publisher, stream streams.Readable) {
+					for range stream {
+						mu.Lock()
+						received[topic]++
+						mu.Unlock()
+					}
+				})
+			}
+
+			So(bus.Validate(), ShouldBeNil)
+
+			done := bus.Start()
+			bus.Publish("input", streams.NewFromRange(1, 5))
+			So(<-done, ShouldBeTrue)
+			So(received, ShouldResemble, map[string]int{"odd": 3, "even": 2})
+		})
+	})
+}
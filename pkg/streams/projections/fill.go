@@ -0,0 +1,168 @@
+package projections
+
+import (
+	"sort"
+	"time"
+)
+
+// FillStrategy is how the gaps of a time series are filled, see
+// TimeSeriesProjectionBuilder.Fill.
+type FillStrategy string
+
+// Fill strategies.
+const (
+	// FillNone does not fill gaps, windows only span existing partitions.
+	FillNone FillStrategy = "none"
+	// FillInit fills gaps with states initialized by Init, e.g. zero counts.
+	FillInit FillStrategy = "init"
+	// FillCarryForward copies the fields of the last partition into the gaps
+	// following it, e.g. for cumulative stars.
+	FillCarryForward FillStrategy = "carry_forward"
+	// FillLinear interpolates the numeric fields between the partitions
+	// around a gap. Gaps before the first and after the last partition are
+	// filled as with FillInit.
+	FillLinear FillStrategy = "linear"
+)
+
+type fillOptions struct {
+	strategy FillStrategy
+	fields   []string
+	start    time.Time
+	end      time.Time
+}
+
+func (o fillOptions) enabled() bool {
+	return o.strategy != "" || !o.start.IsZero() || !o.end.IsZero()
+}
+
+// partitionTime is passed as message to a time partitioner to partition a time
+// instead of a message, e.g. the start of a fill range.
+type partitionTime time.Time
+
+func withPartitionTime(fn TimeSeriesPartitionFunc) TimeSeriesPartitionFunc {
+	return func(msg interface{}) time.Time {
+		if t, ok := msg.(partitionTime); ok {
+			return time.Time(t)
+		}
+		return fn(msg)
+	}
+}
+
+// seriesKey returns the partition key without time and format, which
+// identifies the series of the partition.
+func seriesKey(pk *partitionKey) *partitionKey {
+	keys := pk.GetKeys()
+	values := pk.GetValues()
+	series := newPartitionKey()
+	for i, key := range keys {
+		// skip timestamp and format
+		if i == 0 || i == len(keys)-1 {
+			continue
+		}
+		series.Add(key, values[i])
+	}
+	return series
+}
+
+// fillPartitions adds the states of the gaps of each series, and of the fill
+// range, using the fill strategy.
+func (p *timeSeriesProjection) fillPartitions() {
+	if !p.fill.enabled() || p.fill.strategy == FillNone {
+		return
+	}
+
+	series := map[string][]*timeProjectionState{}
+	seriesKeys := map[string]*partitionKey{}
+	for key, state := range p.state {
+		pk := p.keys[key]
+		ts, ok := pk.GetTimestamp()
+		if !ok {
+			continue
+		}
+
+		sk := seriesKey(pk)
+		series[sk.FormatKey()] = append(series[sk.FormatKey()], &timeProjectionState{time: ts, state: state})
+		seriesKeys[sk.FormatKey()] = sk
+	}
+
+	for key, slice := range series {
+		p.fillSeries(seriesKeys[key], slice)
+	}
+}
+
+func (p *timeSeriesProjection) fillSeries(sk *partitionKey, slice []*timeProjectionState) {
+	sort.Slice(slice, func(i, j int) bool {
+		return slice[i].time.Before(slice[j].time)
+	})
+
+	if !p.fill.start.IsZero() {
+		start := p.tsPartitioner.Partition(partitionTime(p.fill.start))
+		if start.Before(slice[0].time) {
+			slice = append([]*timeProjectionState{{time: start}}, slice...)
+		}
+	}
+	if !p.fill.end.IsZero() {
+		end := p.tsPartitioner.Partition(partitionTime(p.fill.end))
+		if end.After(slice[len(slice)-1].time) {
+			slice = append(slice, &timeProjectionState{time: end})
+		}
+	}
+
+	if len(slice) > 1 {
+		slice = p.tsPartitioner.FillMissingValues(slice)
+	}
+
+	filled := make([]bool, len(slice))
+	for n, item := range slice {
+		filled[n] = item.state == nil
+	}
+
+	for n, item := range slice {
+		if !filled[n] {
+			continue
+		}
+
+		pk := newPartitionKey()
+		pk.AddTimestamp(item.time)
+		values := sk.GetValues()
+		for i, key := range sk.GetKeys() {
+			pk.Add(key, values[i])
+		}
+		pk.Add("tsFormat", p.tsPartitioner.GetFormat())
+		item.state = p.partitionState(pk.FormatKey(), pk)
+
+		switch p.fill.strategy {
+		case FillCarryForward:
+			if n > 0 {
+				for _, field := range p.fill.fields {
+					numericField(item.state, field).Set(numericField(slice[n-1].state, field))
+				}
+			}
+		case FillLinear:
+			p.interpolate(slice, filled, n)
+		}
+	}
+}
+
+// interpolate sets the fields of the state at n, in a gap, by linear
+// interpolation between the partitions around the gap.
+func (p *timeSeriesProjection) interpolate(slice []*timeProjectionState, filled []bool, n int) {
+	prev := n - 1
+	for prev >= 0 && filled[prev] {
+		prev--
+	}
+	next := n + 1
+	for next < len(slice) && filled[next] {
+		next++
+	}
+	if prev < 0 || next >= len(slice) {
+		return
+	}
+
+	ratio := float64(n-prev) / float64(next-prev)
+	for _, field := range p.fill.fields {
+		a := getNumericField(slice[prev].state, field)
+		b := getNumericField(slice[next].state, field)
+		setNumericField(slice[n].state, field, a+(b-a)*ratio)
+	}
+}
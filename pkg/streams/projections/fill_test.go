@@ -0,0 +1,141 @@
+package projections
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fillTestMessage struct {
+	Time  time.Time
+	Repo  string
+	Value float64
+}
+
+type fillTestState struct {
+	Time   time.Time
+	Repo   string
+	Period string
+	Value  float64
+	Total  int
+}
+
+func TestFill(t *testing.T) {
+	Convey("Test filling gaps of time series", t, func() {
+		day := func(d int) time.Time {
+			return time.Date(2019, 1, d, 0, 0, 0, 0, time.UTC)
+		}
+
+		messages := []interface{}{
+			&fillTestMessage{Time: day(2), Repo: "a", Value: 2},
+			&fillTestMessage{Time: day(5), Repo: "a", Value: 8},
+			&fillTestMessage{Time: day(3), Repo: "b", Value: 1},
+		}
+
+		builder := func() *TimeSeriesProjectionBuilder {
+			return FromStream("input").
+				Daily(
+					func(msg interface{}) time.Time { return msg.(*fillTestMessage).Time },
+					func(msg interface{}) (string, interface{}) { return "repo", msg.(*fillTestMessage).Repo },
+				).
+				Init(func(t time.Time, repo string, period string) *fillTestState {
+					return &fillTestState{Time: t, Repo: repo, Period: period}
+				}).
+				Apply(func(s *fillTestState, msg *fillTestMessage) {
+					s.Value += msg.Value
+					s.Total++
+				})
+		}
+
+		run := func(sp *StreamProjection) map[string]*fillTestState {
+			result := map[string]*fillTestState{}
+			for _, s := range sp.Projection.Run(streams.NewFrom(messages...)) {
+				state := s.(*fillTestState)
+				result[state.Period+" "+state.Repo+" "+state.Time.Format("02")] = state
+			}
+			return result
+		}
+
+		Convey("Without fill strategy partitions should not be filled", func() {
+			So(run(builder().Build()), ShouldHaveLength, 3)
+		})
+
+		Convey("None should not fill", func() {
+			So(run(builder().Fill(FillNone).Range(day(1), day(6)).Build()), ShouldHaveLength, 3)
+		})
+
+		Convey("Init should fill gaps with initialized states", func() {
+			result := run(builder().Fill(FillInit).Build())
+			So(result, ShouldHaveLength, 5)
+			So(result["d a 03"].Value, ShouldEqual, 0)
+			So(result["d a 04"].Repo, ShouldEqual, "a")
+			So(result["d a 04"].Period, ShouldEqual, "d")
+		})
+
+		Convey("Carry forward should copy the last partition", func() {
+			result := run(builder().Fill(FillCarryForward, "Value").Range(day(1), day(6)).Build())
+			So(result, ShouldHaveLength, 12)
+			So(result["d a 01"].Value, ShouldEqual, 0)
+			So(result["d a 03"].Value, ShouldEqual, 2)
+			So(result["d a 04"].Value, ShouldEqual, 2)
+			So(result["d a 04"].Total, ShouldEqual, 0)
+			So(result["d a 06"].Value, ShouldEqual, 8)
+			So(result["d b 06"].Value, ShouldEqual, 1)
+		})
+
+		Convey("Linear should interpolate between partitions", func() {
+			result := run(builder().Fill(FillLinear, "Value", "Total").Range(day(1), day(6)).Build())
+			So(result["d a 01"].Value, ShouldEqual, 0)
+			So(result["d a 03"].Value, ShouldEqual, 4)
+			So(result["d a 04"].Value, ShouldEqual, 6)
+			So(result["d a 04"].Total, ShouldEqual, 1)
+			So(result["d a 06"].Value, ShouldEqual, 0)
+		})
+
+		Convey("Range should align all series", func() {
+			result := run(builder().Range(day(1), day(6)).Build())
+			So(result, ShouldHaveLength, 12)
+			for _, repo := range []string{"a", "b"} {
+				So(result["d "+repo+" 01"], ShouldNotBeNil)
+				So(result["d "+repo+" 06"], ShouldNotBeNil)
+			}
+		})
+
+		Convey("Range should be partitioned like the messages", func() {
+			result := run(builder().Range(day(1).Add(13*time.Hour), day(6).Add(13*time.Hour)).Build())
+			So(result, ShouldHaveLength, 12)
+		})
+
+		Convey("Windows should use the filled partitions", func() {
+			result := run(builder().Fill(FillCarryForward, "Value").Windows(RollingSum(2, "d2", "Value")).Build())
+			So(result["d2 a 04"].Value, ShouldEqual, 4)
+			So(result["d2 a 05"].Value, ShouldEqual, 10)
+		})
+
+		Convey("Multi period projections should fill after rolling up", func() {
+			sp := FromStream("input").
+				Periods(func(msg interface{}) time.Time { return msg.(*fillTestMessage).Time }, Daily, Weekly).
+				PartitionBy(func(msg interface{}) (string, interface{}) { return "repo", msg.(*fillTestMessage).Repo }).
+				Init(func(t time.Time, repo string, period string) *fillTestState {
+					return &fillTestState{Time: t, Repo: repo, Period: period}
+				}).
+				Apply(func(s *fillTestState, msg *fillTestMessage) {
+					s.Value += msg.Value
+				}).
+				Merge(func(target, source *fillTestState) {
+					target.Value += source.Value
+				}).
+				Fill(FillLinear, "Value").
+				Range(day(1), day(14)).
+				Build()
+
+			result := run(sp)
+			So(result["d a 03"].Value, ShouldEqual, 4)
+			So(result["w a 31"].Value, ShouldEqual, 10)
+			So(result["w a 07"].Value, ShouldEqual, 0)
+			So(result["w b 07"], ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,150 @@
+package projections
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	hyperLogLogEncodingVersion = 1
+
+	// DefaultHyperLogLogPrecision uses 2^14 registers, which gives distinct
+	// counts within about 1% of the exact ones.
+	DefaultHyperLogLogPrecision = 14
+)
+
+// HyperLogLog is a mergeable sketch estimating the number of distinct values
+// added, e.g. contributors, without keeping the values.
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+// NewHyperLogLog creates an empty sketch with 2^precision registers. The
+// precision must be between 4 and 16.
+func NewHyperLogLog(precision uint8) *HyperLogLog {
+	if precision < 4 || precision > 16 {
+		panic(fmt.Sprintf("hyperloglog precision must be between 4 and 16, got %d", precision))
+	}
+
+	return &HyperLogLog{
+		precision: precision,
+		registers: make([]uint8, 1<<precision),
+	}
+}
+
+// Add adds value.
+func (h *HyperLogLog) Add(value string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+	x := mix64(hash.Sum64())
+
+	index := x >> (64 - h.precision)
+	rank := uint8(bits.LeadingZeros64(x<<h.precision|1<<(h.precision-1)) + 1)
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// mix64 is the finalizer of MurmurHash3, spreading the bits of fnv hashes of
+// short, similar values like logins.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// Merge adds all values of other, which must have the same precision.
+func (h *HyperLogLog) Merge(other *HyperLogLog) error {
+	if other == nil {
+		return nil
+	}
+	if other.precision != h.precision {
+		return fmt.Errorf("cannot merge hyperloglog of precision %d into precision %d", other.precision, h.precision)
+	}
+
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+
+	return nil
+}
+
+// Count returns the estimated number of distinct values.
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.registers))
+
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	var alpha float64
+	switch len(h.registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+
+	estimate := alpha * m * m / sum
+
+	// use linear counting for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(math.Round(estimate))
+}
+
+// MarshalBinary encodes the sketch.
+func (h *HyperLogLog) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, len(h.registers)+2)
+	data = append(data, hyperLogLogEncodingVersion, h.precision)
+	return append(data, h.registers...), nil
+}
+
+// UnmarshalBinary decodes a sketch encoded by MarshalBinary.
+func (h *HyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("invalid hyperloglog encoding")
+	}
+	if data[0] != hyperLogLogEncodingVersion {
+		return fmt.Errorf("unsupported hyperloglog encoding version %d", data[0])
+	}
+
+	precision := data[1]
+	if precision < 4 || precision > 16 || len(data)-2 != 1<<precision {
+		return fmt.Errorf("invalid hyperloglog encoding of precision %d", precision)
+	}
+
+	h.precision = precision
+	h.registers = append([]uint8{}, data[2:]...)
+	return nil
+}
+
+// MarshalText encodes the sketch as base64, which is also used to persist it
+// and to encode it as JSON.
+func (h *HyperLogLog) MarshalText() ([]byte, error) {
+	return marshalBase64(h)
+}
+
+// UnmarshalText decodes a sketch encoded by MarshalText.
+func (h *HyperLogLog) UnmarshalText(text []byte) error {
+	return unmarshalBase64(h, text)
+}
@@ -0,0 +1,37 @@
+package projections
+
+import "github.com/grafana/devtools/pkg/streams/metrics"
+
+var (
+	messagesIn = metrics.NewCounterVec(
+		"devtools_projection_messages_in_total",
+		"Number of messages received by a projection.",
+		"projection")
+	messagesOut = metrics.NewCounterVec(
+		"devtools_projection_messages_out_total",
+		"Number of state items published by a projection to a topic.",
+		"projection", "topic")
+	runDuration = metrics.NewHistogramVec(
+		"devtools_projection_run_duration_seconds",
+		"Time a projection takes to handle all of its messages.",
+		metrics.DefBuckets,
+		"projection")
+	partitions = metrics.NewGaugeVec(
+		"devtools_projection_partitions",
+		"Number of state items, i.e. partitions, of the last run of a projection.",
+		"projection")
+	failedMessages = metrics.NewCounterVec(
+		"devtools_projection_failed_messages_total",
+		"Number of messages a projection failed to handle, by reason panic or error.",
+		"projection", "reason")
+)
+
+type messageCounter interface {
+	setMessageCounter(fn func())
+}
+
+// setMessageCounter makes the projection call fn for each message it
+// receives.
+func (p *projection) setMessageCounter(fn func()) {
+	p.countFn = fn
+}
@@ -0,0 +1,46 @@
+package projections
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/grafana/devtools/pkg/streams"
+	"github.com/grafana/devtools/pkg/streams/memorybus"
+	"github.com/grafana/devtools/pkg/streams/metrics"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type metricsTestState struct {
+	Key int
+	Sum int
+}
+
+func TestMetrics(t *testing.T) {
+	Convey("Test projection metrics", t, func() {
+		bus := memorybus.New()
+		engine := New(bus, streams.NewNoOpStreamPersister())
+		engine.RegisterInput("metrics_input")
+
+		engine.Register(FromStream("metrics_input").
+			Filter(func(msg interface{}) bool { return msg.(int)%2 == 0 }).
+			PartitionBy(func(msg interface{}) (string, interface{}) {
+				return "key", msg.(int) % 4
+			}).
+			Init(func(key int) *metricsTestState { return &metricsTestState{Key: key} }).
+			Apply(func(state *metricsTestState, msg int) { state.Sum += msg }).
+			ToStream("metrics_output").
+			Build())
+
+		bus.Subscribe([]string{"metrics_output"}, func(p streams.Publisher, stream streams.Readable) { stream.Drain() })
+
+		done := bus.Start()
+		bus.Publish("metrics_input", streams.NewFromRange(1, 5))
+		<-done
+
+		var buf bytes.Buffer
+		So(metrics.DefaultRegistry.WriteText(&buf), ShouldBeNil)
+		So(buf.String(), ShouldContainSubstring, "devtools_projection_messages_in_total{projection=\"metrics_output\"} 5\n")
+		So(buf.String(), ShouldContainSubstring, "devtools_projection_messages_out_total{projection=\"metrics_output\",topic=\"metrics_output\"} 2\n")
+		So(buf.String(), ShouldContainSubstring, "devtools_projection_partitions{projection=\"metrics_output\"} 2\n")
+	})
+}
@@ -0,0 +1,139 @@
+package projections
+
+import (
+	"sort"
+	"time"
+)
+
+// InLocation converts the time extracted by fn to loc, which makes the
+// partitioners, e.g. Daily, start their periods at midnight in loc instead of
+// in the location of the message time.
+func InLocation(loc *time.Location, fn TimeSeriesPartitionFunc) TimeSeriesPartitionFunc {
+	return func(msg interface{}) time.Time {
+		return fn(msg).In(loc)
+	}
+}
+
+type calendarTimeSeriesPartitioner struct {
+	*TimePartitionerBase
+	startFn func(t time.Time) time.Time
+}
+
+func newCalendarTimeSeriesPartitioner(extractTimeFn TimeSeriesPartitionFunc, startFn, stepFn func(time.Time) time.Time, format string) *calendarTimeSeriesPartitioner {
+	return &calendarTimeSeriesPartitioner{
+		TimePartitionerBase: NewTimeSeriesPartitionerBase(extractTimeFn, stepFn, format),
+		startFn:             startFn,
+	}
+}
+
+func (p *calendarTimeSeriesPartitioner) Partition(msg interface{}) time.Time {
+	return p.startFn(p.ExtractTimeFn(msg))
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// NewWeeklyPartitioner partitions by weeks starting on weekStart.
+func NewWeeklyPartitioner(extractTimeFn TimeSeriesPartitionFunc, weekStart time.Weekday) TimePartitioner {
+	startFn := func(t time.Time) time.Time {
+		d := startOfDay(t)
+		days := (int(d.Weekday()) - int(weekStart) + 7) % 7
+		return d.AddDate(0, 0, -days)
+	}
+	stepFn := func(t time.Time) time.Time {
+		return t.AddDate(0, 0, 7)
+	}
+
+	return newCalendarTimeSeriesPartitioner(extractTimeFn, startFn, stepFn, "w")
+}
+
+// NewFiscalQuarterlyPartitioner partitions by quarters of a fiscal year
+// starting in startMonth, e.g. February gives the quarters Feb-Apr, May-Jul,
+// Aug-Oct and Nov-Jan. A quarter is identified by its first day.
+func NewFiscalQuarterlyPartitioner(extractTimeFn TimeSeriesPartitionFunc, startMonth time.Month) TimePartitioner {
+	startFn := func(t time.Time) time.Time {
+		months := (int(t.Month()) - int(startMonth) + 12) % 12
+		first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		return first.AddDate(0, -(months % 3), 0)
+	}
+	stepFn := func(t time.Time) time.Time {
+		return t.AddDate(0, 3, 0)
+	}
+
+	return newCalendarTimeSeriesPartitioner(extractTimeFn, startFn, stepFn, "fq")
+}
+
+// NewSprintPartitioner partitions by sprints of days length, one of them
+// starting at anchor. Sprints before anchor are partitioned the same way.
+func NewSprintPartitioner(extractTimeFn TimeSeriesPartitionFunc, anchor time.Time, days int) TimePartitioner {
+	startFn := func(t time.Time) time.Time {
+		a := startOfDay(anchor.In(t.Location()))
+		d := startOfDay(t)
+
+		// count calendar days to not be off by one on daylight saving changes
+		elapsed := int(time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC).Sub(time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)).Hours() / 24)
+		sprints := elapsed / days
+		if elapsed < 0 && elapsed%days != 0 {
+			sprints--
+		}
+
+		return a.AddDate(0, 0, sprints*days)
+	}
+	stepFn := func(t time.Time) time.Time {
+		return t.AddDate(0, 0, days)
+	}
+
+	return newCalendarTimeSeriesPartitioner(extractTimeFn, startFn, stepFn, "s")
+}
+
+// NewBiWeeklySprintPartitioner partitions by two week sprints, one of them
+// starting at anchor.
+func NewBiWeeklySprintPartitioner(extractTimeFn TimeSeriesPartitionFunc, anchor time.Time) TimePartitioner {
+	return NewSprintPartitioner(extractTimeFn, anchor, 14)
+}
+
+// NewReleaseWindowPartitioner partitions by the windows between releases, a
+// window starting at a release and ending at the next one. Messages before
+// the first release are partitioned by the zero time.
+func NewReleaseWindowPartitioner(extractTimeFn TimeSeriesPartitionFunc, releases []time.Time) TimePartitioner {
+	all := append([]time.Time{}, releases...)
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Before(all[j])
+	})
+
+	sorted := []time.Time{}
+	for _, r := range all {
+		if len(sorted) == 0 || !r.Equal(sorted[len(sorted)-1]) {
+			sorted = append(sorted, r)
+		}
+	}
+
+	startFn := func(t time.Time) time.Time {
+		n := sort.Search(len(sorted), func(i int) bool {
+			return sorted[i].After(t)
+		})
+		if n == 0 {
+			return time.Time{}
+		}
+		return sorted[n-1]
+	}
+
+	// after the last release, windows have the length of the last one
+	stepFn := func(t time.Time) time.Time {
+		n := sort.Search(len(sorted), func(i int) bool {
+			return sorted[i].After(t)
+		})
+		if n < len(sorted) {
+			return sorted[n]
+		}
+
+		length := 24 * time.Hour
+		if len(sorted) > 1 {
+			length = sorted[len(sorted)-1].Sub(sorted[len(sorted)-2])
+		}
+		return t.Add(length)
+	}
+
+	return newCalendarTimeSeriesPartitioner(extractTimeFn, startFn, stepFn, "r")
+}
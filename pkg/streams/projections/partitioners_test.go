@@ -0,0 +1,102 @@
+package projections
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCalendarPartitioners(t *testing.T) {
+	Convey("Test calendar partitioners", t, func() {
+		extractTime := func(msg interface{}) time.Time {
+			return msg.(time.Time)
+		}
+
+		Convey("Daily in location should partition by midnight in location", func() {
+			cet, err := time.LoadLocation("Europe/Stockholm")
+			So(err, ShouldBeNil)
+
+			p := newDailyTimeSeriesPartitioner(InLocation(cet, extractTime))
+			actual := p.Partition(time.Date(2019, 3, 4, 23, 30, 0, 0, time.UTC))
+			So(actual.Equal(time.Date(2019, 3, 5, 0, 0, 0, 0, cet)), ShouldBeTrue)
+
+			Convey("Filling missing values should step by calendar days over daylight saving change", func() {
+				actual := p.FillMissingValues([]*timeProjectionState{
+					{time: time.Date(2019, 3, 30, 0, 0, 0, 0, cet)},
+					{time: time.Date(2019, 4, 1, 0, 0, 0, 0, cet)},
+				})
+				So(actual, ShouldHaveLength, 3)
+				So(actual[1].time.Equal(time.Date(2019, 3, 31, 0, 0, 0, 0, cet)), ShouldBeTrue)
+			})
+		})
+
+		Convey("Weekly with week start should partition by week start", func() {
+			p := NewWeeklyPartitioner(extractTime, time.Sunday)
+			So(p.Partition(time.Date(2019, 3, 9, 12, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2019, 3, 3, 0, 0, 0, 0, time.UTC))
+			So(p.Partition(time.Date(2019, 3, 10, 12, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2019, 3, 10, 0, 0, 0, 0, time.UTC))
+
+			p = NewWeeklyPartitioner(extractTime, time.Monday)
+			So(p.Partition(time.Date(2019, 3, 10, 12, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2019, 3, 4, 0, 0, 0, 0, time.UTC))
+		})
+
+		Convey("Fiscal quarterly should partition by quarters starting at start month", func() {
+			p := NewFiscalQuarterlyPartitioner(extractTime, time.February)
+			So(p.Partition(time.Date(2019, 1, 15, 0, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC))
+			So(p.Partition(time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC))
+			So(p.Partition(time.Date(2019, 4, 30, 0, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC))
+			So(p.Partition(time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC))
+			So(p.GetFormat(), ShouldEqual, "fq")
+		})
+
+		Convey("Bi-weekly sprints should partition by sprints anchored at date", func() {
+			anchor := time.Date(2019, 1, 7, 0, 0, 0, 0, time.UTC)
+			p := NewBiWeeklySprintPartitioner(extractTime, anchor)
+			So(p.Partition(time.Date(2019, 1, 20, 23, 0, 0, 0, time.UTC)), ShouldEqual, anchor)
+			So(p.Partition(time.Date(2019, 1, 21, 0, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2019, 1, 21, 0, 0, 0, 0, time.UTC))
+			So(p.Partition(time.Date(2019, 1, 6, 0, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2018, 12, 24, 0, 0, 0, 0, time.UTC))
+		})
+
+		Convey("Release windows should partition by latest release", func() {
+			r1 := time.Date(2019, 1, 10, 12, 0, 0, 0, time.UTC)
+			r2 := time.Date(2019, 2, 10, 12, 0, 0, 0, time.UTC)
+			r3 := time.Date(2019, 2, 20, 12, 0, 0, 0, time.UTC)
+			p := NewReleaseWindowPartitioner(extractTime, []time.Time{r3, r1, r2, r2})
+
+			So(p.Partition(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero(), ShouldBeTrue)
+			So(p.Partition(r1), ShouldEqual, r1)
+			So(p.Partition(time.Date(2019, 2, 15, 0, 0, 0, 0, time.UTC)), ShouldEqual, r2)
+			So(p.Partition(time.Date(2019, 3, 15, 0, 0, 0, 0, time.UTC)), ShouldEqual, r3)
+
+			actual := p.FillMissingValues([]*timeProjectionState{{time: r1}, {time: r3}})
+			So(actual, ShouldHaveLength, 3)
+			So(actual[1].time, ShouldEqual, r2)
+
+			actual = p.FillMissingValues([]*timeProjectionState{{time: r3}})
+			So(actual[1].time, ShouldEqual, r3.Add(10*24*time.Hour))
+		})
+
+		Convey("Custom partitioner should be usable in time series projection", func() {
+			p := NewWeeklyPartitioner(extractTime, time.Sunday)
+			sp := FromStream("input").
+				TimeSeries(p).
+				Init(func(t time.Time, format string) *testTimeState { return &testTimeState{Time: t} }).
+				Apply(func(s *testTimeState, msg time.Time) { s.Count++ }).
+				Build()
+
+			state := sp.Projection.Run(streams.NewFrom(
+				time.Date(2019, 3, 9, 0, 0, 0, 0, time.UTC),
+				time.Date(2019, 3, 10, 0, 0, 0, 0, time.UTC),
+				time.Date(2019, 3, 11, 0, 0, 0, 0, time.UTC),
+			))
+			So(state, ShouldHaveLength, 2)
+			So(state[0].(*testTimeState).Count+state[1].(*testTimeState).Count, ShouldEqual, 3)
+		})
+	})
+}
+
+type testTimeState struct {
+	Time  time.Time
+	Count int
+}
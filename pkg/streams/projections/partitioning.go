@@ -27,24 +27,48 @@ func newPartionedProjection(projection *projection, partitionFns []PartitionFunc
 }
 
 func (p *partionedProjection) Run(in streams.Readable) []ProjectionState {
+	p.applyMessages(in)
+	return p.done()
+}
+
+// applyMessages applies the messages passing the filter to the states of their
+// partitions.
+func (p *partionedProjection) applyMessages(in streams.Readable) {
 	for msg := range in {
-		if p.filterFn != nil && !p.callFilter(msg) {
-			continue
-		}
+		p.handleMessage(msg, func() error {
+			if p.filterFn != nil && !p.callFilter(msg) {
+				return nil
+			}
+
+			return p.applyPartition(msg)
+		})
+	}
+}
 
-		pk := p.callPartition(msg)
-		key := pk.FormatKey()
+// applyPartition applies msg to the state of its partition.
+func (p *partionedProjection) applyPartition(msg interface{}) error {
+	pk := p.callPartition(msg)
+	key := pk.FormatKey()
 
-		state, exists := p.state[key]
-		if !exists {
-			state = p.callInit(pk.GetValues())
-			p.keys[key] = pk
-			p.state[key] = state
-		}
+	return p.callApply(p.partitionState(key, pk), msg)
+}
 
-		p.callApply(state, msg)
+// partitionState returns the state of the partition, initializing it if it
+// does not exist.
+func (p *partionedProjection) partitionState(key string, pk *partitionKey) ProjectionState {
+	state, exists := p.state[key]
+	if !exists {
+		state = p.callInit(pk.GetValues())
+		p.keys[key] = pk
+		p.state[key] = state
 	}
 
+	return state
+}
+
+// done calls the done func with the states of all partitions, sorted by
+// partition key.
+func (p *partionedProjection) done() []ProjectionState {
 	sortedKeys := []string{}
 	for key := range p.state {
 		sortedKeys = append(sortedKeys, key)
@@ -116,8 +140,8 @@ func (b *PartionedProjectionBuilder) ToStream(name string) *PartionedProjectionB
 	return b
 }
 
-func (b *PartionedProjectionBuilder) ToStreams(fn SplitToStreamsFunc) *PartionedProjectionBuilder {
-	b.StreamProjectionBuilder.ToStreams(fn)
+func (b *PartionedProjectionBuilder) ToStreams(fn SplitToStreamsFunc, names ...string) *PartionedProjectionBuilder {
+	b.StreamProjectionBuilder.ToStreams(fn, names...)
 	return b
 }
 
@@ -128,7 +152,7 @@ func (b *PartionedProjectionBuilder) Persist(name string, obj interface{}) *Part
 
 func (b *PartionedProjectionBuilder) Build() *StreamProjection {
 	projection := newProjection(b.filterFn, b.reduceFn, b.reduceInitialValue, b.initFn, b.applyFn, b.doneFn)
-	return newStreamProjection(b.fromStreams, b.splitToStreamsFn, b.persistTo, b.persistObj, newPartionedProjection(projection, b.partitionFns))
+	return newStreamProjection(b.fromStreams, b.splitToStreamsFn, b.toStreamNames, b.persistTo, b.persistObj, newPartionedProjection(projection, b.partitionFns))
 }
 
 type partitionKey struct {
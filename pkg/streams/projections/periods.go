@@ -0,0 +1,255 @@
+package projections
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+)
+
+// Period is a time period of a multi period projection, see Periods.
+type Period struct {
+	format         string
+	newPartitioner func(fn TimeSeriesPartitionFunc) TimePartitioner
+}
+
+// NewPeriod creates a period partitioning by the partitioner newPartitioner
+// creates for the time func of the projection, e.g. to use a period in
+// another time zone or fiscal quarters.
+func NewPeriod(newPartitioner func(fn TimeSeriesPartitionFunc) TimePartitioner) Period {
+	return Period{
+		format:         newPartitioner(nil).GetFormat(),
+		newPartitioner: newPartitioner,
+	}
+}
+
+// Format returns the format of the period, e.g. d for days.
+func (p Period) Format() string {
+	return p.format
+}
+
+// Periods of the built-in time partitioners.
+var (
+	Hourly    = NewPeriod(newHourlyTimeSeriesPartitioner)
+	Daily     = NewPeriod(newDailyTimeSeriesPartitioner)
+	Weekly    = NewPeriod(newWeeklyTimeSeriesPartitioner)
+	Monthly   = NewPeriod(newMonthlyTimeSeriesPartitioner)
+	Quarterly = NewPeriod(newQuarterlyTimeSeriesPartitioner)
+	Yearly    = NewPeriod(newYearlyTimeSeriesPartitioner)
+)
+
+type MergeFunc interface{}
+
+// multiPeriodProjection partitions the messages by several periods in one
+// pass over its input.
+type multiPeriodProjection struct {
+	*projection
+	periods []*timeSeriesProjection
+	mergeFn MergeFunc
+}
+
+func (p *multiPeriodProjection) Run(in streams.Readable) []ProjectionState {
+	// with a merge func only the first period is computed from the messages
+	// and the others are rolled up from it
+	applyTo := p.periods
+	if p.mergeFn != nil {
+		applyTo = p.periods[:1]
+	}
+
+	for msg := range in {
+		p.handleMessage(msg, func() error {
+			if p.filterFn != nil && !p.callFilter(msg) {
+				return nil
+			}
+
+			for _, period := range applyTo {
+				if err := period.applyPartition(msg); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}
+
+	if p.mergeFn != nil {
+		p.rollUp()
+	}
+
+	result := []ProjectionState{}
+	for _, period := range p.periods {
+		period.fillPartitions()
+		result = append(result, period.done()...)
+		if len(period.windows) > 0 {
+			result = append(result, period.windowStates()...)
+		}
+	}
+
+	return result
+}
+
+// rollUp merges the states of the first period into the states of the other
+// periods.
+func (p *multiPeriodProjection) rollUp() {
+	base := p.periods[0]
+
+	sortedKeys := []string{}
+	for key := range base.state {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		pk := base.keys[key]
+		ts, ok := pk.GetTimestamp()
+		if !ok {
+			continue
+		}
+
+		for _, period := range p.periods[1:] {
+			target := newPartitionKey()
+			values := pk.GetValues()
+			for i, k := range pk.GetKeys() {
+				switch k {
+				case timePartitionKey:
+					target.Add(k, period.tsPartitioner.Partition(partitionTime(ts)))
+				case "tsFormat":
+					target.Add(k, period.tsPartitioner.GetFormat())
+				default:
+					target.Add(k, values[i])
+				}
+			}
+
+			state := period.partitionState(target.FormatKey(), target)
+			p.callMerge(state, base.state[key])
+		}
+	}
+}
+
+func (p *multiPeriodProjection) callMerge(target ProjectionState, source ProjectionState) {
+	var params = []reflect.Value{}
+	params = append(params, reflect.ValueOf(target))
+	params = append(params, reflect.ValueOf(source))
+
+	reflect.ValueOf(p.mergeFn).Call(params)
+}
+
+func (p *multiPeriodProjection) formats() string {
+	formats := []string{}
+	for _, period := range p.periods {
+		formats = append(formats, period.tsPartitioner.GetFormat())
+	}
+	return strings.Join(formats, ",")
+}
+
+type MultiPeriodProjectionBuilder struct {
+	*StreamProjectionBuilder
+	timeFn       TimeSeriesPartitionFunc
+	periods      []Period
+	partitionFns []PartitionFunc
+	mergeFn      MergeFunc
+	windows      map[string][]*TimeWindow
+	fill         fillOptions
+}
+
+// Periods partitions the messages by each of periods, using the time returned
+// by fn, in a single pass over the input. The states of all periods are
+// published to the same streams and are told apart by the period format
+// passed as the last argument to the init func.
+func (b *StreamProjectionBuilder) Periods(fn TimeSeriesPartitionFunc, periods ...Period) *MultiPeriodProjectionBuilder {
+	return &MultiPeriodProjectionBuilder{
+		StreamProjectionBuilder: b,
+		timeFn:                  fn,
+		periods:                 periods,
+		partitionFns:            []PartitionFunc{},
+		windows:                 map[string][]*TimeWindow{},
+	}
+}
+
+// PartitionBy partitions the messages of each period further by fns.
+func (b *MultiPeriodProjectionBuilder) PartitionBy(fns ...PartitionFunc) *MultiPeriodProjectionBuilder {
+	b.partitionFns = append(b.partitionFns, fns...)
+	return b
+}
+
+func (b *MultiPeriodProjectionBuilder) Init(fn InitFunc) *MultiPeriodProjectionBuilder {
+	b.StreamProjectionBuilder.Init(fn)
+	return b
+}
+
+func (b *MultiPeriodProjectionBuilder) Apply(fn ApplyFunc) *MultiPeriodProjectionBuilder {
+	b.StreamProjectionBuilder.Apply(fn)
+	return b
+}
+
+// Merge sets a func(target, source) merging the state source into target.
+// With a merge func the messages are only applied to the first period, whose
+// states are then rolled up into the states of the other periods. The first
+// period must therefore be the finest one and fit into the others, e.g. Daily
+// followed by Weekly, Monthly, Quarterly and Yearly.
+func (b *MultiPeriodProjectionBuilder) Merge(fn MergeFunc) *MultiPeriodProjectionBuilder {
+	b.mergeFn = fn
+	return b
+}
+
+// Fill fills the gaps of the series of each period using strategy, after
+// rolling up the periods.
+func (b *MultiPeriodProjectionBuilder) Fill(strategy FillStrategy, fields ...string) *MultiPeriodProjectionBuilder {
+	b.fill.strategy = strategy
+	b.fill.fields = fields
+	return b
+}
+
+// Range fills the series of each period out to the partitions of start and
+// end.
+func (b *MultiPeriodProjectionBuilder) Range(start, end time.Time) *MultiPeriodProjectionBuilder {
+	b.fill.start = start
+	b.fill.end = end
+	return b
+}
+
+func (b *MultiPeriodProjectionBuilder) Done(fn DoneFunc) *MultiPeriodProjectionBuilder {
+	b.StreamProjectionBuilder.Done(fn)
+	return b
+}
+
+// Windows adds windows over the states of period, which are published in
+// addition to the states of the periods.
+func (b *MultiPeriodProjectionBuilder) Windows(period Period, windows ...*TimeWindow) *MultiPeriodProjectionBuilder {
+	b.windows[period.format] = append(b.windows[period.format], windows...)
+	return b
+}
+
+func (b *MultiPeriodProjectionBuilder) ToStream(name string) *MultiPeriodProjectionBuilder {
+	b.StreamProjectionBuilder.ToStream(name)
+	return b
+}
+
+func (b *MultiPeriodProjectionBuilder) ToStreams(fn SplitToStreamsFunc, names ...string) *MultiPeriodProjectionBuilder {
+	b.StreamProjectionBuilder.ToStreams(fn, names...)
+	return b
+}
+
+func (b *MultiPeriodProjectionBuilder) Persist(name string, obj interface{}) *MultiPeriodProjectionBuilder {
+	b.StreamProjectionBuilder.Persist(name, obj)
+	return b
+}
+
+func (b *MultiPeriodProjectionBuilder) Build() *StreamProjection {
+	projection := newProjection(b.filterFn, b.reduceFn, b.reduceInitialValue, b.initFn, b.applyFn, b.doneFn)
+	mp := &multiPeriodProjection{
+		projection: projection,
+		periods:    []*timeSeriesProjection{},
+		mergeFn:    b.mergeFn,
+	}
+
+	for _, period := range b.periods {
+		tsPartitioner := period.newPartitioner(b.timeFn)
+		partionedProjection := newPartionedProjection(projection, timeSeriesPartitionFns(tsPartitioner, b.partitionFns))
+		mp.periods = append(mp.periods, newTimeSeriesProjection(partionedProjection, tsPartitioner, b.windows[period.format], b.fill))
+	}
+
+	return newStreamProjection(b.fromStreams, b.splitToStreamsFn, b.toStreamNames, b.persistTo, b.persistObj, mp)
+}
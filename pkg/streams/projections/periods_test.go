@@ -0,0 +1,120 @@
+package projections
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type periodTestMessage struct {
+	Time time.Time
+	Repo string
+}
+
+type periodTestState struct {
+	Time   time.Time
+	Repo   string
+	Period string
+	Count  int
+}
+
+func TestPeriods(t *testing.T) {
+	Convey("Test multi period projections", t, func() {
+		day := func(m time.Month, d int) time.Time {
+			return time.Date(2019, m, d, 12, 0, 0, 0, time.UTC)
+		}
+
+		messages := []interface{}{
+			&periodTestMessage{Time: day(1, 1), Repo: "a"},
+			&periodTestMessage{Time: day(1, 1), Repo: "b"},
+			&periodTestMessage{Time: day(1, 2), Repo: "a"},
+			&periodTestMessage{Time: day(1, 9), Repo: "a"},
+			&periodTestMessage{Time: day(2, 1), Repo: "a"},
+		}
+
+		builder := func() *MultiPeriodProjectionBuilder {
+			return FromStream("input").
+				Periods(func(msg interface{}) time.Time { return msg.(*periodTestMessage).Time }, Daily, Weekly, Monthly).
+				PartitionBy(func(msg interface{}) (string, interface{}) { return "repo", msg.(*periodTestMessage).Repo }).
+				Init(func(t time.Time, repo string, period string) *periodTestState {
+					return &periodTestState{Time: t, Repo: repo, Period: period}
+				}).
+				Apply(func(s *periodTestState, msg *periodTestMessage) {
+					s.Count++
+				})
+		}
+
+		run := func(sp *StreamProjection) map[string]*periodTestState {
+			result := map[string]*periodTestState{}
+			for _, s := range sp.Projection.Run(streams.NewFrom(messages...)) {
+				state := s.(*periodTestState)
+				result[state.Period+" "+state.Repo+" "+state.Time.Format("01-02")] = state
+			}
+			return result
+		}
+
+		assertPeriods := func(result map[string]*periodTestState) {
+			So(result["d a 01-01"].Count, ShouldEqual, 1)
+			So(result["d b 01-01"].Count, ShouldEqual, 1)
+			So(result["d a 01-09"].Count, ShouldEqual, 1)
+			So(result["w a 12-31"].Count, ShouldEqual, 2)
+			So(result["w b 12-31"].Count, ShouldEqual, 1)
+			So(result["w a 01-07"].Count, ShouldEqual, 1)
+			So(result["w a 01-28"].Count, ShouldEqual, 1)
+			So(result["m a 01-01"].Count, ShouldEqual, 3)
+			So(result["m b 01-01"].Count, ShouldEqual, 1)
+			So(result["m a 02-01"].Count, ShouldEqual, 1)
+		}
+
+		Convey("Should partition by each period in one pass", func() {
+			result := run(builder().Build())
+			So(result, ShouldHaveLength, 12)
+			assertPeriods(result)
+		})
+
+		Convey("Should roll up the first period with a merge func", func() {
+			result := run(builder().
+				Merge(func(target, source *periodTestState) {
+					target.Count += source.Count
+				}).
+				Build())
+			So(result, ShouldHaveLength, 12)
+			assertPeriods(result)
+		})
+
+		Convey("Should add windows of a period", func() {
+			result := run(builder().
+				Windows(Daily, RollingSum(2, "d2", "Count")).
+				Build())
+			So(result["d2 a 01-02"].Count, ShouldEqual, 2)
+			So(result["d2 a 01-03"].Count, ShouldEqual, 1)
+			So(result["w a 12-31"].Count, ShouldEqual, 2)
+		})
+
+		Convey("Should add cumulative windows over the rolled up states of each period", func() {
+			result := run(builder().
+				Merge(func(target, source *periodTestState) {
+					target.Count += source.Count
+				}).
+				Windows(Daily, CumulativeSum("d", "Count")).
+				Windows(Monthly, CumulativeSum("m", "Count")).
+				Build())
+			So(result["d a 01-02"].Count, ShouldEqual, 2)
+			So(result["d a 01-05"].Count, ShouldEqual, 2)
+			So(result["d a 01-09"].Count, ShouldEqual, 3)
+			So(result["m a 01-01"].Count, ShouldEqual, 3)
+			So(result["m a 02-01"].Count, ShouldEqual, 4)
+			So(result["w a 01-07"].Count, ShouldEqual, 1)
+		})
+
+		Convey("Should show all periods in the topology", func() {
+			sp := builder().Windows(Daily, RollingSum(2, "d2", "Count")).Build()
+			topology := newTopology([]string{"input"}, []*StreamProjection{sp})
+			So(topology.Projections[0].Kind, ShouldEqual, ProjectionKindTimeSeries)
+			So(topology.Projections[0].Period, ShouldEqual, "d,w,m")
+			So(topology.Projections[0].Windows, ShouldHaveLength, 1)
+		})
+	})
+}
@@ -24,6 +24,8 @@ type projection struct {
 	initFn             InitFunc
 	applyFn            ApplyFunc
 	doneFn             DoneFunc
+	failureFn          FailureFunc
+	countFn            func()
 }
 
 func newProjection(filterFn FilterFunc, reduceFn ReduceFunc, reduceInitialValue interface{}, initFn InitFunc, applyFn ApplyFunc, doneFn DoneFunc) *projection {
@@ -55,7 +57,9 @@ func (p *projection) callInit(values []interface{}) interface{} {
 	return ret[0].Interface()
 }
 
-func (p *projection) callApply(state ProjectionState, msg interface{}, additionalArgs ...interface{}) {
+// callApply calls the apply func, which may return an error to report the
+// message as failed.
+func (p *projection) callApply(state ProjectionState, msg interface{}, additionalArgs ...interface{}) error {
 	var params = []reflect.Value{}
 	params = append(params, reflect.ValueOf(state))
 	params = append(params, reflect.ValueOf(msg))
@@ -64,7 +68,16 @@ func (p *projection) callApply(state ProjectionState, msg interface{}, additiona
 		params = append(params, reflect.ValueOf(arg))
 	}
 
-	reflect.ValueOf(p.applyFn).Call(params)
+	ret := reflect.ValueOf(p.applyFn).Call(params)
+	if len(ret) == 0 {
+		return nil
+	}
+
+	if err, ok := ret[len(ret)-1].Interface().(error); ok {
+		return err
+	}
+
+	return nil
 }
 
 func (p *projection) callDone(state ProjectionState) {
@@ -82,26 +95,30 @@ func (p *projection) Run(in streams.Readable) []ProjectionState {
 	lastAccumulatedValue := p.reduceInitialValue
 
 	for msg := range in {
-		if p.filterFn != nil && !p.callFilter(msg) {
-			continue
-		}
+		p.handleMessage(msg, func() error {
+			if p.filterFn != nil && !p.callFilter(msg) {
+				return nil
+			}
 
-		if p.reduceFn != nil {
-			lastAccumulatedValue = p.reduceFn(lastAccumulatedValue, msg)
-		}
+			if p.reduceFn != nil {
+				lastAccumulatedValue = p.reduceFn(lastAccumulatedValue, msg)
+			}
 
-		if p.initFn == nil {
-			if p.state == nil {
-				p.state = []interface{}{}
+			if p.initFn == nil {
+				if p.state == nil {
+					p.state = []interface{}{}
+				}
+				arr := p.state.([]interface{})
+				arr = append(arr, msg)
+				p.state = arr
 			}
-			arr := p.state.([]interface{})
-			arr = append(arr, msg)
-			p.state = arr
-		}
 
-		if p.applyFn != nil {
-			p.callApply(p.state, msg)
-		}
+			if p.applyFn != nil {
+				return p.callApply(p.state, msg)
+			}
+
+			return nil
+		})
 	}
 
 	if arr, ok := p.state.([]interface{}); ok {
@@ -130,6 +147,7 @@ type StreamProjectionBuilder struct {
 	initFn             InitFunc
 	applyFn            ApplyFunc
 	splitToStreamsFn   SplitToStreamsFunc
+	toStreamNames      []string
 	doneFn             DoneFunc
 	persistTo          string
 	persistObj         interface{}
@@ -173,6 +191,7 @@ func (b *StreamProjectionBuilder) Done(fn DoneFunc) *StreamProjectionBuilder {
 }
 
 func (b *StreamProjectionBuilder) ToStream(name string) *StreamProjectionBuilder {
+	b.toStreamNames = []string{name}
 	b.splitToStreamsFn = func(state []ProjectionState) map[string][]ProjectionState {
 		return map[string][]ProjectionState{
 			name: state,
@@ -181,8 +200,15 @@ func (b *StreamProjectionBuilder) ToStream(name string) *StreamProjectionBuilder
 	return b
 }
 
-func (b *StreamProjectionBuilder) ToStreams(fn SplitToStreamsFunc) *StreamProjectionBuilder {
+// ToStreams splits the projection state into multiple output streams using fn.
+// Since the topics are decided at runtime, the names of the topics fn may
+// publish to can be declared to make them visible in the engine topology.
+// Without names, a bus validating its subscriptions cannot report subscribed
+// topics that are never published, and emitting projections only publish the
+// topics fn returned states for.
+func (b *StreamProjectionBuilder) ToStreams(fn SplitToStreamsFunc, names ...string) *StreamProjectionBuilder {
 	b.splitToStreamsFn = fn
+	b.toStreamNames = names
 	return b
 }
 
@@ -193,5 +219,5 @@ func (b *StreamProjectionBuilder) Persist(name string, obj interface{}) *StreamP
 }
 
 func (b *StreamProjectionBuilder) Build() *StreamProjection {
-	return newStreamProjection(b.fromStreams, b.splitToStreamsFn, b.persistTo, b.persistObj, newProjection(b.filterFn, b.reduceFn, b.reduceInitialValue, b.initFn, b.applyFn, b.doneFn))
+	return newStreamProjection(b.fromStreams, b.splitToStreamsFn, b.toStreamNames, b.persistTo, b.persistObj, newProjection(b.filterFn, b.reduceFn, b.reduceInitialValue, b.initFn, b.applyFn, b.doneFn))
 }
@@ -0,0 +1,227 @@
+package projections
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type sketchTestState struct {
+	Time         time.Time
+	Period       string
+	Median       float64
+	Contributors float64
+	Ages         *TDigest
+	Logins       *HyperLogLog
+}
+
+func (s *sketchTestState) Digest() *TDigest {
+	return s.Ages
+}
+
+func (s *sketchTestState) Distinct() *HyperLogLog {
+	return s.Logins
+}
+
+func TestTDigest(t *testing.T) {
+	Convey("Test t-digest", t, func() {
+		r := rand.New(rand.NewSource(1))
+		values := make([]float64, 10000)
+		for i := range values {
+			values[i] = r.Float64() * 1000
+		}
+
+		Convey("Empty digest should return zero", func() {
+			So(NewTDigest(DefaultTDigestCompression).Quantile(0.5), ShouldEqual, 0)
+		})
+
+		Convey("Single sample should be returned for all quantiles", func() {
+			d := NewTDigest(DefaultTDigestCompression)
+			d.Add(42)
+			So(d.Quantile(0), ShouldEqual, 42)
+			So(d.Quantile(0.5), ShouldEqual, 42)
+			So(d.Quantile(1), ShouldEqual, 42)
+		})
+
+		Convey("Quantiles should be close to the exact percentiles", func() {
+			d := NewTDigest(DefaultTDigestCompression)
+			for _, v := range values {
+				d.Add(v)
+			}
+
+			So(d.Count(), ShouldEqual, 10000)
+			d.compress()
+			So(len(d.centroids), ShouldBeLessThanOrEqualTo, DefaultTDigestCompression)
+			for _, q := range []float64{0.15, 0.5, 0.85, 0.99} {
+				exact := Percentile(q, append([]float64{}, values...))
+				So(math.Abs(d.Quantile(q)-exact), ShouldBeLessThan, 10)
+			}
+		})
+
+		Convey("Merged digests should give the quantiles of all samples", func() {
+			merged := NewTDigest(DefaultTDigestCompression)
+			for n := 0; n < 10; n++ {
+				d := NewTDigest(DefaultTDigestCompression)
+				for _, v := range values[n*1000 : (n+1)*1000] {
+					d.Add(v)
+				}
+				merged.Merge(d)
+			}
+
+			So(merged.Count(), ShouldEqual, 10000)
+			exact := Percentile(0.5, append([]float64{}, values...))
+			So(math.Abs(merged.Quantile(0.5)-exact), ShouldBeLessThan, 10)
+		})
+
+		Convey("Should round trip through JSON", func() {
+			d := NewTDigest(DefaultTDigestCompression)
+			for _, v := range values {
+				d.Add(v)
+			}
+
+			data, err := json.Marshal(d)
+			So(err, ShouldBeNil)
+
+			decoded := &TDigest{}
+			So(json.Unmarshal(data, decoded), ShouldBeNil)
+			So(decoded.Count(), ShouldEqual, d.Count())
+			So(decoded.Quantile(0.5), ShouldEqual, d.Quantile(0.5))
+		})
+
+		Convey("Should reject invalid encodings", func() {
+			So((&TDigest{}).UnmarshalBinary([]byte{2}), ShouldNotBeNil)
+			So((&TDigest{}).UnmarshalBinary([]byte{1, 0}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestHyperLogLog(t *testing.T) {
+	Convey("Test HyperLogLog", t, func() {
+		Convey("Empty sketch should count zero", func() {
+			So(NewHyperLogLog(DefaultHyperLogLogPrecision).Count(), ShouldEqual, 0)
+		})
+
+		Convey("Duplicates should be counted once", func() {
+			h := NewHyperLogLog(DefaultHyperLogLogPrecision)
+			for n := 0; n < 100; n++ {
+				h.Add("alice")
+				h.Add("bob")
+			}
+			So(h.Count(), ShouldEqual, 2)
+		})
+
+		Convey("Count should be close to the number of distinct values", func() {
+			h := NewHyperLogLog(DefaultHyperLogLogPrecision)
+			for n := 0; n < 100000; n++ {
+				h.Add(fmt.Sprintf("user%d", n))
+			}
+			So(math.Abs(float64(h.Count())-100000), ShouldBeLessThan, 2000)
+		})
+
+		Convey("Merged sketches should count the union", func() {
+			a := NewHyperLogLog(DefaultHyperLogLogPrecision)
+			b := NewHyperLogLog(DefaultHyperLogLogPrecision)
+			for n := 0; n < 1000; n++ {
+				a.Add(fmt.Sprintf("user%d", n))
+				b.Add(fmt.Sprintf("user%d", n+500))
+			}
+
+			So(a.Merge(b), ShouldBeNil)
+			So(math.Abs(float64(a.Count())-1500), ShouldBeLessThan, 30)
+		})
+
+		Convey("Should not merge sketches of different precisions", func() {
+			So(NewHyperLogLog(10).Merge(NewHyperLogLog(12)), ShouldNotBeNil)
+		})
+
+		Convey("Should round trip through JSON", func() {
+			h := NewHyperLogLog(10)
+			for n := 0; n < 100; n++ {
+				h.Add(fmt.Sprintf("user%d", n))
+			}
+
+			data, err := json.Marshal(h)
+			So(err, ShouldBeNil)
+
+			decoded := &HyperLogLog{}
+			So(json.Unmarshal(data, decoded), ShouldBeNil)
+			So(decoded.Count(), ShouldEqual, h.Count())
+		})
+	})
+}
+
+func TestSketchStates(t *testing.T) {
+	Convey("Test projections with sketch states", t, func() {
+		day := func(d int) time.Time {
+			return time.Date(2019, 1, d, 12, 0, 0, 0, time.UTC)
+		}
+
+		type message struct {
+			time  time.Time
+			login string
+			age   float64
+		}
+
+		messages := []interface{}{
+			&message{time: day(1), login: "alice", age: 1},
+			&message{time: day(1), login: "bob", age: 3},
+			&message{time: day(2), login: "alice", age: 5},
+			&message{time: day(8), login: "carol", age: 7},
+		}
+
+		sp := FromStream("input").
+			Periods(func(msg interface{}) time.Time { return msg.(*message).time }, Daily, Weekly).
+			Init(func(t time.Time, period string) *sketchTestState {
+				return &sketchTestState{
+					Time:   t,
+					Period: period,
+					Ages:   NewTDigest(DefaultTDigestCompression),
+					Logins: NewHyperLogLog(DefaultHyperLogLogPrecision),
+				}
+			}).
+			Apply(func(s *sketchTestState, msg *message) {
+				s.Ages.Add(msg.age)
+				s.Logins.Add(msg.login)
+			}).
+			Merge(func(target, source *sketchTestState) {
+				target.Ages.Merge(source.Ages)
+				target.Logins.Merge(source.Logins)
+			}).
+			Done(func(states []ProjectionState) {
+				for _, s := range states {
+					state := s.(*sketchTestState)
+					state.Median = state.Ages.Quantile(0.5)
+					state.Contributors = float64(state.Logins.Count())
+				}
+			}).
+			Windows(Daily,
+				RollingPercentile(2, 0.5, "d2", "Median"),
+				RollingDistinctCount(2, "d2", "Contributors"),
+			).
+			Build()
+
+		result := map[string]*sketchTestState{}
+		for _, s := range sp.Projection.Run(streams.NewFrom(messages...)) {
+			state := s.(*sketchTestState)
+			result[state.Period+" "+state.Time.Format("01-02")] = state
+		}
+
+		Convey("Weeks should be rolled up from the days", func() {
+			So(result["w 12-31"].Contributors, ShouldEqual, 2)
+			So(result["w 12-31"].Ages.Count(), ShouldEqual, 3)
+			So(result["w 12-31"].Median, ShouldEqual, 3)
+			So(result["w 01-07"].Contributors, ShouldEqual, 1)
+		})
+
+		Convey("Windows should merge the sketches of their days", func() {
+			So(result["d2 01-02"].Contributors, ShouldEqual, 2)
+			So(result["d2 01-02"].Median, ShouldEqual, 3)
+		})
+	})
+}
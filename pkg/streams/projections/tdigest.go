@@ -0,0 +1,277 @@
+package projections
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	tdigestEncodingVersion = 1
+
+	// DefaultTDigestCompression keeps about 100 centroids, which gives
+	// quantiles within about 1% of the exact ones.
+	DefaultTDigestCompression = 100
+)
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// TDigest is a mergeable sketch estimating quantiles from a bounded number of
+// centroids instead of all samples. Use it in states instead of raw samples,
+// e.g. to merge the digests of days into the digest of a week.
+type TDigest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []centroid
+	count       float64
+	min         float64
+	max         float64
+}
+
+// NewTDigest creates an empty t-digest. A higher compression keeps more
+// centroids and gives more accurate quantiles.
+func NewTDigest(compression float64) *TDigest {
+	if compression <= 0 {
+		panic(fmt.Sprintf("t-digest compression must be positive, got %v", compression))
+	}
+
+	return &TDigest{
+		compression: compression,
+		centroids:   []centroid{},
+		buffer:      []centroid{},
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+// Add adds the sample x.
+func (d *TDigest) Add(x float64) {
+	d.AddWeighted(x, 1)
+}
+
+// AddWeighted adds the sample x with weight w.
+func (d *TDigest) AddWeighted(x float64, w float64) {
+	if w <= 0 || math.IsNaN(x) {
+		return
+	}
+
+	d.buffer = append(d.buffer, centroid{mean: x, weight: w})
+	d.count += w
+	d.min = math.Min(d.min, x)
+	d.max = math.Max(d.max, x)
+
+	if len(d.buffer) > int(d.compression)*4 {
+		d.compress()
+	}
+}
+
+// Merge adds all samples of other.
+func (d *TDigest) Merge(other *TDigest) {
+	if other == nil || other.count == 0 {
+		return
+	}
+
+	d.buffer = append(d.buffer, other.centroids...)
+	d.buffer = append(d.buffer, other.buffer...)
+	d.count += other.count
+	d.min = math.Min(d.min, other.min)
+	d.max = math.Max(d.max, other.max)
+	d.compress()
+}
+
+// Count returns the total weight of the samples.
+func (d *TDigest) Count() float64 {
+	return d.count
+}
+
+// compress merges the buffered samples into the centroids, merging adjacent
+// centroids as long as they span at most one unit of the scale function.
+func (d *TDigest) compress() {
+	if len(d.buffer) == 0 {
+		return
+	}
+
+	all := append(d.centroids, d.buffer...)
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].mean < all[j].mean
+	})
+
+	result := []centroid{}
+	cur := all[0]
+	weightSoFar := 0.0
+	for _, c := range all[1:] {
+		proposed := cur.weight + c.weight
+		q0 := weightSoFar / d.count
+		q2 := (weightSoFar + proposed) / d.count
+
+		if d.scale(q2)-d.scale(q0) <= 1 {
+			cur.mean += (c.mean - cur.mean) * c.weight / proposed
+			cur.weight = proposed
+			continue
+		}
+
+		result = append(result, cur)
+		weightSoFar += cur.weight
+		cur = c
+	}
+	result = append(result, cur)
+
+	d.centroids = result
+	d.buffer = []centroid{}
+}
+
+// scale is the k1 scale function of the t-digest paper, which allows less
+// weight per centroid near the tails to keep extreme quantiles accurate.
+func (d *TDigest) scale(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// Quantile returns the estimated q quantile, e.g. 0.5 for the median, or 0
+// if no samples were added.
+func (d *TDigest) Quantile(q float64) float64 {
+	d.compress()
+
+	if len(d.centroids) == 0 {
+		return 0
+	}
+	if len(d.centroids) == 1 || q <= 0 {
+		if q >= 1 {
+			return d.max
+		}
+		if q <= 0 {
+			return d.min
+		}
+		return d.centroids[0].mean
+	}
+	if q >= 1 {
+		return d.max
+	}
+
+	index := q * d.count
+	first := d.centroids[0]
+	if index < first.weight/2 {
+		return d.min + (first.mean-d.min)*index/(first.weight/2)
+	}
+
+	weightSoFar := 0.0
+	for n := 0; n < len(d.centroids)-1; n++ {
+		cur, next := d.centroids[n], d.centroids[n+1]
+		left := weightSoFar + cur.weight/2
+		right := weightSoFar + cur.weight + next.weight/2
+		if index <= right {
+			return cur.mean + (next.mean-cur.mean)*(index-left)/(right-left)
+		}
+		weightSoFar += cur.weight
+	}
+
+	last := d.centroids[len(d.centroids)-1]
+	lastCenter := d.count - last.weight/2
+	return last.mean + (d.max-last.mean)*(index-lastCenter)/(last.weight/2)
+}
+
+// MarshalBinary encodes the digest, compressing buffered samples first.
+func (d *TDigest) MarshalBinary() ([]byte, error) {
+	d.compress()
+
+	buf := &bytes.Buffer{}
+	values := []interface{}{
+		uint8(tdigestEncodingVersion),
+		d.compression,
+		d.min,
+		d.max,
+		uint32(len(d.centroids)),
+	}
+	for _, c := range d.centroids {
+		values = append(values, c.mean, c.weight)
+	}
+
+	for _, v := range values {
+		if err := binary.Write(buf, binary.BigEndian, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a digest encoded by MarshalBinary.
+func (d *TDigest) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var version uint8
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return err
+	}
+	if version != tdigestEncodingVersion {
+		return fmt.Errorf("unsupported t-digest encoding version %d", version)
+	}
+
+	var n uint32
+	for _, v := range []interface{}{&d.compression, &d.min, &d.max, &n} {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+
+	if int64(n)*16 != int64(r.Len()) {
+		return fmt.Errorf("invalid t-digest encoding, expected %d centroids", n)
+	}
+
+	d.centroids = make([]centroid, n)
+	d.buffer = []centroid{}
+	d.count = 0
+	for i := range d.centroids {
+		if err := binary.Read(r, binary.BigEndian, &d.centroids[i].mean); err != nil {
+			return err
+		}
+		if err := binary.Read(r, binary.BigEndian, &d.centroids[i].weight); err != nil {
+			return err
+		}
+		d.count += d.centroids[i].weight
+	}
+
+	return nil
+}
+
+// MarshalText encodes the digest as base64, which is also used to persist it
+// and to encode it as JSON.
+func (d *TDigest) MarshalText() ([]byte, error) {
+	return marshalBase64(d)
+}
+
+// UnmarshalText decodes a digest encoded by MarshalText.
+func (d *TDigest) UnmarshalText(text []byte) error {
+	return unmarshalBase64(d, text)
+}
+
+type binaryCodec interface {
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary(data []byte) error
+}
+
+func marshalBase64(v binaryCodec) ([]byte, error) {
+	data, err := v.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	text := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(text, data)
+	return text, nil
+}
+
+func unmarshalBase64(v binaryCodec, text []byte) error {
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+	n, err := base64.StdEncoding.Decode(data, text)
+	if err != nil {
+		return err
+	}
+
+	return v.UnmarshalBinary(data[:n])
+}
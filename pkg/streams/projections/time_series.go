@@ -37,25 +37,18 @@ func (pk *partitionKey) GetTimestamp() (time.Time, bool) {
 
 type timeSeriesProjection struct {
 	*partionedProjection
-	windowKeys       map[string]*partitionKey
-	windows          map[string][]interface{}
-	tsPartitioner    TimePartitioner
-	windowPreceeding int
-	windowFollowing  int
-	windowFormat     string
-	windowApplyFn    TimeWindowApplyFunc
+	tsPartitioner TimePartitioner
+	windows       []*TimeWindow
+	fill          fillOptions
+	watermark     watermarkOptions
 }
 
-func newTimeSeriesProjection(pp *partionedProjection, tp TimePartitioner, windowPreceeding, windowFollowing int, windowFormat string, windowApplyFn TimeWindowApplyFunc) *timeSeriesProjection {
+func newTimeSeriesProjection(pp *partionedProjection, tp TimePartitioner, windows []*TimeWindow, fill fillOptions) *timeSeriesProjection {
 	return &timeSeriesProjection{
 		partionedProjection: pp,
-		windowKeys:          map[string]*partitionKey{},
-		windows:             map[string][]interface{}{},
 		tsPartitioner:       tp,
-		windowPreceeding:    windowPreceeding,
-		windowFollowing:     windowFollowing,
-		windowFormat:        windowFormat,
-		windowApplyFn:       windowApplyFn,
+		windows:             windows,
+		fill:                fill,
 	}
 }
 
@@ -65,12 +58,28 @@ type timeProjectionState struct {
 }
 
 func (p *timeSeriesProjection) Run(in streams.Readable) []ProjectionState {
-	result := p.partionedProjection.Run(in)
+	if p.watermark.enabled {
+		result := []ProjectionState{}
+		p.RunEmitting(in, func(states []ProjectionState) {
+			result = append(result, states...)
+		})
+		return result
+	}
 
-	if p.windowApplyFn == nil {
+	p.applyMessages(in)
+	p.fillPartitions()
+	result := p.done()
+
+	if len(p.windows) == 0 {
 		return result
 	}
 
+	return p.windowStates()
+}
+
+// windowStates returns the states of the windows over the partitions, sorted
+// by partition key.
+func (p *timeSeriesProjection) windowStates() []ProjectionState {
 	group := map[string][]*timeProjectionState{}
 	groupKeys := map[string]*partitionKey{}
 
@@ -87,16 +96,7 @@ func (p *timeSeriesProjection) Run(in streams.Readable) []ProjectionState {
 		if !ok {
 			continue
 		}
-		keys := pk.GetKeys()
-		values := pk.GetValues()
-		pkWithoutTs := newPartitionKey()
-		for i, key := range keys {
-			// skip timestamp and format
-			if i == 0 || i == len(keys)-1 {
-				continue
-			}
-			pkWithoutTs.Add(key, values[i])
-		}
+		pkWithoutTs := seriesKey(pk)
 		pkWithoutTsKey := pkWithoutTs.FormatKey()
 
 		if _, exists := group[pkWithoutTsKey]; !exists {
@@ -109,33 +109,52 @@ func (p *timeSeriesProjection) Run(in streams.Readable) []ProjectionState {
 	state := map[string]ProjectionState{}
 
 	for pkWithoutTsKey, slice := range group {
-		slice = p.tsPartitioner.FillMissingValues(slice)
+		// with a fill strategy the partitions are already filled
+		if !p.fill.enabled() {
+			slice = p.tsPartitioner.FillMissingValues(slice)
+		}
 		var interfaceSlice = make([]interface{}, len(slice))
 		for i, d := range slice {
 			interfaceSlice[i] = d
 		}
-		windowSlices := p.tsPartitioner.Window(p.windowPreceeding, p.windowFollowing, interfaceSlice)
-
-		for _, windowSlice := range windowSlices {
-			pkWithoutTs := groupKeys[pkWithoutTsKey]
-			ts := slice[windowSlice.curIndex].time
-			pk := newPartitionKey()
-			pk.AddTimestamp(ts)
-			values := pkWithoutTs.GetValues()
-			for i, key := range pkWithoutTs.GetKeys() {
-				pk.Add(key, values[i])
-			}
-			pk.Add("format", p.windowFormat)
-			key := pk.FormatKey()
 
-			s := p.callInit(pk.GetValues())
-			for _, item := range slice[windowSlice.wStart:windowSlice.wEnd] {
-				if item.state == nil {
-					item.state = p.callInit(pk.GetValues())
+		for _, w := range p.windows {
+			windowSlices := p.tsPartitioner.Window(w.preceeding, w.following, interfaceSlice)
+
+			for _, windowSlice := range windowSlices {
+				pkWithoutTs := groupKeys[pkWithoutTsKey]
+				ts := slice[windowSlice.curIndex].time
+				pk := newPartitionKey()
+				pk.AddTimestamp(ts)
+				values := pkWithoutTs.GetValues()
+				for i, key := range pkWithoutTs.GetKeys() {
+					pk.Add(key, values[i])
+				}
+				pk.Add("format", w.format)
+				key := pk.FormatKey()
+
+				// windows of the same format, e.g. several percentiles, share state
+				s, exists := state[key]
+				if !exists {
+					s = p.callInit(pk.GetValues())
+				}
+				window := []ProjectionState{}
+				for _, item := range slice[windowSlice.wStart:windowSlice.wEnd] {
+					if item.state == nil {
+						item.state = p.callInit(pk.GetValues())
+					}
+					window = append(window, item.state)
+				}
+
+				if w.aggregateFn != nil {
+					w.aggregateFn(s, window)
+				} else {
+					for _, item := range window {
+						p.callWindowApply(w.applyFn, s, item, len(window))
+					}
 				}
-				p.callWindowApply(s, item.state, len(slice[windowSlice.wStart:windowSlice.wEnd]))
+				state[key] = s
 			}
-			state[key] = s
 		}
 	}
 
@@ -153,25 +172,35 @@ func (p *timeSeriesProjection) Run(in streams.Readable) []ProjectionState {
 	return stateArr
 }
 
-func (p *timeSeriesProjection) callWindowApply(state ProjectionState, msg interface{}, windowSize int) {
+func (p *timeSeriesProjection) callWindowApply(fn TimeWindowApplyFunc, state ProjectionState, msg interface{}, windowSize int) {
 	var params = []reflect.Value{}
 	params = append(params, reflect.ValueOf(state))
 	params = append(params, reflect.ValueOf(msg))
 	params = append(params, reflect.ValueOf(windowSize))
 
-	reflect.ValueOf(p.windowApplyFn).Call(params)
+	reflect.ValueOf(fn).Call(params)
 }
 
 type TimeSeriesProjectionBuilder struct {
 	*PartionedProjectionBuilder
-	tsPartitioner    TimePartitioner
-	windowPreceeding int
-	windowFollowing  int
-	windowFormat     string
-	windowApplyFn    TimeWindowApplyFunc
+	tsPartitioner TimePartitioner
+	windows       []*TimeWindow
+	fill          fillOptions
+	watermark     watermarkOptions
 }
 
 func (b *StreamProjectionBuilder) TimeSeries(tsPartitioner TimePartitioner, fns ...PartitionFunc) *TimeSeriesProjectionBuilder {
+	builder := &TimeSeriesProjectionBuilder{
+		PartionedProjectionBuilder: b.PartitionBy(timeSeriesPartitionFns(tsPartitioner, fns)...),
+		tsPartitioner:              tsPartitioner,
+	}
+
+	return builder
+}
+
+// timeSeriesPartitionFns partitions by the time of tsPartitioner, fns and the
+// format of tsPartitioner, in that order.
+func timeSeriesPartitionFns(tsPartitioner TimePartitioner, fns []PartitionFunc) []PartitionFunc {
 	partitionFns := []PartitionFunc{}
 	partitionFns = append(partitionFns, func(msg interface{}) (key string, value interface{}) {
 		return timePartitionKey, tsPartitioner.Partition(msg)
@@ -180,12 +209,8 @@ func (b *StreamProjectionBuilder) TimeSeries(tsPartitioner TimePartitioner, fns
 	partitionFns = append(partitionFns, func(msg interface{}) (key string, value interface{}) {
 		return "tsFormat", tsPartitioner.GetFormat()
 	})
-	builder := &TimeSeriesProjectionBuilder{
-		PartionedProjectionBuilder: b.PartitionBy(partitionFns...),
-		tsPartitioner:              tsPartitioner,
-	}
 
-	return builder
+	return partitionFns
 }
 
 func (b *StreamProjectionBuilder) Hourly(fn TimeSeriesPartitionFunc, fns ...PartitionFunc) *TimeSeriesProjectionBuilder {
@@ -225,10 +250,50 @@ func (b *TimeSeriesProjectionBuilder) Apply(fn ApplyFunc) *TimeSeriesProjectionB
 type TimeWindowApplyFunc interface{}
 
 func (b *TimeSeriesProjectionBuilder) Window(preceeding, following int, format string, fn TimeWindowApplyFunc) *TimeSeriesProjectionBuilder {
-	b.windowPreceeding = preceeding
-	b.windowFollowing = following
-	b.windowFormat = format
-	b.windowApplyFn = fn
+	return b.Windows(CustomWindow(preceeding, following, format, fn))
+}
+
+// Windows adds windows, e.g. RollingAverage or CumulativeSum, to the
+// projection. The projection then publishes the states of all its windows
+// instead of the states of its partitions. Windows having the same format
+// update the same states, e.g. to compute several percentiles.
+func (b *TimeSeriesProjectionBuilder) Windows(windows ...*TimeWindow) *TimeSeriesProjectionBuilder {
+	b.windows = append(b.windows, windows...)
+	return b
+}
+
+// Fill fills the gaps of each series using strategy, which copies or
+// interpolates fields from the surrounding partitions.
+func (b *TimeSeriesProjectionBuilder) Fill(strategy FillStrategy, fields ...string) *TimeSeriesProjectionBuilder {
+	b.fill.strategy = strategy
+	b.fill.fields = fields
+	return b
+}
+
+// Range fills each series out to the partitions of start and end, so that all
+// series have the same partitions. Without a Fill strategy the added
+// partitions are initialized by Init.
+func (b *TimeSeriesProjectionBuilder) Range(start, end time.Time) *TimeSeriesProjectionBuilder {
+	b.fill.start = start
+	b.fill.end = end
+	return b
+}
+
+// Watermark publishes the state of a partition once the watermark, the latest
+// message time minus maxOutOfOrderness, has passed the end of the partition,
+// instead of when the input ends. Messages arriving later correct their
+// partition, which is then published again, see AllowedLateness.
+func (b *TimeSeriesProjectionBuilder) Watermark(maxOutOfOrderness time.Duration) *TimeSeriesProjectionBuilder {
+	b.watermark.enabled = true
+	b.watermark.maxOutOfOrderness = maxOutOfOrderness
+	return b
+}
+
+// AllowedLateness sets how long after the watermark has passed the end of a
+// partition messages still correct it. Later messages fail with
+// ErrLateMessage.
+func (b *TimeSeriesProjectionBuilder) AllowedLateness(d time.Duration) *TimeSeriesProjectionBuilder {
+	b.watermark.allowedLateness = d
 	return b
 }
 
@@ -242,8 +307,8 @@ func (b *TimeSeriesProjectionBuilder) ToStream(name string) *TimeSeriesProjectio
 	return b
 }
 
-func (b *TimeSeriesProjectionBuilder) ToStreams(fn SplitToStreamsFunc) *TimeSeriesProjectionBuilder {
-	b.PartionedProjectionBuilder.ToStreams(fn)
+func (b *TimeSeriesProjectionBuilder) ToStreams(fn SplitToStreamsFunc, names ...string) *TimeSeriesProjectionBuilder {
+	b.PartionedProjectionBuilder.ToStreams(fn, names...)
 	return b
 }
 
@@ -255,8 +320,9 @@ func (b *TimeSeriesProjectionBuilder) Persist(name string, obj interface{}) *Tim
 func (b *TimeSeriesProjectionBuilder) Build() *StreamProjection {
 	projection := newProjection(b.filterFn, b.reduceFn, b.reduceInitialValue, b.initFn, b.applyFn, b.doneFn)
 	partionedProjection := newPartionedProjection(projection, b.partitionFns)
-	tsProjection := newTimeSeriesProjection(partionedProjection, b.tsPartitioner, b.windowPreceeding, b.windowFollowing, b.windowFormat, b.windowApplyFn)
-	return newStreamProjection(b.fromStreams, b.splitToStreamsFn, b.persistTo, b.persistObj, tsProjection)
+	tsProjection := newTimeSeriesProjection(partionedProjection, b.tsPartitioner, b.windows, b.fill)
+	tsProjection.watermark = b.watermark
+	return newStreamProjection(b.fromStreams, b.splitToStreamsFn, b.toStreamNames, b.persistTo, b.persistObj, tsProjection)
 }
 
 type WindowSlice struct {
@@ -280,7 +346,7 @@ type TimePartitionerBase struct {
 
 func NewTimeSeriesPartitionerBase(extractTimeFn TimeSeriesPartitionFunc, stepFn func(time.Time) time.Time, format string) *TimePartitionerBase {
 	return &TimePartitionerBase{
-		ExtractTimeFn: extractTimeFn,
+		ExtractTimeFn: withPartitionTime(extractTimeFn),
 		StepFn:        stepFn,
 		Format:        format,
 	}
@@ -290,6 +356,16 @@ func (p *TimePartitionerBase) GetFormat() string {
 	return p.Format
 }
 
+// EventTime returns the time of msg the partition is computed from.
+func (p *TimePartitionerBase) EventTime(msg interface{}) time.Time {
+	return p.ExtractTimeFn(msg)
+}
+
+// Next returns the start of the partition following the one starting at t.
+func (p *TimePartitionerBase) Next(t time.Time) time.Time {
+	return p.StepFn(t)
+}
+
 func (p *TimePartitionerBase) FillMissingValues(data []*timeProjectionState) []*timeProjectionState {
 	if len(data) == 0 {
 		return data
@@ -363,7 +439,7 @@ type dailyTimeSeriesPartitioner struct {
 
 func newDailyTimeSeriesPartitioner(extractTimeFn TimeSeriesPartitionFunc) TimePartitioner {
 	stepFn := func(t time.Time) time.Time {
-		return t.Add(24 * time.Hour)
+		return t.AddDate(0, 0, 1)
 	}
 
 	return &dailyTimeSeriesPartitioner{
@@ -382,7 +458,7 @@ type weeklyTimeSeriesPartitioner struct {
 
 func newWeeklyTimeSeriesPartitioner(extractTimeFn TimeSeriesPartitionFunc) TimePartitioner {
 	stepFn := func(t time.Time) time.Time {
-		return t.Add(7 * 24 * time.Hour)
+		return t.AddDate(0, 0, 7)
 	}
 
 	return &weeklyTimeSeriesPartitioner{
@@ -0,0 +1,343 @@
+package projections
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	ProjectionKindProjection  = "projection"
+	ProjectionKindPartitioned = "partitioned"
+	ProjectionKindTimeSeries  = "time-series"
+)
+
+// TopologyWindow describes a window applied to a time series projection.
+type TopologyWindow struct {
+	Preceding int
+	Following int
+	Format    string
+	Function  string
+}
+
+// TopologyProjection describes a registered stream projection.
+type TopologyProjection struct {
+	ID          string
+	Kind        string
+	FromStreams []string
+	ToStreams   []string
+	PersistTo   string
+	Period      string
+	Windows     []*TopologyWindow
+}
+
+// Label returns a short human readable description of the projection.
+func (p *TopologyProjection) Label() string {
+	label := p.Kind
+	if p.Period != "" {
+		label += " (" + p.Period + ")"
+	}
+
+	for n, w := range p.Windows {
+		preceding := fmt.Sprintf("%d", w.Preceding)
+		if w.Preceding == -1 {
+			preceding = "all"
+		}
+		if n > 0 {
+			label += ","
+		}
+		label += fmt.Sprintf(" window %s/%d %s", preceding, w.Following, w.Format)
+		if w.Function != WindowFunctionCustom {
+			label += " " + w.Function
+		}
+	}
+
+	return label
+}
+
+// Topology is the graph of topics, projections and persisters registered in a
+// stream projection engine.
+type Topology struct {
+	Inputs      []string
+	Projections []*TopologyProjection
+}
+
+func newTopology(inputs []string, streamProjections []*StreamProjection) *Topology {
+	t := &Topology{
+		Inputs:      append([]string{}, inputs...),
+		Projections: []*TopologyProjection{},
+	}
+
+	for n, sp := range streamProjections {
+		tp := &TopologyProjection{
+			ID:          fmt.Sprintf("p%d", n),
+			Kind:        ProjectionKindProjection,
+			FromStreams: append([]string{}, sp.FromStreams...),
+			ToStreams:   append([]string{}, sp.ToStreamNames...),
+			PersistTo:   sp.PersistTo,
+		}
+
+		if sp.PersistTo != "" {
+			tp.ToStreams = append(tp.ToStreams, persistTopic(sp.PersistTo))
+		}
+
+		switch p := sp.Projection.(type) {
+		case *timeSeriesProjection:
+			tp.Kind = ProjectionKindTimeSeries
+			tp.Period = p.tsPartitioner.GetFormat()
+			tp.Windows = topologyWindows(p.windows)
+		case *multiPeriodProjection:
+			tp.Kind = ProjectionKindTimeSeries
+			tp.Period = p.formats()
+			for _, period := range p.periods {
+				tp.Windows = append(tp.Windows, topologyWindows(period.windows)...)
+			}
+		case *partionedProjection:
+			tp.Kind = ProjectionKindPartitioned
+		}
+
+		t.Projections = append(t.Projections, tp)
+	}
+
+	return t
+}
+
+func topologyWindows(windows []*TimeWindow) []*TopologyWindow {
+	var result []*TopologyWindow
+	for _, w := range windows {
+		result = append(result, &TopologyWindow{
+			Preceding: w.preceeding,
+			Following: w.following,
+			Format:    w.format,
+			Function:  w.function,
+		})
+	}
+	return result
+}
+
+// Topics returns a sorted list of all topics known in the topology.
+func (t *Topology) Topics() []string {
+	set := map[string]bool{}
+	for _, topic := range t.Inputs {
+		set[topic] = true
+	}
+
+	for _, p := range t.Projections {
+		for _, topic := range p.FromStreams {
+			set[topic] = true
+		}
+		for _, topic := range p.ToStreams {
+			set[topic] = true
+		}
+	}
+
+	return sortedKeys(set)
+}
+
+// Publishers returns the ids of the projections publishing to topic.
+func (t *Topology) Publishers(topic string) []string {
+	ids := []string{}
+	for _, p := range t.Projections {
+		if containsString(p.ToStreams, topic) {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
+
+// Subscribers returns the ids of the projections and persisters subscribing
+// to topic.
+func (t *Topology) Subscribers(topic string) []string {
+	nodes := t.nodeIDs()
+	ids := []string{}
+	for _, p := range t.Projections {
+		if containsString(p.FromStreams, topic) {
+			ids = append(ids, p.ID)
+		}
+		if p.PersistTo != "" && persistTopic(p.PersistTo) == topic {
+			ids = append(ids, nodes.persister(p.PersistTo))
+		}
+	}
+	return ids
+}
+
+// UnsubscribedTopics returns the topics that are published but that nobody
+// subscribes to.
+func (t *Topology) UnsubscribedTopics() []string {
+	topics := []string{}
+	for _, topic := range t.Topics() {
+		if len(t.Subscribers(topic)) == 0 {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// UnpublishedTopics returns the topics that are subscribed to but that are
+// neither published by a projection nor registered as an input.
+func (t *Topology) UnpublishedTopics() []string {
+	topics := []string{}
+	for _, topic := range t.Topics() {
+		if containsString(t.Inputs, topic) {
+			continue
+		}
+
+		if len(t.Publishers(topic)) == 0 {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// WriteDot renders the topology in Graphviz DOT format.
+func (t *Topology) WriteDot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	unsubscribed := t.UnsubscribedTopics()
+	unpublished := t.UnpublishedTopics()
+	nodes := t.nodeIDs()
+
+	fmt.Fprintln(bw, "digraph projections {")
+	fmt.Fprintln(bw, "  rankdir=LR;")
+
+	for _, topic := range t.Topics() {
+		attrs := fmt.Sprintf("shape=ellipse, label=%q", topic)
+		if containsString(t.Inputs, topic) {
+			attrs += ", style=bold"
+		}
+		if containsString(unsubscribed, topic) || containsString(unpublished, topic) {
+			attrs += ", color=red, fontcolor=red"
+		}
+		fmt.Fprintf(bw, "  %s [%s];\n", nodes.topic(topic), attrs)
+	}
+
+	for _, p := range t.Projections {
+		fmt.Fprintf(bw, "  %s [shape=box, label=%q];\n", p.ID, p.Label())
+		if p.PersistTo != "" {
+			fmt.Fprintf(bw, "  %s [shape=cylinder, label=%q];\n", nodes.persister(p.PersistTo), p.PersistTo)
+		}
+	}
+
+	for _, p := range t.Projections {
+		for _, topic := range p.FromStreams {
+			fmt.Fprintf(bw, "  %s -> %s;\n", nodes.topic(topic), p.ID)
+		}
+		for _, topic := range p.ToStreams {
+			fmt.Fprintf(bw, "  %s -> %s;\n", p.ID, nodes.topic(topic))
+		}
+		if p.PersistTo != "" {
+			fmt.Fprintf(bw, "  %s -> %s;\n", nodes.topic(persistTopic(p.PersistTo)), nodes.persister(p.PersistTo))
+		}
+	}
+
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+// WriteMermaid renders the topology as a Mermaid flowchart.
+func (t *Topology) WriteMermaid(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	unsubscribed := t.UnsubscribedTopics()
+	unpublished := t.UnpublishedTopics()
+	nodes := t.nodeIDs()
+
+	fmt.Fprintln(bw, "graph LR")
+
+	for _, topic := range t.Topics() {
+		fmt.Fprintf(bw, "  %s([%q])\n", nodes.topic(topic), topic)
+	}
+
+	for _, p := range t.Projections {
+		fmt.Fprintf(bw, "  %s[%q]\n", p.ID, p.Label())
+		if p.PersistTo != "" {
+			fmt.Fprintf(bw, "  %s[(%q)]\n", nodes.persister(p.PersistTo), p.PersistTo)
+		}
+	}
+
+	for _, p := range t.Projections {
+		for _, topic := range p.FromStreams {
+			fmt.Fprintf(bw, "  %s --> %s\n", nodes.topic(topic), p.ID)
+		}
+		for _, topic := range p.ToStreams {
+			fmt.Fprintf(bw, "  %s --> %s\n", p.ID, nodes.topic(topic))
+		}
+		if p.PersistTo != "" {
+			fmt.Fprintf(bw, "  %s --> %s\n", nodes.topic(persistTopic(p.PersistTo)), nodes.persister(p.PersistTo))
+		}
+	}
+
+	warnings := append(append([]string{}, unsubscribed...), unpublished...)
+	if len(warnings) > 0 {
+		fmt.Fprintln(bw, "  classDef warning stroke:#f00,color:#f00")
+		ids := []string{}
+		for _, topic := range warnings {
+			ids = append(ids, nodes.topic(topic))
+		}
+		fmt.Fprintf(bw, "  class %s warning\n", strings.Join(ids, ","))
+	}
+
+	return bw.Flush()
+}
+
+var nonIdentifierChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// nodeIDs maps topics and persisters to node ids of the rendered graph.
+// Names are sanitized into identifiers, and names sanitized into an id that
+// is already taken, e.g. a.b and a_b, get a numbered suffix.
+type nodeIDs struct {
+	topics     map[string]string
+	persisters map[string]string
+	taken      map[string]bool
+}
+
+func (t *Topology) nodeIDs() *nodeIDs {
+	n := &nodeIDs{topics: map[string]string{}, persisters: map[string]string{}, taken: map[string]bool{}}
+	for _, topic := range t.Topics() {
+		n.topics[topic] = n.unique("t_" + nonIdentifierChars.ReplaceAllString(topic, "_"))
+	}
+	for _, p := range t.Projections {
+		if _, exists := n.persisters[p.PersistTo]; p.PersistTo != "" && !exists {
+			n.persisters[p.PersistTo] = n.unique("s_" + nonIdentifierChars.ReplaceAllString(p.PersistTo, "_"))
+		}
+	}
+	return n
+}
+
+func (n *nodeIDs) unique(id string) string {
+	result := id
+	for i := 2; n.taken[result]; i++ {
+		result = fmt.Sprintf("%s_%d", id, i)
+	}
+	n.taken[result] = true
+	return result
+}
+
+func (n *nodeIDs) topic(topic string) string {
+	return n.topics[topic]
+}
+
+func (n *nodeIDs) persister(persistTo string) string {
+	return n.persisters[persistTo]
+}
+
+func containsString(slice []string, value string) bool {
+	for _, v := range slice {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,101 @@
+package projections
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	"github.com/grafana/devtools/pkg/streams/memorybus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type topologyTestState struct {
+	Time   time.Time
+	Period string
+	Count  int
+}
+
+func TestTopology(t *testing.T) {
+	Convey("Test topology", t, func() {
+		engine := New(memorybus.New(), streams.NewNoOpStreamPersister())
+		engine.RegisterInput("events")
+
+		engine.Register(FromStream("events").
+			ToStreams(func(state []ProjectionState) map[string][]ProjectionState {
+				return map[string][]ProjectionState{"a": state}
+			}, "a", "b").
+			Build())
+
+		engine.Register(FromStream("a").
+			Daily(func(msg interface{}) time.Time { return time.Now() }).
+			Init(func(t time.Time, period string) *topologyTestState {
+				return &topologyTestState{Time: t, Period: period}
+			}).
+			Apply(func(state *topologyTestState, msg interface{}) { state.Count++ }).
+			Window(6, 0, "d7", func(state, msg *topologyTestState, windowSize int) {}).
+			ToStream("d7_a").
+			Build())
+
+		engine.Register(FromStreams("d7_a", "typo").
+			ToStream("all_a").
+			Persist("a", &topologyTestState{}).
+			Build())
+
+		topology := engine.Topology()
+
+		Convey("Should describe registered projections", func() {
+			So(topology.Inputs, ShouldResemble, []string{"events"})
+			So(topology.Projections, ShouldHaveLength, 3)
+
+			So(topology.Projections[0].Kind, ShouldEqual, ProjectionKindProjection)
+			So(topology.Projections[0].ToStreams, ShouldResemble, []string{"a", "b"})
+
+			So(topology.Projections[1].Kind, ShouldEqual, ProjectionKindTimeSeries)
+			So(topology.Projections[1].Period, ShouldEqual, "d")
+			So(topology.Projections[1].Windows, ShouldResemble, []*TopologyWindow{{Preceding: 6, Following: 0, Format: "d7", Function: WindowFunctionCustom}})
+			So(topology.Projections[1].Label(), ShouldEqual, "time-series (d) window 6/0 d7")
+
+			So(topology.Projections[2].PersistTo, ShouldEqual, "a")
+			So(topology.Projections[2].ToStreams, ShouldResemble, []string{"all_a", "persist_to_a"})
+		})
+
+		Convey("Should list topics, publishers and subscribers", func() {
+			So(topology.Topics(), ShouldResemble, []string{"a", "all_a", "b", "d7_a", "events", "persist_to_a", "typo"})
+			So(topology.Publishers("a"), ShouldResemble, []string{"p0"})
+			So(topology.Subscribers("a"), ShouldResemble, []string{"p1"})
+			So(topology.Subscribers("persist_to_a"), ShouldResemble, []string{"s_a"})
+		})
+
+		Convey("Should flag topics without subscribers and subscribed topics never published", func() {
+			So(topology.UnsubscribedTopics(), ShouldResemble, []string{"all_a", "b"})
+			So(topology.UnpublishedTopics(), ShouldResemble, []string{"typo"})
+		})
+
+		Convey("Should render dot", func() {
+			var buf bytes.Buffer
+			So(topology.WriteDot(&buf), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, "digraph projections {")
+			So(buf.String(), ShouldContainSubstring, "t_events -> p0;")
+			So(buf.String(), ShouldContainSubstring, "t_persist_to_a -> s_a;")
+			So(buf.String(), ShouldContainSubstring, `t_typo [shape=ellipse, label="typo", color=red, fontcolor=red];`)
+		})
+
+		Convey("Should render mermaid", func() {
+			var buf bytes.Buffer
+			So(topology.WriteMermaid(&buf), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, "graph LR")
+			So(buf.String(), ShouldContainSubstring, "p1 --> t_d7_a")
+			So(buf.String(), ShouldContainSubstring, "class t_all_a,t_b,t_typo warning")
+		})
+
+		Convey("Should give topics sanitized into the same id unique ids", func() {
+			t := &Topology{Inputs: []string{"a.b", "a_b", "a_b_2"}}
+			var buf bytes.Buffer
+			So(t.WriteMermaid(&buf), ShouldBeNil)
+			So(buf.String(), ShouldContainSubstring, `t_a_b(["a.b"])`)
+			So(buf.String(), ShouldContainSubstring, `t_a_b_2(["a_b"])`)
+			So(buf.String(), ShouldContainSubstring, `t_a_b_2_2(["a_b_2"])`)
+		})
+	})
+}
@@ -0,0 +1,159 @@
+package projections
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+)
+
+// ErrLateMessage is reported for messages arriving after the allowed lateness
+// of their partition, e.g. as dead letter. The message is dropped.
+var ErrLateMessage = errors.New("message arrived after the allowed lateness of its partition")
+
+type watermarkOptions struct {
+	enabled           bool
+	maxOutOfOrderness time.Duration
+	allowedLateness   time.Duration
+}
+
+// emittingProjection publishes states while running instead of once its input
+// ends.
+type emittingProjection interface {
+	emitting() bool
+	RunEmitting(in streams.Readable, emit func(states []ProjectionState))
+}
+
+func (p *timeSeriesProjection) emitting() bool {
+	return p.watermark.enabled
+}
+
+// RunEmitting emits the states of the partitions the watermark has passed,
+// and again the states of fired partitions corrected by late messages. The
+// remaining partitions are emitted when the input ends. With windows all
+// states are emitted when the input ends, since windows span partitions.
+// States are emitted as shallow copies, so values referenced by states, e.g.
+// sketches, are shared with the states late messages are applied to.
+func (p *timeSeriesProjection) RunEmitting(in streams.Readable, emit func(states []ProjectionState)) {
+	incremental := len(p.windows) == 0
+	var watermark time.Time
+	pending := map[string]bool{}
+	fired := map[string]bool{}
+	dirty := map[string]bool{}
+
+	fire := func(final bool) {
+		keys := []string{}
+		for key := range dirty {
+			keys = append(keys, key)
+		}
+		for key := range pending {
+			ts, _ := p.keys[key].GetTimestamp()
+			if final || !p.partitionEnd(ts).After(watermark) {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			return
+		}
+		sort.Strings(keys)
+
+		states := []ProjectionState{}
+		for _, key := range keys {
+			fired[key] = true
+			delete(pending, key)
+			delete(dirty, key)
+			states = append(states, p.state[key])
+		}
+
+		if p.doneFn != nil {
+			p.callDone(states)
+		}
+
+		// late messages may still change the states after they are emitted
+		snapshots := make([]ProjectionState, len(states))
+		for n, state := range states {
+			snapshots[n] = snapshot(state)
+		}
+		emit(snapshots)
+	}
+
+	for msg := range in {
+		p.handleMessage(msg, func() error {
+			if p.filterFn != nil && !p.callFilter(msg) {
+				return nil
+			}
+
+			pk := p.callPartition(msg)
+			key := pk.FormatKey()
+			ts, _ := pk.GetTimestamp()
+			if !watermark.IsZero() && !p.partitionEnd(ts).Add(p.watermark.allowedLateness).After(watermark) {
+				return ErrLateMessage
+			}
+
+			if err := p.callApply(p.partitionState(key, pk), msg); err != nil {
+				return err
+			}
+			if fired[key] {
+				dirty[key] = true
+			} else {
+				pending[key] = true
+			}
+
+			if next := p.eventTime(msg, ts).Add(-p.watermark.maxOutOfOrderness); next.After(watermark) {
+				watermark = next
+				if incremental {
+					fire(false)
+				}
+			}
+
+			return nil
+		})
+	}
+
+	p.fillPartitions()
+	if !incremental {
+		p.done()
+		emit(p.windowStates())
+		return
+	}
+
+	for key := range p.state {
+		if !fired[key] {
+			pending[key] = true
+		}
+	}
+	fire(true)
+}
+
+// snapshot returns a shallow copy of a state that is a pointer to a struct.
+func snapshot(state ProjectionState) ProjectionState {
+	v := reflect.ValueOf(state)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return state
+	}
+
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface()
+}
+
+// eventTime returns the time of msg, or the start of its partition ts if the
+// time partitioner does not expose it.
+func (p *timeSeriesProjection) eventTime(msg interface{}, ts time.Time) time.Time {
+	if tp, ok := p.tsPartitioner.(interface {
+		EventTime(msg interface{}) time.Time
+	}); ok {
+		return tp.EventTime(msg)
+	}
+	return ts
+}
+
+// partitionEnd returns the end of the partition starting at ts.
+func (p *timeSeriesProjection) partitionEnd(ts time.Time) time.Time {
+	if tp, ok := p.tsPartitioner.(interface{ Next(t time.Time) time.Time }); ok {
+		return tp.Next(ts)
+	}
+	return ts
+}
@@ -0,0 +1,188 @@
+package projections
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	"github.com/grafana/devtools/pkg/streams/memorybus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type watermarkTestMessage struct {
+	Time  time.Time
+	Value int
+}
+
+type watermarkTestState struct {
+	Time  time.Time
+	Value int
+}
+
+func TestWatermark(t *testing.T) {
+	Convey("Test watermarks and allowed lateness", t, func() {
+		at := func(d, h int) time.Time {
+			return time.Date(2019, 1, d, h, 0, 0, 0, time.UTC)
+		}
+
+		messages := []interface{}{
+			&watermarkTestMessage{Time: at(1, 10), Value: 1},
+			&watermarkTestMessage{Time: at(2, 3), Value: 2},
+			// late, but within the allowed lateness of day 1
+			&watermarkTestMessage{Time: at(1, 20), Value: 4},
+			&watermarkTestMessage{Time: at(2, 5), Value: 1},
+			&watermarkTestMessage{Time: at(3, 6), Value: 8},
+			// after the allowed lateness of day 1
+			&watermarkTestMessage{Time: at(1, 23), Value: 16},
+		}
+
+		builder := func() *TimeSeriesProjectionBuilder {
+			return FromStream("input").
+				Daily(func(msg interface{}) time.Time { return msg.(*watermarkTestMessage).Time }).
+				Init(func(t time.Time, period string) *watermarkTestState {
+					return &watermarkTestState{Time: t}
+				}).
+				Apply(func(s *watermarkTestState, msg *watermarkTestMessage) {
+					s.Value += msg.Value
+				}).
+				Watermark(2 * time.Hour).
+				AllowedLateness(24 * time.Hour)
+		}
+
+		Convey("Partitions should be emitted when the watermark passes them", func() {
+			emitted := [][]watermarkTestState{}
+			sp := builder().Build()
+			sp.Projection.(emittingProjection).RunEmitting(streams.NewFrom(messages...), func(states []ProjectionState) {
+				batch := []watermarkTestState{}
+				for _, s := range states {
+					batch = append(batch, *s.(*watermarkTestState))
+				}
+				emitted = append(emitted, batch)
+			})
+
+			So(emitted, ShouldResemble, [][]watermarkTestState{
+				{{Time: at(1, 0), Value: 1}},
+				{{Time: at(1, 0), Value: 5}},
+				{{Time: at(2, 0), Value: 3}},
+				{{Time: at(3, 0), Value: 8}},
+			})
+		})
+
+		Convey("Run should return all emitted states", func() {
+			result := builder().Build().Projection.Run(streams.NewFrom(messages...))
+			So(result, ShouldHaveLength, 4)
+			So(result[1].(*watermarkTestState).Value, ShouldEqual, 5)
+		})
+
+		Convey("Windows should only be emitted when the input ends", func() {
+			emitted := 0
+			sp := builder().Windows(RollingSum(2, "d2", "Value")).Build()
+			sp.Projection.(emittingProjection).RunEmitting(streams.NewFrom(messages...), func(states []ProjectionState) {
+				emitted++
+			})
+			So(emitted, ShouldEqual, 1)
+		})
+
+		Convey("Engine should publish corrected partitions and report late messages", func() {
+			bus := memorybus.New()
+			engine := New(bus, streams.NewNoOpStreamPersister())
+			engine.SetDeadLetterTopic("dead")
+			engine.RegisterInput("input")
+			engine.Register(builder().ToStream("output").Build())
+
+			var mu sync.Mutex
+			output := []watermarkTestState{}
+			bus.Subscribe([]string{"output"}, func(p streams.Publisher, stream streams.Readable) {
+				for msg := range stream {
+					mu.Lock()
+					output = append(output, *msg.(*watermarkTestState))
+					mu.Unlock()
+				}
+			})
+
+			deadLetters := []*DeadLetter{}
+			bus.Subscribe([]string{"dead"}, func(p streams.Publisher, stream streams.Readable) {
+				for msg := range stream {
+					mu.Lock()
+					deadLetters = append(deadLetters, msg.(*DeadLetter))
+					mu.Unlock()
+				}
+			})
+
+			done := bus.Start()
+			bus.Publish("input", streams.NewFrom(messages...))
+			<-done
+
+			So(output, ShouldHaveLength, 4)
+			So(output[0].Time, ShouldEqual, at(1, 0))
+			So(output[1].Time, ShouldEqual, at(1, 0))
+			So(deadLetters, ShouldHaveLength, 1)
+			So(deadLetters[0].Error, ShouldEqual, ErrLateMessage.Error())
+		})
+
+		Convey("Engine should publish declared topics nothing was emitted to", func() {
+			bus := memorybus.New()
+			engine := New(bus, streams.NewNoOpStreamPersister())
+			engine.RegisterInput("input")
+			engine.Register(builder().
+				ToStreams(func(states []ProjectionState) map[string][]ProjectionState {
+					// only returns the topics states are split to
+					split := map[string][]ProjectionState{}
+					for _, s := range states {
+						topic := "small"
+						if s.(*watermarkTestState).Value > 100 {
+							topic = "large"
+						}
+						split[topic] = append(split[topic], s)
+					}
+					return split
+				}, "small", "large").
+				Build())
+
+			var mu sync.Mutex
+			received := map[string]int{}
+			for _, topic := range []string{"small", "large"} {
+				topic := topic
+				bus.Subscribe([]string{topic}, func(p streams.Publisher, stream streams.Readable) {
+					for range stream {
+						mu.Lock()
+						received[topic]++
+						mu.Unlock()
+					}
+				})
+			}
+
+			done := bus.Start()
+			bus.Publish("input", streams.NewFrom(messages...))
+			<-done
+
+			So(received, ShouldResemble, map[string]int{"small": 4})
+		})
+
+		Convey("Engine should persist and publish nothing for an empty input", func() {
+			bus := memorybus.New()
+			engine := New(bus, streams.NewNoOpStreamPersister())
+			engine.RegisterInput("input")
+			engine.Register(builder().ToStream("output").Persist("output", &watermarkTestState{}).Build())
+
+			received := 0
+			bus.Subscribe([]string{"output"}, func(p streams.Publisher, stream streams.Readable) {
+				for range stream {
+					received++
+				}
+			})
+
+			done := bus.Start()
+			bus.Publish("input", streams.NewFrom())
+
+			select {
+			case succeeded := <-done:
+				So(succeeded, ShouldBeTrue)
+			case <-time.After(10 * time.Second):
+				So("bus not done", ShouldBeEmpty)
+			}
+			So(received, ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,310 @@
+package projections
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Window functions of the built-in window aggregations.
+const (
+	WindowFunctionCustom        = "custom"
+	WindowFunctionSum           = "sum"
+	WindowFunctionAverage       = "avg"
+	WindowFunctionEMA           = "ema"
+	WindowFunctionPercentile    = "percentile"
+	WindowFunctionCumulativeSum = "cumsum"
+	WindowFunctionCumulativeMax = "cummax"
+	WindowFunctionDistinctCount = "distinct"
+)
+
+// windowAggregateFunc sets the fields of state, initialized for the window,
+// from the partition states of the window, sorted by time.
+type windowAggregateFunc func(state ProjectionState, window []ProjectionState)
+
+// TimeWindow is a window over the partitions of a time series projection.
+// Each window creates one state per partition, identified by the time of the
+// partition and the format of the window.
+type TimeWindow struct {
+	preceeding  int
+	following   int
+	format      string
+	function    string
+	applyFn     TimeWindowApplyFunc
+	aggregateFn windowAggregateFunc
+}
+
+// SampleState is implemented by states that keep the raw samples they were
+// computed from, e.g. ages to compute a median of, which RollingPercentile
+// uses to compute percentiles over a window.
+type SampleState interface {
+	Samples() []float64
+}
+
+// DigestState is implemented by states that keep a t-digest of their samples,
+// which RollingPercentile merges instead of the raw samples.
+type DigestState interface {
+	Digest() *TDigest
+}
+
+// DistinctState is implemented by states that keep a HyperLogLog sketch of
+// distinct values, e.g. contributors, which RollingDistinctCount merges.
+type DistinctState interface {
+	Distinct() *HyperLogLog
+}
+
+// CustomWindow calls fn(windowState, partitionState, windowSize) for each
+// partition state of the window. Use -1 as preceeding to include all
+// preceeding partitions.
+func CustomWindow(preceeding, following int, format string, fn TimeWindowApplyFunc) *TimeWindow {
+	return &TimeWindow{
+		preceeding: preceeding,
+		following:  following,
+		format:     format,
+		function:   WindowFunctionCustom,
+		applyFn:    fn,
+	}
+}
+
+// RollingSum sums fields over the last size partitions.
+func RollingSum(size int, format string, fields ...string) *TimeWindow {
+	return &TimeWindow{
+		preceeding: size - 1,
+		format:     format,
+		function:   WindowFunctionSum,
+		aggregateFn: func(state ProjectionState, window []ProjectionState) {
+			for _, field := range fields {
+				sum := 0.0
+				for _, s := range window {
+					sum += getNumericField(s, field)
+				}
+				setNumericField(state, field, sum)
+			}
+		},
+	}
+}
+
+// RollingAverage averages fields over the last size partitions, i.e. sums
+// them divided by size, like the moving averages of the previous custom
+// windows.
+func RollingAverage(size int, format string, fields ...string) *TimeWindow {
+	return &TimeWindow{
+		preceeding: size - 1,
+		format:     format,
+		function:   WindowFunctionAverage,
+		aggregateFn: func(state ProjectionState, window []ProjectionState) {
+			for _, field := range fields {
+				sum := 0.0
+				for _, s := range window {
+					sum += getNumericField(s, field)
+				}
+				setNumericField(state, field, sum/float64(size))
+			}
+		},
+	}
+}
+
+// ExponentialMovingAverage computes the exponential moving average of fields
+// over all preceeding partitions, using the smoothing factor 2/(span+1).
+func ExponentialMovingAverage(span int, format string, fields ...string) *TimeWindow {
+	alpha := 2 / (float64(span) + 1)
+
+	return &TimeWindow{
+		preceeding: -1,
+		format:     format,
+		function:   WindowFunctionEMA,
+		aggregateFn: func(state ProjectionState, window []ProjectionState) {
+			for _, field := range fields {
+				ema := 0.0
+				for n, s := range window {
+					v := getNumericField(s, field)
+					if n == 0 {
+						ema = v
+						continue
+					}
+					ema = alpha*v + (1-alpha)*ema
+				}
+				setNumericField(state, field, ema)
+			}
+		},
+	}
+}
+
+// RollingPercentile sets field to the k percentile, e.g. 0.5 for the median,
+// of the last size partitions. The partition states must implement
+// DigestState, whose digests are merged, or SampleState, whose raw samples are
+// used.
+func RollingPercentile(size int, k float64, format string, field string) *TimeWindow {
+	return &TimeWindow{
+		preceeding: size - 1,
+		format:     format,
+		function:   WindowFunctionPercentile,
+		aggregateFn: func(state ProjectionState, window []ProjectionState) {
+			if _, ok := window[0].(DigestState); ok {
+				var digest *TDigest
+				for _, s := range window {
+					d := s.(DigestState).Digest()
+					if d == nil {
+						continue
+					}
+					if digest == nil {
+						digest = NewTDigest(d.compression)
+					}
+					digest.Merge(d)
+				}
+				if digest != nil {
+					setNumericField(state, field, digest.Quantile(k))
+				}
+				return
+			}
+
+			samples := []float64{}
+			for _, s := range window {
+				sampleState, ok := s.(SampleState)
+				if !ok {
+					panic(fmt.Sprintf("rolling percentile requires state %T to implement DigestState or SampleState", s))
+				}
+				samples = append(samples, sampleState.Samples()...)
+			}
+			setNumericField(state, field, Percentile(k, samples))
+		},
+	}
+}
+
+// RollingDistinctCount sets field to the number of distinct values over the
+// last size partitions. The partition states must implement DistinctState.
+func RollingDistinctCount(size int, format string, field string) *TimeWindow {
+	return &TimeWindow{
+		preceeding: size - 1,
+		format:     format,
+		function:   WindowFunctionDistinctCount,
+		aggregateFn: func(state ProjectionState, window []ProjectionState) {
+			var sketch *HyperLogLog
+			for _, s := range window {
+				distinctState, ok := s.(DistinctState)
+				if !ok {
+					panic(fmt.Sprintf("rolling distinct count requires state %T to implement DistinctState", s))
+				}
+
+				h := distinctState.Distinct()
+				if h == nil {
+					continue
+				}
+				if sketch == nil {
+					sketch = NewHyperLogLog(h.precision)
+				}
+				if err := sketch.Merge(h); err != nil {
+					panic(err)
+				}
+			}
+
+			if sketch != nil {
+				setNumericField(state, field, float64(sketch.Count()))
+			}
+		},
+	}
+}
+
+// CumulativeSum sums fields over all preceeding partitions.
+func CumulativeSum(format string, fields ...string) *TimeWindow {
+	w := RollingSum(0, format, fields...)
+	w.preceeding = -1
+	w.function = WindowFunctionCumulativeSum
+	return w
+}
+
+// CumulativeMax sets fields to their max over all preceeding partitions.
+func CumulativeMax(format string, fields ...string) *TimeWindow {
+	return &TimeWindow{
+		preceeding: -1,
+		format:     format,
+		function:   WindowFunctionCumulativeMax,
+		aggregateFn: func(state ProjectionState, window []ProjectionState) {
+			for _, field := range fields {
+				max := math.Inf(-1)
+				for _, s := range window {
+					max = math.Max(max, getNumericField(s, field))
+				}
+				setNumericField(state, field, max)
+			}
+		},
+	}
+}
+
+// Percentile returns the k percentile of values, which are sorted in place.
+func Percentile(k float64, values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	index := k * float64(len(values))
+
+	if index != float64(int64(index)) {
+		index = math.Round(index)
+		if int(index) == 0 {
+			return values[int(index)]
+		}
+		return values[int(index)-1]
+	}
+
+	if int(index) >= len(values) {
+		return values[len(values)-1]
+	}
+
+	if int(index) == 0 {
+		return values[0]
+	}
+
+	slice := values[int(index)-1 : int(index)+1]
+	return (slice[0] + slice[1]) / 2
+}
+
+func numericField(state ProjectionState, name string) reflect.Value {
+	v := reflect.ValueOf(state)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	f := v.FieldByName(name)
+	if !f.IsValid() {
+		panic(fmt.Sprintf("window field %s not found in state %T", name, state))
+	}
+
+	return f
+}
+
+func getNumericField(state ProjectionState, name string) float64 {
+	f := numericField(state, name)
+
+	switch f.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return f.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(f.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(f.Uint())
+	}
+
+	panic(fmt.Sprintf("window field %s of state %T is not numeric", name, state))
+}
+
+// setNumericField sets the field name of state to value. Integer fields are
+// truncated, like converting value to an int.
+func setNumericField(state ProjectionState, name string, value float64) {
+	f := numericField(state, name)
+
+	switch f.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f.SetFloat(value)
+		return
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f.SetInt(int64(value))
+		return
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f.SetUint(uint64(value))
+		return
+	}
+
+	panic(fmt.Sprintf("window field %s of state %T is not numeric", name, state))
+}
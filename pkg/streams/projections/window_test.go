@@ -0,0 +1,122 @@
+package projections
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type windowTestMessage struct {
+	Time  time.Time
+	Value float64
+}
+
+type windowTestState struct {
+	Time    time.Time
+	Period  string
+	Count   int
+	Value   float64
+	P50     float64
+	P90     float64
+	samples []float64
+}
+
+func (s *windowTestState) Samples() []float64 {
+	return s.samples
+}
+
+func TestWindows(t *testing.T) {
+	Convey("Test window aggregations", t, func() {
+		day := func(d int) time.Time {
+			return time.Date(2019, 1, d, 0, 0, 0, 0, time.UTC)
+		}
+
+		// day 3 has no messages and is filled with an empty state
+		messages := []interface{}{
+			&windowTestMessage{Time: day(1), Value: 1},
+			&windowTestMessage{Time: day(1), Value: 3},
+			&windowTestMessage{Time: day(2), Value: 10},
+			&windowTestMessage{Time: day(4), Value: 4},
+		}
+
+		run := func(windows ...*TimeWindow) map[string]*windowTestState {
+			sp := FromStream("input").
+				Daily(func(msg interface{}) time.Time { return msg.(*windowTestMessage).Time }).
+				Init(func(t time.Time, period string) *windowTestState {
+					return &windowTestState{Time: t, Period: period, samples: []float64{}}
+				}).
+				Apply(func(s *windowTestState, msg *windowTestMessage) {
+					s.Count++
+					s.Value += msg.Value
+					s.samples = append(s.samples, msg.Value)
+				}).
+				Windows(windows...).
+				Build()
+
+			result := map[string]*windowTestState{}
+			for _, s := range sp.Projection.Run(streams.NewFrom(messages...)) {
+				state := s.(*windowTestState)
+				result[state.Period+" "+state.Time.Format("02")] = state
+			}
+			return result
+		}
+
+		Convey("Rolling sum should sum the last partitions", func() {
+			result := run(RollingSum(2, "d2", "Count", "Value"))
+			So(result, ShouldHaveLength, 3)
+			So(result["d2 02"].Count, ShouldEqual, 3)
+			So(result["d2 02"].Value, ShouldEqual, 14)
+			So(result["d2 03"].Value, ShouldEqual, 10)
+			So(result["d2 04"].Value, ShouldEqual, 4)
+		})
+
+		Convey("Rolling average should average the last partitions", func() {
+			result := run(RollingAverage(2, "d2", "Count", "Value"))
+			So(result, ShouldHaveLength, 3)
+			So(result["d2 02"].Value, ShouldEqual, 7)
+			So(result["d2 04"].Value, ShouldEqual, 2)
+			So(result["d2 02"].Count, ShouldEqual, 1)
+			So(result["d2 03"].Count, ShouldEqual, 0)
+		})
+
+		Convey("Exponential moving average should weight recent partitions", func() {
+			result := run(ExponentialMovingAverage(3, "ema", "Value"))
+			So(result, ShouldHaveLength, 4)
+			So(result["ema 01"].Value, ShouldEqual, 4)
+			So(result["ema 02"].Value, ShouldEqual, 7)
+			So(result["ema 03"].Value, ShouldEqual, 3.5)
+			So(result["ema 04"].Value, ShouldEqual, 3.75)
+		})
+
+		Convey("Rolling percentile should use the raw samples of the partitions", func() {
+			result := run(
+				RollingPercentile(2, 0.5, "d2", "P50"),
+				RollingPercentile(2, 0.9, "d2", "P90"),
+			)
+			So(result, ShouldHaveLength, 3)
+			So(result["d2 02"].P50, ShouldEqual, 3)
+			So(result["d2 02"].P90, ShouldEqual, 10)
+			So(result["d2 03"].P50, ShouldEqual, 10)
+		})
+
+		Convey("Cumulative sum and max should use all preceeding partitions", func() {
+			result := run(CumulativeSum("cumsum", "Value"), CumulativeMax("cummax", "Count"))
+			So(result, ShouldHaveLength, 8)
+			So(result["cumsum 01"].Value, ShouldEqual, 4)
+			So(result["cumsum 04"].Value, ShouldEqual, 18)
+			So(result["cummax 01"].Count, ShouldEqual, 2)
+			So(result["cummax 04"].Count, ShouldEqual, 2)
+		})
+
+		Convey("Custom window should call apply func for each partition", func() {
+			result := run(CustomWindow(1, 0, "custom", func(s *windowTestState, item *windowTestState, windowSize int) {
+				s.Value = math.Max(s.Value, item.Value)
+			}))
+			So(result["custom 02"].Value, ShouldEqual, 10)
+			So(result["custom 04"].Value, ShouldEqual, 4)
+		})
+	})
+}
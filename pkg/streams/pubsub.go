@@ -13,5 +13,22 @@ type Publisher interface {
 type Bus interface {
 	Subscriber
 	Publisher
+	// Start runs the subscriptions. The returned channel receives true once
+	// all of them completed, or false if the bus failed.
 	Start() <-chan bool
+	// Err returns why the bus failed, or nil.
+	Err() error
 }
+
+// PublisherRegistry is implemented by buses that can validate their
+// subscriptions against the topics that are declared to be published.
+// fromTopics are the topics the publisher subscribes to, if any, and
+// toTopics the topics it publishes to.
+type PublisherRegistry interface {
+	DeclarePublisher(fromTopics []string, toTopics []string)
+}
+
+// AnyTopic is declared as a topic of a publisher whose topics are only known
+// at runtime. Buses then cannot tell whether a subscribed topic is never
+// published.
+const AnyTopic = "*"
@@ -0,0 +1,15 @@
+package sqlpersistence
+
+import "github.com/grafana/devtools/pkg/streams/metrics"
+
+var (
+	persistedRows = metrics.NewCounterVec(
+		"devtools_persisted_rows_total",
+		"Number of rows persisted to a database table.",
+		"table")
+	persistDuration = metrics.NewHistogramVec(
+		"devtools_persist_duration_seconds",
+		"Time it takes to persist a stream to a database table.",
+		metrics.DefBuckets,
+		"table")
+)
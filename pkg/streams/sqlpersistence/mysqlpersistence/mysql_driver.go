@@ -109,6 +109,19 @@ func (sp *mySqlDriver) PersistStream(tx *sql.Tx, t *sqlpersistence.Table, stream
 		preparedArgs = append(preparedArgs, "?")
 	}
 	preparedSQLStr := "(" + strings.Join(preparedArgs, ",") + ")"
+
+	// states published again, e.g. corrected by late events, replace the
+	// persisted rows
+	updates := []string{}
+	for _, c := range t.Columns {
+		if !c.IsPrimaryKey {
+			updates = append(updates, fmt.Sprintf("%s=VALUES(%s)", c.Name, c.Name))
+		}
+	}
+	if len(updates) == 0 {
+		updates = append(updates, fmt.Sprintf("%s=%s", t.Columns[0].Name, t.Columns[0].Name))
+	}
+	upsertSQL := " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ",")
 	sql := ""
 	processedRows := int64(0)
 	rowsAffected := int64(0)
@@ -129,7 +142,7 @@ func (sp *mySqlDriver) PersistStream(tx *sql.Tx, t *sqlpersistence.Table, stream
 		rowsAffected++
 
 		if processedRows > 999 {
-			stmt, err := tx.Prepare(initialSQL + sql)
+			stmt, err := tx.Prepare(initialSQL + sql + upsertSQL)
 			if err != nil {
 				return 0, err
 			}
@@ -154,7 +167,7 @@ func (sp *mySqlDriver) PersistStream(tx *sql.Tx, t *sqlpersistence.Table, stream
 		return rowsAffected, nil
 	}
 
-	stmt, err := tx.Prepare(initialSQL + sql)
+	stmt, err := tx.Prepare(initialSQL + sql + upsertSQL)
 	if err != nil {
 		return 0, err
 	}
@@ -83,7 +83,41 @@ func (sp *postgresDriver) CreateTableIfNotExists(tx *sql.Tx, t *sqlpersistence.T
 }
 
 func (sp *postgresDriver) PersistStream(tx *sql.Tx, t *sqlpersistence.Table, stream streams.Readable) (int64, error) {
-	stmt, err := tx.Prepare(pq.CopyIn(t.TableName, t.GetColumnNames()...))
+	// with a primary key the stream is copied into a temporary table and
+	// upserted from there, so states published again, e.g. corrected by late
+	// events, replace the persisted rows
+	tmpTableName := t.TableName + "_upsert"
+	upsertSQL := upsertFromTable(t, tmpTableName)
+	if upsertSQL == "" {
+		return sp.copyIn(tx, t.TableName, t, stream)
+	}
+
+	for _, query := range []string{
+		fmt.Sprintf("CREATE TEMPORARY TABLE %s (LIKE %s) ON COMMIT DROP", pq.QuoteIdentifier(tmpTableName), pq.QuoteIdentifier(t.TableName)),
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN persist_seq BIGSERIAL", pq.QuoteIdentifier(tmpTableName)),
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			sp.logger.Debug("failed to create temporary table", "table", tmpTableName, "sql", query)
+			return 0, err
+		}
+	}
+
+	rowsAffected, err := sp.copyIn(tx, tmpTableName, t, stream)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(upsertSQL); err != nil {
+		sp.logger.Debug("failed to upsert rows", "table", t.TableName, "sql", upsertSQL)
+		return 0, err
+	}
+
+	return rowsAffected, nil
+}
+
+// copyIn copies the rows of stream into tableName, having the columns of t.
+func (sp *postgresDriver) copyIn(tx *sql.Tx, tableName string, t *sqlpersistence.Table, stream streams.Readable) (int64, error) {
+	stmt, err := tx.Prepare(pq.CopyIn(tableName, t.GetColumnNames()...))
 	if err != nil {
 		return 0, err
 	}
@@ -115,6 +149,45 @@ func (sp *postgresDriver) PersistStream(tx *sql.Tx, t *sqlpersistence.Table, str
 	return rowsAffected, nil
 }
 
+// upsertFromTable returns the statement upserting the rows of tmpTableName
+// into t, the last copied row winning for duplicate primary keys. Returns an
+// empty string if t has no primary key, in which case rows are only inserted.
+func upsertFromTable(t *sqlpersistence.Table, tmpTableName string) string {
+	columns := []string{}
+	primaryKeys := []string{}
+	updates := []string{}
+	for _, c := range t.Columns {
+		name := pq.QuoteIdentifier(c.Name)
+		columns = append(columns, name)
+		if c.IsPrimaryKey {
+			primaryKeys = append(primaryKeys, name)
+		} else {
+			updates = append(updates, fmt.Sprintf("%s=EXCLUDED.%s", name, name))
+		}
+	}
+
+	if len(primaryKeys) == 0 {
+		return ""
+	}
+
+	conflict := "DO NOTHING"
+	if len(updates) > 0 {
+		conflict = "DO UPDATE SET " + strings.Join(updates, ",")
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT DISTINCT ON (%s) %s FROM %s ORDER BY %s, persist_seq DESC ON CONFLICT (%s) %s",
+		pq.QuoteIdentifier(t.TableName),
+		strings.Join(columns, ","),
+		strings.Join(primaryKeys, ","),
+		strings.Join(columns, ","),
+		pq.QuoteIdentifier(tmpTableName),
+		strings.Join(primaryKeys, ","),
+		strings.Join(primaryKeys, ","),
+		conflict,
+	)
+}
+
 func getColumnType(c *sqlpersistence.Column) (string, error) {
 	switch c.Type {
 	case sqlpersistence.ColumnTypeInteger:
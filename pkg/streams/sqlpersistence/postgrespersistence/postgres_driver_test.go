@@ -0,0 +1,46 @@
+package sqlpersistence
+
+import (
+	"testing"
+
+	"github.com/grafana/devtools/pkg/streams/sqlpersistence"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUpsertFromTable(t *testing.T) {
+	Convey("Test upsert from table", t, func() {
+		Convey("With primary key should upsert the last copied row per key", func() {
+			table := &sqlpersistence.Table{
+				TableName: "activity",
+				Columns: []*sqlpersistence.Column{
+					{Name: "time", IsPrimaryKey: true},
+					{Name: "repo", IsPrimaryKey: true},
+					{Name: "count"},
+				},
+			}
+
+			So(upsertFromTable(table, "activity_upsert"), ShouldEqual,
+				`INSERT INTO "activity" ("time","repo","count") SELECT DISTINCT ON ("time","repo") "time","repo","count" FROM "activity_upsert" `+
+					`ORDER BY "time","repo", persist_seq DESC ON CONFLICT ("time","repo") DO UPDATE SET "count"=EXCLUDED."count"`)
+		})
+
+		Convey("With only primary key columns should ignore existing rows", func() {
+			table := &sqlpersistence.Table{
+				TableName: "repos",
+				Columns:   []*sqlpersistence.Column{{Name: "repo", IsPrimaryKey: true}},
+			}
+
+			So(upsertFromTable(table, "repos_upsert"), ShouldEqual,
+				`INSERT INTO "repos" ("repo") SELECT DISTINCT ON ("repo") "repo" FROM "repos_upsert" ORDER BY "repo", persist_seq DESC ON CONFLICT ("repo") DO NOTHING`)
+		})
+
+		Convey("Without primary key should not upsert", func() {
+			table := &sqlpersistence.Table{
+				TableName: "events",
+				Columns:   []*sqlpersistence.Column{{Name: "time"}, {Name: "count"}},
+			}
+
+			So(upsertFromTable(table, "events_upsert"), ShouldEqual, "")
+		})
+	})
+}
@@ -2,6 +2,7 @@ package sqlpersistence
 
 import (
 	"database/sql"
+	"encoding"
 	"fmt"
 	"reflect"
 	"sort"
@@ -59,6 +60,8 @@ func Drivers() []string {
 	return list
 }
 
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
 type SQLStreamPersister struct {
 	streams.StreamPersister
 	DriverName         string
@@ -130,6 +133,26 @@ func (sp *SQLStreamPersister) Register(name string, objTemplate interface{}) err
 	t := reflect.TypeOf(objTemplate).Elem()
 	t.NumField()
 	setColumnDataType := func(t reflect.Type, c *Column) {
+		// e.g. sketches like projections.TDigest are persisted in their text encoding
+		if t.Kind() == reflect.Ptr && t.Implements(textMarshalerType) {
+			c.Type = ColumnTypeString
+			if c.Length == 0 {
+				c.Length = 4096
+			}
+			c.ConvertFn = func(v interface{}) interface{} {
+				if reflect.ValueOf(v).IsNil() {
+					return nil
+				}
+				text, err := v.(encoding.TextMarshaler).MarshalText()
+				if err != nil {
+					sp.logger.Error("failed to encode column value", "type", t, "error", err)
+					return nil
+				}
+				return string(text)
+			}
+			return
+		}
+
 		switch t.Kind() {
 		case reflect.TypeOf(time.Time{}).Kind():
 			c.Type = ColumnTypeInteger
@@ -267,6 +290,8 @@ func (sp *SQLStreamPersister) Persist(name string, stream streams.Readable) erro
 		}
 
 		sp.logger.Debug("stream persisted to database", "table", name, "took", time.Since(start), "rowsAffected", rowsAffected)
+		persistedRows.WithLabelValues(name).Add(float64(rowsAffected))
+		persistDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
 
 		return nil
 	})
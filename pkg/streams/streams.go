@@ -167,6 +167,12 @@ func (r Readable) FlatMap(fn FlatMapFunc) Readable {
 }
 
 func Split(streamCount int, stream Readable) ReadableCollection {
+	return SplitObserved(streamCount, stream, nil)
+}
+
+// SplitObserved splits stream like Split and calls fn, if not nil, with each
+// message before it is written to the split streams.
+func SplitObserved(streamCount int, stream Readable, fn func(T)) ReadableCollection {
 	rc, wc := NewCollection(streamCount)
 
 	var wg sync.WaitGroup
@@ -175,6 +181,9 @@ func Split(streamCount int, stream Readable) ReadableCollection {
 	go func() {
 		defer wg.Done()
 		for evt := range stream {
+			if fn != nil {
+				fn(evt)
+			}
 			for n := 0; n < streamCount; n++ {
 				c := wc[n]
 				c <- evt
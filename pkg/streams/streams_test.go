@@ -216,6 +216,21 @@ func TestStreams(t *testing.T) {
 				So(result[0], ShouldResemble, []T{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
 				So(result[1], ShouldResemble, []T{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
 			})
+
+			Convey("When splitting observed should call the observer once for each written message", func() {
+				observed := []T{}
+				inputs := SplitObserved(2, in, func(msg T) { observed = append(observed, msg) })
+
+				result := writeAndReadAllMessages(inputs, WritableCollection{out}, func(writer int, out Writable) {
+					for n := 0; n < 3; n++ {
+						out <- n
+					}
+				})
+
+				So(result[0], ShouldResemble, []T{0, 1, 2})
+				So(result[1], ShouldResemble, []T{0, 1, 2})
+				So(observed, ShouldResemble, []T{0, 1, 2})
+			})
 		})
 
 		Convey("Given two readable and writable streams", func() {
@@ -0,0 +1,174 @@
+package streams
+
+import "sync"
+
+// Subscription keeps track of the streams a bus publishes to the topics of a
+// subscriber. A subscription ends when a stream has been received for each of
+// its topics or, if it is long lived, when all of its topics have been
+// closed.
+type Subscription struct {
+	Topics      []string
+	SubscribeFn SubscribeFunc
+	// Ready is closed when the first stream is received or the subscription
+	// ends without any
+	Ready        chan bool
+	ReadyStreams int
+	longLived    bool
+	counterFn    func(topic string) func()
+	published    chan publishedStream
+	mu           sync.Mutex
+	pending      map[string]bool
+	isReady      bool
+	closed       bool
+}
+
+type publishedStream struct {
+	topic  string
+	stream Readable
+}
+
+func NewSubscription(topics []string, subscribeFn SubscribeFunc) *Subscription {
+	pending := map[string]bool{}
+	for _, topic := range topics {
+		pending[topic] = true
+	}
+
+	return &Subscription{
+		Topics:      topics,
+		SubscribeFn: subscribeFn,
+		Ready:       make(chan bool),
+		published:   make(chan publishedStream),
+		pending:     pending,
+	}
+}
+
+// SetLongLived makes the subscription receive any number of streams per
+// topic until the topic is closed.
+func (s *Subscription) SetLongLived() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.longLived = true
+}
+
+// SetMessageCounter makes Run call the func returned by fn for the topic of
+// a stream with each message of the stream it forwards to the subscriber.
+func (s *Subscription) SetMessageCounter(fn func(topic string) func()) {
+	s.counterFn = fn
+}
+
+func (s *Subscription) HasTopic(topic string) bool {
+	for _, t := range s.Topics {
+		if t == topic {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddReadyStream hands the stream created by streamFn over to the
+// subscription. Returns false if the stream was not accepted, because the
+// subscription has ended or already received a stream for topic, streamFn is
+// not called in that case.
+func (s *Subscription) AddReadyStream(topic string, streamFn func() Readable) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || !s.pending[topic] {
+		return false
+	}
+
+	s.ReadyStreams++
+	s.markReady()
+
+	s.published <- publishedStream{topic: topic, stream: streamFn()}
+
+	if !s.longLived {
+		delete(s.pending, topic)
+	}
+
+	if len(s.pending) == 0 {
+		s.close()
+	}
+
+	return true
+}
+
+// CloseTopic ends the subscription once all of its topics have been closed
+// or, unless it is long lived, received a stream.
+func (s *Subscription) CloseTopic(topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	delete(s.pending, topic)
+
+	if len(s.pending) == 0 {
+		s.markReady()
+		s.close()
+	}
+}
+
+// Abandon ends the subscription without handing it any more streams. Streams
+// already handed over but not yet run are drained.
+func (s *Subscription) Abandon() {
+	go func() {
+		for ps := range s.published {
+			go ps.stream.Drain()
+		}
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.close()
+	}
+}
+
+// Run calls the subscribe func with the messages of all streams handed over
+// to the subscription and returns when the subscribe func returns.
+func (s *Subscription) Run(p Publisher) {
+	in, out := New()
+
+	subscriberDone := make(chan bool)
+	go func() {
+		s.SubscribeFn(p, in)
+		close(subscriberDone)
+	}()
+
+	var wg sync.WaitGroup
+	for ps := range s.published {
+		wg.Add(1)
+		go func(ps publishedStream) {
+			count := func() {}
+			if s.counterFn != nil {
+				count = s.counterFn(ps.topic)
+			}
+			for msg := range ps.stream {
+				count()
+				out <- msg
+			}
+			wg.Done()
+		}(ps)
+	}
+
+	wg.Wait()
+	close(out)
+	<-subscriberDone
+}
+
+func (s *Subscription) markReady() {
+	if !s.isReady {
+		s.isReady = true
+		close(s.Ready)
+	}
+}
+
+func (s *Subscription) close() {
+	s.closed = true
+	close(s.published)
+}
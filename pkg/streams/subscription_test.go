@@ -0,0 +1,58 @@
+package streams
+
+import (
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubscription(t *testing.T) {
+	Convey("Test subscription", t, func() {
+		received := []T{}
+		s := NewSubscription([]string{"a", "b"}, func(p Publisher, stream Readable) {
+			for msg := range stream {
+				received = append(received, msg)
+			}
+		})
+
+		done := make(chan bool)
+		go func() {
+			s.Run(nil)
+			close(done)
+		}()
+
+		Convey("Should end once a stream has been received for each topic", func() {
+			So(s.AddReadyStream("a", func() Readable { return NewFrom(1, 2) }), ShouldBeTrue)
+			<-s.Ready
+			So(s.AddReadyStream("a", func() Readable { return NewFrom(5) }), ShouldBeFalse)
+			So(s.AddReadyStream("b", func() Readable { return NewFrom(3) }), ShouldBeTrue)
+			<-done
+
+			sort.Slice(received, func(i, j int) bool { return received[i].(int) < received[j].(int) })
+			So(received, ShouldResemble, []T{1, 2, 3})
+			So(s.ReadyStreams, ShouldEqual, 2)
+			So(s.AddReadyStream("b", func() Readable { return NewFrom(4) }), ShouldBeFalse)
+		})
+
+		Convey("Long lived should receive streams until its topics are closed", func() {
+			s.SetLongLived()
+			So(s.AddReadyStream("a", func() Readable { return NewFrom(1) }), ShouldBeTrue)
+			So(s.AddReadyStream("a", func() Readable { return NewFrom(2) }), ShouldBeTrue)
+			s.CloseTopic("a")
+			So(s.AddReadyStream("a", func() Readable { return NewFrom(3) }), ShouldBeFalse)
+			s.CloseTopic("b")
+			<-done
+
+			sort.Slice(received, func(i, j int) bool { return received[i].(int) < received[j].(int) })
+			So(received, ShouldResemble, []T{1, 2})
+		})
+
+		Convey("Abandoned should not accept streams", func() {
+			s.Abandon()
+			<-done
+			So(s.AddReadyStream("a", func() Readable { return NewFrom(1) }), ShouldBeFalse)
+			So(received, ShouldBeEmpty)
+		})
+	})
+}
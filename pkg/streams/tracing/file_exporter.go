@@ -0,0 +1,196 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const instrumentationScope = "github.com/grafana/devtools"
+
+// OTLP span kind and status codes.
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusCodeOk     = 1
+	otlpStatusCodeError  = 2
+)
+
+// FileExporter writes spans to a file in the OTLP JSON format, one
+// ExportTraceServiceRequest per line, which is the format written by the file
+// exporter and read by the otlpjsonfile receiver of the OpenTelemetry
+// collector.
+type FileExporter struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// NewFileExporter creates an exporter writing to path, replacing any existing
+// file.
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileExporter{
+		file:   f,
+		writer: bufio.NewWriter(f),
+	}, nil
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func toOTLPValue(v interface{}) otlpAnyValue {
+	switch value := v.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &value}
+	case bool:
+		return otlpAnyValue{BoolValue: &value}
+	case int:
+		s := strconv.FormatInt(int64(value), 10)
+		return otlpAnyValue{IntValue: &s}
+	case int32:
+		s := strconv.FormatInt(int64(value), 10)
+		return otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		return otlpAnyValue{IntValue: &s}
+	case float32:
+		f := float64(value)
+		return otlpAnyValue{DoubleValue: &f}
+	case float64:
+		return otlpAnyValue{DoubleValue: &value}
+	case time.Time:
+		s := value.Format(time.RFC3339)
+		return otlpAnyValue{StringValue: &s}
+	}
+
+	s := fmt.Sprintf("%v", v)
+	return otlpAnyValue{StringValue: &s}
+}
+
+func toOTLPSpan(s *Span) otlpSpan {
+	span := otlpSpan{
+		TraceID:           s.TraceID.String(),
+		SpanID:            s.SpanID.String(),
+		Name:              s.Name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Status:            otlpStatus{Code: otlpStatusCodeOk},
+	}
+
+	if !s.ParentSpanID.IsZero() {
+		span.ParentSpanID = s.ParentSpanID.String()
+	}
+
+	for _, attr := range s.Attributes {
+		span.Attributes = append(span.Attributes, otlpKeyValue{Key: attr.Key, Value: toOTLPValue(attr.Value)})
+	}
+
+	if s.Err != nil {
+		span.Status = otlpStatus{Code: otlpStatusCodeError, Message: s.Err.Error()}
+	}
+
+	return span
+}
+
+func (e *FileExporter) Export(serviceName string, spans []*Span) error {
+	scopeSpans := otlpScopeSpans{Scope: otlpScope{Name: instrumentationScope}}
+	for _, s := range spans {
+		scopeSpans.Spans = append(scopeSpans.Spans, toOTLPSpan(s))
+	}
+
+	req := otlpTraceRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{
+						{Key: "service.name", Value: toOTLPValue(serviceName)},
+					},
+				},
+				ScopeSpans: []otlpScopeSpans{scopeSpans},
+			},
+		},
+	}
+
+	data, err := json.Marshal(&req)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, err := e.writer.Write(data); err != nil {
+		return err
+	}
+
+	return e.writer.WriteByte('\n')
+}
+
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.writer.Flush(); err != nil {
+		e.file.Close()
+		return err
+	}
+
+	return e.file.Close()
+}
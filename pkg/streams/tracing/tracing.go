@@ -0,0 +1,254 @@
+// Package tracing records spans of work done by the pipeline, e.g. downloading
+// an archive hour file or running a projection, to find out where the time of
+// a run is spent.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/devtools/pkg/streams/log"
+)
+
+// DefaultBatchSize is the number of ended spans a tracer buffers before
+// exporting them.
+const DefaultBatchSize = 512
+
+// TraceID identifies all spans of a trace.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsZero returns true for the parent span id of a root span.
+func (id SpanID) IsZero() bool {
+	return id == SpanID{}
+}
+
+// Attribute is a key/value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is a named and timed unit of work, optionally being the child of
+// another span.
+type Span struct {
+	tracer       *Tracer
+	mu           sync.Mutex
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Name         string
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attribute
+	Err          error
+	ended        bool
+}
+
+// SetAttributes adds key/value pairs, in the same form as log context, to the
+// span.
+func (s *Span) SetAttributes(kv ...interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes = append(s.Attributes, toAttributes(kv)...)
+}
+
+// SetError marks the span as failed with err, if not nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err
+}
+
+// Finish ends the span and hands it over to the tracer for export. Calling
+// Finish more than once has no effect.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	if s.tracer != nil {
+		s.tracer.spanEnded(s)
+	}
+}
+
+func toAttributes(kv []interface{}) []Attribute {
+	attrs := []Attribute{}
+	for n := 0; n < len(kv); n += 2 {
+		key := fmt.Sprintf("%v", kv[n])
+		var value interface{} = "(missing)"
+		if n+1 < len(kv) {
+			value = kv[n+1]
+		}
+		attrs = append(attrs, Attribute{Key: key, Value: value})
+	}
+	return attrs
+}
+
+// Exporter sends ended spans somewhere.
+type Exporter interface {
+	Export(serviceName string, spans []*Span) error
+	Close() error
+}
+
+// Tracer creates spans and exports them in batches once they have ended.
+type Tracer struct {
+	serviceName string
+	exporter    Exporter
+	batchSize   int
+	mu          sync.Mutex
+	batch       []*Span
+	lastErr     error
+}
+
+// New creates a tracer for the named service exporting spans using exporter.
+func New(serviceName string, exporter Exporter) *Tracer {
+	return &Tracer{
+		serviceName: serviceName,
+		exporter:    exporter,
+		batchSize:   DefaultBatchSize,
+		batch:       []*Span{},
+	}
+}
+
+// SetBatchSize sets the number of ended spans buffered before exporting them.
+func (t *Tracer) SetBatchSize(size int) {
+	t.batchSize = size
+}
+
+type spanContextKey struct{}
+
+// SpanFromContext returns the span stored in ctx, if any.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	return s
+}
+
+// Start starts a span that is a child of the span in ctx, if any, and returns
+// a context holding the new span. The context of logger, which may be nil, and
+// kv are added as attributes.
+func (t *Tracer) Start(ctx context.Context, name string, logger log.Logger, kv ...interface{}) (context.Context, *Span) {
+	s := &Span{
+		tracer: t,
+		Name:   name,
+		Start:  time.Now(),
+	}
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentSpanID = parent.SpanID
+	} else {
+		rand.Read(s.TraceID[:])
+	}
+	rand.Read(s.SpanID[:])
+
+	if logger != nil {
+		s.SetAttributes(log.Context(logger)...)
+	}
+	s.SetAttributes(kv...)
+
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+func (t *Tracer) spanEnded(s *Span) {
+	t.mu.Lock()
+	t.batch = append(t.batch, s)
+	if len(t.batch) < t.batchSize {
+		t.mu.Unlock()
+		return
+	}
+
+	batch := t.batch
+	t.batch = []*Span{}
+	t.mu.Unlock()
+
+	t.export(batch)
+}
+
+func (t *Tracer) export(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := t.exporter.Export(t.serviceName, batch); err != nil {
+		t.mu.Lock()
+		t.lastErr = err
+		t.mu.Unlock()
+	}
+}
+
+// Close exports the buffered spans and closes the exporter. Returns the last
+// error of exporting spans, if any.
+func (t *Tracer) Close() error {
+	t.mu.Lock()
+	batch := t.batch
+	t.batch = []*Span{}
+	t.mu.Unlock()
+
+	t.export(batch)
+
+	if err := t.exporter.Close(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastErr
+}
+
+var (
+	defaultTracerMu sync.RWMutex
+	defaultTracer   *Tracer
+)
+
+// SetDefault sets the tracer used by Start. Without a default tracer Start
+// returns nil spans, which are safe to use but not recorded.
+func SetDefault(t *Tracer) {
+	defaultTracerMu.Lock()
+	defer defaultTracerMu.Unlock()
+	defaultTracer = t
+}
+
+// Start starts a span using the default tracer, see Tracer.Start.
+func Start(ctx context.Context, name string, logger log.Logger, kv ...interface{}) (context.Context, *Span) {
+	defaultTracerMu.RLock()
+	t := defaultTracer
+	defaultTracerMu.RUnlock()
+
+	if t == nil {
+		return ctx, nil
+	}
+
+	return t.Start(ctx, name, logger, kv...)
+}
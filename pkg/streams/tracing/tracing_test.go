@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/devtools/pkg/streams/log"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordingExporter struct {
+	spans  []*Span
+	closed bool
+}
+
+func (e *recordingExporter) Export(serviceName string, spans []*Span) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	Convey("Test tracing", t, func() {
+		exporter := &recordingExporter{}
+		tracer := New("test", exporter)
+
+		Convey("Child span should belong to trace of parent", func() {
+			logger := log.New().New("logger", "archive-downloader")
+
+			ctx, parent := tracer.Start(context.Background(), "download events", nil)
+			_, child := tracer.Start(ctx, "download hour file", logger, "date", "2019-01-01T00")
+			child.SetError(errors.New("bad gzip"))
+			child.Finish()
+			parent.Finish()
+
+			So(exporter.spans, ShouldBeEmpty)
+			So(tracer.Close(), ShouldBeNil)
+			So(exporter.closed, ShouldBeTrue)
+			So(exporter.spans, ShouldHaveLength, 2)
+
+			So(child.TraceID, ShouldEqual, parent.TraceID)
+			So(child.ParentSpanID, ShouldEqual, parent.SpanID)
+			So(parent.ParentSpanID.IsZero(), ShouldBeTrue)
+			So(child.Attributes, ShouldResemble, []Attribute{
+				{Key: "logger", Value: "archive-downloader"},
+				{Key: "date", Value: "2019-01-01T00"},
+			})
+		})
+
+		Convey("Spans should be exported when batch is full", func() {
+			tracer.SetBatchSize(2)
+			for n := 0; n < 3; n++ {
+				_, s := tracer.Start(context.Background(), "span", nil)
+				s.Finish()
+			}
+
+			So(exporter.spans, ShouldHaveLength, 2)
+		})
+
+		Convey("Start without default tracer should return nil span safe to use", func() {
+			ctx, s := Start(context.Background(), "span", nil, "key", "value")
+			s.SetAttributes("other", 1)
+			s.Finish()
+			So(s, ShouldBeNil)
+			So(ctx, ShouldResemble, context.Background())
+		})
+	})
+}
+
+func TestFileExporter(t *testing.T) {
+	Convey("Test file exporter", t, func() {
+		dir, err := ioutil.TempDir("", "tracing")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "traces.json")
+		exporter, err := NewFileExporter(path)
+		So(err, ShouldBeNil)
+
+		tracer := New("github-event-aggregator", exporter)
+		ctx, parent := tracer.Start(context.Background(), "aggregate", nil)
+		_, child := tracer.Start(ctx, "run projection d_pr_age", nil, "partitions", 3, "fromStreams", "pr_view")
+		child.SetError(errors.New("failed"))
+		child.Finish()
+		parent.Finish()
+		So(tracer.Close(), ShouldBeNil)
+
+		f, err := os.Open(path)
+		So(err, ShouldBeNil)
+		defer f.Close()
+
+		lines := 0
+		var req otlpTraceRequest
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			lines++
+			So(json.Unmarshal(scanner.Bytes(), &req), ShouldBeNil)
+		}
+		So(lines, ShouldEqual, 1)
+
+		So(req.ResourceSpans, ShouldHaveLength, 1)
+		So(*req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue, ShouldEqual, "github-event-aggregator")
+
+		spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+		So(spans, ShouldHaveLength, 2)
+		So(spans[0].Name, ShouldEqual, "run projection d_pr_age")
+		So(spans[0].ParentSpanID, ShouldEqual, spans[1].SpanID)
+		So(spans[0].TraceID, ShouldHaveLength, 32)
+		So(spans[0].Status, ShouldResemble, otlpStatus{Code: otlpStatusCodeError, Message: "failed"})
+		So(*spans[0].Attributes[0].Value.IntValue, ShouldEqual, "3")
+		So(spans[1].ParentSpanID, ShouldEqual, "")
+	})
+}